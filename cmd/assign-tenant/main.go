@@ -0,0 +1,49 @@
+// assign-tenant moves the users of a single-tenant table into a tenant, before
+// MULTI_TENANT is turned on.
+//
+//	AWS_REGION=ap-south-1 go run ./cmd/assign-tenant -table go-serverless -tenant acme -dry-run
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+
+	table := flag.String("table", "go-serverless", "users table")
+	tenant := flag.String("tenant", "", "tenant the existing users belong to")
+	dryRun := flag.Bool("dry-run", false, "only report what would be assigned")
+	flag.Parse()
+
+	if len(*tenant) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(os.Getenv("AWS_REGION")))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	assignment, err := user.AssignTenant(context.Background(), *tenant, *dryRun, *table, user.WithRetry(dynamodb.NewFromConfig(awsCfg, user.DynamoOptions)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(assignment)
+
+	if len(assignment.Failed) > 0 {
+		os.Exit(1)
+	}
+
+}
@@ -0,0 +1,72 @@
+// cleanup purges the users expired more than CLEANUP_RETENTION_HOURS ago, see
+// user.Cleanup. It runs on an EventBridge schedule, a run that runs out of time
+// leaves the rest to the next one. With DRY_RUN=true nothing is deleted.
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/config"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+
+	logger := logging.Setup()
+
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Error("invalid configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	// 30 days unless CLEANUP_RETENTION_HOURS says otherwise
+	retention := 30 * 24 * time.Hour
+	if value := os.Getenv("CLEANUP_RETENTION_HOURS"); len(value) > 0 {
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours < 0 {
+			logger.Error("invalid CLEANUP_RETENTION_HOURS", "value", value)
+			os.Exit(1)
+		}
+		retention = time.Duration(hours) * time.Hour
+	}
+	dryRun := os.Getenv("DRY_RUN") == "true"
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		logger.Error("could not load AWS configuration", logging.Err(err))
+		os.Exit(1)
+	}
+	dynaClient := user.WithRetry(dynamodb.NewFromConfig(awsCfg, user.DynamoOptions))
+
+	lambda.Start(func(ctx context.Context, event events.CloudWatchEvent) error {
+
+		ctx = logging.WithLogger(ctx, logger.With("table", cfg.TableName))
+		result, err := user.Cleanup(ctx, retention, dryRun, cfg.TableName, dynaClient)
+		if err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "cleanup failed", logging.Err(err))
+			return err
+		}
+
+		logging.FromContext(ctx).InfoContext(ctx, "cleanup done", "scanned", result.Scanned, "deleted", len(result.Deleted), "skipped", result.Skipped, "errors", result.Errors, "dryRun", dryRun, "complete", result.Complete)
+		if dryRun {
+			for _, email := range result.Deleted {
+				logging.FromContext(ctx).InfoContext(ctx, "would delete", "email", email)
+			}
+		}
+		if !result.Complete {
+			logging.FromContext(ctx).WarnContext(ctx, "out of time before the end of the table, resume next run")
+		}
+		return nil
+
+	})
+
+}
@@ -0,0 +1,52 @@
+// export dumps the users table to EXPORT_BUCKET as NDJSON on an EventBridge schedule,
+// see pkg/export. The object key and the number of users are logged.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/Rahul-71/go-serverless/pkg/config"
+	"github.com/Rahul-71/go-serverless/pkg/export"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func main() {
+
+	logging.Setup()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	opts := export.OptionsFromEnv()
+	if len(opts.Bucket) == 0 {
+		log.Fatal("EXPORT_BUCKET is not set")
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("could not load AWS configuration: %v", err)
+	}
+	dynaClient := user.WithRetry(dynamodb.NewFromConfig(awsCfg, user.DynamoOptions))
+	s3Client := s3.NewFromConfig(awsCfg)
+
+	lambda.Start(func(ctx context.Context, event events.CloudWatchEvent) (*export.Result, error) {
+
+		result, err := export.ToS3(ctx, opts, "", cfg.TableName, dynaClient, s3Client)
+		if err != nil {
+			log.Printf("export of %s failed: %v", cfg.TableName, err)
+			return nil, err
+		}
+		log.Printf("exported %d users of %s to s3://%s/%s", result.Rows, cfg.TableName, result.Bucket, result.Key)
+		return result, nil
+
+	})
+
+}
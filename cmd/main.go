@@ -1,55 +1,115 @@
 package main
 
 import (
+	"context"
 	"os"
 
+	"github.com/Rahul-71/go-serverless/pkg/config"
 	"github.com/Rahul-71/go-serverless/pkg/handlers"
-	"github.com/aws/aws-lambda-go/events"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/repository"
+	"github.com/Rahul-71/go-serverless/pkg/signing"
+	"github.com/Rahul-71/go-serverless/pkg/tracing"
+	"github.com/Rahul-71/go-serverless/pkg/user"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
 var (
-	dynaClient dynamodbiface.DynamoDBAPI
+	dynaClient user.DynamoDBAPI
 )
 
 // Project Video :- https://youtu.be/qLRvpJmYfCE?list=PL5dTjWUk_cPYztKD7WxVFluHvpBNM28N9
 // Deployment process :- https://youtu.be/qLRvpJmYfCE?list=PL5dTjWUk_cPYztKD7WxVFluHvpBNM28N9&t=5828
-// AWS SDK GO :- https://docs.aws.amazon.com/sdk-for-go/v1/developer-guide/welcome.html
+// AWS SDK GO :- https://aws.github.io/aws-sdk-go-v2/docs/
 
 func main() {
-	region := os.Getenv("AWS_REGION")
-	awsSession, err := session.NewSession(&aws.Config{
-		Region: aws.String(region),
-	})
+	// JSON logs at LOG_LEVEL, the log package writes through them too
+	logger := logging.Setup()
 
+	// a function that can't work shouldn't start, the log says why
+	cfg, err := config.Load()
 	if err != nil {
-		return
+		logger.Error("invalid configuration", logging.Err(err))
+		os.Exit(1)
 	}
 
-	dynaClient = dynamodb.New(awsSession)
-	lambda.Start(handler)
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		logger.Error("could not load AWS configuration", logging.Err(err))
+		os.Exit(1)
+	}
+	// TRACING_ENABLED=true traces the AWS calls of the invocations Lambda samples, every
+	// client below is made from the configuration
+	if cfg.Tracing {
+		tracing.AWSConfig(&awsCfg)
+	}
 
-}
+	// throttling is retried by user.WithRetry, with jitter and a deadline, not by the SDK.
+	// DYNAMODB_ENDPOINT runs against DynamoDB Local, see user.DynamoOptions.
+	dynaClient = user.WithRetry(dynamodb.NewFromConfig(awsCfg, user.DynamoOptions))
+	if cfg.DebugCapacity {
+		dynaClient = user.WithCapacity(dynaClient, user.CapacityOptions{Log: true})
+	}
+
+	// LOCAL_BOOTSTRAP=true creates the table when it's missing, for a fresh local container
+	if cfg.LocalBootstrap {
+		if err := user.EnsureTable(context.Background(), cfg.TableName, dynaClient); err != nil {
+			logger.Error("could not create table", "table", cfg.TableName, logging.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	// the router is built once per cold start and reused by every invocation
+	s3Client := s3.NewFromConfig(awsCfg)
+	router := handlers.NewRouter(cfg.TableName, dynaClient).WithConfig(cfg).WithS3(s3Client, s3.NewPresignClient(s3Client))
+	// USER_STORE=memory keeps the users in memory for local development, only the user
+	// endpoints work without the table then. Otherwise they use the table of the request.
+	if cfg.UserStore == config.UserStoreMemory {
+		router.WithUsers(repository.NewMemory())
+	}
+	if len(cfg.EventBusName) > 0 {
+		router.WithEventBridge(eventbridge.NewFromConfig(awsCfg), cfg.EventBusName)
+	}
+	if len(cfg.SNSTopicArn) > 0 {
+		router.WithSNS(sns.NewFromConfig(awsCfg), cfg.SNSTopicArn)
+	}
+	if cfg.WelcomeEmail {
+		router.WithWelcomeEmail(ses.NewFromConfig(awsCfg), cfg.WelcomeEmailTemplate, cfg.WelcomeEmailFrom)
+	}
+	// the secrets of the clients that sign their requests, read once like the rest
+	secrets := cfg.SigningSecrets
+	if len(cfg.SigningSecretsPath) > 0 {
+		loaded, err := signing.LoadSSM(context.Background(), cfg.SigningSecretsPath, ssm.NewFromConfig(awsCfg))
+		if err != nil {
+			logger.Error("could not load signing secrets", "path", cfg.SigningSecretsPath, logging.Err(err))
+			os.Exit(1)
+		}
+		for client, secret := range loaded {
+			secrets[client] = secret
+		}
+	}
+	if len(secrets) > 0 {
+		router.WithSigningSecrets(secrets)
+	}
+	handlers.RegisterUserRoutes(router)
 
-const tableName = "go-serverless"
-
-// events is something that AWS Lambda will give our function
-func handler(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
-	switch req.HTTPMethod {
-	case "GET":
-		return handlers.GetUser(req, tableName, dynaClient)
-	case "POST":
-		return handlers.CreateUser(req, tableName, dynaClient)
-	case "PUT":
-		return handlers.UpdateUser(req, tableName, dynaClient)
-	case "DELETE":
-		return handlers.DeleteUser(req, tableName, dynaClient)
+	// EVENT_SOURCE selects the payload format the function is deployed behind
+	switch cfg.EventSource {
+	case config.EventSourceHTTPAPI:
+		lambda.Start(router.DispatchV2)
+	case config.EventSourceFunctionURL:
+		lambda.Start(router.DispatchFunctionURL)
+	case config.EventSourceALB:
+		lambda.Start(router.DispatchALB)
 	default:
-		return handlers.UnhandeledMethod()
+		lambda.Start(router.Dispatch)
 	}
 
 }
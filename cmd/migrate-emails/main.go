@@ -0,0 +1,42 @@
+// migrate-emails moves users stored under mixed-case emails to their normalized key.
+//
+//	AWS_REGION=ap-south-1 go run ./cmd/migrate-emails -table go-serverless -dry-run
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+
+	table := flag.String("table", "go-serverless", "users table")
+	dryRun := flag.Bool("dry-run", false, "only report what would be migrated")
+	flag.Parse()
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(os.Getenv("AWS_REGION")))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migration, err := user.MigrateEmails(context.Background(), *dryRun, *table, user.WithRetry(dynamodb.NewFromConfig(awsCfg, user.DynamoOptions)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(migration)
+
+	if len(migration.Collisions) > 0 || len(migration.Failed) > 0 {
+		os.Exit(1)
+	}
+
+}
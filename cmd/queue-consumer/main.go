@@ -0,0 +1,38 @@
+// queue-consumer creates the users of the messages of an SQS queue, see pkg/queue. The
+// queue needs a redrive policy, the dead letter queue is where the bad messages end up.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/Rahul-71/go-serverless/pkg/config"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/queue"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+
+	logging.Setup()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("could not load AWS configuration: %v", err)
+	}
+	dynaClient := user.WithRetry(dynamodb.NewFromConfig(awsCfg, user.DynamoOptions))
+
+	lambda.Start(func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+		return queue.ProcessMessages(ctx, event, cfg.TableName, dynaClient), nil
+	})
+
+}
@@ -0,0 +1,43 @@
+// s3-import upserts the users of the NDJSON and CSV objects of an S3 event notification
+// into the users table, see pkg/importer. Reports go next to the objects, the
+// notification should filter on the suffixes of the objects so reports don't trigger it.
+// The function needs s3:ListBucket to tell a missing report from a forbidden one.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/Rahul-71/go-serverless/pkg/config"
+	"github.com/Rahul-71/go-serverless/pkg/importer"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func main() {
+
+	logging.Setup()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	opts := importer.OptionsFromEnv()
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("could not load AWS configuration: %v", err)
+	}
+	dynaClient := user.WithRetry(dynamodb.NewFromConfig(awsCfg, user.DynamoOptions))
+	s3Client := s3.NewFromConfig(awsCfg)
+
+	lambda.Start(func(ctx context.Context, event events.S3Event) error {
+		return importer.ProcessEvent(ctx, event, opts, cfg.TableName, dynaClient, s3Client)
+	})
+
+}
@@ -0,0 +1,40 @@
+// stream-processor writes the stream of the users table to the audit table, see
+// pkg/audit. The event source mapping needs ReportBatchItemFailures and a stream with
+// new and old images.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/Rahul-71/go-serverless/pkg/audit"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+
+	logging.Setup()
+
+	// AUDIT_TABLE_NAME is the table the history goes to
+	auditTable := os.Getenv("AUDIT_TABLE_NAME")
+	if len(auditTable) == 0 {
+		log.Fatal("AUDIT_TABLE_NAME is not set")
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(os.Getenv("AWS_REGION")))
+	if err != nil {
+		log.Fatalf("could not load AWS configuration: %v", err)
+	}
+	dynaClient := user.WithRetry(dynamodb.NewFromConfig(awsCfg, user.DynamoOptions))
+
+	lambda.Start(func(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+		return audit.ProcessStream(ctx, event, auditTable, dynaClient), nil
+	})
+
+}
@@ -0,0 +1,40 @@
+// webhook-dispatcher delivers the change events of users to their webhooks, see
+// pkg/webhooks. It's the target of an EventBridge rule on the bus of EVENT_BUS_NAME
+// matching the source go-serverless.users, invoked asynchronously so no write of the
+// API waits for it.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/Rahul-71/go-serverless/pkg/config"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/Rahul-71/go-serverless/pkg/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+
+	logging.Setup()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		log.Fatalf("could not load AWS configuration: %v", err)
+	}
+	dynaClient := user.WithRetry(dynamodb.NewFromConfig(awsCfg, user.DynamoOptions))
+
+	lambda.Start(func(ctx context.Context, event events.CloudWatchEvent) error {
+		return webhooks.ProcessEvent(ctx, event, cfg.TableName, dynaClient)
+	})
+
+}
@@ -0,0 +1,147 @@
+// Package audit keeps the history of the users table. The stream of the table is
+// written to an audit table, one item per change that is never updated.
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	userevents "github.com/Rahul-71/go-serverless/pkg/events"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ErrorUnknownEvent    = "unknown stream event"
+	ErrorDynamoPutRecord = "could not store audit record"
+)
+
+// the actions of the records
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+)
+
+// Record is the item of a change. The audit table is keyed by email and sequenceNumber,
+// the history of a user is a query for its email.
+type Record struct {
+	Email          string     `json:"email" dynamodbav:"email"`
+	SequenceNumber string     `json:"sequenceNumber" dynamodbav:"sequenceNumber"`
+	Action         string     `json:"action" dynamodbav:"action"`
+	Timestamp      string     `json:"timestamp" dynamodbav:"timestamp"`
+	Changed        []string   `json:"changed,omitempty" dynamodbav:"changed,omitempty"`
+	OldImage       *user.User `json:"oldImage,omitempty" dynamodbav:"oldImage,omitempty"`
+	NewImage       *user.User `json:"newImage,omitempty" dynamodbav:"newImage,omitempty"`
+	// Expired is a deletion of DynamoDB TTL, not of a client
+	Expired bool `json:"expired,omitempty" dynamodbav:"expired,omitempty"`
+}
+
+// actions are the actions of the event types the stream records stand for
+var actions = map[string]string{
+	userevents.TypeUserCreated: ActionCreated,
+	userevents.TypeUserUpdated: ActionUpdated,
+	userevents.TypeUserDeleted: ActionDeleted,
+}
+
+// ProcessStream writes the audit records of a batch of the stream in order. Records of
+// other items than users are skipped. At the first record that can't be written it stops
+// and reports that one as failed, Lambda retries the batch from there and every record
+// after it would be retried anyway.
+func ProcessStream(ctx context.Context, event events.DynamoDBEvent, auditTable string, dynaClient user.DynamoDBAPI) events.DynamoDBEventResponse {
+
+	response := events.DynamoDBEventResponse{BatchItemFailures: []events.DynamoDBBatchItemFailure{}}
+	for _, record := range event.Records {
+		if err := processRecord(ctx, record, auditTable, dynaClient); err != nil {
+			log.Printf("audit of %s failed: %v", record.Change.SequenceNumber, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{ItemIdentifier: record.Change.SequenceNumber})
+			break
+		}
+	}
+	return response
+
+}
+
+func processRecord(ctx context.Context, record events.DynamoDBEventRecord, auditTable string, dynaClient user.DynamoDBAPI) error {
+
+	action, ok := actions[userevents.StreamTypes[record.EventName]]
+	if !ok {
+		return fmt.Errorf("%s: %s", ErrorUnknownEvent, record.EventName)
+	}
+	oldImage, err := user.UserFromStreamImage(record.Change.OldImage)
+	if err != nil {
+		return err
+	}
+	newImage, err := user.UserFromStreamImage(record.Change.NewImage)
+	if err != nil {
+		return err
+	}
+	if oldImage == nil && newImage == nil {
+		return nil
+	}
+	// before the hashes are dropped, a new password is a change too
+	var changed []string
+	if oldImage != nil && newImage != nil {
+		changed = user.ChangedFields(oldImage, newImage)
+	}
+
+	audit := Record{
+		SequenceNumber: record.Change.SequenceNumber,
+		Action:         action,
+		Changed:        changed,
+		Timestamp:      record.Change.ApproximateCreationDateTime.UTC().Format(user.TimestampLayout),
+		OldImage:       withoutSecrets(oldImage),
+		NewImage:       withoutSecrets(newImage),
+		Expired:        record.UserIdentity != nil && record.UserIdentity.Type == "Service",
+	}
+	if newImage != nil {
+		audit.Email = newImage.Email
+	} else {
+		audit.Email = oldImage.Email
+	}
+	return putRecord(ctx, audit, auditTable, dynaClient)
+
+}
+
+// putRecord stores the record once, a record stored by an earlier try of the batch is
+// left as it is
+func putRecord(ctx context.Context, record Record, auditTable string, dynaClient user.DynamoDBAPI) error {
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return errors.New(user.ErrorMarshalItem)
+	}
+
+	_, err = dynaClient.PutItem(ctx, &dynamodb.PutItemInput{
+		Item:                     item,
+		TableName:                aws.String(auditTable),
+		ConditionExpression:      aws.String("attribute_not_exists(#sequenceNumber)"),
+		ExpressionAttributeNames: map[string]string{"#sequenceNumber": "sequenceNumber"},
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil
+		}
+		return fmt.Errorf("%s: %v", ErrorDynamoPutRecord, err)
+	}
+	return nil
+
+}
+
+// withoutSecrets drops the password and verification hashes, the history is read by
+// more people than the table
+func withoutSecrets(u *user.User) *user.User {
+	if u == nil {
+		return nil
+	}
+	u.PasswordHash = ""
+	u.VerificationTokenHash = ""
+	return u
+}
@@ -0,0 +1,140 @@
+// Package auth reads who made a request out of the context of the API Gateway
+// authorizer in front of the function, and decides what they may do to a user. Where
+// there's no authorizer, Verifier validates the bearer tokens itself.
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrorForbidden = "forbidden"
+
+// RoleAdmin is the role, in custom:role, role or cognito:groups, of callers that may do
+// anything. It's user.RoleAdmin.
+const RoleAdmin = "admin"
+
+// Caller is who made the request according to the authorizer
+type Caller struct {
+	Email string
+	// Subject is the sub claim, callers without an email still have one
+	Subject string
+	Admin   bool
+	// Scopes are the scope or scopes claim, those of the API key for API key callers
+	Scopes []string
+}
+
+// Authenticated is true when an authorizer named the caller
+func (c Caller) Authenticated() bool {
+	return len(c.Email) > 0 || len(c.Subject) > 0
+}
+
+// Claims finds the token claims in the context of an authorizer. Cognito user pool
+// authorizers of REST APIs put them under "claims", JWT authorizers of HTTP APIs with
+// payload 1.0 under "jwt" and "claims" (FromV2Request moves those of payload 2.0 to
+// "claims"), Lambda authorizers return their context values directly.
+func Claims(authorizer map[string]interface{}) map[string]interface{} {
+
+	if jwt, ok := authorizer["jwt"].(map[string]interface{}); ok {
+		if claims := claimMap(jwt["claims"]); claims != nil {
+			return claims
+		}
+	}
+	if claims := claimMap(authorizer["claims"]); claims != nil {
+		return claims
+	}
+	return authorizer
+
+}
+
+func claimMap(v interface{}) map[string]interface{} {
+	switch claims := v.(type) {
+	case map[string]interface{}:
+		return claims
+	case map[string]string:
+		m := make(map[string]interface{}, len(claims))
+		for k, v := range claims {
+			m[k] = v
+		}
+		return m
+	}
+	return nil
+}
+
+// FromAuthorizer is the caller of the claims of an authorizer context. Blank claims are
+// missing ones.
+func FromAuthorizer(authorizer map[string]interface{}) Caller {
+
+	claims := Claims(authorizer)
+	caller := Caller{
+		Email:   strings.TrimSpace(ClaimString(claims["email"])),
+		Subject: strings.TrimSpace(ClaimString(claims["sub"])),
+	}
+	for _, key := range []string{"scopes", "scope"} {
+		caller.Scopes = append(caller.Scopes, ClaimList(claims[key])...)
+	}
+	for _, key := range []string{"custom:role", "role"} {
+		if ClaimString(claims[key]) == RoleAdmin {
+			caller.Admin = true
+		}
+	}
+	for _, group := range ClaimList(claims["cognito:groups"]) {
+		if group == RoleAdmin {
+			caller.Admin = true
+		}
+	}
+	return caller
+
+}
+
+// FromRequest is the caller of a request
+func FromRequest(req events.APIGatewayProxyRequest) Caller {
+	return FromAuthorizer(req.RequestContext.Authorizer)
+}
+
+// Check allows admins to do anything, and the caller with email to act on the user with
+// that email. An empty email is something only admins may do.
+func Check(caller Caller, email string) error {
+
+	if caller.Admin {
+		return nil
+	}
+	if len(email) > 0 && len(caller.Email) > 0 && strings.EqualFold(caller.Email, email) {
+		return nil
+	}
+	if len(email) > 0 {
+		return fmt.Errorf("%s: only admins and %s may do this", ErrorForbidden, email)
+	}
+	return fmt.Errorf("%s: admins only", ErrorForbidden)
+
+}
+
+// ClaimString reads a string claim, "" when it's something else
+func ClaimString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// ClaimList reads a list claim. Depending on the authorizer cognito:groups arrives as a
+// JSON array, as "admin,editors" or as "[admin editors]".
+func ClaimList(v interface{}) []string {
+
+	switch list := v.(type) {
+	case []interface{}:
+		var values []string
+		for _, item := range list {
+			values = append(values, ClaimString(item))
+		}
+		return values
+	case []string:
+		return list
+	case string:
+		return strings.FieldsFunc(strings.Trim(list, "[]"), func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	return nil
+
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromAuthorizer(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		authorizer map[string]interface{}
+		want       Caller
+	}{
+		{"none", nil, Caller{}},
+		{
+			"cognito",
+			map[string]interface{}{"claims": map[string]interface{}{"email": " jane@example.com ", "sub": "s1", "cognito:groups": "admin,editors"}},
+			Caller{Email: "jane@example.com", Subject: "s1", Admin: true},
+		},
+		{
+			"jwt of payload 1.0",
+			map[string]interface{}{"jwt": map[string]interface{}{"claims": map[string]string{"sub": "s2", "scope": "users:read users:write"}}},
+			Caller{Subject: "s2", Scopes: []string{"users:read", "users:write"}},
+		},
+		{
+			"lambda authorizer",
+			map[string]interface{}{"email": "bob@example.com", "custom:role": "admin"},
+			Caller{Email: "bob@example.com", Admin: true},
+		},
+		{
+			"groups as a list",
+			map[string]interface{}{"claims": map[string]interface{}{"sub": "s3", "cognito:groups": []interface{}{"editors", "admin"}}},
+			Caller{Subject: "s3", Admin: true},
+		},
+		{
+			"other role",
+			map[string]interface{}{"sub": "s4", "role": "user", "scopes": []string{"users:read"}},
+			Caller{Subject: "s4", Scopes: []string{"users:read"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromAuthorizer(tt.authorizer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromAuthorizer = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestCheck(t *testing.T) {
+
+	admin := Caller{Email: "root@example.com", Admin: true}
+	jane := Caller{Email: "jane@example.com"}
+	tests := []struct {
+		name    string
+		caller  Caller
+		email   string
+		wantErr string
+	}{
+		{"admin on anyone", admin, "jane@example.com", ""},
+		{"admin on all", admin, "", ""},
+		{"user on itself", jane, "jane@example.com", ""},
+		{"user on itself in other case", jane, "Jane@Example.com", ""},
+		{"user on someone else", jane, "bob@example.com", "forbidden: only admins and bob@example.com may do this"},
+		{"user on all", jane, "", "forbidden: admins only"},
+		{"no email on anyone", Caller{Subject: "s1"}, "jane@example.com", "forbidden: only admins and jane@example.com may do this"},
+		{"nobody", Caller{}, "", "forbidden: admins only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.caller, tt.email)
+			if got := errString(err); got != tt.wantErr {
+				t.Errorf("Check = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorInvalidToken = "invalid bearer token"
+	ErrorTokenExpired = "bearer token expired"
+	// ErrorKeysUnavailable is our fault, not the caller's: the issuer is misconfigured
+	// or its JWKS can't be read
+	ErrorKeysUnavailable = "token signing keys unavailable"
+)
+
+// the signing algorithms a token may use, none and the HMAC ones never verify
+var algorithms = map[string]struct {
+	hash crypto.Hash
+	// size is the length of r and s of ECDSA signatures, 0 for RSA
+	size int
+}{
+	"RS256": {crypto.SHA256, 0},
+	"RS384": {crypto.SHA384, 0},
+	"RS512": {crypto.SHA512, 0},
+	"ES256": {crypto.SHA256, 32},
+	"ES384": {crypto.SHA384, 48},
+}
+
+// Verifier validates the JWTs of an issuer against the keys of its JWKS, which it reads
+// once per TTL and again when a token names a key it doesn't know. That's at most once
+// per MinRefresh, so tokens with made up key IDs don't hammer the issuer.
+type Verifier struct {
+	Issuer string
+	// Audiences are the aud, or client_id for Cognito access tokens, a token must have one of
+	Audiences []string
+	// JWKSURL is the issuer's /.well-known/jwks.json unless it's set
+	JWKSURL    string
+	TTL        time.Duration
+	MinRefresh time.Duration
+	// Leeway is the clock skew allowed on exp and nbf
+	Leeway time.Duration
+	Client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewVerifier verifies tokens of issuer for audiences, with the keys of the issuer's
+// JWKS cached for an hour
+func NewVerifier(issuer string, audiences []string) *Verifier {
+	return &Verifier{
+		Issuer:     strings.TrimSuffix(issuer, "/"),
+		Audiences:  audiences,
+		TTL:        time.Hour,
+		MinRefresh: time.Minute,
+		Leeway:     30 * time.Second,
+		Client:     &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// Verify checks the signature, exp, nbf, iss and aud of token and returns its claims.
+// A token that doesn't pass is ErrorInvalidToken or ErrorTokenExpired, a verifier that
+// can't tell is ErrorKeysUnavailable.
+func (v *Verifier) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+
+	if len(v.Issuer) == 0 || len(v.Audiences) == 0 {
+		return nil, fmt.Errorf("%s: no issuer or audience configured", ErrorKeysUnavailable)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+	alg, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if !verifySignature(key, alg.hash, alg.size, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+	if err := v.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+
+}
+
+func (v *Verifier) checkClaims(claims map[string]interface{}, now time.Time) error {
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New(ErrorInvalidToken)
+	}
+	if !now.Before(time.Unix(int64(exp), 0).Add(v.Leeway)) {
+		return errors.New(ErrorTokenExpired)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New(ErrorInvalidToken)
+	}
+	if strings.TrimSuffix(ClaimString(claims["iss"]), "/") != v.Issuer {
+		return errors.New(ErrorInvalidToken)
+	}
+
+	// Cognito access tokens have no aud, the app client is in client_id
+	audiences := ClaimList(claims["aud"])
+	if len(audiences) == 0 && ClaimString(claims["token_use"]) == "access" {
+		audiences = []string{ClaimString(claims["client_id"])}
+	}
+	for _, aud := range audiences {
+		for _, want := range v.Audiences {
+			if aud == want {
+				return nil
+			}
+		}
+	}
+	return errors.New(ErrorInvalidToken)
+
+}
+
+// key is the public key kid names, read from the JWKS when it isn't known or the keys
+// are older than TTL
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	age := time.Since(v.fetchedAt)
+	if key, ok := v.keys[kid]; ok && age < v.TTL {
+		return key, nil
+	}
+	if v.keys != nil && age < v.MinRefresh {
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, errors.New(ErrorInvalidToken)
+	}
+
+	keys, err := v.fetchKeys(ctx)
+	if err != nil {
+		// keys that are a bit old beat no keys at all
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New(ErrorInvalidToken)
+
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+
+	jwksURL := v.JWKSURL
+	if len(jwksURL) == 0 {
+		jwksURL = v.Issuer + "/.well-known/jwks.json"
+	}
+	if u, err := url.Parse(jwksURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) == 0 {
+		return nil, fmt.Errorf("%s: %q is no URL", ErrorKeysUnavailable, jwksURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ErrorKeysUnavailable, err)
+	}
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ErrorKeysUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s answered %d", ErrorKeysUnavailable, jwksURL, resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("%s: %v", ErrorKeysUnavailable, err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// keys of types or curves that aren't supported are left out, tokens signed
+		// with them don't verify
+		if key := k.publicKey(); key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+
+}
+
+func (k jwk) publicKey() crypto.PublicKey {
+
+	switch k.Kty {
+	case "RSA":
+		n, e := decodeInt(k.N), decodeInt(k.E)
+		if n == nil || e == nil || !e.IsInt64() {
+			return nil
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil
+		}
+		x, y := decodeInt(k.X), decodeInt(k.Y)
+		if x == nil || y == nil {
+			return nil
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	}
+	return nil
+
+}
+
+func verifySignature(key crypto.PublicKey, hash crypto.Hash, size int, signed, signature []byte) bool {
+
+	var digest []byte
+	switch hash {
+	case crypto.SHA256:
+		sum := sha256.Sum256(signed)
+		digest = sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384(signed)
+		digest = sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512(signed)
+		digest = sum[:]
+	}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return size == 0 && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// JWS has r and s one after the other, not ASN.1
+		if size == 0 || len(signature) != 2*size || key.Curve.Params().BitSize != size*8 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func decodeInt(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testIssuer = "https://issuer.example.com"
+
+var (
+	rsaKey   = mustRSAKey()
+	otherKey = mustRSAKey()
+	ecKey    = mustECKey()
+)
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustECKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func segment(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign makes a token of claims with the header alg and kid, signed with key. An HS256
+// token uses the bytes of the public key as the secret, the classic confusion attack.
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+
+	t.Helper()
+	signed := segment(t, map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + segment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "none":
+	case "HS256":
+		mac := hmac.New(sha256.New, rsaKey.PublicKey.N.Bytes())
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+}
+
+// claims are valid claims of testIssuer for the audience app, with overrides
+func claims(overrides map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"iss": testIssuer,
+		"aud": "app",
+		"sub": "s1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(c, k)
+			continue
+		}
+		c[k] = v
+	}
+	return c
+}
+
+// jwks serves the public keys set with keys, fetches counts the requests
+type jwks struct {
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetches int64
+}
+
+func (j *jwks) set(keys map[string]crypto.PublicKey) {
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+}
+
+func (j *jwks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	atomic.AddInt64(&j.fetches, 1)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	var set []jwk
+	for kid, key := range j.keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			set = append(set, jwk{Kty: "RSA", Kid: kid, Use: "sig", N: encode(key.N), E: encode(big.NewInt(int64(key.E)))})
+		case *ecdsa.PublicKey:
+			set = append(set, jwk{Kty: "EC", Kid: kid, Use: "sig", Crv: "P-256", X: encode(key.X), Y: encode(key.Y)})
+		}
+	}
+	json.NewEncoder(w).Encode(map[string][]jwk{"keys": set})
+
+}
+
+// testVerifier verifies tokens of testIssuer for app with the keys of a local JWKS
+func testVerifier(t *testing.T, keys map[string]crypto.PublicKey) (*Verifier, *jwks, *httptest.Server) {
+	set := &jwks{keys: keys}
+	server := httptest.NewServer(set)
+	t.Cleanup(server.Close)
+	v := NewVerifier(testIssuer, []string{"app"})
+	v.JWKSURL = server.URL
+	return v, set, server
+}
+
+func TestVerify(t *testing.T) {
+
+	v, _, _ := testVerifier(t, map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey})
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "RS256", token: sign(t, "RS256", "rsa", rsaKey, claims(nil))},
+		{name: "ES256", token: sign(t, "ES256", "ec", ecKey, claims(nil))},
+		{name: "signed with another key", token: sign(t, "RS256", "rsa", otherKey, claims(nil)), wantErr: ErrorInvalidToken},
+		{name: "ES256 header on an RSA key", token: sign(t, "ES256", "rsa", ecKey, claims(nil)), wantErr: ErrorInvalidToken},
+		{name: "claims changed after signing", token: func() string {
+			parts := strings.Split(sign(t, "RS256", "rsa", rsaKey, claims(nil)), ".")
+			return parts[0] + "." + segment(t, claims(map[string]interface{}{"sub": "admin"})) + "." + parts[2]
+		}(), wantErr: ErrorInvalidToken},
+		{name: "alg none", token: sign(t, "none", "rsa", nil, claims(nil)), wantErr: ErrorInvalidToken},
+		{name: "HS256 with the public key", token: sign(t, "HS256", "rsa", nil, claims(nil)), wantErr: ErrorInvalidToken},
+		{name: "not a JWT", token: "not.a.jwt", wantErr: ErrorInvalidToken},
+		{name: "two segments", token: "a.b", wantErr: ErrorInvalidToken},
+		{name: "expired", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})), wantErr: ErrorTokenExpired},
+		{name: "expired within the leeway", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": time.Now().Add(-10 * time.Second).Unix()}))},
+		{name: "no exp", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": nil})), wantErr: ErrorInvalidToken},
+		{name: "not yet valid", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": time.Now().Add(time.Minute).Unix()})), wantErr: ErrorInvalidToken},
+		{name: "valid within the leeway", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": time.Now().Add(10 * time.Second).Unix()}))},
+		{name: "wrong issuer", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"})), wantErr: ErrorInvalidToken},
+		{name: "issuer with a slash", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": testIssuer + "/"}))},
+		{name: "wrong audience", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": "other"})), wantErr: ErrorInvalidToken},
+		{name: "one of the audiences", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": []string{"other", "app"}}))},
+		{name: "access token with client_id", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": nil, "token_use": "access", "client_id": "app"}))},
+		{name: "access token of another client", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": nil, "token_use": "access", "client_id": "other"})), wantErr: ErrorInvalidToken},
+		{name: "client_id of an id token", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": nil, "client_id": "app"})), wantErr: ErrorInvalidToken},
+		{name: "audience beats client_id", token: sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": "other", "token_use": "access", "client_id": "app"})), wantErr: ErrorInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(context.Background(), tt.token)
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Verify = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify = %v", err)
+			}
+			if got["sub"] != "s1" {
+				t.Errorf("claims = %v", got)
+			}
+		})
+	}
+
+}
+
+func TestVerifyUnknownKey(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		minRefresh  time.Duration
+		wantErr     string
+		wantFetches int64
+	}{
+		{name: "fetched again", wantFetches: 2},
+		{name: "fetched again not that soon", minRefresh: time.Hour, wantErr: ErrorInvalidToken, wantFetches: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, set, _ := testVerifier(t, map[string]crypto.PublicKey{"old": &rsaKey.PublicKey})
+			v.MinRefresh = tt.minRefresh
+			if _, err := v.Verify(context.Background(), sign(t, "RS256", "old", rsaKey, claims(nil))); err != nil {
+				t.Fatal(err)
+			}
+
+			// the issuer rotated its keys
+			set.set(map[string]crypto.PublicKey{"old": &rsaKey.PublicKey, "new": &otherKey.PublicKey})
+			_, err := v.Verify(context.Background(), sign(t, "RS256", "new", otherKey, claims(nil)))
+			if (err == nil) != (len(tt.wantErr) == 0) || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Verify = %v, want %q", err, tt.wantErr)
+			}
+			if fetches := atomic.LoadInt64(&set.fetches); fetches != tt.wantFetches {
+				t.Errorf("fetches = %d, want %d", fetches, tt.wantFetches)
+			}
+
+			// a known key isn't fetched for
+			if _, err := v.Verify(context.Background(), sign(t, "RS256", "old", rsaKey, claims(nil))); err != nil {
+				t.Fatal(err)
+			}
+			if fetches := atomic.LoadInt64(&set.fetches); fetches != tt.wantFetches {
+				t.Errorf("fetches = %d after a known key, want %d", fetches, tt.wantFetches)
+			}
+		})
+	}
+
+}
+
+func TestVerifyKeysUnavailable(t *testing.T) {
+
+	token := sign(t, "RS256", "rsa", rsaKey, claims(nil))
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		closed   bool
+		jwksURL  string
+		noIssuer bool
+	}{
+		{name: "unreachable", closed: true},
+		{name: "server error", handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }},
+		{name: "not JSON", handler: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("<html>")) }},
+		{name: "no URL", jwksURL: "file:///etc/passwd"},
+		{name: "no issuer", noIssuer: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			v := NewVerifier(testIssuer, []string{"app"})
+			v.JWKSURL = server.URL
+			if len(tt.jwksURL) > 0 {
+				v.JWKSURL = tt.jwksURL
+			}
+			if tt.noIssuer {
+				v.Issuer = ""
+			}
+			if tt.closed {
+				server.Close()
+			}
+
+			_, err := v.Verify(context.Background(), token)
+			if err == nil || !strings.HasPrefix(err.Error(), ErrorKeysUnavailable) {
+				t.Errorf("Verify = %v, want %s", err, ErrorKeysUnavailable)
+			}
+		})
+	}
+
+}
+
+func TestVerifyStaleKeys(t *testing.T) {
+
+	v, _, server := testVerifier(t, map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey})
+	token := sign(t, "RS256", "rsa", rsaKey, claims(nil))
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys are due but the issuer is down, the ones there are still do
+	v.TTL, v.MinRefresh = 0, 0
+	server.Close()
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Errorf("Verify = %v, want the cached key", err)
+	}
+	if _, err := v.Verify(context.Background(), sign(t, "RS256", "new", otherKey, claims(nil))); err == nil || !strings.HasPrefix(err.Error(), ErrorKeysUnavailable) {
+		t.Errorf("Verify = %v, want %s for an unknown key", err, ErrorKeysUnavailable)
+	}
+
+}
@@ -0,0 +1,23 @@
+// Package buildinfo holds what was deployed. The values are set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/Rahul-71/go-serverless/pkg/buildinfo.Version=1.2.0 \
+//		-X github.com/Rahul-71/go-serverless/pkg/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//		-X github.com/Rahul-71/go-serverless/pkg/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//		-o build/main cmd/main.go
+package buildinfo
+
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+}
+
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildTime: BuildTime}
+}
@@ -0,0 +1,168 @@
+// Package config reads the settings of the function from the environment once, at cold
+// start, so a missing one fails the start instead of the first request.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+
+	"github.com/Rahul-71/go-serverless/pkg/signing"
+)
+
+var (
+	ErrorMissingRegion      = "AWS_REGION is not set"
+	ErrorInvalidTableName   = "invalid table name"
+	ErrorInvalidEventSource = "invalid EVENT_SOURCE, must be rest-api, http-api, function-url or alb"
+	ErrorInvalidUserStore   = "invalid USER_STORE, must be dynamodb or memory"
+	ErrorWelcomeEmail       = "WELCOME_EMAIL_ENABLED needs WELCOME_EMAIL_TEMPLATE and WELCOME_EMAIL_FROM"
+)
+
+// DefaultTableName is the table of the original deployment
+const DefaultTableName = "go-serverless"
+
+// the event sources, see EVENT_SOURCE
+const (
+	EventSourceRESTAPI     = "rest-api"
+	EventSourceHTTPAPI     = "http-api"
+	EventSourceFunctionURL = "function-url"
+	EventSourceALB         = "alb"
+)
+
+// the user stores, see USER_STORE
+const (
+	UserStoreDynamoDB = "dynamodb"
+	UserStoreMemory   = "memory"
+)
+
+// DynamoDB allows 3 to 255 of these characters in a table name
+var tableNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,255}$`)
+
+type Config struct {
+	// TABLE_NAME is the users table, go-serverless when it isn't set
+	TableName string
+	// AWS_REGION is set by Lambda, it's only optional against DYNAMODB_ENDPOINT
+	Region string
+	// EVENT_SOURCE is the payload format the function is deployed behind, a REST API
+	// by default
+	EventSource string
+	// USER_STORE=memory keeps the users in memory for local development
+	UserStore string
+	// LOCAL_BOOTSTRAP=true creates the table when it's missing
+	LocalBootstrap bool
+	// STAGE_TABLE_VARIABLE names the API Gateway stage variable that overrides TableName
+	// per request, so one function can serve several stages. tableName by default, ""
+	// turns the override off.
+	StageTableVariable string
+	// DEBUG_CAPACITY=true logs the capacity every DynamoDB call consumes, admins get it
+	// in the response with an X-Debug: true header
+	DebugCapacity bool
+	// EVENT_BUS_NAME is the EventBridge bus change events of users go to, none are sent
+	// without it. Webhooks are delivered from it by cmd/webhook-dispatcher.
+	EventBusName string
+	// SNS_TOPIC_ARN is the SNS topic change events of users are fanned out to, none are
+	// sent without it
+	SNSTopicArn string
+	// WELCOME_EMAIL_ENABLED=true sends new users the SES template WELCOME_EMAIL_TEMPLATE
+	// from WELCOME_EMAIL_FROM, a verified identity
+	WelcomeEmail         bool
+	WelcomeEmailTemplate string
+	WelcomeEmailFrom     string
+	// TRACING_ENABLED=true sends X-Ray subsegments of the handlers and the AWS calls,
+	// for invocations Lambda samples
+	Tracing bool
+	// SIGNING_SECRETS, client=secret pairs, and the SSM parameters under
+	// SIGNING_SECRETS_SSM_PATH are the secrets of the clients that sign their POST and
+	// PUT requests. With any of them every such request needs a signature.
+	SigningSecrets     map[string]string
+	SigningSecretsPath string
+}
+
+// Load reads the configuration from the environment and checks it
+func Load() (*Config, error) {
+
+	c := &Config{
+		TableName:          envString("TABLE_NAME", DefaultTableName),
+		Region:             os.Getenv("AWS_REGION"),
+		EventSource:        envString("EVENT_SOURCE", EventSourceRESTAPI),
+		UserStore:          envString("USER_STORE", UserStoreDynamoDB),
+		LocalBootstrap:     os.Getenv("LOCAL_BOOTSTRAP") == "true",
+		StageTableVariable: "tableName",
+		DebugCapacity:      os.Getenv("DEBUG_CAPACITY") == "true",
+		EventBusName:       os.Getenv("EVENT_BUS_NAME"),
+		SNSTopicArn:        os.Getenv("SNS_TOPIC_ARN"),
+
+		WelcomeEmail:         os.Getenv("WELCOME_EMAIL_ENABLED") == "true",
+		WelcomeEmailTemplate: os.Getenv("WELCOME_EMAIL_TEMPLATE"),
+		WelcomeEmailFrom:     os.Getenv("WELCOME_EMAIL_FROM"),
+
+		Tracing: os.Getenv("TRACING_ENABLED") == "true",
+
+		SigningSecretsPath: os.Getenv("SIGNING_SECRETS_SSM_PATH"),
+	}
+	if name, ok := os.LookupEnv("STAGE_TABLE_VARIABLE"); ok {
+		c.StageTableVariable = name
+	}
+	secrets, err := signing.ParseSecrets(os.Getenv("SIGNING_SECRETS"))
+	if err != nil {
+		return nil, err
+	}
+	c.SigningSecrets = secrets
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+
+}
+
+func (c *Config) validate() error {
+
+	if len(c.Region) == 0 && len(os.Getenv("DYNAMODB_ENDPOINT")) == 0 {
+		return errors.New(ErrorMissingRegion)
+	}
+	if !tableNameRegexp.MatchString(c.TableName) {
+		return fmt.Errorf("%s: %q", ErrorInvalidTableName, c.TableName)
+	}
+	switch c.EventSource {
+	case EventSourceRESTAPI, EventSourceHTTPAPI, EventSourceFunctionURL, EventSourceALB:
+	default:
+		return fmt.Errorf("%s: %q", ErrorInvalidEventSource, c.EventSource)
+	}
+	if c.UserStore != UserStoreDynamoDB && c.UserStore != UserStoreMemory {
+		return fmt.Errorf("%s: %q", ErrorInvalidUserStore, c.UserStore)
+	}
+	if c.WelcomeEmail && (len(c.WelcomeEmailTemplate) == 0 || len(c.WelcomeEmailFrom) == 0) {
+		return errors.New(ErrorWelcomeEmail)
+	}
+	return nil
+
+}
+
+// TableFor is the table of a request with these stage variables, the one of the stage
+// when StageTableVariable names a valid table, TableName otherwise
+func (c *Config) TableFor(stageVariables map[string]string) string {
+
+	if len(c.StageTableVariable) == 0 {
+		return c.TableName
+	}
+	name, ok := stageVariables[c.StageTableVariable]
+	if !ok || name == c.TableName {
+		return c.TableName
+	}
+	if !tableNameRegexp.MatchString(name) {
+		log.Printf("ignoring stage variable %s, %s: %q", c.StageTableVariable, ErrorInvalidTableName, name)
+		return c.TableName
+	}
+	return name
+
+}
+
+func envString(name, fallback string) string {
+	if value := os.Getenv(name); len(value) > 0 {
+		return value
+	}
+	return fallback
+}
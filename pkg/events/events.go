@@ -0,0 +1,57 @@
+// Package events is the schema of the lifecycle events of users, the same wherever they
+// go: the EventBridge bus, the SNS topic, webhooks and the audit of the table stream.
+package events
+
+import (
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// the event types, one per kind of write. They're the detail type on EventBridge, the
+// eventType attribute on SNS and the X-Webhook-Event of webhooks.
+const (
+	TypeUserCreated = "user.created"
+	TypeUserUpdated = "user.updated"
+	TypeUserDeleted = "user.deleted"
+)
+
+// Types are all the event types
+var Types = []string{TypeUserCreated, TypeUserUpdated, TypeUserDeleted}
+
+// Source is the source of every event on EventBridge, rules match on it
+const Source = "go-serverless.users"
+
+// StreamTypes are the event types of the records of the table stream
+var StreamTypes = map[string]string{
+	string(events.DynamoDBOperationTypeInsert): TypeUserCreated,
+	string(events.DynamoDBOperationTypeModify): TypeUserUpdated,
+	string(events.DynamoDBOperationTypeRemove): TypeUserDeleted,
+}
+
+// Change is what an event says about the user. Changed names the fields a write changed,
+// never their values, the event bus isn't the place for phone numbers. PreviousEmail is
+// set when the email changed, the user isn't found under it anymore.
+type Change struct {
+	Email         string   `json:"email"`
+	PreviousEmail string   `json:"previousEmail,omitempty"`
+	TenantID      string   `json:"tenantId,omitempty"`
+	Changed       []string `json:"changed,omitempty"`
+	RequestID     string   `json:"requestId"`
+}
+
+// Message is an event with its type, the body of SNS messages and webhook deliveries.
+// EventBridge has its own envelope, the detail there is the Change alone.
+type Message struct {
+	// ID is set for webhooks, SNS has message IDs of its own
+	ID        string `json:"id,omitempty"`
+	Type      string `json:"type"`
+	Timestamp string `json:"timestamp"`
+	Data      Change `json:"data"`
+}
+
+// NewMessage is the message of change with the time it's sent
+func NewMessage(eventType string, change Change) Message {
+	return Message{Type: eventType, Timestamp: time.Now().UTC().Format(user.TimestampLayout), Data: change}
+}
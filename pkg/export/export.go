@@ -0,0 +1,130 @@
+// Package export dumps the users table to S3 as newline delimited JSON, one user per
+// line, for dumps larger than an API response can carry.
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var (
+	ErrorExportDisabled = "exports to S3 are not configured"
+	ErrorExportUpload   = "could not upload export"
+)
+
+// S3API is every S3 call of an upload, single part or multipart, *s3.Client has them all
+type S3API interface {
+	manager.UploadAPIClient
+}
+
+var _ S3API = (*s3.Client)(nil)
+
+// ContentType is the content type of the objects
+const ContentType = "application/x-ndjson"
+
+// Options are where the objects go and how the table is scanned
+type Options struct {
+	Bucket string
+	// Prefix comes before the table name and the timestamp in the key
+	Prefix string
+	// Segments is the number of segments of the parallel scan
+	Segments int
+}
+
+// OptionsFromEnv reads EXPORT_BUCKET, EXPORT_PREFIX and EXPORT_SEGMENTS
+func OptionsFromEnv() Options {
+
+	opts := Options{Bucket: os.Getenv("EXPORT_BUCKET"), Prefix: "exports/", Segments: 4}
+	if prefix, ok := os.LookupEnv("EXPORT_PREFIX"); ok {
+		opts.Prefix = prefix
+	}
+	if segments, err := strconv.Atoi(os.Getenv("EXPORT_SEGMENTS")); err == nil && segments > 0 {
+		opts.Segments = segments
+	}
+	return opts
+
+}
+
+type Result struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Rows   int    `json:"rows"`
+}
+
+// objectKey is the key of an export started at now, exports of a tenant get a folder
+// of their own
+func objectKey(prefix, tenant, tableName string, now time.Time) string {
+	if len(tenant) > 0 {
+		prefix += tenant + "/"
+	}
+	return fmt.Sprintf("%s%s-%s.ndjson", prefix, tableName, now.UTC().Format("20060102T150405Z"))
+}
+
+// ToS3 scans the users, of tenant when it's set, and streams them to a new object. The
+// upload is multipart once it's larger than a part. A scan that fails fails the upload
+// with it, the multipart upload is aborted and no object is created, so a result is
+// only returned for an object that holds every user.
+func ToS3(ctx context.Context, opts Options, tenant, tableName string, dynaClient user.DynamoDBAPI, s3Client S3API) (*Result, error) {
+
+	if s3Client == nil || len(opts.Bucket) == 0 {
+		return nil, errors.New(ErrorExportDisabled)
+	}
+	result := &Result{Bucket: opts.Bucket, Key: objectKey(opts.Prefix, tenant, tableName, time.Now())}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	reader, writer := io.Pipe()
+	uploaded := make(chan error, 1)
+	go func() {
+		_, err := manager.NewUploader(s3Client).Upload(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(result.Bucket),
+			Key:         aws.String(result.Key),
+			Body:        reader,
+			ContentType: aws.String(ContentType),
+		})
+		// an upload that gave up doesn't read the rest, the scan has to stop writing
+		if err != nil {
+			reader.CloseWithError(fmt.Errorf("%s: %v", ErrorExportUpload, err))
+		}
+		uploaded <- err
+	}()
+
+	buffered := bufio.NewWriter(writer)
+	enc := json.NewEncoder(buffered)
+	err := user.ScanAllParallel(ctx, nil, tenant, tableName, opts.Segments, dynaClient, func(u user.User) error {
+		result.Rows++
+		return enc.Encode(u)
+	})
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		writer.CloseWithError(err)
+	} else {
+		writer.Close()
+	}
+
+	if uploadErr := <-uploaded; uploadErr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %v", ErrorExportUpload, uploadErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// AdminQuery is the body of POST /admin/query
+type AdminQuery struct {
+	// Statement is a PartiQL SELECT from the users table, ? marks a parameter
+	Statement  string        `json:"statement"`
+	Parameters []interface{} `json:"parameters,omitempty"`
+	Limit      int           `json:"limit,omitempty"`
+	NextToken  string        `json:"nextToken,omitempty"`
+}
+
+// RunAdminQuery runs a read only PartiQL query for support. It's for admins only, also
+// with RBAC off, and off with MULTI_TENANT, see user.ExecuteQuery for what the rows hold.
+func RunAdminQuery(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if !callerFromRequest(req).Admin {
+		return errorResponse(ctx, req, fmt.Errorf("%s: admins only", ErrorForbidden))
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	var query AdminQuery
+	if err := user.Decode(req.Body, &query); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "ExecuteQuery")
+	result, err := user.ExecuteQuery(ctx, query.Statement, query.Parameters, query.Limit, query.NextToken, tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	return listResponse(ctx, req, http.StatusOK, result, len(result.Items))
+
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// DispatchALB is the entrypoint for an Application Load Balancer Lambda target group
+func (r *Router) DispatchALB(ctx context.Context, req events.ALBTargetGroupRequest) (*events.ALBTargetGroupResponse, error) {
+
+	resp, err := r.Dispatch(ctx, r.FromALBRequest(req))
+	if err != nil {
+		return nil, err
+	}
+
+	// with multi-value headers enabled on the target group the ALB only reads the
+	// multi-value fields of the response, so answer in the same form we were called
+	return albResponse(resp, len(req.MultiValueHeaders) > 0), nil
+
+}
+
+func (r *Router) FromALBRequest(req events.ALBTargetGroupRequest) events.APIGatewayProxyRequest {
+
+	resource, pathParams := r.matchResource(req.Path)
+
+	proxyReq := events.APIGatewayProxyRequest{
+		Resource:          resource,
+		Path:              req.Path,
+		HTTPMethod:        req.HTTPMethod,
+		Headers:           req.Headers,
+		MultiValueHeaders: req.MultiValueHeaders,
+		PathParameters:    pathParams,
+		Body:              req.Body,
+		IsBase64Encoded:   req.IsBase64Encoded,
+	}
+
+	// the handlers read the single value maps, fill them from the multi-value ones
+	if proxyReq.Headers == nil && len(req.MultiValueHeaders) > 0 {
+		proxyReq.Headers = map[string]string{}
+		for k, v := range req.MultiValueHeaders {
+			if len(v) > 0 {
+				proxyReq.Headers[k] = v[len(v)-1]
+			}
+		}
+	}
+
+	// unlike API Gateway, the ALB passes query parameters through still URL-encoded
+	proxyReq.QueryStringParameters = map[string]string{}
+	proxyReq.MultiValueQueryStringParameters = map[string][]string{}
+	for k, v := range req.QueryStringParameters {
+		proxyReq.QueryStringParameters[unescapeQuery(k)] = unescapeQuery(v)
+		proxyReq.MultiValueQueryStringParameters[unescapeQuery(k)] = []string{unescapeQuery(v)}
+	}
+	for k, values := range req.MultiValueQueryStringParameters {
+		key := unescapeQuery(k)
+		proxyReq.MultiValueQueryStringParameters[key] = nil
+		for _, v := range values {
+			proxyReq.MultiValueQueryStringParameters[key] = append(proxyReq.MultiValueQueryStringParameters[key], unescapeQuery(v))
+		}
+		if len(values) > 0 {
+			proxyReq.QueryStringParameters[key] = unescapeQuery(values[len(values)-1])
+		}
+	}
+
+	return proxyReq
+
+}
+
+// albResponse is the ALB flavour of apiResponse. The ALB requires StatusDescription
+// and IsBase64Encoded to always be set.
+func albResponse(resp *events.APIGatewayProxyResponse, multiValue bool) *events.ALBTargetGroupResponse {
+
+	albResp := events.ALBTargetGroupResponse{
+		StatusCode:        resp.StatusCode,
+		StatusDescription: fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		Body:              resp.Body,
+		IsBase64Encoded:   resp.IsBase64Encoded,
+	}
+
+	if multiValue {
+		albResp.MultiValueHeaders = map[string][]string{}
+		for k, v := range resp.Headers {
+			albResp.MultiValueHeaders[k] = []string{v}
+		}
+		for k, v := range resp.MultiValueHeaders {
+			albResp.MultiValueHeaders[k] = append(albResp.MultiValueHeaders[k], v...)
+		}
+		return &albResp
+	}
+
+	albResp.Headers = map[string]string{}
+	for k, v := range resp.Headers {
+		albResp.Headers[k] = v
+	}
+	for k, v := range resp.MultiValueHeaders {
+		if len(v) > 0 {
+			albResp.Headers[k] = v[len(v)-1]
+		}
+	}
+	return &albResp
+
+}
+
+func unescapeQuery(s string) string {
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestFromALBRequest(t *testing.T) {
+
+	r := testRouter()
+	tests := []struct {
+		name         string
+		req          events.ALBTargetGroupRequest
+		wantResource string
+		wantParams   map[string]string
+		wantHeaders  map[string]string
+		wantQuery    map[string]string
+		wantMulti    map[string][]string
+	}{
+		{
+			name:         "escaped path and query",
+			req:          events.ALBTargetGroupRequest{Path: "/users/foo%40bar.com", QueryStringParameters: map[string]string{"fields": "email%2CfirstName"}},
+			wantResource: UserResource,
+			wantParams:   map[string]string{"email": "foo@bar.com"},
+			wantQuery:    map[string]string{"fields": "email,firstName"},
+			wantMulti:    map[string][]string{"fields": {"email,firstName"}},
+		},
+		{
+			name:         "multi-value headers and query",
+			req:          events.ALBTargetGroupRequest{Path: "/users", MultiValueHeaders: map[string][]string{"accept": {"text/csv", "application/json"}}, MultiValueQueryStringParameters: map[string][]string{"status": {"active", "suspended%20now"}}},
+			wantResource: UsersResource,
+			wantParams:   map[string]string{},
+			wantHeaders:  map[string]string{"accept": "application/json"},
+			wantQuery:    map[string]string{"status": "suspended now"},
+			wantMulti:    map[string][]string{"status": {"active", "suspended now"}},
+		},
+		{
+			name:         "invalid escape",
+			req:          events.ALBTargetGroupRequest{Path: "/users/%4"},
+			wantResource: invalidPathResource,
+			wantQuery:    map[string]string{},
+			wantMulti:    map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.FromALBRequest(tt.req)
+			if got.Resource != tt.wantResource || !reflect.DeepEqual(got.PathParameters, tt.wantParams) {
+				t.Errorf("resource %q %v, want %q %v", got.Resource, got.PathParameters, tt.wantResource, tt.wantParams)
+			}
+			if tt.wantHeaders != nil && !reflect.DeepEqual(got.Headers, tt.wantHeaders) {
+				t.Errorf("headers = %v, want %v", got.Headers, tt.wantHeaders)
+			}
+			if tt.wantQuery != nil && !reflect.DeepEqual(got.QueryStringParameters, tt.wantQuery) {
+				t.Errorf("query = %v, want %v", got.QueryStringParameters, tt.wantQuery)
+			}
+			if tt.wantMulti != nil && !reflect.DeepEqual(got.MultiValueQueryStringParameters, tt.wantMulti) {
+				t.Errorf("multi-value query = %v, want %v", got.MultiValueQueryStringParameters, tt.wantMulti)
+			}
+		})
+	}
+
+}
+
+func TestALBResponse(t *testing.T) {
+
+	resp := &events.APIGatewayProxyResponse{
+		StatusCode:        404,
+		Headers:           map[string]string{"Content-Type": "application/json"},
+		MultiValueHeaders: map[string][]string{"Set-Cookie": {"a=1", "b=2"}},
+	}
+	tests := []struct {
+		name       string
+		multiValue bool
+		wantSingle map[string]string
+		wantMulti  map[string][]string
+	}{
+		{name: "single value", wantSingle: map[string]string{"Content-Type": "application/json", "Set-Cookie": "b=2"}},
+		{name: "multi value", multiValue: true, wantMulti: map[string][]string{"Content-Type": {"application/json"}, "Set-Cookie": {"a=1", "b=2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := albResponse(resp, tt.multiValue)
+			if got.StatusDescription != "404 Not Found" {
+				t.Errorf("StatusDescription = %q", got.StatusDescription)
+			}
+			if !reflect.DeepEqual(got.Headers, tt.wantSingle) || !reflect.DeepEqual(got.MultiValueHeaders, tt.wantMulti) {
+				t.Errorf("headers = %v %v, want %v %v", got.Headers, got.MultiValueHeaders, tt.wantSingle, tt.wantMulti)
+			}
+		})
+	}
+
+}
@@ -1,17 +1,30 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
 
+	"github.com/Rahul-71/go-serverless/pkg/buildinfo"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
 	"github.com/aws/aws-lambda-go/events"
 )
 
-func apiResponse(status int, body interface{}) (*events.APIGatewayProxyResponse, error) {
+var ErrorMarshalResponse = "could not marshal response"
 
-	responseBody, _ := json.Marshal(body)
+// apiResponse marshals body, logging with the logger of ctx, and so the ID of the
+// request, when it can't
+func apiResponse(ctx context.Context, status int, body interface{}) (*events.APIGatewayProxyResponse, error) {
+
+	responseBody, err := json.Marshal(body)
+	if err != nil {
+		// never answer with a success status and a broken body
+		logging.FromContext(ctx).ErrorContext(ctx, ErrorMarshalResponse, logging.Err(err))
+		return marshalErrorResponse()
+	}
 
 	resp := events.APIGatewayProxyResponse{
-		Headers:    map[string]string{"Content-Type": "application/json"},
+		Headers:    defaultHeaders(),
 		StatusCode: status,
 		Body:       string(responseBody),
 	}
@@ -19,3 +32,83 @@ func apiResponse(status int, body interface{}) (*events.APIGatewayProxyResponse,
 	return &resp, nil
 
 }
+
+// marshalErrorResponse is the 500 sent when a body can't be marshalled. It is built
+// from fixed values only, so it can't fail the same way.
+func marshalErrorResponse() (*events.APIGatewayProxyResponse, error) {
+
+	m := errorMappings[ErrorMarshalResponse]
+	var body interface{} = Problem{
+		Type:   problemType(m.code),
+		Title:  http.StatusText(m.status),
+		Status: m.status,
+		Detail: ErrorMarshalResponse,
+		Code:   m.code,
+	}
+	contentType := "application/problem+json"
+	if legacyErrors {
+		body = ErrorBody{ErrorMsg: &ErrorMarshalResponse, Code: &m.code}
+		contentType = "application/json"
+	}
+
+	responseBody, _ := json.Marshal(body)
+	return rawResponse(m.status, contentType, string(responseBody))
+
+}
+
+// emptyResponse has the same headers as apiResponse but no body, e.g. for HEAD
+func emptyResponse(status int) (*events.APIGatewayProxyResponse, error) {
+
+	resp := events.APIGatewayProxyResponse{
+		Headers:    defaultHeaders(),
+		StatusCode: status,
+	}
+
+	return &resp, nil
+
+}
+
+// rawResponse sends body as it is, for anything that isn't JSON
+func rawResponse(status int, contentType, body string) (*events.APIGatewayProxyResponse, error) {
+
+	resp := events.APIGatewayProxyResponse{
+		Headers:    defaultHeaders(),
+		StatusCode: status,
+		Body:       body,
+	}
+	resp.Headers["Content-Type"] = contentType
+
+	return &resp, nil
+
+}
+
+// securityHeaders go out with every response. User data must never end up in a shared
+// cache, endpoints that are fine to cache override Cache-Control with withHeaders.
+var securityHeaders = map[string]string{
+	"X-Content-Type-Options":    "nosniff",
+	"Cache-Control":             "no-store",
+	"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+	"Content-Security-Policy":   envString("CONTENT_SECURITY_POLICY", "default-src 'none'; frame-ancestors 'none'"),
+}
+
+func defaultHeaders() map[string]string {
+	headers := map[string]string{
+		"Content-Type":  "application/json",
+		"X-App-Version": buildinfo.Version,
+	}
+	for k, v := range securityHeaders {
+		headers[k] = v
+	}
+	return headers
+}
+
+// withHeaders overrides headers on a response, e.g. to make it cacheable
+func withHeaders(resp *events.APIGatewayProxyResponse, headers map[string]string) *events.APIGatewayProxyResponse {
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	for k, v := range headers {
+		resp.Headers[k] = v
+	}
+	return resp
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAPIResponse(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		body       interface{}
+		wantStatus int
+		wantBody   string
+		wantLog    bool
+	}{
+		{name: "marshalled", body: map[string]int{"count": 1}, wantStatus: http.StatusOK, wantBody: `{"count":1}`},
+		{name: "not marshallable", body: map[string]interface{}{"c": make(chan int)}, wantStatus: http.StatusInternalServerError, wantLog: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			ctx := logging.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(&logs, nil)).With("requestId", "r1"))
+
+			resp, err := apiResponse(ctx, http.StatusOK, tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if len(tt.wantBody) > 0 && resp.Body != tt.wantBody {
+				t.Errorf("body = %s, want %s", resp.Body, tt.wantBody)
+			}
+			if !tt.wantLog {
+				if logs.Len() > 0 {
+					t.Errorf("logged %s", logs.String())
+				}
+				return
+			}
+			var problem Problem
+			if err := json.Unmarshal([]byte(resp.Body), &problem); err != nil || problem.Detail != ErrorMarshalResponse {
+				t.Errorf("body = %s", resp.Body)
+			}
+			if line := logs.String(); !strings.Contains(line, `"requestId":"r1"`) || !strings.Contains(line, ErrorMarshalResponse) {
+				t.Errorf("log = %s", line)
+			}
+		})
+	}
+
+}
+
+func TestSecurityHeaders(t *testing.T) {
+
+	ok, _ := apiResponse(context.Background(), http.StatusOK, map[string]string{})
+	empty, _ := emptyResponse(http.StatusNoContent)
+	raw, _ := rawResponse(http.StatusOK, "text/csv", "email\n")
+	problem, _ := errorResponse(context.Background(), events.APIGatewayProxyRequest{}, errors.New(ErrorNotFound))
+	cached := withHeaders(&events.APIGatewayProxyResponse{Headers: defaultHeaders()}, map[string]string{"Cache-Control": "public, max-age=60"})
+
+	tests := []struct {
+		name      string
+		resp      *events.APIGatewayProxyResponse
+		wantCache string
+		wantType  string
+	}{
+		{"json", ok, "no-store", "application/json"},
+		{"empty", empty, "no-store", "application/json"},
+		{"raw", raw, "no-store", "text/csv"},
+		{"problem", problem, "no-store", "application/problem+json"},
+		{"cacheable", cached, "public, max-age=60", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"X-Content-Type-Options", "Strict-Transport-Security", "Content-Security-Policy"} {
+				if tt.resp.Headers[name] != securityHeaders[name] {
+					t.Errorf("%s = %q", name, tt.resp.Headers[name])
+				}
+			}
+			if tt.resp.Headers["Cache-Control"] != tt.wantCache || tt.resp.Headers["Content-Type"] != tt.wantType {
+				t.Errorf("Cache-Control = %q, Content-Type = %q", tt.resp.Headers["Cache-Control"], tt.resp.Headers["Content-Type"])
+			}
+		})
+	}
+
+}
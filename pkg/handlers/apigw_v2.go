@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// DispatchV2 is the entrypoint for API Gateway HTTP APIs (payload format 2.0). The event is
+// converted into the REST shape the handlers work with and the response converted back.
+func (r *Router) DispatchV2(ctx context.Context, req events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+
+	resp, err := r.Dispatch(ctx, r.FromV2Request(req))
+	if err != nil {
+		return nil, err
+	}
+	return ToV2Response(resp), nil
+
+}
+
+func (r *Router) FromV2Request(req events.APIGatewayV2HTTPRequest) events.APIGatewayProxyRequest {
+
+	resource, pathParams := "", req.PathParameters
+
+	// routeKey looks like "GET /users/{email}", except for the catch-all $default route
+	if parts := strings.SplitN(req.RouteKey, " ", 2); len(parts) == 2 && parts[1] != "/{proxy+}" {
+		resource = parts[1]
+	} else {
+		path := req.RawPath
+		if stage := req.RequestContext.Stage; stage != "" && stage != "$default" {
+			path = strings.TrimPrefix(path, "/"+stage)
+		}
+		resource, pathParams = r.matchResource(path)
+	}
+
+	headers := map[string]string{}
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	// HTTP APIs move cookies out of the headers
+	if len(req.Cookies) > 0 {
+		headers["cookie"] = strings.Join(req.Cookies, "; ")
+	}
+
+	proxyReq := events.APIGatewayProxyRequest{
+		Resource:              resource,
+		Path:                  req.RawPath,
+		HTTPMethod:            req.RequestContext.HTTP.Method,
+		Headers:               headers,
+		QueryStringParameters: req.QueryStringParameters,
+		PathParameters:        pathParams,
+		StageVariables:        req.StageVariables,
+		Body:                  req.Body,
+		IsBase64Encoded:       req.IsBase64Encoded,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:  req.RequestContext.AccountID,
+			Stage:      req.RequestContext.Stage,
+			DomainName: req.RequestContext.DomainName,
+			RequestID:  req.RequestContext.RequestID,
+			Protocol:   req.RequestContext.HTTP.Protocol,
+			HTTPMethod: req.RequestContext.HTTP.Method,
+			APIID:      req.RequestContext.APIID,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  req.RequestContext.HTTP.SourceIP,
+				UserAgent: req.RequestContext.HTTP.UserAgent,
+			},
+		},
+	}
+
+	// v2 joins repeated query parameters with commas
+	if len(req.QueryStringParameters) > 0 {
+		proxyReq.MultiValueQueryStringParameters = map[string][]string{}
+		for k, v := range req.QueryStringParameters {
+			proxyReq.MultiValueQueryStringParameters[k] = strings.Split(v, ",")
+		}
+	}
+
+	// keep the JWT claims where a REST API Cognito authorizer would put them
+	if auth := req.RequestContext.Authorizer; auth != nil {
+		proxyReq.RequestContext.Authorizer = map[string]interface{}{}
+		if auth.JWT != nil {
+			claims := map[string]interface{}{}
+			for k, v := range auth.JWT.Claims {
+				claims[k] = v
+			}
+			proxyReq.RequestContext.Authorizer["claims"] = claims
+		}
+		for k, v := range auth.Lambda {
+			proxyReq.RequestContext.Authorizer[k] = v
+		}
+	}
+
+	return proxyReq
+
+}
+
+func ToV2Response(resp *events.APIGatewayProxyResponse) *events.APIGatewayV2HTTPResponse {
+	return &events.APIGatewayV2HTTPResponse{
+		StatusCode:        resp.StatusCode,
+		Headers:           resp.Headers,
+		MultiValueHeaders: resp.MultiValueHeaders,
+		Body:              resp.Body,
+		IsBase64Encoded:   resp.IsBase64Encoded,
+	}
+}
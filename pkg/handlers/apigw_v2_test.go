@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestFromV2Request(t *testing.T) {
+
+	r := testRouter()
+	tests := []struct {
+		name         string
+		req          events.APIGatewayV2HTTPRequest
+		wantResource string
+		wantParams   map[string]string
+	}{
+		{
+			name:         "route",
+			req:          events.APIGatewayV2HTTPRequest{RouteKey: "GET /users/{email}", RawPath: "/users/jane@example.com", PathParameters: map[string]string{"email": "jane@example.com"}},
+			wantResource: UserResource,
+			wantParams:   map[string]string{"email": "jane@example.com"},
+		},
+		{
+			name:         "default route",
+			req:          events.APIGatewayV2HTTPRequest{RouteKey: "$default", RawPath: "/users/batch"},
+			wantResource: BatchResource,
+			wantParams:   map[string]string{},
+		},
+		{
+			name:         "proxy route below a stage",
+			req:          events.APIGatewayV2HTTPRequest{RouteKey: "ANY /{proxy+}", RawPath: "/prod/users/foo%40bar.com", RequestContext: events.APIGatewayV2HTTPRequestContext{Stage: "prod"}},
+			wantResource: UserResource,
+			wantParams:   map[string]string{"email": "foo@bar.com"},
+		},
+		{
+			name:         "default stage",
+			req:          events.APIGatewayV2HTTPRequest{RouteKey: "$default", RawPath: "/users/a%2Bb@x.com", RequestContext: events.APIGatewayV2HTTPRequestContext{Stage: "$default"}},
+			wantResource: UserResource,
+			wantParams:   map[string]string{"email": "a+b@x.com"},
+		},
+		{
+			name:         "invalid escape",
+			req:          events.APIGatewayV2HTTPRequest{RouteKey: "$default", RawPath: "/users/%"},
+			wantResource: invalidPathResource,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.FromV2Request(tt.req)
+			if got.Resource != tt.wantResource || !reflect.DeepEqual(got.PathParameters, tt.wantParams) {
+				t.Errorf("resource %q %v, want %q %v", got.Resource, got.PathParameters, tt.wantResource, tt.wantParams)
+			}
+			if got.Path != tt.req.RawPath {
+				t.Errorf("path = %q, want %q", got.Path, tt.req.RawPath)
+			}
+		})
+	}
+
+}
+
+func TestFromV2RequestContext(t *testing.T) {
+
+	req := events.APIGatewayV2HTTPRequest{
+		RouteKey:              "POST /users",
+		RawPath:               "/users",
+		Headers:               map[string]string{"content-type": "application/json"},
+		Cookies:               []string{"a=1", "b=2"},
+		QueryStringParameters: map[string]string{"status": "active,suspended"},
+		Body:                  "e30=",
+		IsBase64Encoded:       true,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RequestID: "r1",
+			Stage:     "prod",
+			HTTP:      events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "POST", SourceIP: "203.0.113.7", UserAgent: "curl"},
+			Authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+				JWT:    &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: map[string]string{"email": "jane@example.com"}},
+				Lambda: map[string]interface{}{"tenantId": "acme"},
+			},
+		},
+	}
+	got := testRouter().FromV2Request(req)
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"method", got.HTTPMethod, "POST"},
+		{"cookies", got.Headers["cookie"], "a=1; b=2"},
+		{"content type", got.Headers["content-type"], "application/json"},
+		{"multi-value query", got.MultiValueQueryStringParameters["status"], []string{"active", "suspended"}},
+		{"body", got.Body, "e30="},
+		{"base64", got.IsBase64Encoded, true},
+		{"request id", got.RequestContext.RequestID, "r1"},
+		{"source ip", got.RequestContext.Identity.SourceIP, "203.0.113.7"},
+		{"claims", callerFromRequest(got).Email, "jane@example.com"},
+		{"lambda context", got.RequestContext.Authorizer["tenantId"], "acme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestToV2Response(t *testing.T) {
+
+	resp := ToV2Response(&events.APIGatewayProxyResponse{
+		StatusCode:        201,
+		Headers:           map[string]string{"Location": "/users/jane@example.com"},
+		MultiValueHeaders: map[string][]string{"Set-Cookie": {"a=1"}},
+		Body:              "{}",
+		IsBase64Encoded:   true,
+	})
+	if resp.StatusCode != 201 || resp.Headers["Location"] != "/users/jane@example.com" || resp.MultiValueHeaders["Set-Cookie"][0] != "a=1" || resp.Body != "{}" || !resp.IsBase64Encoded {
+		t.Errorf("response = %+v", resp)
+	}
+
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var (
+	ErrorInvalidAPIKey  = "invalid api key"
+	ErrorAPIKeyExpired  = "api key expired"
+	ErrorAPIKeyDisabled = "api key disabled"
+)
+
+// API_KEYS_ENABLED=true authenticates requests with an X-Api-Key header against the keys
+// of POST /admin/api-keys. Leave it off while API Gateway usage plans read the header.
+// Validated keys are kept for API_KEY_CACHE_TTL_MS, at most API_KEY_CACHE_SIZE of them.
+var (
+	apiKeysEnabled  = os.Getenv("API_KEYS_ENABLED") == "true"
+	apiKeyCacheTTL  = time.Duration(envInt("API_KEY_CACHE_TTL_MS", 60000)) * time.Millisecond
+	apiKeyCacheSize = envInt("API_KEY_CACHE_SIZE", 1000)
+)
+
+const APIKeyHeader = "X-Api-Key"
+
+// CreateAPIKey generates a key for a {"owner", "scopes", "expiresAt"} body, admins only.
+// The key is in the response and nowhere else, which is also why it isn't idempotent:
+// a stored response would keep it.
+func CreateAPIKey(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	var body struct {
+		Owner     string   `json:"owner"`
+		Scopes    []string `json:"scopes"`
+		ExpiresAt string   `json:"expiresAt"`
+	}
+	if err := user.Decode(req.Body, &body); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "CreateAPIKey")
+	key, err := user.CreateAPIKey(ctx, body.Owner, body.Scopes, body.ExpiresAt, tenant, user.CallerIdentity(req), tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	resp, err := successResponse(ctx, req, http.StatusCreated, key)
+	resp.Headers["Cache-Control"] = "no-store"
+	return resp, err
+
+}
+
+// RevokeAPIKey disables the key of the id in the path, admins only. This instance stops
+// accepting it at once, others once their cached entry expires.
+func RevokeAPIKey(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "RevokeAPIKey")
+	key, err := user.RevokeAPIKey(ctx, req.PathParameters["id"], tenant, tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	apiKeys.forget(tableName, key.Hash)
+	return emptyResponse(http.StatusNoContent)
+
+}
+
+// authenticateAPIKey checks the X-Api-Key of the request and names its owner as the
+// caller, in the authorizer context like an authorizer would. Requests without the
+// header, or with API_KEYS_ENABLED off, are returned as they are. Unknown and expired
+// keys are a 401, disabled keys and methods outside the scopes of the key a 403.
+func authenticateAPIKey(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (events.APIGatewayProxyRequest, error) {
+
+	if !apiKeysEnabled {
+		return req, nil
+	}
+	presented := headerValue(req, APIKeyHeader)
+	if len(presented) == 0 {
+		return req, nil
+	}
+	if dynaClient == nil {
+		return req, errors.New(ErrorInvalidAPIKey)
+	}
+
+	hash := user.HashAPIKey(presented)
+	key, err := apiKeys.get(ctx, hash, tableName, dynaClient)
+	if err != nil {
+		if err.Error() == user.ErrorAPIKeyNotFound {
+			return req, errors.New(ErrorInvalidAPIKey)
+		}
+		return req, err
+	}
+	// the lookup went by the hash already, this is in case the stored one differs
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) != 1 {
+		return req, errors.New(ErrorInvalidAPIKey)
+	}
+	if !key.Enabled {
+		return req, errors.New(ErrorAPIKeyDisabled)
+	}
+	if key.Expired(time.Now()) {
+		return req, errors.New(ErrorAPIKeyExpired)
+	}
+	if scope := requiredScope(req); !key.Allows(scope) {
+		return req, fmt.Errorf("%s: the api key lacks the %s scope", ErrorForbidden, scope)
+	}
+
+	logging.FromContext(ctx).DebugContext(ctx, "api key accepted", "apiKeyId", key.ID)
+	req.RequestContext.Authorizer = apiKeyClaims(key)
+	return req, nil
+
+}
+
+// requiredScope is the scope a request needs
+func requiredScope(req events.APIGatewayProxyRequest) string {
+	if req.HTTPMethod == http.MethodGet || req.HTTPMethod == http.MethodHead {
+		return user.ScopeUsersRead
+	}
+	return user.ScopeUsersWrite
+}
+
+// apiKeyClaims are the claims pkg/auth and pkg/user read the caller and tenant out of.
+// An owner that's an email is the caller with that email, so the key acts on that user.
+func apiKeyClaims(key *user.APIKey) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub":      key.Owner,
+		"scopes":   key.Scopes,
+		"apiKeyId": key.ID,
+	}
+	if strings.Contains(key.Owner, "@") {
+		claims["email"] = key.Owner
+	}
+	if key.HasScope(user.ScopeAdmin) {
+		claims["role"] = user.RoleAdmin
+	}
+	if len(key.TenantID) > 0 {
+		claims["tenantId"] = key.TenantID
+	}
+	return claims
+}
+
+// apiKeyCache keeps validated keys for apiKeyCacheTTL, so not every request reads its
+// key. Keys revoked on another instance are still accepted by instances that cached
+// them until the entry expires, the key is read again then and dropped.
+type apiKeyCache struct {
+	mu      sync.Mutex
+	entries map[string]apiKeyCacheEntry
+}
+
+type apiKeyCacheEntry struct {
+	key     *user.APIKey
+	expires time.Time
+}
+
+var apiKeys = &apiKeyCache{entries: map[string]apiKeyCacheEntry{}}
+
+func (c *apiKeyCache) get(ctx context.Context, hash, tableName string, dynaClient user.DynamoDBAPI) (*user.APIKey, error) {
+
+	cacheKey := tableName + "\x00" + hash
+	c.mu.Lock()
+	entry, ok := c.entries[cacheKey]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.key, nil
+	}
+
+	done := metrics.Time(ctx, "FetchAPIKey")
+	key, err := user.FetchAPIKey(ctx, hash, tableName, dynaClient)
+	done()
+	if err != nil {
+		return nil, err
+	}
+	// only keys that let the request in are worth keeping
+	if key.Enabled && !key.Expired(time.Now()) {
+		c.put(cacheKey, key)
+	} else {
+		c.mu.Lock()
+		delete(c.entries, cacheKey)
+		c.mu.Unlock()
+	}
+	return key, nil
+
+}
+
+// forget drops the key of hash, so the next request reads it again
+func (c *apiKeyCache) forget(tableName, hash string) {
+	c.mu.Lock()
+	delete(c.entries, tableName+"\x00"+hash)
+	c.mu.Unlock()
+}
+
+// put adds a key, making room by dropping expired entries and then any one of them
+func (c *apiKeyCache) put(cacheKey string, key *user.APIKey) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= apiKeyCacheSize {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < apiKeyCacheSize {
+			break
+		}
+		delete(c.entries, k)
+	}
+	if apiKeyCacheSize > 0 {
+		c.entries[cacheKey] = apiKeyCacheEntry{key: key, expires: time.Now().Add(apiKeyCacheTTL)}
+	}
+
+}
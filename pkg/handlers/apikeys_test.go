@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// keyTable stores one API key and counts the reads of it
+type keyTable struct {
+	key   user.APIKey
+	reads int64
+}
+
+func (k *keyTable) item(t *testing.T) map[string]types.AttributeValue {
+	t.Helper()
+	item, err := attributevalue.MarshalMap(k.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item["email"] = &types.AttributeValueMemberS{Value: "APIKEY#" + k.key.Hash}
+	item[user.ItemTypeAttribute] = &types.AttributeValueMemberS{Value: user.ItemTypeAPIKey}
+	return item
+}
+
+func (k *keyTable) client(t *testing.T) *fakeDynamo {
+	return &fakeDynamo{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			atomic.AddInt64(&k.reads, 1)
+			if input.Key["email"].(*types.AttributeValueMemberS).Value != "APIKEY#"+k.key.Hash {
+				return &dynamodb.GetItemOutput{}, nil
+			}
+			return &dynamodb.GetItemOutput{Item: k.item(t)}, nil
+		},
+		scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+			return &dynamodb.ScanOutput{Items: []map[string]types.AttributeValue{k.item(t)}}, nil
+		},
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			k.key.Enabled = false
+			return &dynamodb.UpdateItemOutput{Attributes: k.item(t)}, nil
+		},
+	}
+}
+
+// apiKeyRequest is a request of method presenting key
+func apiKeyRequest(method, key string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:     method,
+		Resource:       UserResource,
+		PathParameters: map[string]string{"email": "jane@example.com"},
+		Headers:        map[string]string{APIKeyHeader: key},
+	}
+}
+
+// withAPIKeys turns API keys on with an empty cache for the test
+func withAPIKeys(t *testing.T) {
+	enabled, entries := apiKeysEnabled, apiKeys.entries
+	apiKeysEnabled, apiKeys.entries = true, map[string]apiKeyCacheEntry{}
+	t.Cleanup(func() { apiKeysEnabled, apiKeys.entries = enabled, entries })
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+
+	withAPIKeys(t)
+	const presented = user.APIKeyPrefix + "secret"
+
+	tests := []struct {
+		name       string
+		key        user.APIKey
+		method     string
+		presented  string
+		wantStatus int
+		wantClaims map[string]interface{}
+	}{
+		{name: "read key", key: user.APIKey{ID: "k1", Owner: "reporting", Scopes: []string{user.ScopeUsersRead}, Enabled: true}, method: http.MethodGet, wantClaims: map[string]interface{}{"sub": "reporting", "apiKeyId": "k1"}},
+		{name: "write key reads", key: user.APIKey{ID: "k1", Owner: "sync", Scopes: []string{user.ScopeUsersWrite}, Enabled: true}, method: http.MethodGet, wantClaims: map[string]interface{}{"sub": "sync"}},
+		{name: "owned by a user", key: user.APIKey{ID: "k1", Owner: "jane@example.com", Scopes: []string{user.ScopeUsersWrite}, Enabled: true}, method: http.MethodPut, wantClaims: map[string]interface{}{"email": "jane@example.com"}},
+		{name: "admin key", key: user.APIKey{ID: "k1", Owner: "ops", Scopes: []string{user.ScopeAdmin}, Enabled: true, TenantID: "acme"}, method: http.MethodDelete, wantClaims: map[string]interface{}{"role": user.RoleAdmin, "tenantId": "acme"}},
+		{name: "not expired yet", key: user.APIKey{ID: "k1", Owner: "ops", Scopes: []string{user.ScopeUsersRead}, Enabled: true, ExpiresAt: time.Now().Add(time.Hour).UTC().Format(time.RFC3339)}, method: http.MethodGet, wantClaims: map[string]interface{}{"sub": "ops"}},
+		{name: "unknown key", key: user.APIKey{ID: "k1", Owner: "ops", Scopes: []string{user.ScopeUsersRead}, Enabled: true}, presented: user.APIKeyPrefix + "other", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "expired", key: user.APIKey{ID: "k1", Owner: "ops", Scopes: []string{user.ScopeUsersRead}, Enabled: true, ExpiresAt: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)}, method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "disabled", key: user.APIKey{ID: "k1", Owner: "ops", Scopes: []string{user.ScopeAdmin}, Enabled: false}, method: http.MethodGet, wantStatus: http.StatusForbidden},
+		{name: "missing scope", key: user.APIKey{ID: "k1", Owner: "reporting", Scopes: []string{user.ScopeUsersRead}, Enabled: true}, method: http.MethodPut, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKeys.entries = map[string]apiKeyCacheEntry{}
+			table := &keyTable{key: tt.key}
+			table.key.Hash = user.HashAPIKey(presented)
+			if len(tt.presented) == 0 {
+				tt.presented = presented
+			}
+
+			req, err := authenticateAPIKey(context.Background(), apiKeyRequest(tt.method, tt.presented), "users", table.client(t))
+			if tt.wantStatus != 0 {
+				if err == nil {
+					t.Fatalf("authenticateAPIKey = %v, want a %d", req.RequestContext.Authorizer, tt.wantStatus)
+				}
+				resp, _ := errorResponse(context.Background(), req, err)
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d: %v", resp.StatusCode, tt.wantStatus, err)
+				}
+				if len(req.RequestContext.Authorizer) > 0 {
+					t.Errorf("authorizer = %v, want none", req.RequestContext.Authorizer)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authenticateAPIKey = %v", err)
+			}
+			for claim, want := range tt.wantClaims {
+				if got := req.RequestContext.Authorizer[claim]; got != want {
+					t.Errorf("%s = %v, want %v", claim, got, want)
+				}
+			}
+		})
+	}
+
+}
+
+func TestAuthenticateAPIKeyPassThrough(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		enabled bool
+		headers map[string]string
+	}{
+		{name: "no header", enabled: true},
+		{name: "turned off", headers: map[string]string{APIKeyHeader: user.APIKeyPrefix + "secret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withAPIKeys(t)
+			apiKeysEnabled = tt.enabled
+			client := &fakeDynamo{getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				t.Fatal("read a key")
+				return nil, nil
+			}}
+
+			req, err := authenticateAPIKey(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Headers: tt.headers}, "users", client)
+			if err != nil || len(req.RequestContext.Authorizer) > 0 {
+				t.Errorf("authenticateAPIKey = %v, %v, want the request as it was", req.RequestContext.Authorizer, err)
+			}
+		})
+	}
+
+}
+
+func TestAPIKeyCache(t *testing.T) {
+
+	const presented = user.APIKeyPrefix + "secret"
+	admin := callerRequest("admin@example.com", true, "")
+
+	tests := []struct {
+		name string
+		// revoke drops the key of the cache, the others are in it
+		revoke    func(t *testing.T, r *Router, table *keyTable)
+		wantReads int64
+	}{
+		{name: "cached", revoke: func(t *testing.T, r *Router, table *keyTable) {}, wantReads: 1},
+		{name: "revoked here", revoke: func(t *testing.T, r *Router, table *keyTable) {
+			req := admin
+			req.HTTPMethod, req.Resource, req.PathParameters = http.MethodDelete, AdminAPIKeyResource, map[string]string{"id": "k1"}
+			resp, err := r.Dispatch(context.Background(), req)
+			if err != nil || resp.StatusCode != http.StatusNoContent {
+				t.Fatalf("revoke = %v, %v", resp, err)
+			}
+		}, wantReads: 2},
+		{name: "revoked elsewhere", revoke: func(t *testing.T, r *Router, table *keyTable) {
+			table.key.Enabled = false
+			apiKeys.mu.Lock()
+			for k, entry := range apiKeys.entries {
+				entry.expires = time.Now()
+				apiKeys.entries[k] = entry
+			}
+			apiKeys.mu.Unlock()
+		}, wantReads: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withAPIKeys(t)
+			table := &keyTable{key: user.APIKey{ID: "k1", Hash: user.HashAPIKey(presented), Owner: "ops", Scopes: []string{user.ScopeUsersRead}, Enabled: true}}
+			client := table.client(t)
+			r := NewRouter("users", client)
+			RegisterUserRoutes(r)
+
+			for i := 0; i < 2; i++ {
+				if _, err := authenticateAPIKey(context.Background(), apiKeyRequest(http.MethodGet, presented), "users", client); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.revoke(t, r, table)
+
+			_, err := authenticateAPIKey(context.Background(), apiKeyRequest(http.MethodGet, presented), "users", client)
+			if reads := atomic.LoadInt64(&table.reads); reads != tt.wantReads {
+				t.Errorf("reads = %d, want %d", reads, tt.wantReads)
+			}
+			if table.key.Enabled {
+				if err != nil {
+					t.Errorf("authenticateAPIKey = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != ErrorAPIKeyDisabled {
+				t.Errorf("authenticateAPIKey = %v, want %s", err, ErrorAPIKeyDisabled)
+			}
+			if len(apiKeys.entries) != 0 {
+				t.Errorf("cache = %v, want the revoked key dropped", apiKeys.entries)
+			}
+		})
+	}
+
+}
+
+func TestRevokeAPIKeyNotFound(t *testing.T) {
+
+	client := &fakeDynamo{scan: func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		return &dynamodb.ScanOutput{}, nil
+	}}
+	req := callerRequest("admin@example.com", true, "")
+	req.PathParameters = map[string]string{"id": "nope"}
+
+	resp, err := RevokeAPIKey(context.Background(), req, "users", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want %d: %s", resp.StatusCode, http.StatusNotFound, resp.Body)
+	}
+
+}
+
+func TestCreateAPIKey(t *testing.T) {
+
+	defer func(enabled bool) { envelopeEnabled = enabled }(envelopeEnabled)
+	envelopeEnabled = true
+
+	tests := []struct {
+		name       string
+		admin      bool
+		body       string
+		wantStatus int
+	}{
+		{name: "created", admin: true, body: `{"owner":"reporting","scopes":["users:read"]}`, wantStatus: http.StatusCreated},
+		{name: "with an expiry", admin: true, body: `{"owner":"reporting","scopes":["users:read"],"expiresAt":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`, wantStatus: http.StatusCreated},
+		{name: "not an admin", body: `{"owner":"reporting","scopes":["users:read"]}`, wantStatus: http.StatusForbidden},
+		{name: "unknown scope", admin: true, body: `{"owner":"reporting","scopes":["everything"]}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "no owner", admin: true, body: `{"scopes":["users:read"]}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "expired already", admin: true, body: `{"owner":"reporting","scopes":["users:read"],"expiresAt":"2020-01-01T00:00:00Z"}`, wantStatus: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored []map[string]types.AttributeValue
+			client := &fakeDynamo{putItem: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				stored = append(stored, input.Item)
+				return &dynamodb.PutItemOutput{}, nil
+			}}
+
+			resp, err := CreateAPIKey(context.Background(), callerRequest("admin@example.com", tt.admin, tt.body), "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if len(stored) > 0 {
+					t.Errorf("stored %d keys, want none", len(stored))
+				}
+				return
+			}
+
+			var body struct {
+				Data user.APIKey `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+				t.Fatal(err)
+			}
+			key := body.Data
+			if !strings.HasPrefix(key.Key, user.APIKeyPrefix) || len(key.Key) < len(user.APIKeyPrefix)+32 || !key.Enabled {
+				t.Errorf("key = %+v", key)
+			}
+			if resp.Headers["Cache-Control"] != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", resp.Headers["Cache-Control"])
+			}
+			if strings.Contains(resp.Body, "keyHash") || strings.Contains(resp.Body, user.HashAPIKey(key.Key)) {
+				t.Errorf("body = %s, the hash stays in the table", resp.Body)
+			}
+
+			// the table has the hash and never the key
+			if len(stored) != 1 {
+				t.Fatalf("stored %d keys, want 1", len(stored))
+			}
+			if hash, ok := stored[0]["keyHash"].(*types.AttributeValueMemberS); !ok || hash.Value != user.HashAPIKey(key.Key) {
+				t.Errorf("keyHash = %v, want the hash of the key", stored[0]["keyHash"])
+			}
+			for name, value := range stored[0] {
+				if s, ok := value.(*types.AttributeValueMemberS); ok && strings.Contains(s.Value, key.Key) {
+					t.Errorf("%s stores the key", name)
+				}
+			}
+			var read user.APIKey
+			if err := attributevalue.UnmarshalMap(stored[0], &read); err != nil || len(read.Key) > 0 {
+				t.Errorf("stored key = %+v, %v", read, err)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Rahul-71/go-serverless/pkg/auth"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrorForbidden = auth.ErrorForbidden
+
+// RBAC_ENABLED=true restricts listing all users and setting roles and statuses to admins, and
+// reading, changing and deleting a user to admins and the user itself. It needs an
+// authorizer in front of the function. A request an authorizer named the caller of is
+// restricted the same way without it.
+var rbacEnabled = os.Getenv("RBAC_ENABLED") == "true"
+
+// Caller is who made the request according to the API Gateway authorizer
+type Caller = auth.Caller
+
+// callerFromRequest reads the caller out of the authorizer context, see auth.Claims
+func callerFromRequest(req events.APIGatewayProxyRequest) Caller {
+	return auth.FromRequest(req)
+}
+
+// authorize allows admins, and with a non-empty email the user itself, see auth.Check.
+// Everything is allowed while RBAC is off and no authorizer named the caller.
+func authorize(req events.APIGatewayProxyRequest, email string) error {
+
+	caller := callerFromRequest(req)
+	if !rbacEnabled && !caller.Authenticated() {
+		return nil
+	}
+	return auth.Check(caller, email)
+
+}
+
+// authorizeAdminFields allows a body that sets the role or the status of a user, on POST,
+// PUT and PATCH, only to admins, under the conditions of authorize. A user that could set
+// its own status would undo DeactivateUser. Bodies that aren't JSON objects are left to
+// the user package to reject.
+func authorizeAdminFields(req events.APIGatewayProxyRequest) error {
+
+	var body struct {
+		Role   string `json:"role"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(req.Body), &body); err != nil {
+		return nil
+	}
+	field := ""
+	switch {
+	case len(body.Role) > 0:
+		field = "role"
+	case len(body.Status) > 0:
+		field = "status"
+	default:
+		return nil
+	}
+	if err := authorize(req, ""); err != nil {
+		return fmt.Errorf("%s: only admins may set the %s", ErrorForbidden, field)
+	}
+	return nil
+
+}
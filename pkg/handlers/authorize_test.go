@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func callerRequest(email string, admin bool, body string) events.APIGatewayProxyRequest {
+	claims := map[string]interface{}{"email": email, "sub": email}
+	if admin {
+		claims["custom:role"] = "admin"
+	}
+	return events.APIGatewayProxyRequest{
+		Headers:        map[string]string{"Content-Type": "application/json"},
+		PathParameters: map[string]string{"email": email},
+		Body:           body,
+		RequestContext: events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{"claims": claims}},
+	}
+}
+
+func TestAdminOnlyHandlers(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		handler HandlerFunc
+		body    string
+	}{
+		{"CreateUsers", CreateUsers, `[{"email":"bob@example.com"}]`},
+		{"CountUsers", CountUsers, ""},
+		{"ImportUsers", ImportUsers, "email,firstName,lastName\nbob@example.com,Bob,Doe\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.handler(context.Background(), callerRequest("jane@example.com", false, tt.body), "users", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+
+}
+
+func TestAuthorizeAdminFields(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		req     events.APIGatewayProxyRequest
+		wantErr bool
+	}{
+		{"user sets a role", callerRequest("jane@example.com", false, `{"email":"jane@example.com","role":"admin"}`), true},
+		{"user sets a role in other case", callerRequest("jane@example.com", false, `{"Role":"admin"}`), true},
+		{"user without a role", callerRequest("jane@example.com", false, `{"firstName":"Jane"}`), false},
+		{"user with a null role", callerRequest("jane@example.com", false, `{"role":null}`), false},
+		{"admin sets a role", callerRequest("root@example.com", true, `{"role":"admin"}`), false},
+		{"not JSON", callerRequest("jane@example.com", false, `role=admin`), false},
+		{"user activates itself", callerRequest("jane@example.com", false, `{"status":"active"}`), true},
+		{"user with an empty status", callerRequest("jane@example.com", false, `{"status":""}`), false},
+		{"admin sets a status", callerRequest("root@example.com", true, `{"status":"active"}`), false},
+		{"nobody named while RBAC is off", events.APIGatewayProxyRequest{Body: `{"role":"admin","status":"active"}`}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := authorizeAdminFields(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("authorizeAdminFields = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+
+}
+
+func TestSetAdminFieldsForbidden(t *testing.T) {
+
+	r := testRouter()
+	tests := []struct {
+		method string
+		body   string
+	}{
+		{http.MethodPost, `{"email":"jane@example.com","role":"admin"}`},
+		{http.MethodPut, `{"email":"jane@example.com","role":"admin"}`},
+		{http.MethodPatch, `{"email":"jane@example.com","role":"admin"}`},
+		{http.MethodPost, `{"email":"jane@example.com","status":"active"}`},
+		{http.MethodPut, `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe","status":"active"}`},
+		{http.MethodPatch, `{"status":"active"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.body, func(t *testing.T) {
+			req := callerRequest("jane@example.com", false, tt.body)
+			req.HTTPMethod, req.Resource = tt.method, UserResource
+			if tt.method == http.MethodPost {
+				req.Resource, req.PathParameters = UsersResource, nil
+			}
+			resp, err := r.Dispatch(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+
+}
+
+func TestAuthorize(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		rbac    bool
+		req     events.APIGatewayProxyRequest
+		email   string
+		wantErr bool
+	}{
+		{name: "RBAC off, nobody named", req: events.APIGatewayProxyRequest{}, email: "", wantErr: false},
+		{name: "RBAC on, nobody named", rbac: true, req: events.APIGatewayProxyRequest{}, email: "jane@example.com", wantErr: true},
+		{name: "the user itself", rbac: true, req: callerRequest("jane@example.com", false, ""), email: "jane@example.com", wantErr: false},
+		{name: "another user", rbac: true, req: callerRequest("bob@example.com", false, ""), email: "jane@example.com", wantErr: true},
+		{name: "another user, RBAC off", req: callerRequest("bob@example.com", false, ""), email: "jane@example.com", wantErr: true},
+		{name: "a user listing", rbac: true, req: callerRequest("jane@example.com", false, ""), email: "", wantErr: true},
+		{name: "an admin", rbac: true, req: callerRequest("root@example.com", true, ""), email: "jane@example.com", wantErr: false},
+		{name: "an admin listing", rbac: true, req: callerRequest("root@example.com", true, ""), email: "", wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(enabled bool) { rbacEnabled = enabled }(rbacEnabled)
+			rbacEnabled = tt.rbac
+
+			if err := authorize(tt.req, tt.email); (err != nil) != tt.wantErr {
+				t.Errorf("authorize = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+
+}
+
+func TestUserAccess(t *testing.T) {
+
+	stored := storedUser(t, user.User{Email: "jane@example.com", FirstName: "Jane"})
+	client := &fakeDynamo{
+		getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: stored}, nil
+		},
+		deleteItem: func(in *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+			return &dynamodb.DeleteItemOutput{Attributes: stored}, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		handler    HandlerFunc
+		caller     string
+		admin      bool
+		email      string
+		wantStatus int
+	}{
+		{name: "user reads itself", handler: GetUser, caller: "jane@example.com", email: "jane@example.com", wantStatus: http.StatusOK},
+		{name: "user reads another", handler: GetUser, caller: "bob@example.com", email: "jane@example.com", wantStatus: http.StatusForbidden},
+		{name: "user lists", handler: GetUser, caller: "jane@example.com", wantStatus: http.StatusForbidden},
+		{name: "admin lists", handler: GetUser, caller: "root@example.com", admin: true, wantStatus: http.StatusOK},
+		{name: "user deletes another", handler: DeleteUser, caller: "bob@example.com", email: "jane@example.com", wantStatus: http.StatusForbidden},
+		{name: "user deletes itself", handler: DeleteUser, caller: "jane@example.com", email: "jane@example.com", wantStatus: http.StatusOK},
+		{name: "admin deletes", handler: DeleteUser, caller: "root@example.com", admin: true, email: "jane@example.com", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := callerRequest(tt.caller, tt.admin, "")
+			req.PathParameters = map[string]string{"email": tt.email}
+
+			resp, err := tt.handler(context.Background(), req, "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+		})
+	}
+
+}
+
+func TestWriteTarget(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		method     string
+		caller     string
+		admin      bool
+		query      string
+		path       string
+		body       string
+		wantStatus int
+		wantKey    string
+	}{
+		{name: "PUT of another user in the body", method: http.MethodPut, caller: "jane@example.com", query: "jane@example.com", body: `{"email":"victim@example.com","firstName":"Jane","lastName":"Doe"}`, wantStatus: http.StatusBadRequest},
+		{name: "PATCH of another user in the body", method: http.MethodPatch, caller: "jane@example.com", query: "jane@example.com", body: `{"email":"victim@example.com","firstName":"Jane"}`, wantStatus: http.StatusBadRequest},
+		{name: "PUT of another user in the path", method: http.MethodPut, caller: "jane@example.com", path: "jane@example.com", body: `{"email":"victim@example.com","firstName":"Jane","lastName":"Doe"}`, wantStatus: http.StatusBadRequest},
+		{name: "PUT of the caller by query", method: http.MethodPut, caller: "jane@example.com", query: "jane@example.com", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"}`, wantStatus: http.StatusOK, wantKey: "jane@example.com"},
+		{name: "PATCH of the caller by query", method: http.MethodPatch, caller: "jane@example.com", query: "jane@example.com", body: `{"firstName":"Jane"}`, wantStatus: http.StatusOK, wantKey: "jane@example.com"},
+		{name: "PUT of another user by query", method: http.MethodPut, caller: "jane@example.com", query: "victim@example.com", body: `{"firstName":"Jane","lastName":"Doe"}`, wantStatus: http.StatusForbidden},
+		{name: "PATCH of the body user without a query", method: http.MethodPatch, caller: "jane@example.com", body: `{"email":"victim@example.com","firstName":"Jane"}`, wantStatus: http.StatusForbidden},
+		{name: "admin PATCH of the body user", method: http.MethodPatch, caller: "root@example.com", admin: true, body: `{"email":"victim@example.com","firstName":"Jane"}`, wantStatus: http.StatusOK, wantKey: "victim@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var written string
+			client := &fakeDynamo{
+				getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+					email := in.Key["email"].(*types.AttributeValueMemberS).Value
+					return &dynamodb.GetItemOutput{Item: storedUser(t, user.User{Email: email, FirstName: "Jane"})}, nil
+				},
+				updateItem: func(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+					email := in.Key["email"].(*types.AttributeValueMemberS).Value
+					written = email
+					return &dynamodb.UpdateItemOutput{Attributes: storedUser(t, user.User{Email: email, FirstName: "Jane"})}, nil
+				},
+			}
+			r := NewRouter("users", client)
+			RegisterUserRoutes(r)
+			req := callerRequest(tt.caller, tt.admin, tt.body)
+			req.HTTPMethod, req.Resource, req.PathParameters = tt.method, UsersResource, nil
+			if len(tt.path) > 0 {
+				req.Resource, req.PathParameters = UserResource, map[string]string{"email": tt.path}
+			}
+			if len(tt.query) > 0 {
+				req.QueryStringParameters = map[string]string{"email": tt.query}
+			}
+
+			resp, err := r.Dispatch(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if written != tt.wantKey {
+				t.Errorf("written = %q, want %q", written, tt.wantKey)
+			}
+		})
+	}
+
+}
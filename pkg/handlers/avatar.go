@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	userevents "github.com/Rahul-71/go-serverless/pkg/events"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+var (
+	ErrorAvatarsDisabled      = "avatars are not configured"
+	ErrorInvalidAvatarType    = "avatar content type must be an image"
+	ErrorInvalidAvatarKey     = "avatar key does not belong to the user"
+	ErrorAvatarNotUploaded    = "avatar has not been uploaded"
+	ErrorAvatarPresign        = "could not presign avatar url"
+	ErrorAvatarStorageFailure = "could not check avatar upload"
+)
+
+// AVATAR_BUCKET holds the profile pictures under AVATAR_KEY_PREFIX. With
+// AVATAR_PUBLIC_BASE_URL (a public bucket or a CDN) avatarUrl points there, otherwise
+// it's a presigned GET.
+var (
+	avatarBucket        = envString("AVATAR_BUCKET", "")
+	avatarKeyPrefix     = envString("AVATAR_KEY_PREFIX", "avatars/")
+	avatarPublicBaseURL = envString("AVATAR_PUBLIC_BASE_URL", "")
+)
+
+const (
+	avatarUploadExpiry   = 5 * time.Minute
+	avatarDownloadExpiry = time.Hour
+)
+
+type AvatarUpload struct {
+	UploadURL string            `json:"uploadUrl"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	Key       string            `json:"key"`
+	ExpiresAt string            `json:"expiresAt"`
+}
+
+// AvatarUploadURL hands out a presigned PUT for a {"contentType": "image/..."} body.
+// Once the upload is done the client confirms the key with PUT /users/{email}/avatar.
+func (r *Router) AvatarUploadURL(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if r.s3Presigner == nil || len(avatarBucket) == 0 {
+		return errorResponse(ctx, req, errors.New(ErrorAvatarsDisabled))
+	}
+	if err := authorize(req, emailParam(req)); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	var body struct {
+		ContentType string `json:"contentType"`
+	}
+	if err := user.Decode(req.Body, &body); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if !strings.HasPrefix(body.ContentType, "image/") {
+		return errorResponse(ctx, req, errors.New(ErrorInvalidAvatarType))
+	}
+
+	email := emailParam(req)
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	done := metrics.Time(ctx, "FetchUser")
+	_, err = user.FetchUser(ctx, email, tenant, tableName, dynaClient, "email")
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	// a new key per upload, so caches never serve an old picture under a new name
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return errorResponse(ctx, req, flatten(ctx, ErrorAvatarPresign, err))
+	}
+	key := avatarPrefix(email) + hex.EncodeToString(suffix)
+
+	// the content type is part of the signature, S3 refuses uploads with another one
+	upload, err := r.s3Presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(avatarBucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(body.ContentType),
+	}, s3.WithPresignExpires(avatarUploadExpiry), signContentType)
+	if err != nil {
+		return errorResponse(ctx, req, flatten(ctx, ErrorAvatarPresign, err))
+	}
+
+	return successResponse(ctx, req, http.StatusOK, AvatarUpload{
+		UploadURL: upload.URL,
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"Content-Type": body.ContentType},
+		Key:       key,
+		ExpiresAt: time.Now().Add(avatarUploadExpiry).UTC().Format(time.RFC3339),
+	})
+
+}
+
+// ConfirmAvatar stores the key of an uploaded picture, sent as {"key": "..."}, on the user
+func (r *Router) ConfirmAvatar(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if r.s3Client == nil || len(avatarBucket) == 0 {
+		return errorResponse(ctx, req, errors.New(ErrorAvatarsDisabled))
+	}
+	if err := authorize(req, emailParam(req)); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	var body struct {
+		Key string `json:"key"`
+	}
+	if err := user.Decode(req.Body, &body); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	email := emailParam(req)
+	if !strings.HasPrefix(body.Key, avatarPrefix(email)) {
+		return errorResponse(ctx, req, errors.New(ErrorInvalidAvatarKey))
+	}
+
+	head, err := r.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(avatarBucket),
+		Key:    aws.String(body.Key),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return errorResponse(ctx, req, errors.New(ErrorAvatarNotUploaded))
+		}
+		return errorResponse(ctx, req, flatten(ctx, ErrorAvatarStorageFailure, err))
+	}
+	if !strings.HasPrefix(aws.ToString(head.ContentType), "image/") {
+		return errorResponse(ctx, req, errors.New(ErrorInvalidAvatarType))
+	}
+
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	done := metrics.Time(ctx, "SetAvatar")
+	result, err := user.SetAvatar(ctx, email, body.Key, tenant, user.CallerIdentity(req), tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	r.publishChange(ctx, req, userevents.TypeUserUpdated, result, []string{"avatarUrl"})
+	r.withAvatarURL(ctx, result)
+	return successResponse(ctx, req, http.StatusOK, withUserLinks(req, result, result.Email))
+
+}
+
+// withAvatarURL fills in avatarUrl for a user with a picture
+func (r *Router) withAvatarURL(ctx context.Context, u *user.User) {
+
+	if len(u.AvatarKey) == 0 || len(avatarBucket) == 0 {
+		return
+	}
+
+	if len(avatarPublicBaseURL) > 0 {
+		u.AvatarURL = strings.TrimSuffix(avatarPublicBaseURL, "/") + "/" + u.AvatarKey
+		return
+	}
+	if r.s3Presigner == nil {
+		return
+	}
+
+	download, err := r.s3Presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(avatarBucket),
+		Key:    aws.String(u.AvatarKey),
+	}, s3.WithPresignExpires(avatarDownloadExpiry))
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "presigning avatar failed", "email", u.Email, logging.Err(err))
+		return
+	}
+	u.AvatarURL = download.URL
+
+}
+
+// signContentType keeps the content type in the signature of a presigned PUT, the SDK
+// drops it from requests without a body
+func signContentType(opts *s3.PresignOptions) {
+	opts.ClientOptions = append(opts.ClientOptions, func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			_, err := stack.Build.Remove("RemoveContentTypeHeader")
+			return err
+		})
+	})
+}
+
+// avatarPrefix is where the pictures of one user live
+func avatarPrefix(email string) string {
+	return avatarKeyPrefix + url.PathEscape(validators.NormalizeEmail(email)) + "/"
+}
+
+// HeadObject has no body to carry an error code, a missing key is a plain NotFound
+func isS3NotFound(err error) bool {
+	var notFound *types.NotFound
+	var noSuchKey *types.NoSuchKey
+	return errors.As(err, &notFound) || errors.As(err, &noSuchKey)
+}
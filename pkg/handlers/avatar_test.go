@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// testPresigner signs with static credentials, presigning makes no call
+func testPresigner() S3PresignAPI {
+	return s3.NewPresignClient(s3.New(s3.Options{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+	}))
+}
+
+func TestAvatarUploadURL(t *testing.T) {
+
+	defer func(bucket string, enabled bool) { avatarBucket, envelopeEnabled = bucket, enabled }(avatarBucket, envelopeEnabled)
+	avatarBucket, envelopeEnabled = "avatars", true
+
+	jane := user.User{Email: "jane@example.com", FirstName: "Jane", LastName: "Doe", Version: 1}
+	client := &fakeDynamo{getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		return &dynamodb.GetItemOutput{Item: storedUser(t, jane)}, nil
+	}}
+	r := NewRouter("users", client).WithS3(&fakeS3{}, testPresigner())
+	RegisterUserRoutes(r)
+	req := callerRequest(jane.Email, false, `{"contentType":"image/png"}`)
+	req.HTTPMethod, req.Resource = http.MethodPost, AvatarUploadResource
+
+	resp, err := r.Dispatch(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, resp.Body)
+	}
+	var body struct {
+		Data AvatarUpload `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	upload, err := url.Parse(body.Data.UploadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(body.Data.Key, avatarPrefix(jane.Email)) || !strings.Contains(upload.Host+upload.Path, "avatars") || !strings.HasSuffix(upload.Path, "/"+body.Data.Key) {
+		t.Errorf("upload = %s for key %s", body.Data.UploadURL, body.Data.Key)
+	}
+	// the content type is signed, S3 refuses an upload with another one
+	query := upload.Query()
+	if query.Get("X-Amz-Expires") != "300" || !strings.Contains(query.Get("X-Amz-SignedHeaders"), "content-type") || len(query.Get("X-Amz-Signature")) == 0 {
+		t.Errorf("upload query = %v", query)
+	}
+
+}
+
+func TestConfirmAvatar(t *testing.T) {
+
+	defer func(bucket string, enabled bool) { avatarBucket, envelopeEnabled = bucket, enabled }(avatarBucket, envelopeEnabled)
+	avatarBucket, envelopeEnabled = "avatars", true
+
+	key := avatarPrefix("jane@example.com") + "a1"
+	tests := []struct {
+		name       string
+		headErr    error
+		wantStatus int
+	}{
+		{name: "uploaded", wantStatus: http.StatusOK},
+		{name: "not uploaded", headErr: &types.NotFound{}, wantStatus: http.StatusConflict},
+		{name: "no such key", headErr: &types.NoSuchKey{}, wantStatus: http.StatusConflict},
+		{name: "storage failing", headErr: errors.New("denied"), wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := storedUser(t, user.User{Email: "jane@example.com", FirstName: "Jane", LastName: "Doe", AvatarKey: key, Version: 2})
+			client := &fakeDynamo{updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				return &dynamodb.UpdateItemOutput{Attributes: stored}, nil
+			}}
+			r := NewRouter("users", client).WithS3(&fakeS3{headErr: tt.headErr}, testPresigner())
+			RegisterUserRoutes(r)
+			req := callerRequest("jane@example.com", false, `{"key":"`+key+`"}`)
+			req.HTTPMethod, req.Resource = http.MethodPut, AvatarResource
+
+			resp, err := r.Dispatch(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			// without a public base URL the picture is a presigned GET
+			var body struct {
+				Data user.User `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+				t.Fatal(err)
+			}
+			download, err := url.Parse(body.Data.AvatarURL)
+			if err != nil || !strings.HasSuffix(download.Path, "/"+key) || download.Query().Get("X-Amz-Expires") != "3600" {
+				t.Errorf("avatarUrl = %s", body.Data.AvatarURL)
+			}
+		})
+	}
+
+}
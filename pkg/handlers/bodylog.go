@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/redact"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// BODY_LOGGING=true logs every request with its body and the status and size of the
+// response, emails and names masked. Bodies are cut at BODY_LOG_MAX_BYTES.
+var (
+	bodyLogging     = os.Getenv("BODY_LOGGING") == "true"
+	bodyLogMaxBytes = envInt("BODY_LOG_MAX_BYTES", 2048)
+)
+
+// the headers that carry credentials, they're never logged
+var secretHeaders = map[string]bool{
+	"authorization":        true,
+	"cookie":               true,
+	"x-api-key":            true,
+	"x-amz-security-token": true,
+	"x-signature":          true,
+}
+
+type dispatchFunc func(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error)
+
+// withBodyLogging logs the request before next and the response after it
+func withBodyLogging(next dispatchFunc) dispatchFunc {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+
+		logger := logging.FromContext(ctx)
+		logger.InfoContext(ctx, "request",
+			"path", redact.Text(req.Path),
+			"headers", loggedHeaders(req),
+			"body", loggedBody(req),
+		)
+
+		resp, err := next(ctx, req)
+		if resp != nil {
+			logger.InfoContext(ctx, "response", "status", resp.StatusCode, "size", len(resp.Body))
+		}
+		return resp, err
+
+	}
+}
+
+func loggedHeaders(req events.APIGatewayProxyRequest) map[string]string {
+	headers := map[string]string{}
+	for name, values := range req.MultiValueHeaders {
+		headers[name] = strings.Join(values, ", ")
+	}
+	for name, value := range req.Headers {
+		headers[name] = value
+	}
+	for name, value := range headers {
+		if secretHeaders[strings.ToLower(name)] {
+			delete(headers, name)
+			continue
+		}
+		headers[name] = redact.Text(value)
+	}
+	return headers
+}
+
+// loggedBody is the masked body, cut at bodyLogMaxBytes with a marker of what's left out
+func loggedBody(req events.APIGatewayProxyRequest) string {
+
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return "[invalid base64 body]"
+		}
+		body = decoded
+	}
+	if len(body) == 0 {
+		return ""
+	}
+
+	if strings.Contains(strings.ToLower(headerValue(req, "Content-Type")), "csv") {
+		body = redact.CSV(body)
+	} else {
+		body = redact.JSON(body)
+	}
+	if len(body) > bodyLogMaxBytes {
+		return fmt.Sprintf("%s...[truncated %d bytes]", strings.ToValidUTF8(string(body[:bodyLogMaxBytes]), ""), len(body)-bodyLogMaxBytes)
+	}
+	return string(body)
+
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestLoggedHeaders(t *testing.T) {
+
+	headers := loggedHeaders(events.APIGatewayProxyRequest{
+		Headers: map[string]string{
+			"Authorization":         "Bearer token",
+			"X-Api-Key":             "key",
+			"X-Signature":           "sha256=00",
+			"X-Signature-Timestamp": "1700000000",
+			"From":                  "jane@example.com",
+		},
+		MultiValueHeaders: map[string][]string{"Cookie": {"a=1", "b=2"}},
+	})
+
+	tests := []struct {
+		name   string
+		want   string
+		logged bool
+	}{
+		{name: "Authorization"},
+		{name: "X-Api-Key"},
+		{name: "X-Signature"},
+		{name: "Cookie"},
+		{name: "X-Signature-Timestamp", want: "1700000000", logged: true},
+		{name: "From", want: "j***@example.com", logged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := headers[tt.name]
+			if ok != tt.logged || got != tt.want {
+				t.Errorf("%s = %q (logged %t), want %q (logged %t)", tt.name, got, ok, tt.want, tt.logged)
+			}
+		})
+	}
+
+}
+
+func TestLoggedBody(t *testing.T) {
+
+	tests := []struct {
+		name string
+		req  events.APIGatewayProxyRequest
+		want string
+	}{
+		{"json", events.APIGatewayProxyRequest{Body: `{"email":"jane@example.com","password":"hunter2"}`}, `{"email":"j***@example.com","password":"***"}`},
+		{"csv", events.APIGatewayProxyRequest{Headers: map[string]string{"Content-Type": "text/csv"}, Body: "jane@example.com,Jane\n"}, "j***@example.com,J***\n"},
+		{"base64", events.APIGatewayProxyRequest{IsBase64Encoded: true, Body: "eyJ0b2tlbiI6InQifQ=="}, `{"token":"***"}`},
+		{"invalid base64", events.APIGatewayProxyRequest{IsBase64Encoded: true, Body: "!"}, "[invalid base64 body]"},
+		{"empty", events.APIGatewayProxyRequest{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loggedBody(tt.req); got != tt.want {
+				t.Errorf("loggedBody = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	userevents "github.com/Rahul-71/go-serverless/pkg/events"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+var publishFailures int64
+
+// PublishFailures is how many change events this instance couldn't publish to the bus
+// or the topic
+func PublishFailures() int64 {
+	return atomic.LoadInt64(&publishFailures)
+}
+
+// WithEventBridge publishes a change event to the bus for every write of a user, without
+// a client or a bus nothing is published
+func (r *Router) WithEventBridge(client EventBridgeAPI, busName string) *Router {
+	r.eventBridge = client
+	r.eventBusName = busName
+	return r
+}
+
+// WithSNS publishes every change event to the topic too, without a client or a topic
+// nothing is published
+func (r *Router) WithSNS(client SNSAPI, topicArn string) *Router {
+	r.sns = client
+	r.snsTopicArn = topicArn
+	return r
+}
+
+// the entries one PutEvents or PublishBatch takes at most
+const publishBatchSize = 10
+
+// publishChange sends the change event of a write of u that succeeded, see publish
+func (r *Router) publishChange(ctx context.Context, req events.APIGatewayProxyRequest, detailType string, u *user.User, changed []string) {
+
+	if u == nil {
+		return
+	}
+	r.publish(ctx, detailType, []userevents.Change{{Email: u.Email, TenantID: u.TenantID, Changed: changed, RequestID: requestID(req)}})
+
+}
+
+// publishChanges sends a change event for every user of tenant a batch wrote, see publish
+func (r *Router) publishChanges(ctx context.Context, req events.APIGatewayProxyRequest, detailType string, emails []string, tenant string) {
+
+	changes := make([]userevents.Change, 0, len(emails))
+	for _, email := range emails {
+		changes = append(changes, userevents.Change{Email: email, TenantID: tenant, RequestID: requestID(req)})
+	}
+	r.publish(ctx, detailType, changes)
+
+}
+
+// createdEmails are the emails of the users a batch created
+func createdEmails(results []user.BatchResult) []string {
+	var emails []string
+	for _, result := range results {
+		if result.Status == user.BatchStatusCreated {
+			emails = append(emails, result.Email)
+		}
+	}
+	return emails
+}
+
+// publish sends the change events of writes that succeeded to the bus and the topic, the
+// webhooks get them from the bus, see pkg/webhooks. Every write of a user ends here. The
+// writes stay done whatever happens, a failure is logged and counted.
+func (r *Router) publish(ctx context.Context, detailType string, changes []userevents.Change) {
+
+	for start := 0; start < len(changes); start += publishBatchSize {
+		end := start + publishBatchSize
+		if end > len(changes) {
+			end = len(changes)
+		}
+		r.putEvents(ctx, detailType, changes[start:end])
+		r.publishSNS(ctx, detailType, changes[start:end])
+	}
+
+}
+
+// putEvents sends the change events to the bus of WithEventBridge
+func (r *Router) putEvents(ctx context.Context, detailType string, changes []userevents.Change) {
+
+	if r.eventBridge == nil || len(r.eventBusName) == 0 {
+		return
+	}
+
+	var entries []eventbridgetypes.PutEventsRequestEntry
+	var sent []userevents.Change
+	for _, event := range changes {
+		detail, err := json.Marshal(event)
+		if err != nil {
+			atomic.AddInt64(&publishFailures, 1)
+			logging.FromContext(ctx).ErrorContext(ctx, "encoding event failed", "detailType", detailType, "email", event.Email, logging.Err(err))
+			continue
+		}
+		entries = append(entries, eventbridgetypes.PutEventsRequestEntry{
+			EventBusName: aws.String(r.eventBusName),
+			Source:       aws.String(userevents.Source),
+			DetailType:   aws.String(detailType),
+			Detail:       aws.String(string(detail)),
+		})
+		sent = append(sent, event)
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	result, err := r.eventBridge.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries})
+	if err != nil {
+		for _, event := range sent {
+			logging.FromContext(ctx).ErrorContext(ctx, "publishing event failed", "detailType", detailType, "email", event.Email, "eventBus", r.eventBusName, logging.Err(err))
+		}
+		atomic.AddInt64(&publishFailures, int64(len(sent)))
+		return
+	}
+	// PutEvents succeeds with failed entries, those have an error code each and are in
+	// the order of the request
+	if result.FailedEntryCount == 0 {
+		return
+	}
+	for i, entry := range result.Entries {
+		if i >= len(sent) || len(aws.ToString(entry.ErrorCode)) == 0 {
+			continue
+		}
+		logging.FromContext(ctx).ErrorContext(ctx, "publishing event failed", "detailType", detailType, "email", sent[i].Email, "eventBus", r.eventBusName, slog.Group("error", "code", aws.ToString(entry.ErrorCode), "message", aws.ToString(entry.ErrorMessage)))
+		atomic.AddInt64(&publishFailures, 1)
+	}
+
+}
+
+// publishSNS sends the change events to the topic of WithSNS. The eventType and
+// emailDomain attributes are there for filter policies.
+func (r *Router) publishSNS(ctx context.Context, eventType string, changes []userevents.Change) {
+
+	if r.sns == nil || len(r.snsTopicArn) == 0 {
+		return
+	}
+
+	var entries []snstypes.PublishBatchRequestEntry
+	emails := map[string]string{}
+	for i, event := range changes {
+		message, err := json.Marshal(userevents.NewMessage(eventType, event))
+		if err != nil {
+			atomic.AddInt64(&publishFailures, 1)
+			logging.FromContext(ctx).ErrorContext(ctx, "encoding message failed", "eventType", eventType, "email", event.Email, logging.Err(err))
+			continue
+		}
+		id := strconv.Itoa(i)
+		emails[id] = event.Email
+		entries = append(entries, snstypes.PublishBatchRequestEntry{
+			Id:      aws.String(id),
+			Message: aws.String(string(message)),
+			MessageAttributes: map[string]snstypes.MessageAttributeValue{
+				"eventType":   {DataType: aws.String("String"), StringValue: aws.String(eventType)},
+				"emailDomain": {DataType: aws.String("String"), StringValue: aws.String(validators.EmailDomain(event.Email))},
+			},
+		})
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	result, err := r.sns.PublishBatch(ctx, &sns.PublishBatchInput{
+		TopicArn:                   aws.String(r.snsTopicArn),
+		PublishBatchRequestEntries: entries,
+	})
+	if err != nil {
+		for _, email := range emails {
+			logging.FromContext(ctx).ErrorContext(ctx, "publishing message failed", "eventType", eventType, "email", email, "topic", r.snsTopicArn, logging.Err(err))
+		}
+		atomic.AddInt64(&publishFailures, int64(len(entries)))
+		return
+	}
+	for _, failed := range result.Failed {
+		logging.FromContext(ctx).ErrorContext(ctx, "publishing message failed", "eventType", eventType, "email", emails[aws.ToString(failed.Id)], "topic", r.snsTopicArn, slog.Group("error", "code", aws.ToString(failed.Code), "message", aws.ToString(failed.Message)))
+		atomic.AddInt64(&publishFailures, 1)
+	}
+
+}
+
+// patchedFields are the fields a PATCH body sets, there's no previous user to compare
+// with. The server controlled ones a client may send back are ignored by PatchUser.
+func patchedFields(body string) []string {
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &patch); err != nil {
+		return nil
+	}
+	var fields []string
+	for field := range patch {
+		switch field {
+		case "email", "createdBy", "updatedBy", "tenantId":
+			continue
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	userevents "github.com/Rahul-71/go-serverless/pkg/events"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// fakeEventBridge keeps the entries it's sent
+type fakeEventBridge struct {
+	entries []eventbridgetypes.PutEventsRequestEntry
+}
+
+func (f *fakeEventBridge) PutEvents(ctx context.Context, input *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	f.entries = append(f.entries, input.Entries...)
+	return &eventbridge.PutEventsOutput{}, nil
+}
+
+// fakeSNS keeps the messages it's sent
+type fakeSNS struct {
+	entries []snstypes.PublishBatchRequestEntry
+}
+
+func (f *fakeSNS) PublishBatch(ctx context.Context, input *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error) {
+	f.entries = append(f.entries, input.PublishBatchRequestEntries...)
+	return &sns.PublishBatchOutput{}, nil
+}
+
+// fakeS3 has an uploaded picture for every key, unless headErr is set
+type fakeS3 struct {
+	S3API
+	headErr error
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, input *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if f.headErr != nil {
+		return nil, f.headErr
+	}
+	return &s3.HeadObjectOutput{ContentType: aws.String("image/png")}, nil
+}
+
+func TestPublishWritePaths(t *testing.T) {
+
+	defer func(bucket string) { avatarBucket = bucket }(avatarBucket)
+	avatarBucket = "avatars"
+
+	jane := user.User{Email: "jane@example.com", FirstName: "Jane", LastName: "Doe", Version: 1}
+	// every write finds jane and the update returns her
+	client := func(t *testing.T) *fakeDynamo {
+		stored := storedUser(t, jane)
+		pending := storedUser(t, user.User{Email: jane.Email, VerificationExpiresAt: "9999-12-31T00:00:00Z", Version: 1})
+		return &fakeDynamo{
+			getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				if input.Key["email"].(*types.AttributeValueMemberS).Value != jane.Email {
+					return &dynamodb.GetItemOutput{}, nil
+				}
+				if strings.Contains(aws.ToString(input.ProjectionExpression), "#") {
+					return &dynamodb.GetItemOutput{Item: pending}, nil
+				}
+				return &dynamodb.GetItemOutput{Item: stored}, nil
+			},
+			updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				return &dynamodb.UpdateItemOutput{Attributes: stored}, nil
+			},
+			deleteItem: func(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+				return &dynamodb.DeleteItemOutput{Attributes: stored}, nil
+			},
+			query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+				if aws.ToString(input.IndexName) == user.VerificationIndex {
+					return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{{"email": &types.AttributeValueMemberS{Value: jane.Email}}}}, nil
+				}
+				return &dynamodb.QueryOutput{}, nil
+			},
+			batchGetItem: func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+				// only jane exists
+				var items []map[string]types.AttributeValue
+				for _, key := range input.RequestItems["users"].Keys {
+					if key["email"].(*types.AttributeValueMemberS).Value == jane.Email {
+						items = append(items, stored)
+					}
+				}
+				return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{"users": items}}, nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		resource    string
+		contentType string
+		query       map[string]string
+		body        string
+		wantType    string
+		wantEmails  []string
+		wantChanged []string
+		// wantPrevious is the email the user moved from
+		wantPrevious string
+	}{
+		{name: "create", method: http.MethodPost, resource: UsersResource, body: `{"email":"bob@example.com","firstName":"Bob","lastName":"Doe"}`, wantType: userevents.TypeUserCreated, wantEmails: []string{"bob@example.com"}},
+		{name: "update", method: http.MethodPut, resource: UserResource, body: `{"email":"jane@example.com","firstName":"Janet","lastName":"Doe"}`, wantType: userevents.TypeUserUpdated, wantEmails: []string{"jane@example.com"}},
+		{name: "delete", method: http.MethodDelete, resource: UserResource, wantType: userevents.TypeUserDeleted, wantEmails: []string{"jane@example.com"}},
+		{name: "activate", method: http.MethodPost, resource: ActivateResource, wantType: userevents.TypeUserUpdated, wantEmails: []string{"jane@example.com"}, wantChanged: []string{"status"}},
+		{name: "deactivate", method: http.MethodPost, resource: DeactivateResource, wantType: userevents.TypeUserUpdated, wantEmails: []string{"jane@example.com"}, wantChanged: []string{"status"}},
+		{name: "verify", method: http.MethodGet, resource: VerifyResource, query: map[string]string{"token": "token"}, wantType: userevents.TypeUserUpdated, wantEmails: []string{"jane@example.com"}, wantChanged: []string{"verified"}},
+		{name: "change email", method: http.MethodPost, resource: ChangeEmailResource, body: `{"newEmail":"janet@example.com"}`, wantType: userevents.TypeUserUpdated, wantEmails: []string{"janet@example.com"}, wantChanged: []string{"email", "verified"}, wantPrevious: "jane@example.com"},
+		{name: "avatar", method: http.MethodPut, resource: AvatarResource, body: `{"key":"` + avatarPrefix(jane.Email) + `a.png"}`, wantType: userevents.TypeUserUpdated, wantEmails: []string{"jane@example.com"}, wantChanged: []string{"avatarUrl"}},
+		{name: "batch create", method: http.MethodPost, resource: BatchResource, body: `[{"email":"bob@example.com","firstName":"Bob","lastName":"Doe"},{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"},{"email":"amy@example.com","firstName":"Amy","lastName":"Doe"}]`, wantType: userevents.TypeUserCreated, wantEmails: []string{"bob@example.com", "amy@example.com"}},
+		{name: "bulk delete", method: http.MethodPost, resource: BulkDeleteResource, body: `{"emails":["jane@example.com","bob@example.com"]}`, wantType: userevents.TypeUserDeleted, wantEmails: []string{"jane@example.com"}},
+		{name: "import", method: http.MethodPost, resource: ImportResource, contentType: "text/csv", body: "email,firstName,lastName\nbob@example.com,Bob,Doe\njane@example.com,Jane,Doe\n", wantType: userevents.TypeUserCreated, wantEmails: []string{"bob@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus, topic := &fakeEventBridge{}, &fakeSNS{}
+			r := NewRouter("users", client(t)).WithS3(&fakeS3{}, nil).WithEventBridge(bus, "bus").WithSNS(topic, "topic")
+			RegisterUserRoutes(r)
+			req := callerRequest(jane.Email, true, tt.body)
+			req.HTTPMethod, req.Resource, req.QueryStringParameters = tt.method, tt.resource, tt.query
+			if len(tt.contentType) > 0 {
+				req.Headers["Content-Type"] = tt.contentType
+			}
+
+			resp, err := r.Dispatch(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode >= 300 && resp.StatusCode != http.StatusMultiStatus {
+				t.Fatalf("status = %d: %s", resp.StatusCode, resp.Body)
+			}
+
+			if len(bus.entries) != len(tt.wantEmails) || len(topic.entries) != len(tt.wantEmails) {
+				t.Fatalf("events = %d, messages = %d, want %d", len(bus.entries), len(topic.entries), len(tt.wantEmails))
+			}
+			for i, entry := range bus.entries {
+				var change userevents.Change
+				if err := json.Unmarshal([]byte(aws.ToString(entry.Detail)), &change); err != nil {
+					t.Fatal(err)
+				}
+				if aws.ToString(entry.DetailType) != tt.wantType || change.Email != tt.wantEmails[i] || strings.Join(change.Changed, ",") != strings.Join(tt.wantChanged, ",") || change.PreviousEmail != tt.wantPrevious {
+					t.Errorf("event %d = %s %+v, want %s %s %v", i, aws.ToString(entry.DetailType), change, tt.wantType, tt.wantEmails[i], tt.wantChanged)
+				}
+				var message userevents.Message
+				if err := json.Unmarshal([]byte(aws.ToString(topic.entries[i].Message)), &message); err != nil || message.Type != tt.wantType || message.Data.Email != tt.wantEmails[i] {
+					t.Errorf("message %d = %s", i, aws.ToString(topic.entries[i].Message))
+				}
+			}
+		})
+	}
+
+}
+
+func TestPublishBatches(t *testing.T) {
+
+	bus, topic := &fakeEventBridge{}, &fakeSNS{}
+	r := NewRouter("users", nil).WithEventBridge(bus, "bus").WithSNS(topic, "topic")
+	emails := make([]string, 25)
+	for i := range emails {
+		emails[i] = strings.Repeat("a", i+1) + "@example.com"
+	}
+
+	r.publishChanges(context.Background(), callerRequest("admin@example.com", true, ""), userevents.TypeUserCreated, emails, "")
+	if len(bus.entries) != len(emails) || len(topic.entries) != len(emails) {
+		t.Fatalf("events = %d, messages = %d, want %d", len(bus.entries), len(topic.entries), len(emails))
+	}
+	seen := map[string]bool{}
+	for _, entry := range topic.entries {
+		seen[aws.ToString(entry.Id)+aws.ToString(entry.Message)] = true
+	}
+	if len(seen) != len(emails) {
+		t.Errorf("messages = %d distinct, want %d", len(seen), len(emails))
+	}
+
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/Rahul-71/go-serverless/pkg/export"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// S3API is every S3 call of the avatars and exports, *s3.Client has them all. Tests
+// embed it in a fake and only implement the calls they expect.
+type S3API interface {
+	export.S3API
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// S3PresignAPI presigns the avatar uploads and downloads, *s3.PresignClient has both
+type S3PresignAPI interface {
+	PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// EventBridgeAPI publishes the change events to the bus
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// SNSAPI fans the change events out to the topic
+type SNSAPI interface {
+	PublishBatch(ctx context.Context, params *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error)
+}
+
+// SESAPI sends the welcome email
+type SESAPI interface {
+	SendTemplatedEmail(ctx context.Context, params *ses.SendTemplatedEmailInput, optFns ...func(*ses.Options)) (*ses.SendTemplatedEmailOutput, error)
+}
+
+var (
+	_ S3API          = (*s3.Client)(nil)
+	_ S3PresignAPI   = (*s3.PresignClient)(nil)
+	_ EventBridgeAPI = (*eventbridge.Client)(nil)
+	_ SNSAPI         = (*sns.Client)(nil)
+	_ SESAPI         = (*ses.Client)(nil)
+)
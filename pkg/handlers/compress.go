@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// GZIP_MIN_BYTES is the body size from which responses get compressed, 1 KB by default
+var gzipMinBytes = envInt("GZIP_MIN_BYTES", 1024)
+
+// withCompression gzips the body when the client accepts it and it's big enough to be
+// worth it. API Gateway only passes binary bodies through base64 encoded.
+func withCompression(req events.APIGatewayProxyRequest, resp *events.APIGatewayProxyResponse) *events.APIGatewayProxyResponse {
+
+	if resp == nil || resp.IsBase64Encoded || len(resp.Body) < gzipMinBytes || !acceptsGzip(headerValue(req, "Accept-Encoding")) {
+		return resp
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(resp.Body)); err != nil {
+		return resp
+	}
+	if err := zw.Close(); err != nil {
+		return resp
+	}
+
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	resp.Headers["Content-Encoding"] = "gzip"
+	addVary(resp.Headers, "Accept-Encoding")
+	resp.Body = base64.StdEncoding.EncodeToString(buf.Bytes())
+	resp.IsBase64Encoded = true
+	return resp
+
+}
+
+// acceptsGzip parses an Accept-Encoding header such as "br;q=1.0, gzip;q=0.8, *;q=0.1"
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		// gzip;q=0 means the client explicitly refuses it
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
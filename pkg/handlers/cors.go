@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// CORS_ALLOWED_ORIGINS is a comma-separated list like "https://app.example.com,https://*.example.com".
+// A single "*" allows every origin. When it is unset no CORS headers are sent at all.
+// CORS_ALLOW_CREDENTIALS=true lets browsers send cookies/auth, CORS_MAX_AGE (seconds)
+// is how long preflight results may be cached.
+var (
+	allowedOrigins   = parseOrigins(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	allowCredentials = os.Getenv("CORS_ALLOW_CREDENTIALS") == "true"
+	corsMaxAge       = envInt("CORS_MAX_AGE", 0)
+)
+
+// response headers scripts may read besides the CORS-safelisted ones
+var corsExposedHeaders = []string{"ETag", "Location", "Retry-After", "X-Request-Id", "X-Truncated", "X-Cache"}
+
+var corsAllowedHeaders = []string{"Content-Type", "Authorization", "X-Api-Key", "X-Amz-Date", "X-Amz-Security-Token", "If-Match", "If-None-Match", "X-Condition", "Idempotency-Key", "X-Request-Id", "X-Correlation-Id", "X-Debug", "Cache-Control"}
+
+func parseOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); len(origin) > 0 {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return origins
+}
+
+// corsOrigin returns the value for Access-Control-Allow-Origin, or "" when the
+// origin isn't allowed
+func corsOrigin(origin string) string {
+	if len(origin) == 0 {
+		return ""
+	}
+
+	for _, allowed := range allowedOrigins {
+		// browsers refuse a wildcard together with credentials, echo the origin instead
+		if allowed == "*" && allowCredentials {
+			return origin
+		}
+		if allowed == "*" {
+			return "*"
+		}
+		if originMatches(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// originMatches compares an origin against an allowed entry, where the entry may
+// contain a single "*" standing for any subdomain, e.g. https://*.example.com. Scheme
+// and port have to match exactly, https://*.example.com doesn't allow
+// http://a.example.com or https://a.example.com:8443.
+func originMatches(allowed, origin string) bool {
+	if strings.EqualFold(allowed, origin) {
+		return true
+	}
+
+	prefix, suffix, found := strings.Cut(strings.ToLower(allowed), "*")
+	if !found {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+
+	// the wildcard covers subdomain labels only, not a port or a path
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(sub, ":/")
+}
+
+func withCORS(req events.APIGatewayProxyRequest, resp *events.APIGatewayProxyResponse) *events.APIGatewayProxyResponse {
+
+	if resp == nil {
+		return resp
+	}
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+
+	// caches must not hand a response for one origin to another
+	if len(allowedOrigins) > 0 {
+		addVary(resp.Headers, "Origin")
+	}
+
+	origin := corsOrigin(headerValue(req, "Origin"))
+	if len(origin) == 0 {
+		return resp
+	}
+
+	resp.Headers["Access-Control-Allow-Origin"] = origin
+	resp.Headers["Access-Control-Expose-Headers"] = strings.Join(corsExposedHeaders, ", ")
+	if allowCredentials {
+		resp.Headers["Access-Control-Allow-Credentials"] = "true"
+	}
+	return resp
+
+}
+
+func preflightResponse(methods []string) (*events.APIGatewayProxyResponse, error) {
+
+	allow := strings.Join(append(methods, http.MethodOptions), ", ")
+
+	resp, err := emptyResponse(http.StatusNoContent)
+	resp.Headers["Allow"] = allow
+	resp.Headers["Access-Control-Allow-Methods"] = allow
+	resp.Headers["Access-Control-Allow-Headers"] = strings.Join(corsAllowedHeaders, ", ")
+	if corsMaxAge > 0 {
+		resp.Headers["Access-Control-Max-Age"] = strconv.Itoa(corsMaxAge)
+	}
+	return resp, err
+
+}
+
+// addVary appends to the Vary header instead of overwriting it
+func addVary(headers map[string]string, value string) {
+	current := headers["Vary"]
+	for _, v := range strings.Split(current, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return
+		}
+	}
+	if len(current) == 0 {
+		headers["Vary"] = value
+		return
+	}
+	headers["Vary"] = current + ", " + value
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestOriginMatches(t *testing.T) {
+
+	tests := []struct {
+		allowed string
+		origin  string
+		want    bool
+	}{
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "HTTPS://App.Example.com", true},
+		{"https://app.example.com", "https://evil.example.com", false},
+		{"https://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "http://a.example.com", false},
+		{"https://*.example.com", "https://a.example.com:8443", false},
+		{"https://*.example.com", "https://evil.com/.example.com", false},
+		{"https://*.example.com", "https://a.example.com.evil.com", false},
+		{"https://*.example.com:8443", "https://a.example.com:8443", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.allowed+" "+tt.origin, func(t *testing.T) {
+			if got := originMatches(tt.allowed, tt.origin); got != tt.want {
+				t.Errorf("originMatches(%q, %q) = %t, want %t", tt.allowed, tt.origin, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestWithCORS(t *testing.T) {
+
+	defer func(origins []string, credentials bool) { allowedOrigins, allowCredentials = origins, credentials }(allowedOrigins, allowCredentials)
+
+	tests := []struct {
+		name        string
+		allowed     string
+		credentials bool
+		origin      string
+		wantOrigin  string
+		wantVary    string
+	}{
+		{name: "cors off", origin: "https://app.example.com"},
+		{name: "allowed", allowed: "https://app.example.com/", origin: "https://app.example.com", wantOrigin: "https://app.example.com", wantVary: "Origin"},
+		{name: "not allowed", allowed: "https://app.example.com", origin: "https://evil.com", wantVary: "Origin"},
+		{name: "wildcard", allowed: "*", origin: "https://evil.com", wantOrigin: "*", wantVary: "Origin"},
+		{name: "wildcard with credentials", allowed: "*", credentials: true, origin: "https://evil.com", wantOrigin: "https://evil.com", wantVary: "Origin"},
+		{name: "no origin", allowed: "*", wantVary: "Origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowedOrigins, allowCredentials = parseOrigins(tt.allowed), tt.credentials
+			resp := withCORS(events.APIGatewayProxyRequest{Headers: map[string]string{"origin": tt.origin}}, &events.APIGatewayProxyResponse{})
+			if got := resp.Headers["Access-Control-Allow-Origin"]; got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := resp.Headers["Vary"]; got != tt.wantVary {
+				t.Errorf("Vary = %q, want %q", got, tt.wantVary)
+			}
+			if got := resp.Headers["Access-Control-Allow-Credentials"] == "true"; got != (tt.credentials && len(tt.wantOrigin) > 0) {
+				t.Errorf("Access-Control-Allow-Credentials = %t", got)
+			}
+		})
+	}
+
+}
+
+func TestAddVary(t *testing.T) {
+
+	tests := []struct {
+		current string
+		want    string
+	}{
+		{"", "Origin"},
+		{"Accept-Encoding", "Accept-Encoding, Origin"},
+		{"accept-encoding, origin", "accept-encoding, origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.current, func(t *testing.T) {
+			headers := map[string]string{}
+			if len(tt.current) > 0 {
+				headers["Vary"] = tt.current
+			}
+			addVary(headers, "Origin")
+			if headers["Vary"] != tt.want {
+				t.Errorf("Vary = %q, want %q", headers["Vary"], tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// RESPONSE_ENVELOPE=false sends the bare data like before, for older clients
+var envelopeEnabled = os.Getenv("RESPONSE_ENVELOPE") != "false"
+
+type Meta struct {
+	RequestID string `json:"requestId,omitempty"`
+	Timestamp string `json:"timestamp"`
+	Count     *int   `json:"count,omitempty"`
+	// Filters are the filters a list was narrowed down with, see listFilters
+	Filters map[string]string `json:"filters,omitempty"`
+	// Debug is only there for admins asking with X-Debug, see withDebug
+	Debug *Debug `json:"debug,omitempty"`
+}
+
+type Envelope struct {
+	Data  interface{} `json:"data"`
+	Meta  Meta        `json:"meta"`
+	Links Links       `json:"_links,omitempty"`
+}
+
+// successResponse wraps data in the standard {"data": ..., "meta": ...} envelope
+func successResponse(ctx context.Context, req events.APIGatewayProxyRequest, status int, data interface{}) (*events.APIGatewayProxyResponse, error) {
+	var body interface{} = data
+	if envelopeEnabled {
+		body = Envelope{Data: data, Meta: newMeta(req)}
+	}
+
+	resp, err := apiResponse(ctx, status, body)
+	return withETag(req, data, resp), err
+}
+
+// listResponse is successResponse for lists, meta.count holds the number of items
+func listResponse(ctx context.Context, req events.APIGatewayProxyRequest, status int, data interface{}, count int) (*events.APIGatewayProxyResponse, error) {
+	var body interface{} = data
+	if envelopeEnabled {
+		meta := newMeta(req)
+		meta.Count = &count
+		if filters, err := listFilters(req); err == nil && len(filters) > 0 {
+			meta.Filters = filters
+		}
+		envelope := Envelope{Data: data, Meta: meta}
+		// lists may be bare arrays, in the envelope the links sit next to the data
+		if l, ok := data.(linked); ok {
+			envelope.Data, envelope.Links = l.data, l.links
+		}
+		body = envelope
+	}
+
+	resp, err := apiResponse(ctx, status, body)
+	return withETag(req, data, resp), err
+}
+
+func newMeta(req events.APIGatewayProxyRequest) Meta {
+	return Meta{
+		RequestID: requestID(req),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// Debug is what the DynamoDB calls of a request cost, with DEBUG_CAPACITY on
+type Debug struct {
+	Calls         []user.Call `json:"calls"`
+	CapacityUnits float64     `json:"capacityUnits"`
+	LatencyMs     float64     `json:"latencyMs"`
+}
+
+// debugRequested is true for admins sending X-Debug: true, nobody else learns what a
+// request costs
+func debugRequested(req events.APIGatewayProxyRequest) bool {
+	return envelopeEnabled && headerValue(req, "X-Debug") == "true" && callerFromRequest(req).Admin
+}
+
+// withDebug adds the calls recorded with ctx to the meta of an enveloped JSON response,
+// anything else is sent as it is
+func withDebug(ctx context.Context, resp *events.APIGatewayProxyResponse) *events.APIGatewayProxyResponse {
+
+	if resp == nil || resp.IsBase64Encoded || !strings.HasPrefix(resp.Headers["Content-Type"], "application/json") {
+		return resp
+	}
+	var envelope struct {
+		Data  json.RawMessage `json:"data"`
+		Meta  Meta            `json:"meta"`
+		Links json.RawMessage `json:"_links,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &envelope); err != nil || len(envelope.Meta.Timestamp) == 0 {
+		return resp
+	}
+
+	debug := &Debug{Calls: user.RecordedCalls(ctx)}
+	if debug.Calls == nil {
+		debug.Calls = []user.Call{}
+	}
+	for _, call := range debug.Calls {
+		debug.CapacityUnits += call.CapacityUnits
+		debug.LatencyMs += call.LatencyMs
+	}
+	envelope.Meta.Debug = debug
+
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return resp
+	}
+	resp.Body = string(body)
+	return resp
+
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestSuccessResponse(t *testing.T) {
+
+	defer func(enabled bool) { envelopeEnabled = enabled }(envelopeEnabled)
+	req := events.APIGatewayProxyRequest{Headers: map[string]string{"X-Request-Id": "r1"}}
+
+	tests := []struct {
+		name     string
+		envelope bool
+		list     bool
+		want     func(t *testing.T, body map[string]interface{})
+	}{
+		{"enveloped", true, false, func(t *testing.T, body map[string]interface{}) {
+			data, _ := body["data"].(map[string]interface{})
+			meta, _ := body["meta"].(map[string]interface{})
+			if data["email"] != "jane@example.com" || meta["requestId"] != "r1" || meta["timestamp"] == nil || meta["count"] != nil {
+				t.Errorf("body = %v", body)
+			}
+		}},
+		{"enveloped list", true, true, func(t *testing.T, body map[string]interface{}) {
+			meta, _ := body["meta"].(map[string]interface{})
+			if _, ok := body["data"].([]interface{}); !ok || meta["count"] != float64(1) {
+				t.Errorf("body = %v", body)
+			}
+		}},
+		{"bare", false, false, func(t *testing.T, body map[string]interface{}) {
+			if body["email"] != "jane@example.com" || body["meta"] != nil {
+				t.Errorf("body = %v", body)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelopeEnabled = tt.envelope
+			var resp *events.APIGatewayProxyResponse
+			var err error
+			item := map[string]string{"email": "jane@example.com"}
+			if tt.list {
+				resp, err = listResponse(context.Background(), req, http.StatusOK, []interface{}{item}, 1)
+			} else {
+				resp, err = successResponse(context.Background(), req, http.StatusOK, item)
+			}
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("response = %+v, %v", resp, err)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+				t.Fatal(err)
+			}
+			tt.want(t, body)
+		})
+	}
+
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/auth"
+	"github.com/Rahul-71/go-serverless/pkg/export"
+	"github.com/Rahul-71/go-serverless/pkg/idempotency"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/signing"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var CodeInternalError = "INTERNAL_ERROR"
+
+type errorMapping struct {
+	status int
+	code   string
+}
+
+// errorMappings decides the HTTP status and the stable machine-readable code for every
+// error message the handlers and the user package produce
+var errorMappings = map[string]errorMapping{
+	ErrorNotFound:          {http.StatusNotFound, "NOT_FOUND"},
+	ErrorTimeout:           {http.StatusGatewayTimeout, "TIMEOUT"},
+	ErrorInvalidPath:       {http.StatusBadRequest, "INVALID_PATH"},
+	ErrorInternal:          {http.StatusInternalServerError, CodeInternalError},
+	ErrorMarshalResponse:   {http.StatusInternalServerError, "RESPONSE_MARSHAL_FAILED"},
+	ErrorMethodNotAllowed:  {http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+	ErrorInvalidBase64Body: {http.StatusBadRequest, "INVALID_BODY_ENCODING"},
+	ErrorInvalidCSV:        {http.StatusBadRequest, "INVALID_CSV"},
+
+	ErrorUnsupportedMediaType: {http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE"},
+	ErrorBodyTooLarge:         {http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE"},
+	ErrorPreconditionRequired: {http.StatusPreconditionRequired, "PRECONDITION_REQUIRED"},
+	ErrorExportTooLarge:       {http.StatusRequestEntityTooLarge, "EXPORT_TOO_LARGE"},
+	ErrorTooManyRequests:      {http.StatusTooManyRequests, "TOO_MANY_REQUESTS"},
+	ErrorForbidden:            {http.StatusForbidden, "FORBIDDEN"},
+	ErrorInvalidAPIKey:        {http.StatusUnauthorized, "INVALID_API_KEY"},
+	ErrorAPIKeyExpired:        {http.StatusUnauthorized, "API_KEY_EXPIRED"},
+	ErrorAPIKeyDisabled:       {http.StatusForbidden, "API_KEY_DISABLED"},
+	ErrorAvatarsDisabled:      {http.StatusNotImplemented, "AVATARS_DISABLED"},
+	ErrorInvalidAvatarType:    {http.StatusUnsupportedMediaType, "INVALID_AVATAR_TYPE"},
+	ErrorInvalidAvatarKey:     {http.StatusBadRequest, "INVALID_AVATAR_KEY"},
+	ErrorAvatarNotUploaded:    {http.StatusConflict, "AVATAR_NOT_UPLOADED"},
+	ErrorAvatarPresign:        {http.StatusInternalServerError, "AVATAR_PRESIGN_FAILED"},
+	ErrorAvatarStorageFailure: {http.StatusBadGateway, "AVATAR_STORAGE_FAILED"},
+
+	auth.ErrorInvalidToken:    {http.StatusUnauthorized, "INVALID_BEARER_TOKEN"},
+	auth.ErrorTokenExpired:    {http.StatusUnauthorized, "BEARER_TOKEN_EXPIRED"},
+	auth.ErrorKeysUnavailable: {http.StatusServiceUnavailable, "TOKEN_KEYS_UNAVAILABLE"},
+
+	export.ErrorExportDisabled: {http.StatusNotImplemented, "EXPORT_DISABLED"},
+	export.ErrorExportUpload:   {http.StatusBadGateway, "EXPORT_UPLOAD_FAILED"},
+
+	idempotency.ErrorKeyReused:      {http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED"},
+	idempotency.ErrorInProgress:     {http.StatusConflict, "IDEMPOTENCY_KEY_IN_PROGRESS"},
+	idempotency.ErrorDynamoStoreKey: {http.StatusInternalServerError, "IDEMPOTENCY_STORE_FAILED"},
+
+	signing.ErrorSignatureMissing: {http.StatusUnauthorized, "SIGNATURE_MISSING"},
+	signing.ErrorSignatureStale:   {http.StatusUnauthorized, "SIGNATURE_STALE"},
+	signing.ErrorSignatureInvalid: {http.StatusUnauthorized, "SIGNATURE_INVALID"},
+
+	user.ErrorUserAlreadyExists: {http.StatusConflict, "USER_ALREADY_EXISTS"},
+	user.ErrorUserDoesNotExists: {http.StatusNotFound, "USER_NOT_FOUND"},
+	user.ErrorTokenNotFound:     {http.StatusNotFound, "TOKEN_NOT_FOUND"},
+	user.ErrorNoteNotFound:      {http.StatusNotFound, "NOTE_NOT_FOUND"},
+	user.ErrorNoteAlreadyExists: {http.StatusConflict, "NOTE_ALREADY_EXISTS"},
+	user.ErrorWebhookNotFound:   {http.StatusNotFound, "WEBHOOK_NOT_FOUND"},
+	user.ErrorAPIKeyNotFound:    {http.StatusNotFound, "API_KEY_NOT_FOUND"},
+	user.ErrorTooManyNotes:      {http.StatusConflict, "TOO_MANY_NOTES"},
+	user.ErrorTokenExpired:      {http.StatusGone, "TOKEN_EXPIRED"},
+	user.ErrorVersionMismatch:   {http.StatusPreconditionFailed, "PRECONDITION_FAILED"},
+	user.ErrorVersionConflict:   {http.StatusConflict, "VERSION_CONFLICT"},
+	user.ErrorConditionFailed:   {http.StatusPreconditionFailed, "CONDITION_FAILED"},
+	user.ErrorQueriesDisabled:   {http.StatusNotImplemented, "QUERIES_DISABLED"},
+
+	user.ErrorInvalidEmail:       {http.StatusBadRequest, "INVALID_EMAIL"},
+	user.ErrorEmailDomainBlocked: {http.StatusUnprocessableEntity, "EMAIL_DOMAIN_BLOCKED"},
+	user.ErrorInvalidPhone:       {http.StatusBadRequest, "INVALID_PHONE"},
+	user.ErrorInvalidStatus:      {http.StatusBadRequest, "INVALID_STATUS"},
+	user.ErrorInvalidTokenData:   {http.StatusBadRequest, "INVALID_TOKEN"},
+	user.ErrorInvalidNoteData:    {http.StatusBadRequest, "INVALID_NOTE"},
+	user.ErrorInvalidRole:        {http.StatusBadRequest, "INVALID_ROLE"},
+	user.ErrorInvalidUserData:    {http.StatusBadRequest, "INVALID_USER_DATA"},
+	user.ErrorTenantRequired:     {http.StatusBadRequest, "TENANT_REQUIRED"},
+	user.ErrorValidation:         {http.StatusUnprocessableEntity, "VALIDATION_FAILED"},
+	user.ErrorNothingToUpdate:    {http.StatusBadRequest, "NOTHING_TO_UPDATE"},
+	user.ErrorEmptyBatch:         {http.StatusBadRequest, "EMPTY_BATCH"},
+	user.ErrorInvalidFilter:      {http.StatusBadRequest, "INVALID_FILTER"},
+	user.ErrorInvalidCursor:      {http.StatusBadRequest, "INVALID_CURSOR"},
+	user.ErrorCursorInvalid:      {http.StatusBadRequest, "CURSOR_INVALID"},
+	user.ErrorInvalidLimit:       {http.StatusBadRequest, "INVALID_LIMIT"},
+	user.ErrorInvalidSortField:   {http.StatusBadRequest, "INVALID_SORT_FIELD"},
+	user.ErrorInvalidSortOrder:   {http.StatusBadRequest, "INVALID_SORT_ORDER"},
+	user.ErrorInvalidFields:      {http.StatusBadRequest, "INVALID_FIELDS"},
+	user.ErrorInvalidStatement:   {http.StatusBadRequest, "INVALID_STATEMENT"},
+	user.ErrorInvalidCondition:   {http.StatusBadRequest, "INVALID_CONDITION"},
+
+	user.ErrorFailedToFetchRecord:     {http.StatusInternalServerError, "FETCH_FAILED"},
+	user.ErrorFailedToUnmarshalRecord: {http.StatusInternalServerError, "UNMARSHAL_FAILED"},
+	user.ErrorMarshalItem:             {http.StatusInternalServerError, "MARSHAL_FAILED"},
+	user.ErrorDynamoPutItem:           {http.StatusInternalServerError, "PUT_FAILED"},
+	user.ErrorDynamoUpdateItem:        {http.StatusInternalServerError, "UPDATE_FAILED"},
+	user.ErrorDeleteItem:              {http.StatusInternalServerError, "DELETE_FAILED"},
+	user.ErrorDynamoBatchWrite:        {http.StatusInternalServerError, "BATCH_WRITE_FAILED"},
+	user.ErrorDynamoBatchGet:          {http.StatusInternalServerError, "BATCH_GET_FAILED"},
+	user.ErrorIndexNotFound:           {http.StatusInternalServerError, "INDEX_NOT_FOUND"},
+	user.ErrorDynamoExecuteStatement:  {http.StatusInternalServerError, "EXECUTE_STATEMENT_FAILED"},
+	user.ErrorCreateTable:             {http.StatusInternalServerError, "CREATE_TABLE_FAILED"},
+	user.ErrorGenerateToken:           {http.StatusInternalServerError, "TOKEN_GENERATION_FAILED"},
+	user.ErrorHashPassword:            {http.StatusInternalServerError, "PASSWORD_HASH_FAILED"},
+	user.ErrorGenerateNoteID:          {http.StatusInternalServerError, "NOTE_ID_GENERATION_FAILED"},
+	user.ErrorGenerateAPIKey:          {http.StatusInternalServerError, "API_KEY_GENERATION_FAILED"},
+}
+
+// mapError looks the error up in errorMappings. Some messages carry details after the
+// known prefix (e.g. the list of valid fields), anything unknown is an internal error.
+func mapError(err error) errorMapping {
+	msg := err.Error()
+	if m, ok := errorMappings[msg]; ok {
+		return m
+	}
+	for prefix, m := range errorMappings {
+		if strings.HasPrefix(msg, prefix+",") || strings.HasPrefix(msg, prefix+":") {
+			return m
+		}
+	}
+	return errorMapping{http.StatusInternalServerError, CodeInternalError}
+}
+
+// LEGACY_ERRORS=true keeps the old {"response": "..."} error body for clients that
+// haven't moved to problem+json yet
+var legacyErrors = os.Getenv("LEGACY_ERRORS") == "true"
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+	// RequestID is what support needs to find the request in the logs
+	RequestID string `json:"requestId,omitempty"`
+	// Errors names every invalid field of a VALIDATION_FAILED problem
+	Errors []user.FieldError `json:"errors,omitempty"`
+	// Current has the stored values of the fields a CONDITION_FAILED write expected
+	// differently
+	Current map[string]string `json:"current,omitempty"`
+}
+
+// errorResponse turns an error into an application/problem+json response with the
+// matching status code. The instance is the API Gateway request ID, requestId the
+// correlation ID also sent as X-Request-Id.
+func errorResponse(ctx context.Context, req events.APIGatewayProxyRequest, err error) (*events.APIGatewayProxyResponse, error) {
+
+	m := mapError(err)
+	if legacyErrors {
+		return apiResponse(ctx, m.status, ErrorBody{ErrorMsg: aws.String(err.Error()), Code: aws.String(m.code), RequestID: aws.String(requestID(req))})
+	}
+
+	problem := Problem{
+		Type:      problemType(m.code),
+		Title:     http.StatusText(m.status),
+		Status:    m.status,
+		Detail:    err.Error(),
+		Instance:  req.RequestContext.RequestID,
+		Code:      m.code,
+		RequestID: requestID(req),
+	}
+	var verr *user.ValidationError
+	if errors.As(err, &verr) {
+		problem.Errors = verr.Fields
+	}
+	var cerr *user.ConditionError
+	if errors.As(err, &cerr) {
+		problem.Current = cerr.Current
+	}
+
+	resp, rerr := apiResponse(ctx, m.status, problem)
+	resp.Headers["Content-Type"] = "application/problem+json"
+	return resp, rerr
+
+}
+
+// problemType turns a code like USER_NOT_FOUND into urn:go-serverless:problem:user-not-found
+func problemType(code string) string {
+	return "urn:go-serverless:problem:" + strings.ToLower(strings.ReplaceAll(code, "_", "-"))
+}
+
+// flatten logs err with the logger of ctx and returns the error of message in its place,
+// like the user package does for DynamoDB
+func flatten(ctx context.Context, message string, err error) error {
+	logging.FromContext(ctx).ErrorContext(ctx, message, logging.Err(err))
+	return errors.New(message)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestMapError(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"exact", errors.New(user.ErrorUserDoesNotExists), http.StatusNotFound, "USER_NOT_FOUND"},
+		{"with details after a colon", fmt.Errorf("%s: only admins may set the role", ErrorForbidden), http.StatusForbidden, "FORBIDDEN"},
+		{"with details after a comma", errors.New(user.ErrorInvalidFields + ", valid are email, firstName"), http.StatusBadRequest, "INVALID_FIELDS"},
+		{"validation", &user.ValidationError{Fields: []user.FieldError{{Field: "email", Message: "is required"}}}, http.StatusUnprocessableEntity, "VALIDATION_FAILED"},
+		{"conflict", errors.New(user.ErrorUserAlreadyExists), http.StatusConflict, "USER_ALREADY_EXISTS"},
+		{"timeout", errors.New(ErrorTimeout), http.StatusGatewayTimeout, "TIMEOUT"},
+		{"invalid path", errors.New(ErrorInvalidPath), http.StatusBadRequest, "INVALID_PATH"},
+		{"prefix without separator", errors.New(user.ErrorUserDoesNotExists + "!"), http.StatusInternalServerError, CodeInternalError},
+		{"unknown", errors.New("connection reset by peer"), http.StatusInternalServerError, CodeInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mapError(tt.err)
+			if m.status != tt.wantStatus || m.code != tt.wantCode {
+				t.Errorf("mapError(%q) = %d %s, want %d %s", tt.err, m.status, m.code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+
+}
+
+func TestErrorMappings(t *testing.T) {
+	for msg, m := range errorMappings {
+		if m.status < 400 || len(http.StatusText(m.status)) == 0 || len(m.code) == 0 {
+			t.Errorf("%q maps to %d %q", msg, m.status, m.code)
+		}
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+
+	req := events.APIGatewayProxyRequest{RequestContext: events.APIGatewayProxyRequestContext{RequestID: "apigw-1"}, Headers: map[string]string{"X-Request-Id": "r1"}}
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantFields int
+	}{
+		{"not found", errors.New(user.ErrorUserDoesNotExists), http.StatusNotFound, 0},
+		{"validation", &user.ValidationError{Fields: []user.FieldError{{Field: "email", Message: "is required"}, {Field: "phone", Message: "is not E.164"}}}, http.StatusUnprocessableEntity, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := errorResponse(context.Background(), req, tt.err)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var problem Problem
+			if err := json.Unmarshal([]byte(resp.Body), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || problem.Status != tt.wantStatus || resp.Headers["Content-Type"] != "application/problem+json" {
+				t.Errorf("status = %d, problem %+v, headers %v", resp.StatusCode, problem, resp.Headers)
+			}
+			if problem.Detail != tt.err.Error() || problem.Instance != "apigw-1" || problem.RequestID != requestID(req) || problem.Type != problemType(problem.Code) {
+				t.Errorf("problem = %+v", problem)
+			}
+			if len(problem.Errors) != tt.wantFields {
+				t.Errorf("errors = %v", problem.Errors)
+			}
+		})
+	}
+
+}
+
+func TestProblemType(t *testing.T) {
+	if got := problemType("USER_NOT_FOUND"); got != "urn:go-serverless:problem:user-not-found" {
+		t.Errorf("problemType = %s", got)
+	}
+}
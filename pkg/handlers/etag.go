@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrorPreconditionRequired = "If-Match header is required"
+
+// withETag sets a strong ETag on successful GETs and turns the response into a 304 when
+// the client already has that version. The tag is computed from the data alone, the
+// envelope meta changes on every request.
+func withETag(req events.APIGatewayProxyRequest, data interface{}, resp *events.APIGatewayProxyResponse) *events.APIGatewayProxyResponse {
+
+	if req.HTTPMethod != http.MethodGet || resp == nil || resp.StatusCode != http.StatusOK {
+		return resp
+	}
+
+	etag, err := etagFor(data)
+	if err != nil {
+		return resp
+	}
+
+	if etagMatches(headerValue(req, "If-None-Match"), etag) {
+		resp, _ = emptyResponse(http.StatusNotModified)
+	}
+	resp.Headers["ETag"] = etag
+	return resp
+
+}
+
+// etagMatches implements the If-None-Match comparison: a list of tags or "*", where
+// weak tags (W/"...") match by their opaque value
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// a full user is tagged with its version so the tag can be sent back in If-Match,
+// anything else with a hash of its JSON
+func etagFor(data interface{}) (string, error) {
+	if l, ok := data.(linked); ok {
+		data = l.data
+	}
+	if u, ok := data.(*user.User); ok {
+		return `"` + strconv.FormatInt(u.Version, 10) + `"`, nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// STRICT_CONCURRENCY=true makes If-Match mandatory on PUT
+var strictConcurrency = os.Getenv("STRICT_CONCURRENCY") == "true"
+
+// ifMatchVersion reads the version out of an If-Match header. nil means the update
+// is unconditional, "*" only requires the user to exist which UpdateUser checks anyway.
+func ifMatchVersion(req events.APIGatewayProxyRequest) (*int64, error) {
+
+	ifMatch := strings.TrimSpace(headerValue(req, "If-Match"))
+	if len(ifMatch) == 0 {
+		if strictConcurrency {
+			return nil, errors.New(ErrorPreconditionRequired)
+		}
+		return nil, nil
+	}
+	if ifMatch == "*" {
+		return nil, nil
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 64)
+	if err != nil || version < 0 {
+		// a tag we never handed out can't match the stored version
+		return nil, errors.New(user.ErrorVersionMismatch)
+	}
+	return &version, nil
+
+}
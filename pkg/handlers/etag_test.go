@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestETagMatches(t *testing.T) {
+
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{`"1", "3"`, true},
+		{`"1",W/"3"`, true},
+		{`*`, true},
+		{`"4"`, false},
+		{`3`, false},
+		{``, false},
+		{`"33"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ifNoneMatch, func(t *testing.T) {
+			if got := etagMatches(tt.ifNoneMatch, `"3"`); got != tt.want {
+				t.Errorf("etagMatches(%s) = %t, want %t", tt.ifNoneMatch, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestWithETag(t *testing.T) {
+
+	jane := &user.User{Email: "jane@example.com", Version: 3}
+	tests := []struct {
+		name        string
+		method      string
+		status      int
+		ifNoneMatch string
+		data        interface{}
+		wantStatus  int
+		wantETag    string
+	}{
+		{name: "user", method: http.MethodGet, status: http.StatusOK, data: jane, wantStatus: http.StatusOK, wantETag: `"3"`},
+		{name: "user not modified", method: http.MethodGet, status: http.StatusOK, ifNoneMatch: `"3"`, data: jane, wantStatus: http.StatusNotModified, wantETag: `"3"`},
+		{name: "user modified", method: http.MethodGet, status: http.StatusOK, ifNoneMatch: `"2"`, data: jane, wantStatus: http.StatusOK, wantETag: `"3"`},
+		{name: "hash of anything else", method: http.MethodGet, status: http.StatusOK, data: map[string]int{"count": 1}, wantStatus: http.StatusOK, wantETag: `"6aea6dfe6561984cdc5c54ead84d47d2cf29e48253ae282aef237404adad4661"`},
+		{name: "not a GET", method: http.MethodPut, status: http.StatusOK, ifNoneMatch: `"3"`, data: jane, wantStatus: http.StatusOK},
+		{name: "not a 200", method: http.MethodGet, status: http.StatusCreated, data: jane, wantStatus: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{HTTPMethod: tt.method, Headers: map[string]string{"If-None-Match": tt.ifNoneMatch}}
+			resp, _ := apiResponse(context.Background(), tt.status, tt.data)
+			resp = withETag(req, tt.data, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.Headers["ETag"] != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", resp.Headers["ETag"], tt.wantETag)
+			}
+			if tt.wantStatus == http.StatusNotModified && len(resp.Body) > 0 {
+				t.Errorf("304 with body %s", resp.Body)
+			}
+		})
+	}
+
+}
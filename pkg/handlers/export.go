@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Rahul-71/go-serverless/pkg/export"
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrorExportTooLarge = "export too large, narrow it down with filters"
+
+// Lambda responses are capped at 6 MB, stay well below that by default
+var exportMaxBytes = envInt("EXPORT_MAX_BYTES", 5*1024*1024)
+
+var errExportTooLarge = errors.New(ErrorExportTooLarge)
+
+// EXPORT_BUCKET and EXPORT_PREFIX are where POST /users/export-s3 puts the dumps
+var s3Export = export.OptionsFromEnv()
+
+// ExportUsers returns every user, optionally filtered by ?firstName= / ?lastName= / ?status=, as CSV
+func ExportUsers(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	filters := map[string]string{}
+	for _, field := range []string{"firstName", "lastName", "status"} {
+		if value := req.QueryStringParameters[field]; len(value) > 0 {
+			filters[field] = value
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"email", "firstName", "lastName"})
+
+	done := metrics.Time(ctx, "ScanAll")
+	err = user.ScanAll(ctx, filters, tenant, tableName, dynaClient, func(u user.User) error {
+		w.Write([]string{u.Email, u.FirstName, u.LastName})
+		w.Flush()
+		if buf.Len() > exportMaxBytes {
+			return errExportTooLarge
+		}
+		return nil
+	})
+	done()
+	if err == errExportTooLarge {
+		return errorResponse(ctx, req, errors.New(ErrorExportTooLarge))
+	}
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	resp, err := rawResponse(http.StatusOK, "text/csv; charset=utf-8", buf.String())
+	resp.Headers["Content-Disposition"] = fmt.Sprintf("attachment; filename=%q", tableName+".csv")
+	return resp, err
+
+}
+
+// ExportUsersS3 writes every user to a new NDJSON object in EXPORT_BUCKET and answers
+// with its key and the number of users. It's for admins only, also with RBAC off.
+// Tables too large to scan before the API Gateway timeout need cmd/export.
+func (r *Router) ExportUsersS3(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if !callerFromRequest(req).Admin {
+		return errorResponse(ctx, req, fmt.Errorf("%s: admins only", ErrorForbidden))
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	result, err := export.ToS3(ctx, s3Export, tenant, tableName, dynaClient, r.s3Client)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	return successResponse(ctx, req, http.StatusCreated, result)
+
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// fakeDynamo answers the calls a test sets a func for. Item, batch and transaction calls
+// without one find nothing, other calls panic on the nil DynamoDBAPI.
+type fakeDynamo struct {
+	user.DynamoDBAPI
+	getItem    func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	putItem    func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	updateItem func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
+	deleteItem func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+	query      func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	scan       func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
+
+	batchGetItem       func(*dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error)
+	batchWriteItem     func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	transactWriteItems func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+func (f *fakeDynamo) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if f.getItem == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return f.getItem(input)
+}
+
+func (f *fakeDynamo) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if f.putItem == nil {
+		return &dynamodb.PutItemOutput{}, nil
+	}
+	return f.putItem(input)
+}
+
+func (f *fakeDynamo) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if f.updateItem == nil {
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+	return f.updateItem(input)
+}
+
+func (f *fakeDynamo) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if f.deleteItem == nil {
+		return &dynamodb.DeleteItemOutput{}, nil
+	}
+	return f.deleteItem(input)
+}
+
+func (f *fakeDynamo) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if f.query == nil {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	return f.query(input)
+}
+
+func (f *fakeDynamo) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if f.scan == nil {
+		return &dynamodb.ScanOutput{}, nil
+	}
+	return f.scan(input)
+}
+
+func (f *fakeDynamo) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	if f.batchGetItem == nil {
+		return &dynamodb.BatchGetItemOutput{}, nil
+	}
+	return f.batchGetItem(input)
+}
+
+func (f *fakeDynamo) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if f.batchWriteItem == nil {
+		return &dynamodb.BatchWriteItemOutput{}, nil
+	}
+	return f.batchWriteItem(input)
+}
+
+func (f *fakeDynamo) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if f.transactWriteItems == nil {
+		return &dynamodb.TransactWriteItemsOutput{}, nil
+	}
+	return f.transactWriteItems(input)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// DispatchFunctionURL is the entrypoint when the function is invoked through a Lambda
+// Function URL. There is no API Gateway resource, so the route is resolved from the raw path.
+func (r *Router) DispatchFunctionURL(ctx context.Context, req events.LambdaFunctionURLRequest) (*events.LambdaFunctionURLResponse, error) {
+
+	resp, err := r.Dispatch(ctx, r.FromFunctionURLRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	return ToFunctionURLResponse(resp), nil
+
+}
+
+func (r *Router) FromFunctionURLRequest(req events.LambdaFunctionURLRequest) events.APIGatewayProxyRequest {
+
+	resource, pathParams := r.matchResource(req.RawPath)
+
+	headers := map[string]string{}
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	// like HTTP APIs, function URLs hand the cookies over separately
+	if len(req.Cookies) > 0 {
+		headers["cookie"] = strings.Join(req.Cookies, "; ")
+	}
+
+	proxyReq := events.APIGatewayProxyRequest{
+		Resource:              resource,
+		Path:                  req.RawPath,
+		HTTPMethod:            req.RequestContext.HTTP.Method,
+		Headers:               headers,
+		QueryStringParameters: req.QueryStringParameters,
+		PathParameters:        pathParams,
+		Body:                  req.Body,
+		IsBase64Encoded:       req.IsBase64Encoded,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:  req.RequestContext.AccountID,
+			DomainName: req.RequestContext.DomainName,
+			RequestID:  req.RequestContext.RequestID,
+			Protocol:   req.RequestContext.HTTP.Protocol,
+			HTTPMethod: req.RequestContext.HTTP.Method,
+			APIID:      req.RequestContext.APIID,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  req.RequestContext.HTTP.SourceIP,
+				UserAgent: req.RequestContext.HTTP.UserAgent,
+			},
+		},
+	}
+
+	if len(req.QueryStringParameters) > 0 {
+		proxyReq.MultiValueQueryStringParameters = map[string][]string{}
+		for k, v := range req.QueryStringParameters {
+			proxyReq.MultiValueQueryStringParameters[k] = strings.Split(v, ",")
+		}
+	}
+
+	if auth := req.RequestContext.Authorizer; auth != nil && auth.IAM != nil {
+		proxyReq.RequestContext.Identity.AccountID = auth.IAM.AccountID
+		proxyReq.RequestContext.Identity.AccessKey = auth.IAM.AccessKey
+		proxyReq.RequestContext.Identity.Caller = auth.IAM.CallerID
+		proxyReq.RequestContext.Identity.User = auth.IAM.UserID
+		proxyReq.RequestContext.Identity.UserArn = auth.IAM.UserARN
+	}
+
+	return proxyReq
+
+}
+
+// function URL responses have no multi-value headers, repeated values get joined
+func ToFunctionURLResponse(resp *events.APIGatewayProxyResponse) *events.LambdaFunctionURLResponse {
+
+	headers := map[string]string{}
+	for k, v := range resp.Headers {
+		headers[k] = v
+	}
+
+	var cookies []string
+	for k, values := range resp.MultiValueHeaders {
+		if strings.EqualFold(k, "Set-Cookie") {
+			cookies = append(cookies, values...)
+			continue
+		}
+		headers[k] = strings.Join(values, ", ")
+	}
+
+	return &events.LambdaFunctionURLResponse{
+		StatusCode:      resp.StatusCode,
+		Headers:         headers,
+		Body:            resp.Body,
+		IsBase64Encoded: resp.IsBase64Encoded,
+		Cookies:         cookies,
+	}
+
+}
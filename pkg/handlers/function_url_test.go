@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestFromFunctionURLRequest(t *testing.T) {
+
+	r := testRouter()
+	tests := []struct {
+		name         string
+		req          events.LambdaFunctionURLRequest
+		wantResource string
+		wantParams   map[string]string
+		wantCookie   string
+		wantCaller   string
+	}{
+		{
+			name:         "escaped email",
+			req:          events.LambdaFunctionURLRequest{RawPath: "/users/foo%40bar.com"},
+			wantResource: UserResource,
+			wantParams:   map[string]string{"email": "foo@bar.com"},
+		},
+		{
+			name:         "cookies",
+			req:          events.LambdaFunctionURLRequest{RawPath: "/users", Cookies: []string{"a=1", "b=2"}},
+			wantResource: UsersResource,
+			wantParams:   map[string]string{},
+			wantCookie:   "a=1; b=2",
+		},
+		{
+			name: "iam caller",
+			req: events.LambdaFunctionURLRequest{RawPath: "/health", RequestContext: events.LambdaFunctionURLRequestContext{
+				Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::1:user/ops"}},
+			}},
+			wantResource: HealthResource,
+			wantParams:   map[string]string{},
+			wantCaller:   "arn:aws:iam::1:user/ops",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.FromFunctionURLRequest(tt.req)
+			if got.Resource != tt.wantResource || !reflect.DeepEqual(got.PathParameters, tt.wantParams) {
+				t.Errorf("resource %q %v, want %q %v", got.Resource, got.PathParameters, tt.wantResource, tt.wantParams)
+			}
+			if got.Headers["cookie"] != tt.wantCookie {
+				t.Errorf("cookie = %q, want %q", got.Headers["cookie"], tt.wantCookie)
+			}
+			if got.RequestContext.Identity.UserArn != tt.wantCaller {
+				t.Errorf("caller = %q, want %q", got.RequestContext.Identity.UserArn, tt.wantCaller)
+			}
+		})
+	}
+
+}
+
+func TestToFunctionURLResponse(t *testing.T) {
+
+	resp := ToFunctionURLResponse(&events.APIGatewayProxyResponse{
+		StatusCode:        200,
+		Headers:           map[string]string{"Content-Type": "application/json"},
+		MultiValueHeaders: map[string][]string{"Set-Cookie": {"a=1", "b=2"}, "Vary": {"Origin", "Accept-Encoding"}},
+	})
+	want := map[string]string{"Content-Type": "application/json", "Vary": "Origin, Accept-Encoding"}
+	if !reflect.DeepEqual(resp.Headers, want) || !reflect.DeepEqual(resp.Cookies, []string{"a=1", "b=2"}) {
+		t.Errorf("response = %+v", resp)
+	}
+
+}
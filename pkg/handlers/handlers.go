@@ -1,79 +1,559 @@
 package handlers
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"net/http"
+	"strings"
 
+	userevents "github.com/Rahul-71/go-serverless/pkg/events"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
 	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/Rahul-71/go-serverless/pkg/validators"
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
-var ErrorMethodNotAllowed = "method not allowed"
+var (
+	ErrorMethodNotAllowed = "method not allowed"
+
+	CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+)
+
+// how often a write that lost a race with another one is reapplied before it's a 409
+const conflictRetries = 3
 
 type ErrorBody struct {
 	ErrorMsg *string `json:"response,omitempty"`
+	Code     *string `json:"code,omitempty"`
+
+	RequestID *string `json:"requestId,omitempty"`
+}
+
+// GetUser serves a single user, a list or an export depending on the parameters.
+// Without an S3 client the avatarUrl is left out, the router uses (*Router).GetUser.
+func GetUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).GetUser(ctx, req, tableName, dynaClient)
 }
 
-func GetUser(req events.APIGatewayProxyRequest, tableName string, dynaClient dynamodbiface.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+// GetUser is GetUser with links to the avatars in the router's bucket
+func (r *Router) GetUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	// ?fields=email,firstName only reads and returns those attributes
+	var fields []string
+	if value, ok := req.QueryStringParameters["fields"]; ok {
+		if fields, err = user.ParseFields(value); err != nil {
+			return errorResponse(ctx, req, err)
+		}
+	}
+
+	// anything but a single user may only be read by admins, a single user by admins and
+	// the user itself
+	if err := authorize(req, emailParam(req)); err != nil {
+		return errorResponse(ctx, req, err)
+	}
 
-	email := req.QueryStringParameters["email"]
-	if len(email) > 0 {
-		result, _ := user.FetchUser(email, tableName, dynaClient)
+	if emails := emailsParam(req); len(emails) > 0 {
+		done := metrics.Time(ctx, "FetchUsersBatch")
+		result, err := user.FetchUsersBatch(ctx, emails, tenant, tableName, dynaClient, fields...)
+		done()
+		if err != nil {
+			return errorResponse(ctx, req, err)
+		}
+		if len(fields) > 0 {
+			return successResponse(ctx, req, http.StatusOK, map[string]interface{}{
+				"users":   selectFields(result.Users, fields),
+				"missing": result.Missing,
+			})
+		}
+		return successResponse(ctx, req, http.StatusOK, result)
+	}
 
-		// check if user exist & with correct data
-		if result != nil && len(result.Email) == 0 {
-			return apiResponse(http.StatusBadRequest, ErrorBody{aws.String(user.ErrorUserDoesNotExists)})
+	email := emailParam(req)
+	if len(email) == 0 {
+		if req.QueryStringParameters["format"] == "csv" {
+			return ExportUsers(ctx, req, tableName, dynaClient)
 		}
-		return apiResponse(http.StatusOK, result)
+		return r.listUsers(ctx, req, fields, tableName, dynaClient)
 	}
 
-	result, err := user.FetchUsers(tableName, dynaClient)
+	// the email is always read so a missing user can be told apart. ?consistent=true
+	// sees a user created or changed right before, so does Cache-Control: no-cache, both
+	// skip the cache.
+	consistent := req.QueryStringParameters["consistent"] == "true" || noCache(req)
+	ctx = user.TrackCache(ctx)
+	done := metrics.Time(ctx, "FetchUser")
+	result, err := r.userRepository(tableName, dynaClient).Get(ctx, email, tenant, consistent, withField(fields, "email")...)
+	done()
 	if err != nil {
-		return apiResponse(http.StatusBadRequest, ErrorBody{aws.String(err.Error())})
+		return errorResponse(ctx, req, err)
+	}
+	r.withAvatarURL(ctx, result)
+	resp, err := successResponse(ctx, req, http.StatusOK, withUserLinks(req, selectFields(result, fields), result.Email))
+	if resp != nil && user.ServedFromCache(ctx) {
+		resp.Headers["X-Cache"] = "HIT"
 	}
-	return apiResponse(http.StatusOK, result)
+	return resp, err
 
 }
 
-func CreateUser(req events.APIGatewayProxyRequest, tableName string, dynaClient dynamodbiface.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+// CountUsers returns {"count": N}, optionally only counting users matching ?lastName= / ?firstName= / ?status=
+// or the filters of listFilters
+func CountUsers(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
 
-	result, err := user.CreateUser(req, tableName, dynaClient)
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	filters, err := listFilters(req)
 	if err != nil {
-		return apiResponse(http.StatusBadRequest, ErrorBody{
-			aws.String(err.Error()),
-		})
+		return errorResponse(ctx, req, err)
+	}
+	for _, field := range []string{"firstName", "lastName"} {
+		if value := req.QueryStringParameters[field]; len(value) > 0 {
+			filters[field] = value
+		}
 	}
-	return apiResponse(http.StatusCreated, result)
+
+	done := metrics.Time(ctx, "CountUsers")
+	count, err := user.CountUsers(ctx, filters, tenant, tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	return successResponse(ctx, req, http.StatusOK, map[string]int64{"count": count})
 
 }
 
-func UpdateUser(req events.APIGatewayProxyRequest, tableName string, dynaClient dynamodbiface.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+// HeadUser answers whether a user exists without sending the record back
+func HeadUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).HeadUser(ctx, req, tableName, dynaClient)
+}
+
+// HeadUser is HeadUser with the router's repository
+func (r *Router) HeadUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	email := emailParam(req)
+	tenant, err := user.TenantFromRequest(req)
+	if len(email) == 0 || err != nil {
+		return emptyResponse(http.StatusBadRequest)
+	}
+	if err := authorize(req, email); err != nil {
+		return emptyResponse(http.StatusForbidden)
+	}
 
-	result, err := user.UpdateUser(req, tableName, dynaClient)
+	done := metrics.Time(ctx, "FetchUser")
+	_, err = r.userRepository(tableName, dynaClient).Get(ctx, email, tenant, false, "email")
+	done()
 	if err != nil {
-		return apiResponse(http.StatusBadRequest, ErrorBody{aws.String(err.Error())})
+		return emptyResponse(mapError(err).status)
 	}
+	return emptyResponse(http.StatusOK)
+
+}
+
+func CreateUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).CreateUser(ctx, req, tableName, dynaClient)
+}
 
-	return apiResponse(http.StatusOK, result)
+// CreateUser is CreateUser with the router's repository
+func (r *Router) CreateUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := authorizeAdminFields(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "CreateUser")
+	result, err := r.userRepository(tableName, dynaClient).Create(ctx, req)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	r.publishChange(ctx, req, userevents.TypeUserCreated, result, nil)
+	r.sendWelcomeEmail(ctx, result)
+
+	resp, err := successResponse(ctx, req, http.StatusCreated, withUserLinks(req, result, result.Email))
+	resp.Headers["Location"] = userURL(req, result.Email)
+	return resp, err
+
+}
 
+func CreateUsers(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).CreateUsers(ctx, req, tableName, dynaClient)
 }
 
-func DeleteUser(req events.APIGatewayProxyRequest, tableName string, dynaClient dynamodbiface.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+// CreateUsers stores a JSON array of users in one go. The response has one result per
+// user and is a 207 as soon as any of them wasn't created.
+func (r *Router) CreateUsers(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
 
-	email := req.QueryStringParameters["email"]
-	if len(email) > 0 {
-		if res, err := user.FetchUser(email, tableName, dynaClient); err != nil || len(res.FirstName) == 0 {
-			return apiResponse(http.StatusBadRequest, ErrorBody{aws.String(user.ErrorUserDoesNotExists)})
-		} else if err := user.DeleteUser(req, tableName, dynaClient); err != nil {
-			return apiResponse(http.StatusBadRequest, ErrorBody{aws.String(err.Error())})
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	var users []user.User
+	if err := user.Decode(req.Body, &users); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "CreateUsers")
+	results, err := user.CreateUsers(ctx, users, tenant, user.CallerIdentity(req), tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	r.publishChanges(ctx, req, userevents.TypeUserCreated, createdEmails(results), tenant)
+
+	status := http.StatusCreated
+	for _, result := range results {
+		if result.Status != user.BatchStatusCreated {
+			status = http.StatusMultiStatus
+			break
 		}
 	}
-	return apiResponse(http.StatusOK, ErrorBody{aws.String(fmt.Sprintf("%v successfully deleted", email))})
+	return listResponse(ctx, req, status, results, len(results))
+
+}
+
+func UpdateUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).UpdateUser(ctx, req, tableName, dynaClient)
+}
+
+// UpdateUser is UpdateUser with the router's repository
+func (r *Router) UpdateUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, emailParam(req)); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := authorizeAdminFields(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	// If-Match makes the update conditional on the version the client last saw
+	expectedVersion, err := ifMatchVersion(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	// ?upsert=true creates the user when it doesn't exist yet, PUT is a 404 otherwise
+	upsert := req.QueryStringParameters["upsert"] == "true"
+
+	// without If-Match the client wants its PUT applied, a concurrent write is retried
+	var result, previous *user.User
+	err = user.RetryOnConflict(conflictRetries, func() error {
+		var err error
+		done := metrics.Time(ctx, "UpdateUser")
+		result, previous, err = r.userRepository(tableName, dynaClient).Update(ctx, req, expectedVersion, upsert)
+		done()
+		return err
+	})
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	if previous == nil {
+		r.publishChange(ctx, req, userevents.TypeUserCreated, result, nil)
+		resp, err := successResponse(ctx, req, http.StatusCreated, withUserLinks(req, result, result.Email))
+		resp.Headers["Location"] = userURL(req, result.Email)
+		return resp, err
+	}
+
+	// the names of the fields only, for the audit trail in CloudWatch
+	changed := user.ChangedFields(previous, result)
+	if len(changed) > 0 {
+		logging.FromContext(ctx).InfoContext(ctx, "user updated", "changed", changed)
+	} else {
+		logging.FromContext(ctx).InfoContext(ctx, "user unchanged")
+	}
+	r.publishChange(ctx, req, userevents.TypeUserUpdated, result, changed)
+
+	// ?includePrevious=true adds the user as it was before to the response
+	if req.QueryStringParameters["includePrevious"] == "true" {
+		return successResponse(ctx, req, http.StatusOK, withPrevious(withUserLinks(req, result, result.Email), previous))
+	}
+	return successResponse(ctx, req, http.StatusOK, withUserLinks(req, result, result.Email))
+
+}
+
+func PatchUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).PatchUser(ctx, req, tableName, dynaClient)
+}
+
+// PatchUser is PatchUser with the router's change events
+func (r *Router) PatchUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, emailParam(req)); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := authorizeAdminFields(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	// a patch only sets the fields it carries, so it can be reapplied after a concurrent write
+	var result *user.User
+	err = user.RetryOnConflict(conflictRetries, func() error {
+		var err error
+		done := metrics.Time(ctx, "PatchUser")
+		result, err = user.PatchUser(ctx, req, tableName, dynaClient)
+		done()
+		return err
+	})
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	r.publishChange(ctx, req, userevents.TypeUserUpdated, result, patchedFields(req.Body))
+
+	return successResponse(ctx, req, http.StatusOK, withUserLinks(req, result, result.Email))
+
+}
+
+func DeleteUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).DeleteUser(ctx, req, tableName, dynaClient)
+}
+
+// DeleteUser is DeleteUser with the router's repository
+func (r *Router) DeleteUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, emailParam(req)); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	// {"ifMatch": {...}} or X-Condition only deletes the user while it's still as expected
+	conditions, err := user.DeleteConditions(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "DeleteUser")
+	result, err := r.userRepository(tableName, dynaClient).Delete(ctx, emailParam(req), tenant, conditions)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	r.publishChange(ctx, req, userevents.TypeUserDeleted, result, nil)
+	return successResponse(ctx, req, http.StatusOK, result)
+
+}
+
+func VerifyEmail(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).VerifyEmail(ctx, req, tableName, dynaClient)
+}
+
+// VerifyEmail is where the link in the verification email points, ?token= is the
+// token handed out when the user was created
+func (r *Router) VerifyEmail(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	done := metrics.Time(ctx, "VerifyEmail")
+	result, err := user.VerifyEmail(ctx, req.QueryStringParameters["token"], user.CallerIdentity(req), tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	r.publishChange(ctx, req, userevents.TypeUserUpdated, result, []string{"verified"})
+	return successResponse(ctx, req, http.StatusOK, result)
+
+}
+
+func ChangeEmail(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).ChangeEmail(ctx, req, tableName, dynaClient)
+}
+
+// ChangeEmail moves a user to the {"newEmail": "..."} of the body. The moved user is
+// returned with its new location.
+func (r *Router) ChangeEmail(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, emailParam(req)); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	var body struct {
+		NewEmail string `json:"newEmail"`
+	}
+	if err := user.Decode(req.Body, &body); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "ChangeEmail")
+	result, err := user.ChangeEmail(ctx, emailParam(req), body.NewEmail, tenant, user.CallerIdentity(req), tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	// the user under the old email is gone, the event says where it went
+	r.publish(ctx, userevents.TypeUserUpdated, []userevents.Change{{
+		Email:         result.Email,
+		PreviousEmail: validators.NormalizeEmail(emailParam(req)),
+		TenantID:      result.TenantID,
+		Changed:       []string{"email", "verified"},
+		RequestID:     requestID(req),
+	}})
+	resp, err := successResponse(ctx, req, http.StatusOK, withUserLinks(req, result, result.Email))
+	resp.Headers["Location"] = userURL(req, result.Email)
+	return resp, err
+
+}
+
+func ActivateUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).ActivateUser(ctx, req, tableName, dynaClient)
+}
+
+// ActivateUser sets the status of a suspended user back to active
+func (r *Router) ActivateUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	// users don't get to lift their own suspension
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "SetStatus")
+	result, err := user.SetStatus(ctx, emailParam(req), user.StatusActive, tenant, user.CallerIdentity(req), tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	r.publishChange(ctx, req, userevents.TypeUserUpdated, result, []string{"status"})
+	return successResponse(ctx, req, http.StatusOK, withUserLinks(req, result, result.Email))
+
+}
+
+func DeactivateUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).DeactivateUser(ctx, req, tableName, dynaClient)
 }
 
-func UnhandeledMethod() (*events.APIGatewayProxyResponse, error) {
-	return apiResponse(http.StatusMethodNotAllowed, ErrorMethodNotAllowed)
+// DeactivateUser suspends a user without deleting the record
+func (r *Router) DeactivateUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "SetStatus")
+	result, err := user.SetStatus(ctx, emailParam(req), user.StatusSuspended, tenant, user.CallerIdentity(req), tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	r.publishChange(ctx, req, userevents.TypeUserUpdated, result, []string{"status"})
+	return successResponse(ctx, req, http.StatusOK, withUserLinks(req, result, result.Email))
+
+}
+
+// MethodNotAllowed tells the client which methods the resource does support
+func MethodNotAllowed(ctx context.Context, req events.APIGatewayProxyRequest, allowed []string) (*events.APIGatewayProxyResponse, error) {
+
+	resp, err := errorResponse(ctx, req, errors.New(ErrorMethodNotAllowed))
+	resp.Headers["Allow"] = strings.Join(allowed, ", ")
+	return resp, err
+
+}
+
+func DeleteUsers(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).DeleteUsers(ctx, req, tableName, dynaClient)
+}
+
+// DeleteUsers removes every user listed in a {"emails": [...]} body
+func (r *Router) DeleteUsers(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	var body struct {
+		Emails []string `json:"emails"`
+	}
+	if err := user.Decode(req.Body, &body); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "DeleteUsers")
+	result, err := user.DeleteUsers(ctx, body.Emails, tenant, tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	r.publishChanges(ctx, req, userevents.TypeUserDeleted, result.Deleted, tenant)
+
+	status := http.StatusOK
+	if len(result.Failed) > 0 {
+		status = http.StatusMultiStatus
+	}
+	return successResponse(ctx, req, status, result)
 
 }
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func storedUser(t *testing.T, u user.User) map[string]types.AttributeValue {
+	t.Helper()
+	u.SchemaVersion = user.CurrentSchemaVersion
+	item, err := attributevalue.MarshalMap(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func TestGetUser(t *testing.T) {
+
+	defer func(enabled bool) { envelopeEnabled = enabled }(envelopeEnabled)
+	envelopeEnabled = true
+
+	tests := []struct {
+		name       string
+		email      string
+		item       map[string]types.AttributeValue
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "found", email: "found@example.com", item: storedUser(t, user.User{Email: "found@example.com", FirstName: "Jane"}), wantStatus: http.StatusOK},
+		{name: "missing", email: "missing@example.com", wantStatus: http.StatusNotFound, wantCode: "USER_NOT_FOUND"},
+		{name: "no such email", email: "nobody", wantStatus: http.StatusNotFound, wantCode: "USER_NOT_FOUND"},
+		{name: "failure", email: "failing@example.com", err: &types.InternalServerError{}, wantStatus: http.StatusInternalServerError, wantCode: "FETCH_FAILED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDynamo{getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{Item: tt.item}, tt.err
+			}}
+			req := events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Resource: UserResource, PathParameters: map[string]string{"email": tt.email}}
+
+			resp, err := GetUser(context.Background(), req, "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if len(tt.wantCode) == 0 {
+				var got struct {
+					Data user.User `json:"data"`
+				}
+				if err := json.Unmarshal([]byte(resp.Body), &got); err != nil || got.Data.Email != tt.email || got.Data.FirstName != "Jane" {
+					t.Errorf("body = %s", resp.Body)
+				}
+				return
+			}
+			var problem Problem
+			if err := json.Unmarshal([]byte(resp.Body), &problem); err != nil || problem.Code != tt.wantCode {
+				t.Errorf("body = %s, want code %s", resp.Body, tt.wantCode)
+			}
+		})
+	}
+
+}
+
+func TestCreateUser(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		existing   map[string]types.AttributeValue
+		putErr     error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "created", wantStatus: http.StatusCreated},
+		{name: "exists", existing: storedUser(t, user.User{Email: "jane@example.com"}), wantStatus: http.StatusConflict, wantCode: "USER_ALREADY_EXISTS"},
+		{name: "created concurrently", putErr: &types.ConditionalCheckFailedException{}, wantStatus: http.StatusConflict, wantCode: "USER_ALREADY_EXISTS"},
+		{name: "put fails", putErr: &types.InternalServerError{}, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			puts := 0
+			client := &fakeDynamo{
+				getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+					return &dynamodb.GetItemOutput{Item: tt.existing}, nil
+				},
+				putItem: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+					puts++
+					return &dynamodb.PutItemOutput{}, tt.putErr
+				},
+			}
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Resource:   UsersResource,
+				Headers:    map[string]string{"Content-Type": "application/json"},
+				Body:       `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"}`,
+			}
+
+			resp, err := CreateUser(context.Background(), req, "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.existing != nil && puts > 0 {
+				t.Errorf("an existing user is written")
+			}
+			if tt.wantStatus == http.StatusCreated && resp.Headers["Location"] != "/users/jane@example.com" {
+				t.Errorf("Location = %q", resp.Headers["Location"])
+			}
+			if len(tt.wantCode) > 0 {
+				var problem Problem
+				if err := json.Unmarshal([]byte(resp.Body), &problem); err != nil || problem.Code != tt.wantCode {
+					t.Errorf("body = %s, want code %s", resp.Body, tt.wantCode)
+				}
+			}
+		})
+	}
+
+}
+
+func TestGetUserConsistent(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		query map[string]string
+		want  bool
+	}{
+		{"default", nil, false},
+		{"consistent", map[string]string{"consistent": "true"}, true},
+		{"not true", map[string]string{"consistent": "yes"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input *dynamodb.GetItemInput
+			client := &fakeDynamo{getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				input = in
+				return &dynamodb.GetItemOutput{Item: storedUser(t, user.User{Email: "jane@example.com"})}, nil
+			}}
+			req := events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Resource: UserResource, PathParameters: map[string]string{"email": "jane@example.com"}, QueryStringParameters: tt.query}
+
+			resp, err := GetUser(context.Background(), req, "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d: %s", resp.StatusCode, resp.Body)
+			}
+			if got := input.ConsistentRead != nil && *input.ConsistentRead; got != tt.want {
+				t.Errorf("ConsistentRead = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const (
+	healthTimeout  = 2 * time.Second
+	healthCacheTTL = 30 * time.Second
+)
+
+type HealthStatus struct {
+	Status    string `json:"status"`
+	Table     string `json:"table"`
+	ItemCount *int64 `json:"itemCount,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// probes come in every few seconds, the DescribeTable result is reused for a while
+var healthCache struct {
+	sync.Mutex
+	status    HealthStatus
+	code      int
+	checkedAt time.Time
+}
+
+// Health reports whether the table can be reached
+func Health(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	healthCache.Lock()
+	defer healthCache.Unlock()
+
+	if time.Since(healthCache.checkedAt) > healthCacheTTL || healthCache.status.Table != tableName {
+		healthCache.status, healthCache.code = checkHealth(ctx, tableName, dynaClient)
+		healthCache.checkedAt = time.Now()
+	}
+
+	resp, err := apiResponse(ctx, healthCache.code, healthCache.status)
+	// the result is cached here anyway, probes may cache it just as long
+	return withHeaders(resp, map[string]string{"Cache-Control": "public, max-age=30"}), err
+
+}
+
+func checkHealth(ctx context.Context, tableName string, dynaClient user.DynamoDBAPI) (HealthStatus, int) {
+
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	result, err := dynaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return HealthStatus{Status: "unavailable", Table: tableName, Reason: err.Error()}, http.StatusServiceUnavailable
+	}
+
+	return HealthStatus{
+		Status:    "ok",
+		Table:     tableName,
+		ItemCount: aws.Int64(aws.ToInt64(result.Table.ItemCount)),
+	}, http.StatusOK
+
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+
+	"github.com/Rahul-71/go-serverless/pkg/idempotency"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// IDEMPOTENCY_TABLE names the table Idempotency-Keys are stored in, keyed by "key" with
+// TTL on expiresAt. Without it the header is ignored.
+var idempotencyTable = os.Getenv("IDEMPOTENCY_TABLE")
+
+// withIdempotency runs next at most once per Idempotency-Key. A retry with the same key
+// and body gets the stored response with Idempotent-Replayed: true, the same key with a
+// different body is a 422.
+func withIdempotency(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+		key := headerValue(req, "Idempotency-Key")
+		if len(key) == 0 || len(idempotencyTable) == 0 {
+			return next(ctx, req, tableName, dynaClient)
+		}
+		// keys are picked by clients, one tenant mustn't get another tenant's response
+		if tenant, err := user.TenantFromRequest(req); err == nil && len(tenant) > 0 {
+			key = tenant + "#" + key
+		}
+
+		hash := requestHash(req)
+		stored, err := idempotency.Acquire(ctx, key, hash, idempotencyTable, dynaClient)
+		if err != nil {
+			return errorResponse(ctx, req, err)
+		}
+		if stored != nil {
+			resp := &events.APIGatewayProxyResponse{
+				StatusCode:      stored.StatusCode,
+				Headers:         stored.Headers,
+				Body:            stored.Body,
+				IsBase64Encoded: stored.IsBase64Encoded,
+			}
+			if resp.Headers == nil {
+				resp.Headers = map[string]string{}
+			}
+			resp.Headers["Idempotent-Replayed"] = "true"
+			return resp, nil
+		}
+
+		resp, err := next(ctx, req, tableName, dynaClient)
+
+		// server errors may well succeed on a retry, so they aren't remembered
+		if err != nil || resp == nil || resp.StatusCode >= http.StatusInternalServerError {
+			if releaseErr := idempotency.Release(ctx, key, idempotencyTable, dynaClient); releaseErr != nil {
+				logging.FromContext(ctx).WarnContext(ctx, "releasing idempotency key failed", "idempotencyKey", key, logging.Err(releaseErr))
+			}
+			return resp, err
+		}
+
+		record := idempotency.Record{
+			Key:             key,
+			RequestHash:     hash,
+			StatusCode:      resp.StatusCode,
+			Headers:         resp.Headers,
+			Body:            resp.Body,
+			IsBase64Encoded: resp.IsBase64Encoded,
+		}
+		if err := idempotency.Complete(ctx, record, idempotencyTable, dynaClient); err != nil {
+			// the request did run, the client should still get its response
+			logging.FromContext(ctx).WarnContext(ctx, "completing idempotency key failed", "idempotencyKey", key, logging.Err(err))
+		}
+		return resp, nil
+
+	}
+}
+
+// requestHash identifies what was asked for, a key may only be reused for the same request
+func requestHash(req events.APIGatewayProxyRequest) string {
+	sum := sha256.Sum256([]byte(req.HTTPMethod + " " + req.Resource + " " + emailParam(req) + "\n" + req.Body))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	userevents "github.com/Rahul-71/go-serverless/pkg/events"
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var (
+	ErrorInvalidCSV    = "invalid csv"
+	ErrorImportWriting = "could not write row"
+)
+
+type ImportFailure struct {
+	Line   int    `json:"line"`
+	Email  string `json:"email,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type ImportResult struct {
+	Imported int             `json:"imported"`
+	Skipped  int             `json:"skipped"`
+	Failed   int             `json:"failed"`
+	Failures []ImportFailure `json:"failures"`
+}
+
+func ImportUsers(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return (&Router{}).ImportUsers(ctx, req, tableName, dynaClient)
+}
+
+// ImportUsers reads email,firstName,lastName rows from a text/csv body. Existing and
+// repeated emails are skipped, the rest is written with BatchWriteItem.
+func (r *Router) ImportUsers(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	result := ImportResult{Failures: []ImportFailure{}}
+
+	reader := csv.NewReader(strings.NewReader(req.Body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var users []user.User
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			result.Failed++
+			result.Failures = append(result.Failures, ImportFailure{Line: perr.StartLine, Reason: ErrorInvalidCSV})
+			continue
+		} else if err != nil {
+			return errorResponse(ctx, req, errors.New(ErrorInvalidCSV))
+		}
+
+		// the header row is optional
+		if line == 1 && strings.EqualFold(record[0], "email") {
+			continue
+		}
+
+		if len(record) != 3 {
+			result.Failed++
+			result.Failures = append(result.Failures, ImportFailure{Line: line, Email: record[0], Reason: ErrorInvalidCSV})
+			continue
+		}
+
+		users = append(users, user.User{Email: record[0], FirstName: record[1], LastName: record[2]})
+		lines = append(lines, line)
+	}
+
+	if len(users) == 0 && result.Failed == 0 {
+		return errorResponse(ctx, req, errors.New(user.ErrorEmptyBatch))
+	}
+
+	if len(users) > 0 {
+		tenant, err := user.TenantFromRequest(req)
+		if err != nil {
+			return errorResponse(ctx, req, err)
+		}
+		done := metrics.Time(ctx, "CreateUsers")
+		statuses, err := user.CreateUsers(ctx, users, tenant, user.CallerIdentity(req), tableName, dynaClient)
+		done()
+		if err != nil {
+			return errorResponse(ctx, req, err)
+		}
+		r.publishChanges(ctx, req, userevents.TypeUserCreated, createdEmails(statuses), tenant)
+
+		for i, s := range statuses {
+			switch s.Status {
+			case user.BatchStatusCreated:
+				result.Imported++
+			case user.BatchStatusAlreadyExists:
+				result.Skipped++
+			case user.BatchStatusInvalid:
+				result.Failed++
+				result.Failures = append(result.Failures, ImportFailure{Line: lines[i], Email: s.Email, Reason: user.ErrorInvalidEmail})
+			default:
+				result.Failed++
+				result.Failures = append(result.Failures, ImportFailure{Line: lines[i], Email: s.Email, Reason: ErrorImportWriting})
+			}
+		}
+	}
+
+	status := http.StatusOK
+	if result.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	return successResponse(ctx, req, status, result)
+
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/auth"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// JWT_ISSUER makes the function validate Authorization: Bearer tokens itself, for
+// Function URLs and everything else without an authorizer in front. Tokens need an aud,
+// or a client_id, out of the comma separated JWT_AUDIENCE. The keys come from
+// JWT_JWKS_URL, the issuer's /.well-known/jwks.json by default, and are read again
+// after JWKS_CACHE_TTL_MS.
+var bearerTokens = newBearerVerifier()
+
+func newBearerVerifier() *auth.Verifier {
+
+	issuer := os.Getenv("JWT_ISSUER")
+	if len(issuer) == 0 {
+		return nil
+	}
+	var audiences []string
+	for _, aud := range strings.Split(os.Getenv("JWT_AUDIENCE"), ",") {
+		if aud = strings.TrimSpace(aud); len(aud) > 0 {
+			audiences = append(audiences, aud)
+		}
+	}
+	v := auth.NewVerifier(issuer, audiences)
+	v.JWKSURL = os.Getenv("JWT_JWKS_URL")
+	v.TTL = time.Duration(envInt("JWKS_CACHE_TTL_MS", 3600000)) * time.Millisecond
+	return v
+
+}
+
+// authenticateBearer validates the bearer token of the request and puts its claims in
+// the authorizer context, under "claims" like a Cognito authorizer does, so authorize
+// and the tenant lookup work the same either way. Requests an authorizer already named
+// the caller of, and requests without a bearer token, are returned as they are. A
+// verifier that can't read the keys is a 503, not a 401: it's not the client's fault.
+func authenticateBearer(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyRequest, error) {
+
+	if bearerTokens == nil || callerFromRequest(req).Authenticated() {
+		return req, nil
+	}
+	scheme, token, _ := strings.Cut(headerValue(req, "Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || len(strings.TrimSpace(token)) == 0 {
+		return req, nil
+	}
+
+	claims, err := bearerTokens.Verify(ctx, strings.TrimSpace(token))
+	if err != nil {
+		if strings.HasPrefix(err.Error(), auth.ErrorKeysUnavailable) {
+			return req, flatten(ctx, auth.ErrorKeysUnavailable, err)
+		}
+		return req, err
+	}
+	req.RequestContext.Authorizer = map[string]interface{}{"claims": claims}
+	return req, nil
+
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/auth"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAuthenticateBearerStatus(t *testing.T) {
+
+	defer func(v *auth.Verifier) { bearerTokens = v }(bearerTokens)
+
+	// a token that gets as far as the keys
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"k1"}`))
+	token := header + ".e30." + base64.RawURLEncoding.EncodeToString([]byte("signature"))
+
+	tests := []struct {
+		name       string
+		token      string
+		jwks       http.HandlerFunc
+		wantStatus int
+	}{
+		{name: "keys unreachable", token: token, wantStatus: http.StatusServiceUnavailable},
+		{name: "keys failing", token: token, jwks: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) }, wantStatus: http.StatusServiceUnavailable},
+		{name: "unknown key", token: token, jwks: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"keys":[]}`)) }, wantStatus: http.StatusUnauthorized},
+		{name: "not a JWT", token: "garbage", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.jwks)
+			defer server.Close()
+			bearerTokens = auth.NewVerifier("https://issuer.example.com", []string{"app"})
+			bearerTokens.JWKSURL = server.URL
+			if tt.jwks == nil {
+				server.Close()
+			}
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodGet,
+				Resource:       UserResource,
+				PathParameters: map[string]string{"email": "jane@example.com"},
+				Headers:        map[string]string{"Authorization": "Bearer " + tt.token},
+			}
+			resp, err := testRouter().Dispatch(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// INCLUDE_LINKS=true adds _links to responses without the client asking for ?include=links
+var linksDefault = os.Getenv("INCLUDE_LINKS") == "true"
+
+type Link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"`
+}
+
+type Links map[string]Link
+
+// linked is data sent together with its _links. Objects get the links as an extra
+// _links key, anything else is sent as is. ETags are computed from data alone.
+type linked struct {
+	data  interface{}
+	links Links
+}
+
+func (l linked) MarshalJSON() ([]byte, error) {
+
+	raw, err := json.Marshal(l.data)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil || object == nil {
+		return raw, nil
+	}
+
+	links, err := json.Marshal(l.links)
+	if err != nil {
+		return nil, err
+	}
+	object["_links"] = links
+	return json.Marshal(object)
+
+}
+
+// previousData is an updated user sent together with what it overwrote, as an extra
+// previous key like _links
+type previousData struct {
+	data     interface{}
+	previous interface{}
+}
+
+func withPrevious(data, previous interface{}) previousData {
+	return previousData{data: data, previous: previous}
+}
+
+func (p previousData) MarshalJSON() ([]byte, error) {
+
+	raw, err := json.Marshal(p.data)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil || object == nil {
+		return raw, nil
+	}
+
+	previous, err := json.Marshal(p.previous)
+	if err != nil {
+		return nil, err
+	}
+	object["previous"] = previous
+	return json.Marshal(object)
+
+}
+
+// linksRequested is true for ?include=links, include takes a comma separated list
+func linksRequested(req events.APIGatewayProxyRequest) bool {
+	include, ok := req.QueryStringParameters["include"]
+	if !ok {
+		return linksDefault
+	}
+	for _, value := range strings.Split(include, ",") {
+		if strings.TrimSpace(value) == "links" {
+			return true
+		}
+	}
+	return false
+}
+
+// withUserLinks adds self, update and delete links of a single user when requested
+func withUserLinks(req events.APIGatewayProxyRequest, data interface{}, email string) interface{} {
+	if !linksRequested(req) || len(email) == 0 {
+		return data
+	}
+
+	self := userURL(req, email)
+	return linked{data: data, links: Links{
+		"self":   {Href: self, Method: http.MethodGet},
+		"update": {Href: self, Method: http.MethodPut},
+		"delete": {Href: self, Method: http.MethodDelete},
+	}}
+}
+
+// withListLinks adds self, and for pages next and first, to a list when requested.
+// Cursors only go forward, first is how a client gets back to the start.
+func withListLinks(req events.APIGatewayProxyRequest, data interface{}, nextCursor string) interface{} {
+	if !linksRequested(req) {
+		return data
+	}
+
+	links := Links{"self": {Href: listURL(req, req.QueryStringParameters["cursor"])}}
+	if len(nextCursor) > 0 {
+		links["next"] = Link{Href: listURL(req, nextCursor)}
+	}
+	if len(req.QueryStringParameters["cursor"]) > 0 {
+		links["first"] = Link{Href: listURL(req, "")}
+	}
+	return linked{data: data, links: links}
+}
+
+// listURL is the current list request with its cursor replaced
+func listURL(req events.APIGatewayProxyRequest, cursor string) string {
+	query := url.Values{}
+	for k, v := range req.QueryStringParameters {
+		if k != "cursor" {
+			query.Set(k, v)
+		}
+	}
+	if len(cursor) > 0 {
+		query.Set("cursor", cursor)
+	}
+
+	href := baseURL(req) + UsersResource
+	if encoded := query.Encode(); len(encoded) > 0 {
+		href += "?" + encoded
+	}
+	return href
+}
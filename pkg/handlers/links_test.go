@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestLinksRequested(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		include string
+		set     bool
+		def     bool
+		want    bool
+	}{
+		{name: "not asked", want: false},
+		{name: "not asked, on by default", def: true, want: true},
+		{name: "links", include: "links", set: true, want: true},
+		{name: "in a list", include: "previous, links", set: true, want: true},
+		{name: "something else", include: "previous", set: true, def: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(def bool) { linksDefault = def }(linksDefault)
+			linksDefault = tt.def
+
+			req := events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{}}
+			if tt.set {
+				req.QueryStringParameters["include"] = tt.include
+			}
+			if got := linksRequested(req); got != tt.want {
+				t.Errorf("linksRequested = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestUserURL(t *testing.T) {
+
+	tests := []struct {
+		name string
+		req  events.APIGatewayProxyRequest
+		want string
+	}{
+		{
+			name: "stage of execute-api",
+			req: events.APIGatewayProxyRequest{Resource: "/users/{email}", Path: "/users/jane@example.com",
+				RequestContext: events.APIGatewayProxyRequestContext{DomainName: "abc.execute-api.eu-west-1.amazonaws.com", Stage: "prod"}},
+			want: "https://abc.execute-api.eu-west-1.amazonaws.com/prod/users/jane%2B1@example.com",
+		},
+		{
+			name: "custom domain with base path",
+			req: events.APIGatewayProxyRequest{Resource: "/users", Path: "/v1/users",
+				RequestContext: events.APIGatewayProxyRequestContext{DomainName: "api.example.com", Stage: "prod"}},
+			want: "https://api.example.com/v1/users/jane%2B1@example.com",
+		},
+		{
+			name: "no domain",
+			req:  events.APIGatewayProxyRequest{Resource: "/users", Path: "/users"},
+			want: "/users/jane%2B1@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// + is escaped, it'd be read as a space
+			if got := userURL(tt.req, "jane+1@example.com"); got != tt.want {
+				t.Errorf("userURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestWithListLinks(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		query      map[string]string
+		nextCursor string
+		want       map[string]string
+	}{
+		{
+			name:  "single page",
+			query: map[string]string{"include": "links", "limit": "10"},
+			want:  map[string]string{"self": "/users?include=links&limit=10"},
+		},
+		{
+			name:       "first page",
+			query:      map[string]string{"include": "links"},
+			nextCursor: "abc",
+			want:       map[string]string{"self": "/users?include=links", "next": "/users?cursor=abc&include=links"},
+		},
+		{
+			name:       "later page",
+			query:      map[string]string{"include": "links", "cursor": "abc"},
+			nextCursor: "def",
+			want: map[string]string{
+				"self":  "/users?cursor=abc&include=links",
+				"next":  "/users?cursor=def&include=links",
+				"first": "/users?include=links",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{Resource: "/users", Path: "/users", QueryStringParameters: tt.query}
+			raw, err := json.Marshal(withListLinks(req, map[string]interface{}{"users": []string{}}, tt.nextCursor))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body struct {
+				Users []string `json:"users"`
+				Links Links    `json:"_links"`
+			}
+			if err := json.Unmarshal(raw, &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Users == nil {
+				t.Errorf("data is lost: %s", raw)
+			}
+			if len(body.Links) != len(tt.want) {
+				t.Errorf("links = %v, want %v", body.Links, tt.want)
+			}
+			for rel, href := range tt.want {
+				if body.Links[rel].Href != href {
+					t.Errorf("%s = %q, want %q", rel, body.Links[rel].Href, href)
+				}
+			}
+		})
+	}
+
+}
+
+func TestLinked(t *testing.T) {
+
+	links := Links{"self": {Href: "/users/jane@example.com", Method: "GET"}}
+	tests := []struct {
+		name string
+		data interface{}
+		want string
+	}{
+		{"object", map[string]string{"email": "jane@example.com"}, `{"_links":{"self":{"href":"/users/jane@example.com","method":"GET"}},"email":"jane@example.com"}`},
+		{"array as is", []string{"jane@example.com"}, `["jane@example.com"]`},
+		{"null as is", nil, `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(linked{data: tt.data, links: links})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != tt.want {
+				t.Errorf("got %s, want %s", raw, tt.want)
+			}
+		})
+	}
+
+}
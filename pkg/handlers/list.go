@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// listUsers serves GET without an email: the full list, a lastName lookup or a page
+func (r *Router) listUsers(ctx context.Context, req events.APIGatewayProxyRequest, fields []string, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	// ?sort= and ?order= only order what is returned, with pagination that's a single page
+	sortField, order := req.QueryStringParameters["sort"], req.QueryStringParameters["order"]
+	if len(sortField) > 0 || len(order) > 0 {
+		if len(sortField) == 0 {
+			sortField = "email"
+		}
+		if err := user.ValidateSort(sortField, order); err != nil {
+			return errorResponse(ctx, req, err)
+		}
+	}
+
+	// sorting needs the sort attribute even when the client didn't ask for it
+	attributes := fields
+	if len(sortField) > 0 {
+		attributes = withField(fields, sortField)
+	}
+
+	filters, err := listFilters(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	if lastName := req.QueryStringParameters["lastName"]; len(lastName) > 0 {
+		done := metrics.Time(ctx, "QueryUsersByLastName")
+		result, err := user.QueryUsersByLastName(ctx, lastName, filters, tenant, tableName, dynaClient, attributes...)
+		done()
+		if err != nil && err.Error() == user.ErrorIndexNotFound {
+			// older tables don't have the lastName index yet
+			done = metrics.Time(ctx, "ScanUsersByLastName")
+			result, err = user.ScanUsersByLastName(ctx, lastName, filters, tenant, tableName, dynaClient, attributes...)
+			done()
+		}
+		if err != nil {
+			return errorResponse(ctx, req, err)
+		}
+		if len(sortField) > 0 {
+			user.SortUsers(*result, sortField, order)
+		}
+		return listResponse(ctx, req, http.StatusOK, withListLinks(req, selectFields(result, fields), ""), len(*result))
+	}
+
+	// ?limit= and ?cursor= switch the list to single pages with a cursor for the next one
+	limitParam, cursor := req.QueryStringParameters["limit"], req.QueryStringParameters["cursor"]
+	if len(limitParam) > 0 || len(cursor) > 0 {
+		var limit int64
+		if len(limitParam) > 0 {
+			if limit, err = strconv.ParseInt(limitParam, 10, 64); err != nil || limit <= 0 {
+				return errorResponse(ctx, req, errors.New(user.ErrorInvalidLimit))
+			}
+		}
+
+		// a cursor is only good for the list it came from, the next page of another order
+		// isn't the next page
+		params := map[string]string{"sort": sortField, "order": order}
+		done := metrics.Time(ctx, "FetchUsersPage")
+		page, err := user.FetchUsersPage(ctx, limit, cursor, params, filters, tenant, tableName, dynaClient, attributes...)
+		done()
+		if err != nil {
+			return errorResponse(ctx, req, err)
+		}
+		if len(sortField) > 0 {
+			user.SortUsers(page.Items, sortField, order)
+		}
+		if len(fields) == 0 {
+			return listResponse(ctx, req, http.StatusOK, withListLinks(req, page, page.NextCursor), len(page.Items))
+		}
+		body := map[string]interface{}{"items": selectFields(page.Items, fields)}
+		if len(page.NextCursor) > 0 {
+			body["nextCursor"] = page.NextCursor
+		}
+		return listResponse(ctx, req, http.StatusOK, withListLinks(req, body, page.NextCursor), len(page.Items))
+	}
+
+	done := metrics.Time(ctx, "FetchUsers")
+	result, complete, err := r.userRepository(tableName, dynaClient).List(ctx, filters, tenant, attributes...)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if len(sortField) > 0 {
+		user.SortUsers(result, sortField, order)
+	}
+	resp, err := listResponse(ctx, req, http.StatusOK, withListLinks(req, selectFields(result, fields), ""), len(result))
+	// a list that hit the scan caps is only the start of the table, ?limit= pages
+	// through all of it
+	if !complete && resp != nil {
+		resp.Headers["X-Truncated"] = "true"
+	}
+	return resp, err
+
+}
+
+// listFilters reads ?status=active|suspended and the generic filters,
+// ?filter[firstName]=John for equality and ?filter[lastName][begins_with]=Sm for a
+// prefix. Which fields and operators exist is up to the user package, it rejects the
+// rest.
+func listFilters(req events.APIGatewayProxyRequest) (map[string]string, error) {
+
+	filters := map[string]string{}
+	if status := req.QueryStringParameters["status"]; len(status) > 0 {
+		filters["status"] = status
+	}
+
+	for param, value := range req.QueryStringParameters {
+		if !strings.HasPrefix(param, "filter[") {
+			continue
+		}
+		// filter[field] or filter[field][operator]
+		parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(param, "filter["), "]"), "][")
+		if len(parts) > 2 || len(parts[0]) == 0 || !strings.HasSuffix(param, "]") {
+			return nil, fmt.Errorf("%s: %s", user.ErrorInvalidFilter, param)
+		}
+		operator := ""
+		if len(parts) == 2 {
+			operator = parts[1]
+		}
+		filters[user.FilterKey(parts[0], operator)] = value
+	}
+	return filters, nil
+
+}
+
+// withField returns the fields plus field, unless all fields are selected anyway
+func withField(fields []string, field string) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	for _, f := range fields {
+		if f == field {
+			return fields
+		}
+	}
+	return append(append([]string{}, fields...), field)
+}
+
+// selectFields drops every attribute that wasn't asked for from a user or a list of
+// users, so sparse responses don't carry empty values. No fields means everything.
+func selectFields(v interface{}, fields []string) interface{} {
+
+	if len(fields) == 0 {
+		return v
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	keep := func(item map[string]interface{}) map[string]interface{} {
+		selected := map[string]interface{}{}
+		for _, f := range fields {
+			if value, ok := item[f]; ok {
+				selected[f] = value
+			}
+		}
+		return selected
+	}
+
+	var list []map[string]interface{}
+	if err := json.Unmarshal(raw, &list); err == nil {
+		selected := make([]map[string]interface{}, 0, len(list))
+		for _, item := range list {
+			selected = append(selected, keep(item))
+		}
+		return selected
+	}
+
+	var item map[string]interface{}
+	if err := json.Unmarshal(raw, &item); err == nil {
+		return keep(item)
+	}
+	return v
+
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func TestListFilters(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		query   map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "none", query: map[string]string{"limit": "10"}, want: map[string]string{}},
+		{name: "status", query: map[string]string{"status": "active"}, want: map[string]string{"status": "active"}},
+		{name: "equals", query: map[string]string{"filter[firstName]": "John"}, want: map[string]string{"firstName": "John"}},
+		{name: "operator", query: map[string]string{"filter[lastName][begins_with]": "Sm"}, want: map[string]string{user.FilterKey("lastName", user.FilterBeginsWith): "Sm"}},
+		{name: "several", query: map[string]string{"filter[firstName]": "John", "filter[role]": "admin", "status": "suspended"}, want: map[string]string{"firstName": "John", "role": "admin", "status": "suspended"}},
+		// the user package decides about fields and operators
+		{name: "unknown field passed on", query: map[string]string{"filter[passwordHash]": "x"}, want: map[string]string{"passwordHash": "x"}},
+		{name: "empty field", query: map[string]string{"filter[]": "x"}, wantErr: true},
+		{name: "unclosed", query: map[string]string{"filter[firstName": "x"}, wantErr: true},
+		{name: "too deep", query: map[string]string{"filter[lastName][begins_with][x]": "Sm"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := listFilters(events.APIGatewayProxyRequest{QueryStringParameters: tt.query})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("filters = %v, want an error", filters)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(filters, tt.want) {
+				t.Errorf("filters = %v, want %v", filters, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestListUsersFilters(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		query      map[string]string
+		wantStatus int
+		wantCode   string
+		wantScan   bool
+	}{
+		{name: "valid", query: map[string]string{"filter[lastName][begins_with]": "Sm"}, wantStatus: http.StatusOK, wantScan: true},
+		{name: "unknown field", query: map[string]string{"filter[passwordHash]": "x"}, wantStatus: http.StatusBadRequest, wantCode: "INVALID_FILTER"},
+		{name: "unknown operator", query: map[string]string{"filter[firstName][contains]": "o"}, wantStatus: http.StatusBadRequest, wantCode: "INVALID_FILTER"},
+		{name: "malformed", query: map[string]string{"filter[firstName": "x"}, wantStatus: http.StatusBadRequest, wantCode: "INVALID_FILTER"},
+		{name: "invalid status", query: map[string]string{"status": "deleted"}, wantStatus: http.StatusBadRequest, wantCode: "INVALID_STATUS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanned := false
+			client := &fakeDynamo{scan: func(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+				scanned = true
+				return &dynamodb.ScanOutput{}, nil
+			}}
+			req := events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Resource: UsersResource, QueryStringParameters: tt.query}
+
+			resp, err := GetUser(context.Background(), req, "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || scanned != tt.wantScan {
+				t.Fatalf("status = %d, scanned = %t: %s", resp.StatusCode, scanned, resp.Body)
+			}
+			if len(tt.wantCode) > 0 && !strings.Contains(resp.Body, `"`+tt.wantCode+`"`) {
+				t.Errorf("body = %s, want code %s", resp.Body, tt.wantCode)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// CreateNote adds a {"text": "..."} note to the user in the path. Notes are for support
+// staff, with RBAC on only admins read and write them.
+func CreateNote(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	var body struct {
+		Text string `json:"text"`
+	}
+	if err := user.Decode(req.Body, &body); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "CreateNote")
+	note, err := user.CreateNote(ctx, emailParam(req), body.Text, tenant, user.CallerIdentity(req), tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	resp, err := successResponse(ctx, req, http.StatusCreated, note)
+	resp.Headers["Location"] = userURL(req, emailParam(req)) + "/notes/" + note.ID
+	return resp, err
+
+}
+
+// GetNotes lists the notes of the user in the path, oldest first
+func GetNotes(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "FetchNotes")
+	notes, err := user.FetchNotes(ctx, emailParam(req), tenant, tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	return successResponse(ctx, req, http.StatusOK, notes)
+
+}
+
+func DeleteNote(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "DeleteNote")
+	err = user.DeleteNote(ctx, emailParam(req), req.PathParameters["id"], tenant, tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	return emptyResponse(http.StatusNoContent)
+
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Rahul-71/go-serverless/pkg/buildinfo"
+	"github.com/Rahul-71/go-serverless/pkg/export"
+	"github.com/Rahul-71/go-serverless/pkg/spec"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// operation documents a registered route. The paths and methods come from the router,
+// the schemas from the sample values, so neither can drift from the code.
+type operation struct {
+	summary  string
+	status   int
+	request  interface{}
+	response interface{}
+}
+
+var operations = map[string]operation{
+	http.MethodGet + " " + UsersResource:    {summary: "List users", response: []user.User{}},
+	http.MethodHead + " " + UsersResource:   {summary: "Check a user by ?email="},
+	http.MethodPost + " " + UsersResource:   {summary: "Create a user", status: http.StatusCreated, request: user.User{}, response: user.User{}},
+	http.MethodPut + " " + UsersResource:    {summary: "Update a user, or create it with upsert", request: user.User{}, response: user.User{}},
+	http.MethodPatch + " " + UsersResource:  {summary: "Update some fields of a user", request: user.User{}, response: user.User{}},
+	http.MethodDelete + " " + UsersResource: {summary: "Delete a user by ?email=", response: user.User{}},
+	http.MethodGet + " " + UserResource:     {summary: "Fetch a user", response: user.User{}},
+	http.MethodHead + " " + UserResource:    {summary: "Check a user exists"},
+	http.MethodPut + " " + UserResource:     {summary: "Update a user, or create it with upsert", request: user.User{}, response: user.User{}},
+	http.MethodPatch + " " + UserResource:   {summary: "Update some fields of a user", request: user.User{}, response: user.User{}},
+	http.MethodDelete + " " + UserResource:  {summary: "Delete a user", response: user.User{}},
+	http.MethodGet + " " + VerifyResource:   {summary: "Verify an email with ?token=", response: user.User{}},
+	http.MethodPost + " " + AvatarUploadResource: {summary: "Get a presigned URL to upload an avatar", request: struct {
+		ContentType string `json:"contentType"`
+	}{}, response: AvatarUpload{}},
+	http.MethodPut + " " + AvatarResource: {summary: "Confirm an uploaded avatar", request: struct {
+		Key string `json:"key"`
+	}{}, response: user.User{}},
+	http.MethodPost + " " + ActivateResource:   {summary: "Activate a suspended user", response: user.User{}},
+	http.MethodPost + " " + DeactivateResource: {summary: "Suspend a user", response: user.User{}},
+	http.MethodPost + " " + ChangeEmailResource: {summary: "Move a user to another email", request: struct {
+		NewEmail string `json:"newEmail"`
+	}{}, response: user.User{}},
+	http.MethodPost + " " + NotesResource: {summary: "Add a note to a user", status: http.StatusCreated, request: struct {
+		Text string `json:"text"`
+	}{}, response: user.Note{}},
+	http.MethodGet + " " + NotesResource:       {summary: "List the notes of a user", response: []user.Note{}},
+	http.MethodDelete + " " + NoteResource:     {summary: "Delete a note", status: http.StatusNoContent},
+	http.MethodPost + " " + BatchResource:      {summary: "Create up to 25 users", status: http.StatusCreated, request: []user.User{}, response: []user.BatchResult{}},
+	http.MethodPost + " " + BulkDeleteResource: {summary: "Delete users by email", request: []string{}, response: user.BulkDeleteResult{}},
+	http.MethodGet + " " + CountResource:       {summary: "Count users", response: map[string]int64{}},
+	http.MethodGet + " " + ExportResource:      {summary: "Export users as CSV"},
+	http.MethodPost + " " + ExportS3Resource:   {summary: "Export users to S3 as NDJSON, admins only", status: http.StatusCreated, response: export.Result{}},
+	http.MethodPost + " " + ImportResource:     {summary: "Import users from CSV", response: ImportResult{}},
+	http.MethodPost + " " + AdminQueryResource: {summary: "Run a PartiQL SELECT, admins only", request: AdminQuery{}, response: user.QueryResult{}},
+	http.MethodPost + " " + AdminAPIKeysResource: {summary: "Generate an API key, admins only. The key is only in this response", status: http.StatusCreated, request: struct {
+		Owner     string   `json:"owner"`
+		Scopes    []string `json:"scopes"`
+		ExpiresAt string   `json:"expiresAt,omitempty"`
+	}{}, response: user.APIKey{}},
+	http.MethodDelete + " " + AdminAPIKeyResource: {summary: "Revoke an API key, admins only", status: http.StatusNoContent},
+	http.MethodPost + " " + WebhooksResource: {summary: "Subscribe a webhook to changes of users", status: http.StatusCreated, request: struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events,omitempty"`
+	}{}, response: user.Webhook{}},
+	http.MethodGet + " " + WebhooksResource:   {summary: "List the webhooks", response: []user.Webhook{}},
+	http.MethodDelete + " " + WebhookResource: {summary: "Delete a webhook", status: http.StatusNoContent},
+	http.MethodGet + " " + HealthResource:     {summary: "Check the table is reachable", response: HealthStatus{}},
+	http.MethodGet + " " + VersionResource:    {summary: "Show the deployed build", response: VersionInfo{}},
+	http.MethodGet + " " + OpenAPIResource:    {summary: "This document"},
+}
+
+// OpenAPI serves the spec of every route registered on r. The document only changes
+// with a deploy, so clients may cache it for a day.
+func (r *Router) OpenAPI(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	var endpoints []spec.Endpoint
+	for _, rt := range r.routes {
+		if rt.resource == legacyResource {
+			continue
+		}
+
+		op := operations[rt.method+" "+rt.resource]
+		endpoints = append(endpoints, spec.Endpoint{
+			Method:   rt.method,
+			Path:     rt.resource,
+			Summary:  op.summary,
+			Status:   op.status,
+			Request:  op.request,
+			Response: op.response,
+			Errors:   Problem{},
+		})
+	}
+
+	resp, err := apiResponse(ctx, http.StatusOK, spec.Build("go-serverless", buildinfo.Version, endpoints))
+	return withHeaders(resp, map[string]string{"Cache-Control": "public, max-age=86400"}), err
+
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/ratelimit"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrorTooManyRequests = "too many requests"
+
+// RATE_LIMIT_PER_MINUTE caps the requests per client, 0 (the default) disables the limiter.
+// The buckets live in RATE_LIMIT_TABLE, keyed by "key" with TTL on expiresAt.
+var (
+	rateLimitPerMinute = envInt("RATE_LIMIT_PER_MINUTE", 0)
+	rateLimitTable     = envString("RATE_LIMIT_TABLE", "")
+)
+
+// rateLimited returns the 429 for a client that used up its requests, nil otherwise. The
+// limiter fails open: when DynamoDB can't be reached the request is served.
+func (r *Router) rateLimited(ctx context.Context, req events.APIGatewayProxyRequest) *events.APIGatewayProxyResponse {
+
+	if rateLimitPerMinute <= 0 || len(rateLimitTable) == 0 || req.HTTPMethod == http.MethodOptions {
+		return nil
+	}
+
+	allowed, retryAfter, err := ratelimit.Allow(ctx, clientIdentity(req), rateLimitPerMinute, rateLimitTable, r.dynaClient)
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "rate limiter failed, serving the request", logging.Err(err))
+		return nil
+	}
+	if allowed {
+		return nil
+	}
+
+	resp, _ := errorResponse(ctx, req, errors.New(ErrorTooManyRequests))
+	resp.Headers["Retry-After"] = strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	return resp
+
+}
+
+// clientIdentity is the hash of the API key of the client when API Gateway or
+// authenticateAPIKey validated it, its source IP otherwise. A header nobody checked would
+// let clients pick their bucket, and the buckets are stored, so a key never is in plain.
+func clientIdentity(req events.APIGatewayProxyRequest) string {
+	if key := req.RequestContext.Identity.APIKey; len(key) > 0 {
+		return "key:" + user.HashAPIKey(key)
+	}
+	if _, ok := req.RequestContext.Authorizer["apiKeyId"]; ok {
+		if key := headerValue(req, APIKeyHeader); len(key) > 0 {
+			return "key:" + user.HashAPIKey(key)
+		}
+	}
+	return "ip:" + req.RequestContext.Identity.SourceIP
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestClientIdentity(t *testing.T) {
+
+	tests := []struct {
+		name string
+		req  events.APIGatewayProxyRequest
+		want string
+	}{
+		{
+			name: "source ip",
+			req:  events.APIGatewayProxyRequest{RequestContext: events.APIGatewayProxyRequestContext{Identity: events.APIGatewayRequestIdentity{SourceIP: "203.0.113.7"}}},
+			want: "ip:203.0.113.7",
+		},
+		{
+			name: "usage plan key",
+			req:  events.APIGatewayProxyRequest{RequestContext: events.APIGatewayProxyRequestContext{Identity: events.APIGatewayRequestIdentity{APIKey: "plan-key", SourceIP: "203.0.113.7"}}},
+			want: "key:" + user.HashAPIKey("plan-key"),
+		},
+		{
+			name: "validated key",
+			req: events.APIGatewayProxyRequest{
+				Headers:        map[string]string{"x-api-key": "table-key"},
+				RequestContext: events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{"apiKeyId": "k1"}, Identity: events.APIGatewayRequestIdentity{SourceIP: "203.0.113.7"}},
+			},
+			want: "key:" + user.HashAPIKey("table-key"),
+		},
+		{
+			name: "unchecked header",
+			req: events.APIGatewayProxyRequest{
+				Headers:        map[string]string{"X-Api-Key": "made-up"},
+				RequestContext: events.APIGatewayProxyRequestContext{Identity: events.APIGatewayRequestIdentity{SourceIP: "203.0.113.7"}},
+			},
+			want: "ip:203.0.113.7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientIdentity(tt.req); got != tt.want {
+				t.Errorf("clientIdentity = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+}
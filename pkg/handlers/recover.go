@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrorInternal = "internal error"
+
+// MetricPanics counts the requests that panicked, see metrics.Add
+const MetricPanics = "Panics"
+
+var panics int64
+
+// Panics is how many requests of this instance panicked
+func Panics() int64 {
+	return atomic.LoadInt64(&panics)
+}
+
+// withRecovery turns a panic of next into a 500 that tells the client the request ID to
+// report, instead of the 502 of API Gateway for a crashed invocation. The panic and its
+// stack are logged.
+func withRecovery(next dispatchFunc) dispatchFunc {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (resp *events.APIGatewayProxyResponse, err error) {
+
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			atomic.AddInt64(&panics, 1)
+			metrics.Add(ctx, MetricPanics, 1)
+			logging.FromContext(ctx).ErrorContext(ctx, "panic", "panic", fmt.Sprint(value), "stack", string(debug.Stack()))
+			resp, err = errorResponse(ctx, req, fmt.Errorf("%s, reference %s", ErrorInternal, requestID(req)))
+		}()
+		return next(ctx, req)
+
+	}
+}
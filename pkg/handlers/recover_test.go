@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestDispatchPanic(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		panic      func()
+		headers    map[string]string
+		wantStatus int
+		wantID     string
+	}{
+		{name: "no panic", panic: func() {}, wantStatus: http.StatusOK},
+		{name: "string", panic: func() { panic("boom") }, wantStatus: http.StatusInternalServerError, wantID: "gateway-id"},
+		{name: "error", panic: func() { panic(errors.New("boom")) }, wantStatus: http.StatusInternalServerError, wantID: "gateway-id"},
+		{name: "runtime error", panic: func() {
+			var m map[string]int
+			m["boom"]++
+		}, wantStatus: http.StatusInternalServerError, wantID: "gateway-id"},
+		{name: "client request ID", panic: func() { panic("boom") }, headers: map[string]string{"X-Request-Id": "client-id"}, wantStatus: http.StatusInternalServerError, wantID: "client-id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter("users", nil)
+			r.Register(http.MethodGet, "/boom", func(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+				tt.panic()
+				return emptyResponse(http.StatusOK)
+			})
+			r.Register(http.MethodGet, "/version", Version)
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodGet,
+				Resource:       "/boom",
+				Headers:        tt.headers,
+				RequestContext: events.APIGatewayProxyRequestContext{RequestID: "gateway-id"},
+			}
+			before := Panics()
+
+			resp, err := r.Dispatch(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if len(tt.wantID) == 0 {
+				if Panics() != before {
+					t.Errorf("panics = %d, want %d", Panics(), before)
+				}
+				return
+			}
+			if Panics() != before+1 {
+				t.Errorf("panics = %d, want %d", Panics(), before+1)
+			}
+			var problem Problem
+			if err := json.Unmarshal([]byte(resp.Body), &problem); err != nil || problem.Code != CodeInternalError {
+				t.Fatalf("body = %s, want code %s", resp.Body, CodeInternalError)
+			}
+			if problem.RequestID != tt.wantID || !strings.HasSuffix(problem.Detail, "reference "+tt.wantID) {
+				t.Errorf("request ID = %q, detail = %q, want %s", problem.RequestID, problem.Detail, tt.wantID)
+			}
+			if strings.Contains(problem.Detail, "boom") {
+				t.Errorf("detail = %q, the panic is for the log only", problem.Detail)
+			}
+
+			// /version reports the panics of the instance
+			resp, err = r.Dispatch(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Resource: "/version"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var info VersionInfo
+			if err := json.Unmarshal([]byte(resp.Body), &info); err != nil || info.Panics != Panics() {
+				t.Errorf("version = %s, want %d panics", resp.Body, Panics())
+			}
+		})
+	}
+
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var (
+	ErrorInvalidBase64Body    = "invalid base64 encoded body"
+	ErrorUnsupportedMediaType = "unsupported media type, the body must be application/json"
+	ErrorBodyTooLarge         = "request body too large"
+)
+
+// MAX_BODY_BYTES caps the size of JSON bodies, 64 KB by default
+var maxBodyBytes = envInt("MAX_BODY_BYTES", 64*1024)
+
+// checkJSONRequest runs before a JSON body is decoded. A missing Content-Type is
+// accepted so existing scripts that never set one keep working.
+func checkJSONRequest(req events.APIGatewayProxyRequest) error {
+	if contentType := headerValue(req, "Content-Type"); len(contentType) > 0 {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+			return errors.New(ErrorUnsupportedMediaType)
+		}
+	}
+
+	// the limit applies to what the client sent, not to its base64 form
+	size := len(req.Body)
+	if req.IsBase64Encoded {
+		size = base64.StdEncoding.DecodedLen(len(req.Body)) - strings.Count(req.Body, "=")
+	}
+	if size > maxBodyBytes {
+		return fmt.Errorf("%s, the limit is %d bytes", ErrorBodyTooLarge, maxBodyBytes)
+	}
+	return nil
+}
+
+// decodeBody returns the request with a plain body. API Gateway base64 encodes bodies
+// for binary media types, the user package only ever sees the decoded JSON.
+func decodeBody(req events.APIGatewayProxyRequest) (events.APIGatewayProxyRequest, error) {
+	if !req.IsBase64Encoded {
+		return req, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(req.Body)
+	if err != nil {
+		return req, errors.New(ErrorInvalidBase64Body)
+	}
+	req.Body = string(decoded)
+	req.IsBase64Encoded = false
+	return req, nil
+}
+
+// baseURL is where the API is reachable for this request. On the execute-api domain the
+// stage is part of the URL, behind a custom domain the base path mapping is whatever
+// precedes the resource in the request path.
+func baseURL(req events.APIGatewayProxyRequest) string {
+
+	prefix := ""
+	if resource := req.Resource; len(resource) > 0 && !strings.Contains(resource, "{") && strings.HasSuffix(req.Path, resource) {
+		prefix = strings.TrimSuffix(req.Path, resource)
+	} else if i := strings.Index(req.Path, "/users"); i > 0 {
+		prefix = req.Path[:i]
+	}
+
+	stage := req.RequestContext.Stage
+	if strings.Contains(req.RequestContext.DomainName, ".execute-api.") && len(stage) > 0 && stage != "$default" {
+		prefix = "/" + stage + prefix
+	}
+
+	if len(req.RequestContext.DomainName) == 0 {
+		return prefix
+	}
+	return "https://" + req.RequestContext.DomainName + prefix
+
+}
+
+// userURL is the URL of a single user, /users/{email}. PathEscape leaves "+" alone
+// but enough proxies and clients read it as a space that it's escaped as well.
+func userURL(req events.APIGatewayProxyRequest, email string) string {
+	return baseURL(req) + "/users/" + strings.ReplaceAll(url.PathEscape(email), "+", "%2B")
+}
+
+// emailParam reads the email from the path (/users/{email}) and falls back to the
+// ?email= query string used by older clients, see user.EmailFromRequest
+func emailParam(req events.APIGatewayProxyRequest) string {
+	return user.EmailFromRequest(req)
+}
+
+// emailsParam reads ?emails=a@x.com,b@y.com, repeated emails= parameters are combined
+func emailsParam(req events.APIGatewayProxyRequest) []string {
+	values := req.MultiValueQueryStringParameters["emails"]
+	if len(values) == 0 {
+		if value, ok := req.QueryStringParameters["emails"]; ok {
+			values = []string{value}
+		}
+	}
+
+	var emails []string
+	for _, value := range values {
+		for _, email := range strings.Split(value, ",") {
+			if email = strings.TrimSpace(email); len(email) > 0 {
+				emails = append(emails, email)
+			}
+		}
+	}
+	return emails
+}
+
+// requestID is the correlation ID of the request: the client's X-Request-Id or
+// X-Correlation-Id when it looks sane, the API Gateway request ID otherwise
+func requestID(req events.APIGatewayProxyRequest) string {
+	for _, name := range []string{"X-Request-Id", "X-Correlation-Id"} {
+		if id := headerValue(req, name); validRequestID(id) {
+			return id
+		}
+	}
+	return req.RequestContext.RequestID
+}
+
+// the ID ends up in headers and log lines, so only short plain tokens are taken over
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// headerValue looks a request header up case-insensitively, API Gateway passes the
+// names through exactly as the client sent them
+func headerValue(req events.APIGatewayProxyRequest, name string) string {
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	for k, v := range req.MultiValueHeaders {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+func envString(name, fallback string) string {
+	if value := os.Getenv(name); len(value) > 0 {
+		return value
+	}
+	return fallback
+}
+
+// noCache is true for a Cache-Control: no-cache request, the client wants what is stored
+// right now
+func noCache(req events.APIGatewayProxyRequest) bool {
+	for _, directive := range strings.Split(headerValue(req, "Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+	return false
+}
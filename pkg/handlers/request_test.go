@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestCheckJSONRequest(t *testing.T) {
+
+	tests := []struct {
+		contentType string
+		// multiValue is the Content-Type of MultiValueHeaders, Headers wins when both have one
+		multiValue []string
+		wantErr    bool
+	}{
+		{"", nil, false},
+		{"application/json", nil, false},
+		{"application/json; charset=utf-8", nil, false},
+		{"Application/JSON", nil, false},
+		{"application/merge-patch+json", nil, false},
+		{"text/plain", nil, true},
+		{"application/x-www-form-urlencoded", nil, true},
+		{"application/jsonp", nil, true},
+		{"not a media type;;", nil, true},
+		{"", []string{"application/json"}, false},
+		{"", []string{"text/plain"}, true},
+		{"application/json", []string{"text/plain"}, false},
+		{"text/plain", []string{"application/json"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType+"|"+strings.Join(tt.multiValue, ","), func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{Body: "{}"}
+			if len(tt.contentType) > 0 {
+				req.Headers = map[string]string{"content-type": tt.contentType}
+			}
+			if len(tt.multiValue) > 0 {
+				req.MultiValueHeaders = map[string][]string{"Content-Type": tt.multiValue}
+			}
+			err := checkJSONRequest(req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkJSONRequest(%q, %q) = %v", tt.contentType, tt.multiValue, err)
+			}
+			if err != nil && mapError(err).status != http.StatusUnsupportedMediaType {
+				t.Errorf("status = %d", mapError(err).status)
+			}
+		})
+	}
+
+}
+
+func TestBodyLimit(t *testing.T) {
+
+	defer func(max int) { maxBodyBytes = max }(maxBodyBytes)
+	maxBodyBytes = 8
+
+	tests := []struct {
+		name    string
+		body    string
+		base64  bool
+		wantErr bool
+	}{
+		{name: "at the limit", body: "12345678"},
+		{name: "over the limit", body: "123456789", wantErr: true},
+		// 8 bytes in 12 characters of base64
+		{name: "base64 at the limit", body: base64.StdEncoding.EncodeToString([]byte("12345678")), base64: true},
+		{name: "base64 over the limit", body: base64.StdEncoding.EncodeToString([]byte("123456789")), base64: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkJSONRequest(events.APIGatewayProxyRequest{Body: tt.body, IsBase64Encoded: tt.base64})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkJSONRequest = %v", err)
+			}
+			if err != nil && mapError(err).status != http.StatusRequestEntityTooLarge {
+				t.Errorf("status = %d", mapError(err).status)
+			}
+		})
+	}
+
+}
+
+func TestDecodeBody(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		req      events.APIGatewayProxyRequest
+		wantBody string
+		wantErr  bool
+	}{
+		{name: "plain", req: events.APIGatewayProxyRequest{Body: `{"email":"jane@example.com"}`}, wantBody: `{"email":"jane@example.com"}`},
+		{name: "base64", req: events.APIGatewayProxyRequest{Body: base64.StdEncoding.EncodeToString([]byte(`{"email":"jane@example.com"}`)), IsBase64Encoded: true}, wantBody: `{"email":"jane@example.com"}`},
+		{name: "invalid base64", req: events.APIGatewayProxyRequest{Body: "not base64!", IsBase64Encoded: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBody(tt.req)
+			if tt.wantErr {
+				if err == nil || err.Error() != ErrorInvalidBase64Body {
+					t.Errorf("err = %v", err)
+				}
+				return
+			}
+			if err != nil || got.Body != tt.wantBody || got.IsBase64Encoded {
+				t.Errorf("decodeBody = %q %t %v", got.Body, got.IsBase64Encoded, err)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/config"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/Rahul-71/go-serverless/pkg/repository"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var (
+	ErrorNotFound    = "not found"
+	ErrorTimeout     = "request timed out"
+	ErrorInvalidPath = "invalid escape in path"
+)
+
+// DEADLINE_MARGIN_MS is how long before the Lambda timeout DynamoDB calls are given up,
+// so there's still time to answer with a 504
+var deadlineMargin = time.Duration(envInt("DEADLINE_MARGIN_MS", 500)) * time.Millisecond
+
+const (
+	UsersResource        = "/users"
+	UserResource         = "/users/{email}"
+	BatchResource        = "/users/batch"
+	BulkDeleteResource   = "/users/bulk-delete"
+	CountResource        = "/users/count"
+	ExportResource       = "/users/export"
+	ExportS3Resource     = "/users/export-s3"
+	ImportResource       = "/users/import"
+	HealthResource       = "/health"
+	VersionResource      = "/version"
+	OpenAPIResource      = "/openapi.json"
+	ActivateResource     = "/users/{email}/activate"
+	DeactivateResource   = "/users/{email}/deactivate"
+	VerifyResource       = "/users/verify"
+	AvatarResource       = "/users/{email}/avatar"
+	AvatarUploadResource = "/users/{email}/avatar-upload-url"
+	NotesResource        = "/users/{email}/notes"
+	NoteResource         = "/users/{email}/notes/{id}"
+	ChangeEmailResource  = "/users/{email}/change-email"
+	AdminQueryResource   = "/admin/query"
+	AdminAPIKeysResource = "/admin/api-keys"
+	AdminAPIKeyResource  = "/admin/api-keys/{id}"
+	WebhooksResource     = "/webhooks"
+	WebhookResource      = "/webhooks/{id}"
+
+	// resource of the original deployment, kept so existing clients keep working
+	legacyResource = "/go-serverless"
+
+	// what matchResource resolves a path with an invalid escape to, answered with a 400
+	invalidPathResource = "{invalid path}"
+)
+
+type HandlerFunc func(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error)
+
+type route struct {
+	method   string
+	resource string
+	handler  HandlerFunc
+}
+
+// Router dispatches API Gateway requests on resource and method. Every entity registers
+// its own routes, all of them share the table name and client given to NewRouter.
+type Router struct {
+	routes     []route
+	tableName  string
+	dynaClient user.DynamoDBAPI
+	s3Client   S3API
+	users      repository.UserRepository
+	config     *config.Config
+	// s3Presigner presigns the avatar URLs, see WithS3
+	s3Presigner S3PresignAPI
+	// eventBridge and eventBusName are where change events go, see WithEventBridge
+	eventBridge  EventBridgeAPI
+	eventBusName string
+	// sns and snsTopicArn are where change events are fanned out, see WithSNS
+	sns         SNSAPI
+	snsTopicArn string
+	// ses sends the welcome email, see WithWelcomeEmail
+	ses             SESAPI
+	welcomeTemplate string
+	welcomeFrom     string
+	// signingSecrets are the secrets of the clients that sign requests, see WithSigningSecrets
+	signingSecrets map[string]string
+}
+
+func NewRouter(tableName string, dynaClient user.DynamoDBAPI) *Router {
+	return &Router{tableName: tableName, dynaClient: dynaClient}
+}
+
+// WithS3 sets the client for the avatar and export buckets and the presigner of the
+// avatar URLs, s3.NewPresignClient of the client. Without a client avatars and exports
+// to S3 are disabled.
+func (r *Router) WithS3(s3Client S3API, presigner S3PresignAPI) *Router {
+	r.s3Client = s3Client
+	r.s3Presigner = presigner
+	return r
+}
+
+// WithConfig takes the table from cfg, including the per stage override of
+// STAGE_TABLE_VARIABLE
+func (r *Router) WithConfig(cfg *config.Config) *Router {
+	r.config = cfg
+	r.tableName = cfg.TableName
+	return r
+}
+
+// WithUsers sets where single users are read and written and lists come from, the
+// table given to NewRouter by default. Everything else still goes to the table.
+func (r *Router) WithUsers(users repository.UserRepository) *Router {
+	r.users = users
+	return r
+}
+
+// userRepository is the repository set with WithUsers or the table handlers are given
+func (r *Router) userRepository(tableName string, dynaClient user.DynamoDBAPI) repository.UserRepository {
+	if r.users != nil {
+		return r.users
+	}
+	return repository.NewDynamo(tableName, dynaClient)
+}
+
+// Register adds a handler for method on an API Gateway resource path such as /users/{email}
+func (r *Router) Register(method, resource string, handler HandlerFunc) {
+	r.routes = append(r.routes, route{method, resource, handler})
+}
+
+// RegisterUserRoutes adds the user endpoints along with /health, /version and /openapi.json
+func RegisterUserRoutes(r *Router) {
+	for _, resource := range []string{UsersResource, legacyResource} {
+		r.Register(http.MethodGet, resource, r.GetUser)
+		r.Register(http.MethodHead, resource, r.HeadUser)
+		r.Register(http.MethodPost, resource, withIdempotency(r.CreateUser))
+		r.Register(http.MethodPut, resource, r.UpdateUser)
+		r.Register(http.MethodPatch, resource, r.PatchUser)
+		r.Register(http.MethodDelete, resource, r.DeleteUser)
+	}
+
+	r.Register(http.MethodGet, UserResource, r.GetUser)
+	r.Register(http.MethodHead, UserResource, r.HeadUser)
+	r.Register(http.MethodPut, UserResource, r.UpdateUser)
+	r.Register(http.MethodPatch, UserResource, r.PatchUser)
+	r.Register(http.MethodDelete, UserResource, r.DeleteUser)
+
+	r.Register(http.MethodGet, VerifyResource, r.VerifyEmail)
+	r.Register(http.MethodPost, AvatarUploadResource, r.AvatarUploadURL)
+	r.Register(http.MethodPut, AvatarResource, r.ConfirmAvatar)
+	r.Register(http.MethodPost, ActivateResource, r.ActivateUser)
+	r.Register(http.MethodPost, DeactivateResource, r.DeactivateUser)
+	r.Register(http.MethodPost, ChangeEmailResource, withIdempotency(r.ChangeEmail))
+	r.Register(http.MethodPost, NotesResource, withIdempotency(CreateNote))
+	r.Register(http.MethodGet, NotesResource, GetNotes)
+	r.Register(http.MethodDelete, NoteResource, DeleteNote)
+
+	r.Register(http.MethodPost, BatchResource, withIdempotency(r.CreateUsers))
+	r.Register(http.MethodPost, BulkDeleteResource, withIdempotency(r.DeleteUsers))
+	r.Register(http.MethodGet, CountResource, CountUsers)
+	r.Register(http.MethodGet, ExportResource, ExportUsers)
+	r.Register(http.MethodPost, ExportS3Resource, r.ExportUsersS3)
+	r.Register(http.MethodPost, ImportResource, withIdempotency(r.ImportUsers))
+	r.Register(http.MethodPost, AdminQueryResource, RunAdminQuery)
+	r.Register(http.MethodPost, AdminAPIKeysResource, CreateAPIKey)
+	r.Register(http.MethodDelete, AdminAPIKeyResource, RevokeAPIKey)
+
+	r.Register(http.MethodPost, WebhooksResource, withIdempotency(CreateWebhook))
+	r.Register(http.MethodGet, WebhooksResource, GetWebhooks)
+	r.Register(http.MethodDelete, WebhookResource, DeleteWebhook)
+
+	r.Register(http.MethodGet, HealthResource, Health)
+	r.Register(http.MethodGet, VersionResource, Version)
+	r.Register(http.MethodGet, OpenAPIResource, r.OpenAPI)
+}
+
+// Dispatch picks the handler based on the API Gateway resource and the HTTP method.
+// A known resource with an unsupported method gets a 405 listing the registered
+// methods, anything else a 404.
+func (r *Router) Dispatch(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+
+	invocations++
+	start := time.Now()
+
+	// every log line of the request, pkg/user's included, says which one it's for
+	id := requestID(req)
+	logger := slog.Default().With(
+		"requestId", id,
+		"method", req.HTTPMethod,
+		"resource", req.Resource,
+	)
+	ctx = logging.WithLogger(ctx, logger)
+	ctx = metrics.Begin(ctx)
+	retries := user.Retries()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-deadlineMargin))
+		defer cancel()
+	}
+	ctx = user.TrackTimeouts(ctx)
+
+	// the caller is known from here on, to the logs, the limiter and the handlers alike.
+	// A request that failed to authenticate is answered once it's routed.
+	tableName := r.tableName
+	if r.config != nil {
+		tableName = r.config.TableFor(req.StageVariables)
+	}
+	authenticated, authErr := r.authenticate(ctx, req, tableName)
+	if authErr == nil {
+		req = authenticated
+	}
+	logger = logger.With("caller", user.CallerIdentity(req))
+	ctx = logging.WithLogger(ctx, logger)
+
+	debug := r.config != nil && r.config.DebugCapacity && debugRequested(req)
+	if debug {
+		ctx = user.RecordCalls(ctx)
+	}
+
+	dispatch := withRecovery(func(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+		return r.dispatch(ctx, req, tableName, authErr)
+	})
+	if bodyLogging {
+		dispatch = withBodyLogging(dispatch)
+	}
+	resp := r.rateLimited(ctx, req)
+	var err error
+	if resp == nil {
+		resp, err = dispatch(ctx, req)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "request failed", logging.Err(err), "durationMs", time.Since(start).Milliseconds())
+		if metrics.Enabled() {
+			metrics.Flush(ctx, r.operation(req), http.StatusInternalServerError, user.Retries()-retries, map[string]interface{}{"requestId": id})
+		}
+		return resp, err
+	}
+	// whatever failed, it failed because DynamoDB didn't answer in time
+	if resp.StatusCode >= http.StatusInternalServerError && user.TimedOut(ctx) {
+		resp, _ = errorResponse(ctx, req, errors.New(ErrorTimeout))
+	}
+
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	resp.Headers["X-Request-Id"] = id
+	if debug {
+		resp = withDebug(ctx, resp)
+	}
+	logger.InfoContext(ctx, "request completed", "status", resp.StatusCode, "durationMs", time.Since(start).Milliseconds())
+	if metrics.Enabled() {
+		metrics.Flush(ctx, r.operation(req), resp.StatusCode, user.Retries()-retries, map[string]interface{}{"requestId": id})
+	}
+	return withCompression(req, withCORS(req, resp)), nil
+
+}
+
+// authenticate checks the signature of the request and names its caller by its bearer
+// token or API key, see verifySignature, authenticateBearer and authenticateAPIKey
+func (r *Router) authenticate(ctx context.Context, req events.APIGatewayProxyRequest, tableName string) (events.APIGatewayProxyRequest, error) {
+
+	if err := r.verifySignature(req); err != nil {
+		return req, err
+	}
+	req, err := authenticateBearer(ctx, req)
+	if err != nil {
+		return req, err
+	}
+	return authenticateAPIKey(ctx, req, tableName, r.dynaClient)
+
+}
+
+// dispatch routes a request authenticate was done with, authErr is what it failed with
+func (r *Router) dispatch(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, authErr error) (*events.APIGatewayProxyResponse, error) {
+
+	if req.Resource == invalidPathResource {
+		return errorResponse(ctx, req, errors.New(ErrorInvalidPath))
+	}
+	methods := r.allowedMethods(req.Resource)
+	if len(methods) == 0 {
+		return errorResponse(ctx, req, errors.New(ErrorNotFound))
+	}
+
+	if req.HTTPMethod == http.MethodOptions {
+		return preflightResponse(methods)
+	}
+
+	if authErr != nil {
+		return errorResponse(ctx, req, authErr)
+	}
+	for _, rt := range r.routes {
+		if rt.resource == req.Resource && rt.method == req.HTTPMethod {
+			if r.config != nil && r.config.Tracing {
+				return traced(ctx, req, rt, tableName, r.dynaClient)
+			}
+			return rt.handler(ctx, req, tableName, r.dynaClient)
+		}
+	}
+
+	return MethodNotAllowed(ctx, req, append(methods, http.MethodOptions))
+
+}
+
+// operation names the route of a request in metrics, an unknown resource is just that
+// so arbitrary paths don't become dimensions
+func (r *Router) operation(req events.APIGatewayProxyRequest) string {
+	if len(r.allowedMethods(req.Resource)) == 0 {
+		return "unknown"
+	}
+	return req.HTTPMethod + " " + req.Resource
+}
+
+// allowedMethods lists the methods registered for a resource
+func (r *Router) allowedMethods(resource string) []string {
+	var methods []string
+	for _, rt := range r.routes {
+		if rt.resource == resource {
+			methods = append(methods, rt.method)
+		}
+	}
+	return methods
+}
+
+// matchResource resolves a raw request path such as /users/foo%40bar.com into the
+// registered resource template (/users/{email}) and its path parameters, unescaped
+// segment by segment so an escaped slash stays inside its parameter. It is used by
+// event sources that only deliver the raw path. A path with an invalid escape resolves
+// to invalidPathResource.
+func (r *Router) matchResource(path string) (string, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return invalidPathResource, nil
+		}
+		segments[i] = unescaped
+	}
+
+	// like API Gateway, prefer the most specific resource: /users/batch wins over /users/{email}
+	bestResource, bestParams := path, map[string]string(nil)
+	for _, rt := range r.routes {
+		template := strings.Split(strings.Trim(rt.resource, "/"), "/")
+		if len(template) != len(segments) {
+			continue
+		}
+
+		params := map[string]string{}
+		matched := true
+		for i, part := range template {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				params[strings.Trim(part, "{}")] = segments[i]
+				continue
+			}
+			if part != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched && (bestParams == nil || len(params) < len(bestParams)) {
+			bestResource, bestParams = rt.resource, params
+		}
+	}
+
+	return bestResource, bestParams
+}
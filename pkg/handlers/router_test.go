@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func testRouter() *Router {
+	r := NewRouter("users", nil)
+	RegisterUserRoutes(r)
+	return r
+}
+
+func TestMatchResource(t *testing.T) {
+
+	r := testRouter()
+	tests := []struct {
+		path         string
+		wantResource string
+		wantParams   map[string]string
+	}{
+		{"/users", UsersResource, map[string]string{}},
+		{"/users/", UsersResource, map[string]string{}},
+		{"/users/foo@bar.com", UserResource, map[string]string{"email": "foo@bar.com"}},
+		{"/users/foo%40bar.com", UserResource, map[string]string{"email": "foo@bar.com"}},
+		{"/users/a%2Bb@x.com", UserResource, map[string]string{"email": "a+b@x.com"}},
+		{"/users/a+b@x.com", UserResource, map[string]string{"email": "a+b@x.com"}},
+		{"/users/a%2Fb@x.com", UserResource, map[string]string{"email": "a/b@x.com"}},
+		{"/users/batch", BatchResource, map[string]string{}},
+		{"/users/%62atch", BatchResource, map[string]string{}},
+		{"/users/jane@x.com/notes/n1", NoteResource, map[string]string{"email": "jane@x.com", "id": "n1"}},
+		{"/users/%zz", invalidPathResource, nil},
+		{"/nothing/here", "/nothing/here", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resource, params := r.matchResource(tt.path)
+			if resource != tt.wantResource || !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("matchResource(%q) = %q %v, want %q %v", tt.path, resource, params, tt.wantResource, tt.wantParams)
+			}
+		})
+	}
+
+}
+
+func TestDispatchInvalidPath(t *testing.T) {
+
+	r := testRouter()
+	resp, err := r.Dispatch(context.Background(), r.FromALBRequest(events.ALBTargetGroupRequest{HTTPMethod: http.MethodGet, Path: "/users/%zz"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var problem Problem
+	if err := json.Unmarshal([]byte(resp.Body), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || problem.Code != "INVALID_PATH" {
+		t.Errorf("status = %d, code = %s", resp.StatusCode, problem.Code)
+	}
+
+}
+
+func TestDispatchAuthenticatesFirst(t *testing.T) {
+
+	defer func(enabled bool, perMinute int, table string, logger *slog.Logger) {
+		apiKeysEnabled, rateLimitPerMinute, rateLimitTable = enabled, perMinute, table
+		slog.SetDefault(logger)
+	}(apiKeysEnabled, rateLimitPerMinute, rateLimitTable, slog.Default())
+	apiKeysEnabled, rateLimitPerMinute, rateLimitTable = true, 10, "buckets"
+
+	stored, err := attributevalue.MarshalMap(user.APIKey{ID: "k1", Hash: user.HashAPIKey("gsk_valid"), Owner: "robot@example.com", Scopes: []string{user.ScopeUsersRead}, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored[user.ItemTypeAttribute] = &types.AttributeValueMemberS{Value: user.ItemTypeAPIKey}
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantBucket string
+		wantCaller string
+	}{
+		{"valid key", "gsk_valid", http.StatusOK, "key:" + user.HashAPIKey("gsk_valid"), "robot@example.com"},
+		{"unknown key", "gsk_unknown", http.StatusUnauthorized, "ip:203.0.113.7", "ip:203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+			apiKeys = &apiKeyCache{entries: map[string]apiKeyCacheEntry{}}
+
+			var bucket string
+			client := &fakeDynamo{
+				getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+					if key := in.Key[user.KeyAttribute].(*types.AttributeValueMemberS); key.Value == "APIKEY#"+user.HashAPIKey("gsk_valid") {
+						return &dynamodb.GetItemOutput{Item: stored}, nil
+					}
+					return &dynamodb.GetItemOutput{}, nil
+				},
+				updateItem: func(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+					bucket = in.Key["key"].(*types.AttributeValueMemberS).Value
+					return &dynamodb.UpdateItemOutput{Attributes: map[string]types.AttributeValue{"count": &types.AttributeValueMemberN{Value: "1"}}}, nil
+				},
+			}
+			r := NewRouter("users", client)
+			RegisterUserRoutes(r)
+
+			resp, err := r.Dispatch(context.Background(), events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodGet,
+				Resource:       VersionResource,
+				Headers:        map[string]string{APIKeyHeader: tt.key},
+				RequestContext: events.APIGatewayProxyRequestContext{Identity: events.APIGatewayRequestIdentity{SourceIP: "203.0.113.7"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if !strings.HasPrefix(bucket, tt.wantBucket+"#") {
+				t.Errorf("bucket = %q, want %s#...", bucket, tt.wantBucket)
+			}
+			if !strings.Contains(logs.String(), `"caller":"`+tt.wantCaller+`"`) {
+				t.Errorf("logs don't name the caller %s: %s", tt.wantCaller, logs.String())
+			}
+		})
+	}
+
+}
+
+func TestDispatchRoutes(t *testing.T) {
+
+	r := NewRouter("users", nil)
+	var called string
+	handler := func(name string) HandlerFunc {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+			called = name + " " + tableName
+			return emptyResponse(http.StatusOK)
+		}
+	}
+	r.Register(http.MethodGet, UserResource, handler("get"))
+	r.Register(http.MethodDelete, UserResource, handler("delete"))
+
+	tests := []struct {
+		name       string
+		method     string
+		resource   string
+		wantStatus int
+		wantCalled string
+		wantAllow  string
+	}{
+		{name: "registered", method: http.MethodGet, resource: UserResource, wantStatus: http.StatusOK, wantCalled: "get users"},
+		{name: "other method", method: http.MethodDelete, resource: UserResource, wantStatus: http.StatusOK, wantCalled: "delete users"},
+		{name: "method not allowed", method: http.MethodPost, resource: UserResource, wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, DELETE, OPTIONS"},
+		{name: "preflight", method: http.MethodOptions, resource: UserResource, wantStatus: http.StatusNoContent, wantAllow: "GET, DELETE, OPTIONS"},
+		{name: "unknown resource", method: http.MethodGet, resource: "/nothing", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = ""
+			resp, err := r.Dispatch(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: tt.method, Resource: tt.resource})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || called != tt.wantCalled {
+				t.Errorf("status = %d, called %q, want %d %q", resp.StatusCode, called, tt.wantStatus, tt.wantCalled)
+			}
+			if resp.Headers["Allow"] != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", resp.Headers["Allow"], tt.wantAllow)
+			}
+		})
+	}
+
+}
+
+// ctxDynamo hands the context of every GetItem to getItem
+type ctxDynamo struct {
+	user.DynamoDBAPI
+	getItem func(ctx context.Context) (*dynamodb.GetItemOutput, error)
+}
+
+func (c ctxDynamo) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return c.getItem(ctx)
+}
+
+func (c ctxDynamo) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return &dynamodb.QueryOutput{}, ctx.Err()
+}
+
+func TestDispatchContext(t *testing.T) {
+
+	defer func(margin time.Duration) { deadlineMargin = margin }(deadlineMargin)
+	deadlineMargin = 500 * time.Millisecond
+	type key struct{}
+
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		hang         bool
+		wantDeadline bool
+		wantStatus   int
+		wantCode     string
+	}{
+		{name: "no deadline", wantStatus: http.StatusOK},
+		{name: "lambda deadline", timeout: 10 * time.Second, wantDeadline: true, wantStatus: http.StatusOK},
+		{name: "call outlasts the deadline", timeout: 600 * time.Millisecond, hang: true, wantDeadline: true, wantStatus: http.StatusGatewayTimeout, wantCode: "TIMEOUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), key{}, "invocation")
+			var lambdaDeadline time.Time
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+				lambdaDeadline, _ = ctx.Deadline()
+			}
+
+			var callCtx context.Context
+			client := ctxDynamo{getItem: func(ctx context.Context) (*dynamodb.GetItemOutput, error) {
+				callCtx = ctx
+				if tt.hang {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				return &dynamodb.GetItemOutput{Item: storedUser(t, user.User{Email: "jane@example.com"})}, nil
+			}}
+			r := NewRouter("users", client)
+			RegisterUserRoutes(r)
+
+			req := events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Resource: UserResource, PathParameters: map[string]string{"email": "jane@example.com"}}
+			resp, err := r.Dispatch(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if len(tt.wantCode) > 0 && !strings.Contains(resp.Body, `"`+tt.wantCode+`"`) {
+				t.Errorf("body = %s, want code %s", resp.Body, tt.wantCode)
+			}
+
+			if callCtx == nil || callCtx.Value(key{}) != "invocation" {
+				t.Fatal("the call didn't get the invocation context")
+			}
+			deadline, ok := callCtx.Deadline()
+			if ok != tt.wantDeadline {
+				t.Fatalf("deadline set = %t, want %t", ok, tt.wantDeadline)
+			}
+			if ok && !deadline.Equal(lambdaDeadline.Add(-deadlineMargin)) {
+				t.Errorf("deadline = %s, want the margin before %s", deadline, lambdaDeadline)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/signing"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// SIGNATURE_WINDOW_SECONDS is how far the timestamp of a signed request may be from now
+var signatureWindow = time.Duration(envInt("SIGNATURE_WINDOW_SECONDS", 300)) * time.Second
+
+// the headers of a signed request: the client, the signature of the timestamp and the
+// raw body with the secret of that client, see signing.Sign, and when it was signed in
+// unix seconds
+const (
+	ClientIDHeader           = "X-Client-Id"
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+)
+
+// WithSigningSecrets makes every POST and PUT need a signature of the client in
+// X-Client-Id, with its secret out of secrets. Without secrets nothing is checked.
+func (r *Router) WithSigningSecrets(secrets map[string]string) *Router {
+	r.signingSecrets = secrets
+	return r
+}
+
+// verifySignature checks the signature of a POST or PUT against its timestamp and the
+// raw body, decoded when API Gateway base64 encoded it. A missing header, a timestamp
+// out of the window and a signature that doesn't match are each their own 401.
+func (r *Router) verifySignature(req events.APIGatewayProxyRequest) error {
+
+	if len(r.signingSecrets) == 0 || (req.HTTPMethod != http.MethodPost && req.HTTPMethod != http.MethodPut) {
+		return nil
+	}
+	client := headerValue(req, ClientIDHeader)
+	signature := headerValue(req, SignatureHeader)
+	timestamp := headerValue(req, SignatureTimestampHeader)
+	if len(client) == 0 || len(signature) == 0 || len(timestamp) == 0 {
+		return errors.New(signing.ErrorSignatureMissing)
+	}
+	secret, ok := r.signingSecrets[client]
+	if !ok {
+		return errors.New(signing.ErrorSignatureInvalid)
+	}
+
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return errors.New(ErrorInvalidBase64Body)
+		}
+		body = decoded
+	}
+	return signing.Verify([]byte(secret), body, signature, timestamp, signatureWindow, time.Now())
+
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/signing"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestVerifySignature(t *testing.T) {
+
+	r := NewRouter("users", nil).WithSigningSecrets(map[string]string{"partner": "secret"})
+	body := `{"email":"jane@example.com"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	signed := func(client, timestamp, signature string) map[string]string {
+		return map[string]string{ClientIDHeader: client, SignatureTimestampHeader: timestamp, SignatureHeader: signature}
+	}
+
+	tests := []struct {
+		name    string
+		req     events.APIGatewayProxyRequest
+		wantErr string
+	}{
+		{"signed", events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Body: body, Headers: signed("partner", now, signing.Sign([]byte("secret"), now, []byte(body)))}, ""},
+		{"signed base64 body", events.APIGatewayProxyRequest{HTTPMethod: http.MethodPut, IsBase64Encoded: true, Body: base64.StdEncoding.EncodeToString([]byte(body)), Headers: signed("partner", now, signing.Sign([]byte("secret"), now, []byte(body)))}, ""},
+		{"GET isn't signed", events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet}, ""},
+		{"missing", events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Body: body}, signing.ErrorSignatureMissing},
+		{"unknown client", events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Body: body, Headers: signed("stranger", now, signing.Sign([]byte("secret"), now, []byte(body)))}, signing.ErrorSignatureInvalid},
+		{"stale", events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Body: body, Headers: signed("partner", stale, signing.Sign([]byte("secret"), stale, []byte(body)))}, signing.ErrorSignatureStale},
+		{"replayed with a new timestamp", events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Body: body, Headers: signed("partner", now, signing.Sign([]byte("secret"), stale, []byte(body)))}, signing.ErrorSignatureInvalid},
+		{"invalid base64", events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, IsBase64Encoded: true, Body: "!", Headers: signed("partner", now, "sha256=00")}, ErrorInvalidBase64Body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.verifySignature(tt.req)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("verifySignature = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/tracing"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// traced runs the handler of rt in a subsegment of its own, annotated with the method,
+// the hash of the email of the path and the status. The DynamoDB calls of the handler
+// are subsegments of it.
+func traced(ctx context.Context, req events.APIGatewayProxyRequest, rt route, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	ctx, seg := tracing.Begin(ctx, rt.method+" "+rt.resource)
+	seg.Annotate("method", rt.method)
+	seg.Annotate("resource", rt.resource)
+	if email := emailParam(req); len(email) > 0 {
+		seg.Annotate("email_hash", emailHash(email))
+	}
+
+	resp, err := rt.handler(ctx, req, tableName, dynaClient)
+	if resp != nil {
+		seg.Annotate("status", resp.StatusCode)
+		seg.SetStatus(resp.StatusCode)
+	}
+	seg.Close(err)
+	return resp, err
+
+}
+
+// emailHash stands in for an email in traces, the same user always gets the same one
+func emailHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:8])
+}
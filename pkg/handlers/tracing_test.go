@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/tracing"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestEmailHash(t *testing.T) {
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"same email", "jane@example.com", "jane@example.com", true},
+		{"other case", "Jane@Example.com", "jane@example.com", true},
+		{"other email", "jane@example.com", "john@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := emailHash(tt.a), emailHash(tt.b)
+			if len(a) != 16 {
+				t.Errorf("emailHash(%q) = %q, want 16 hex characters", tt.a, a)
+			}
+			if (a == b) != tt.same {
+				t.Errorf("emailHash(%q) = %q, emailHash(%q) = %q", tt.a, a, tt.b, b)
+			}
+		})
+	}
+
+}
+
+func TestTraced(t *testing.T) {
+
+	t.Setenv("_X_AMZN_TRACE_ID", "")
+
+	tests := []struct {
+		name      string
+		sampled   bool
+		email     string
+		status    int
+		err       error
+		wantFault bool
+	}{
+		{name: "not sampled", status: http.StatusOK},
+		{name: "ok", sampled: true, email: "jane@example.com", status: http.StatusOK},
+		{name: "no email", sampled: true, status: http.StatusOK},
+		{name: "server error", sampled: true, status: http.StatusServiceUnavailable, wantFault: true},
+		{name: "failed", sampled: true, err: errors.New("boom"), wantFault: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seg *tracing.Segment
+			rt := route{method: http.MethodGet, resource: UserResource, handler: func(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+				seg = tracing.FromContext(ctx)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &events.APIGatewayProxyResponse{StatusCode: tt.status}, nil
+			}}
+			header := "Root=1-abc;Parent=def;Sampled=0"
+			if tt.sampled {
+				header = "Root=1-abc;Parent=def;Sampled=1"
+			}
+			ctx := context.WithValue(context.Background(), "x-amzn-trace-id", header)
+			req := events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Resource: UserResource, PathParameters: map[string]string{"email": tt.email}}
+
+			_, err := traced(ctx, req, rt, "users", &fakeDynamo{})
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if !tt.sampled {
+				if seg != nil {
+					t.Errorf("segment = %+v, want none", seg)
+				}
+				return
+			}
+			if seg == nil {
+				t.Fatal("the handler runs without a segment")
+			}
+			if seg.Name != "GET "+UserResource || seg.Annotations["method"] != http.MethodGet || seg.Annotations["resource"] != UserResource {
+				t.Errorf("segment = %+v", seg)
+			}
+			if hash, ok := seg.Annotations["email_hash"]; len(tt.email) > 0 != ok || ok && hash != emailHash(tt.email) {
+				t.Errorf("email_hash = %v", hash)
+			}
+			if tt.err == nil && seg.Annotations["status"] != tt.status {
+				t.Errorf("status = %v, want %d", seg.Annotations["status"], tt.status)
+			}
+			if seg.Fault != tt.wantFault {
+				t.Errorf("fault = %t, want %t", seg.Fault, tt.wantFault)
+			}
+		})
+	}
+
+}
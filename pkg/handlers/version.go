@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/Rahul-71/go-serverless/pkg/buildinfo"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// invocations counts the requests this Lambda instance has served, the first one is the cold start
+var invocations int
+
+type VersionInfo struct {
+	buildinfo.Info
+	FunctionName string `json:"functionName,omitempty"`
+	ColdStart    bool   `json:"coldStart"`
+	// DynamoRetries counts the DynamoDB calls of this instance that were throttled and retried
+	DynamoRetries int64 `json:"dynamoRetries"`
+	// PublishFailures counts the change events of this instance that got lost
+	PublishFailures int64 `json:"publishFailures"`
+	// WelcomeEmailFailures counts the welcome emails of this instance that weren't sent
+	WelcomeEmailFailures int64 `json:"welcomeEmailFailures"`
+	// Panics counts the requests of this instance that panicked and got a 500
+	Panics int64 `json:"panics"`
+}
+
+// Version tells which build is deployed
+func Version(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+	return apiResponse(ctx, http.StatusOK, VersionInfo{
+		Info:                 buildinfo.Get(),
+		FunctionName:         os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		ColdStart:            invocations == 1,
+		DynamoRetries:        user.Retries(),
+		PublishFailures:      PublishFailures(),
+		WelcomeEmailFailures: WelcomeEmailFailures(),
+		Panics:               Panics(),
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	userevents "github.com/Rahul-71/go-serverless/pkg/events"
+	"github.com/Rahul-71/go-serverless/pkg/metrics"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// CreateWebhook subscribes a {"url", "secret", "events"} body to the changes of users.
+// The secret isn't in the response, nor in any other. The deliveries are made by
+// cmd/webhook-dispatcher from the events of the bus, see pkg/webhooks.
+func CreateWebhook(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	if err := checkJSONRequest(req); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	req, err := decodeBody(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	var body struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+	}
+	if err := user.Decode(req.Body, &body); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "CreateWebhook")
+	webhook, err := user.CreateWebhook(ctx, user.Webhook{URL: body.URL, Secret: body.Secret, Events: body.Events}, userevents.Types, tenant, user.CallerIdentity(req), tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	webhook.Secret = ""
+	resp, err := successResponse(ctx, req, http.StatusCreated, webhook)
+	resp.Headers["Location"] = baseURL(req) + WebhooksResource + "/" + webhook.ID
+	return resp, err
+
+}
+
+// GetWebhooks lists the webhooks without their secrets
+func GetWebhooks(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "FetchWebhooks")
+	list, err := user.FetchWebhooks(ctx, tenant, tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	for i := range list {
+		list[i].Secret = ""
+	}
+	return successResponse(ctx, req, http.StatusOK, list)
+
+}
+
+func DeleteWebhook(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient user.DynamoDBAPI) (*events.APIGatewayProxyResponse, error) {
+
+	if err := authorize(req, ""); err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	tenant, err := user.TenantFromRequest(req)
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+
+	done := metrics.Time(ctx, "DeleteWebhook")
+	err = user.DeleteWebhook(ctx, req.PathParameters["id"], tenant, tableName, dynaClient)
+	done()
+	if err != nil {
+		return errorResponse(ctx, req, err)
+	}
+	return emptyResponse(http.StatusNoContent)
+
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/ses/types"
+)
+
+var welcomeEmailFailures int64
+
+// WelcomeEmailFailures is how many welcome emails this instance couldn't send
+func WelcomeEmailFailures() int64 {
+	return atomic.LoadInt64(&welcomeEmailFailures)
+}
+
+// WithWelcomeEmail sends every user created with POST /users the SES template from
+// from, unless the body has "sendWelcomeEmail": false. Without a client nothing is sent.
+func (r *Router) WithWelcomeEmail(client SESAPI, template, from string) *Router {
+	r.ses = client
+	r.welcomeTemplate = template
+	r.welcomeFrom = from
+	return r
+}
+
+// welcomeData are the values the template can use
+type welcomeData struct {
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// sendWelcomeEmail sends the welcome email of a user that was just created. The user
+// stays created whatever happens here, a failure is logged and counted. The opt-out is
+// cleared from u, it's no field of the user.
+func (r *Router) sendWelcomeEmail(ctx context.Context, u *user.User) {
+
+	optOut := u.SendWelcomeEmail != nil && !*u.SendWelcomeEmail
+	u.SendWelcomeEmail = nil
+	if r.ses == nil || optOut {
+		return
+	}
+
+	data, err := json.Marshal(welcomeData{Email: u.Email, FirstName: u.FirstName, LastName: u.LastName})
+	if err != nil {
+		atomic.AddInt64(&welcomeEmailFailures, 1)
+		logging.FromContext(ctx).ErrorContext(ctx, "encoding welcome email failed", "email", u.Email, logging.Err(err))
+		return
+	}
+
+	_, err = r.ses.SendTemplatedEmail(ctx, &ses.SendTemplatedEmailInput{
+		Source:       aws.String(r.welcomeFrom),
+		Destination:  &types.Destination{ToAddresses: []string{u.Email}},
+		Template:     aws.String(r.welcomeTemplate),
+		TemplateData: aws.String(string(data)),
+	})
+	if err != nil {
+		atomic.AddInt64(&welcomeEmailFailures, 1)
+		logging.FromContext(ctx).ErrorContext(ctx, "sending welcome email failed", "template", r.welcomeTemplate, "email", u.Email, logging.Err(err))
+	}
+
+}
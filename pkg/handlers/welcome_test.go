@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+)
+
+type fakeSES struct {
+	sent []*ses.SendTemplatedEmailInput
+	err  error
+}
+
+func (f *fakeSES) SendTemplatedEmail(ctx context.Context, input *ses.SendTemplatedEmailInput, optFns ...func(*ses.Options)) (*ses.SendTemplatedEmailOutput, error) {
+	f.sent = append(f.sent, input)
+	return &ses.SendTemplatedEmailOutput{}, f.err
+}
+
+func TestWelcomeEmail(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		body         string
+		err          error
+		wantSent     bool
+		wantFailures int64
+	}{
+		{name: "sent", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"}`, wantSent: true},
+		{name: "asked for", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe","sendWelcomeEmail":true}`, wantSent: true},
+		{name: "opted out", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe","sendWelcomeEmail":false}`},
+		{name: "ses fails", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"}`, err: errors.New("throttled"), wantSent: true, wantFailures: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeSES{err: tt.err}
+			r := NewRouter("users", &fakeDynamo{}).WithWelcomeEmail(client, "welcome", "hello@example.com")
+			RegisterUserRoutes(r)
+			failures := WelcomeEmailFailures()
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Resource:   UsersResource,
+				Headers:    map[string]string{"Content-Type": "application/json"},
+				Body:       tt.body,
+			}
+			resp, err := r.Dispatch(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the user is created whatever happens to the email
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("status = %d: %s", resp.StatusCode, resp.Body)
+			}
+			if strings.Contains(resp.Body, "sendWelcomeEmail") {
+				t.Errorf("the opt-out is in the response: %s", resp.Body)
+			}
+			if got := WelcomeEmailFailures() - failures; got != tt.wantFailures {
+				t.Errorf("failures = %d, want %d", got, tt.wantFailures)
+			}
+
+			if (len(client.sent) == 1) != tt.wantSent || len(client.sent) > 1 {
+				t.Fatalf("sent %d emails", len(client.sent))
+			}
+			if !tt.wantSent {
+				return
+			}
+			sent := client.sent[0]
+			if aws.ToString(sent.Template) != "welcome" || aws.ToString(sent.Source) != "hello@example.com" || len(sent.Destination.ToAddresses) != 1 || sent.Destination.ToAddresses[0] != "jane@example.com" {
+				t.Errorf("input = %v", sent)
+			}
+			var data welcomeData
+			if err := json.Unmarshal([]byte(aws.ToString(sent.TemplateData)), &data); err != nil || data != (welcomeData{Email: "jane@example.com", FirstName: "Jane", LastName: "Doe"}) {
+				t.Errorf("TemplateData = %s", aws.ToString(sent.TemplateData))
+			}
+		})
+	}
+
+}
+
+func TestWelcomeEmailWithoutClient(t *testing.T) {
+
+	optOut := false
+	tests := []struct {
+		name string
+		opt  *bool
+	}{
+		{"no opt-out", nil},
+		{"opted out", &optOut},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &user.User{Email: "jane@example.com", SendWelcomeEmail: tt.opt}
+			(&Router{}).sendWelcomeEmail(context.Background(), u)
+			if u.SendWelcomeEmail != nil {
+				t.Error("the opt-out isn't cleared")
+			}
+		})
+	}
+
+}
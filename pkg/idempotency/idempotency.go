@@ -0,0 +1,141 @@
+// Package idempotency remembers the responses to requests sent with an Idempotency-Key,
+// so a retried request gets the original response instead of being executed twice.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ErrorKeyReused      = "idempotency key was already used for a different request"
+	ErrorInProgress     = "a request with this idempotency key is still in progress"
+	ErrorDynamoStoreKey = "could not store idempotency key"
+)
+
+const (
+	StatusInProgress = "in-progress"
+	StatusCompleted  = "completed"
+)
+
+// DynamoDBAPI is the part of the DynamoDB client the records need, *dynamodb.Client and
+// the clients of user.WithRetry have it
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// TTL is how long keys are remembered, the table's TTL attribute must be expiresAt
+var TTL = 24 * time.Hour
+
+// Record is the item stored per key, the table's partition key is "key"
+type Record struct {
+	Key             string            `json:"key" dynamodbav:"key"`
+	RequestHash     string            `json:"requestHash" dynamodbav:"requestHash"`
+	Status          string            `json:"status" dynamodbav:"status"`
+	StatusCode      int               `json:"statusCode,omitempty" dynamodbav:"statusCode,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty" dynamodbav:"headers,omitempty"`
+	Body            string            `json:"body,omitempty" dynamodbav:"body,omitempty"`
+	IsBase64Encoded bool              `json:"isBase64Encoded,omitempty" dynamodbav:"isBase64Encoded,omitempty"`
+	ExpiresAt       int64             `json:"expiresAt" dynamodbav:"expiresAt"`
+}
+
+// Acquire claims key for a request. It returns nil when the request should run, the
+// stored record when it already completed, ErrorKeyReused when the key was used with a
+// different requestHash and ErrorInProgress while the first request is still running.
+func Acquire(ctx context.Context, key, requestHash, tableName string, dynaClient DynamoDBAPI) (*Record, error) {
+
+	now := time.Now()
+	item, err := attributevalue.MarshalMap(Record{
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      StatusInProgress,
+		ExpiresAt:   now.Add(TTL).Unix(),
+	})
+	if err != nil {
+		return nil, errors.New(ErrorDynamoStoreKey)
+	}
+
+	// the conditional put is what keeps two concurrent retries from both running,
+	// DynamoDB TTL deletes lazily so expired records count as absent
+	_, err = dynaClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(tableName),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#key) OR #expiresAt < :now"),
+		ExpressionAttributeNames: map[string]string{"#key": "key", "#expiresAt": "expiresAt"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+	if err == nil {
+		return nil, nil
+	}
+
+	var failed *types.ConditionalCheckFailedException
+	if !errors.As(err, &failed) {
+		return nil, errors.New(ErrorDynamoStoreKey)
+	}
+
+	result, err := dynaClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName),
+		Key:            map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, errors.New(ErrorDynamoStoreKey)
+	}
+
+	var record Record
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, errors.New(ErrorDynamoStoreKey)
+	}
+
+	switch {
+	case record.RequestHash != requestHash:
+		return nil, errors.New(ErrorKeyReused)
+	case record.Status != StatusCompleted:
+		return nil, errors.New(ErrorInProgress)
+	}
+	return &record, nil
+
+}
+
+// Complete stores the response of the request that acquired the key
+func Complete(ctx context.Context, record Record, tableName string, dynaClient DynamoDBAPI) error {
+
+	record.Status = StatusCompleted
+	record.ExpiresAt = time.Now().Add(TTL).Unix()
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return errors.New(ErrorDynamoStoreKey)
+	}
+
+	if _, err := dynaClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: item}); err != nil {
+		return errors.New(ErrorDynamoStoreKey)
+	}
+	return nil
+
+}
+
+// Release forgets the key, for requests that failed in a way worth retrying
+func Release(ctx context.Context, key, tableName string, dynaClient DynamoDBAPI) error {
+
+	_, err := dynaClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key:       map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+	})
+	if err != nil {
+		return errors.New(ErrorDynamoStoreKey)
+	}
+	return nil
+
+}
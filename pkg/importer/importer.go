@@ -0,0 +1,364 @@
+// Package importer upserts the users of NDJSON and CSV objects dropped in S3, the
+// counterpart of pkg/export. Every object gets a report next to it.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var (
+	ErrorObjectTooLarge    = "object too large"
+	ErrorUnsupportedFormat = "unsupported format, must be .ndjson, .jsonl or .csv"
+	ErrorInvalidRow        = "invalid row"
+	ErrorReadObject        = "could not read object"
+	ErrorWriteReport       = "could not write report"
+)
+
+// ReportSuffix is appended to the key of an object for the key of its report, objects
+// with it are never imported
+const ReportSuffix = ".report.json"
+
+// S3API is every S3 call of an import, *s3.Client has them all
+type S3API interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+var _ S3API = (*s3.Client)(nil)
+
+// CreatedBy is who the imported users are created and updated by
+const CreatedBy = "s3-import"
+
+// rows are upserted this many at a time, one BatchWriteItem each
+const chunkSize = 25
+
+// lines of NDJSON longer than this are invalid rows
+const maxLineBytes = 1024 * 1024
+
+// Options limit what gets imported
+type Options struct {
+	// MaxBytes is the size above which objects are refused
+	MaxBytes int64
+}
+
+// OptionsFromEnv reads IMPORT_MAX_BYTES, 100 MB by default
+func OptionsFromEnv() Options {
+
+	opts := Options{MaxBytes: 100 * 1024 * 1024}
+	if value, err := strconv.ParseInt(os.Getenv("IMPORT_MAX_BYTES"), 10, 64); err == nil && value > 0 {
+		opts.MaxBytes = value
+	}
+	return opts
+
+}
+
+type Failure struct {
+	Line   int    `json:"line"`
+	Email  string `json:"email,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Report is written as JSON to the key of the object with ReportSuffix. ETag is the one
+// of the object imported, an object that already has a report for its ETag was imported
+// and is skipped when the event is delivered again.
+type Report struct {
+	Bucket   string    `json:"bucket"`
+	Key      string    `json:"key"`
+	ETag     string    `json:"etag"`
+	Imported int       `json:"imported"`
+	Skipped  int       `json:"skipped"`
+	Errored  int       `json:"errored"`
+	Error    string    `json:"error,omitempty"`
+	Skips    []Failure `json:"skips"`
+	Errors   []Failure `json:"errors"`
+}
+
+// ProcessEvent imports the objects of the records one after the other. A failure of
+// DynamoDB or S3 is returned so Lambda retries the event, rows imported by an earlier
+// try are unchanged and skipped the second time.
+func ProcessEvent(ctx context.Context, event events.S3Event, opts Options, tableName string, dynaClient user.DynamoDBAPI, s3Client S3API) error {
+
+	for _, record := range event.Records {
+		bucket := record.S3.Bucket.Name
+		// keys in S3 events are URL encoded, spaces as +
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			key = record.S3.Object.Key
+		}
+		if strings.HasSuffix(key, ReportSuffix) {
+			continue
+		}
+
+		report, err := ImportObject(ctx, bucket, key, opts, tableName, dynaClient, s3Client)
+		if err != nil {
+			log.Printf("import of s3://%s/%s failed: %v", bucket, key, err)
+			return err
+		}
+		if report != nil {
+			log.Printf("imported s3://%s/%s: imported %d, skipped %d, errored %d", bucket, key, report.Imported, report.Skipped, report.Errored)
+		}
+	}
+	return nil
+
+}
+
+// ImportObject imports one object and writes its report. An object that already has a
+// report is nil, nothing is done.
+func ImportObject(ctx context.Context, bucket, key string, opts Options, tableName string, dynaClient user.DynamoDBAPI, s3Client S3API) (*Report, error) {
+
+	head, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ErrorReadObject, err)
+	}
+	report := &Report{Bucket: bucket, Key: key, ETag: aws.ToString(head.ETag), Skips: []Failure{}, Errors: []Failure{}}
+
+	done, err := imported(ctx, report, s3Client)
+	if err != nil || done {
+		return nil, err
+	}
+
+	// refused objects get a report too, retrying won't make them fit
+	format := formatOf(key)
+	switch {
+	case aws.ToInt64(head.ContentLength) > opts.MaxBytes:
+		report.Error = fmt.Sprintf("%s: %d bytes, at most %d", ErrorObjectTooLarge, aws.ToInt64(head.ContentLength), opts.MaxBytes)
+	case len(format) == 0:
+		report.Error = ErrorUnsupportedFormat
+	default:
+		object, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(bucket),
+			Key:     aws.String(key),
+			IfMatch: head.ETag,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ErrorReadObject, err)
+		}
+		defer object.Body.Close()
+
+		if err := importRows(ctx, format, object.Body, report, tableName, dynaClient); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeReport(ctx, report, s3Client); err != nil {
+		return nil, err
+	}
+	return report, nil
+
+}
+
+func formatOf(key string) string {
+	lower := strings.ToLower(key)
+	switch {
+	case strings.HasSuffix(lower, ".ndjson"), strings.HasSuffix(lower, ".jsonl"):
+		return "ndjson"
+	case strings.HasSuffix(lower, ".csv"):
+		return "csv"
+	}
+	return ""
+}
+
+// row is a user read from the object and the line it starts on
+type row struct {
+	line int
+	user user.User
+}
+
+// importRows reads the rows one at a time and upserts them in chunks, the object is
+// never in memory as a whole
+func importRows(ctx context.Context, format string, body io.Reader, report *Report, tableName string, dynaClient user.DynamoDBAPI) error {
+
+	var chunk []row
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		err := upsertChunk(ctx, chunk, report, tableName, dynaClient)
+		chunk = chunk[:0]
+		return err
+	}
+	add := func(r row) error {
+		chunk = append(chunk, r)
+		if len(chunk) < chunkSize {
+			return nil
+		}
+		return flush()
+	}
+	invalid := func(line int, reason string) {
+		report.Errored++
+		report.Errors = append(report.Errors, Failure{Line: line, Reason: reason})
+	}
+
+	var err error
+	if format == "csv" {
+		err = readCSV(body, add, invalid)
+	} else {
+		err = readNDJSON(body, add, invalid)
+	}
+	if err != nil {
+		return err
+	}
+	return flush()
+
+}
+
+// readCSV reads email,firstName,lastName rows with an optional header, like POST
+// /users/import
+func readCSV(body io.Reader, add func(row) error, invalid func(int, string)) error {
+
+	r := csv.NewReader(body)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.ReuseRecord = true
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			invalid(perr.StartLine, ErrorInvalidRow)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%s: %v", ErrorReadObject, err)
+		}
+		line, _ := r.FieldPos(0)
+
+		if line == 1 && strings.EqualFold(record[0], "email") {
+			continue
+		}
+		if len(record) != 3 {
+			invalid(line, fmt.Sprintf("%s: %d columns, want email,firstName,lastName", ErrorInvalidRow, len(record)))
+			continue
+		}
+		if err := add(row{line, user.User{Email: record[0], FirstName: record[1], LastName: record[2]}}); err != nil {
+			return err
+		}
+	}
+
+}
+
+// readNDJSON reads a user per line, the way pkg/export writes them. Blank lines are
+// ignored.
+func readNDJSON(body io.Reader, add func(row) error, invalid func(int, string)) error {
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var u user.User
+		if err := json.Unmarshal(raw, &u); err != nil {
+			invalid(line, ErrorInvalidRow)
+			continue
+		}
+		if err := add(row{line, u}); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", ErrorReadObject, err)
+	}
+	return nil
+
+}
+
+func upsertChunk(ctx context.Context, chunk []row, report *Report, tableName string, dynaClient user.DynamoDBAPI) error {
+
+	users := make([]user.User, len(chunk))
+	for i, r := range chunk {
+		users[i] = r.user
+		// what the server keeps track of isn't taken from the object
+		users[i].Version = 0
+		users[i].Verified = false
+	}
+	results, err := user.UpsertUsers(ctx, users, CreatedBy, tableName, dynaClient)
+	if err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		failure := Failure{Line: chunk[i].line, Email: result.Email, Reason: result.Reason}
+		switch result.Status {
+		case user.BatchStatusCreated, user.BatchStatusUpdated:
+			report.Imported++
+		case user.BatchStatusUnchanged, user.BatchStatusAlreadyExists:
+			if len(failure.Reason) == 0 {
+				failure.Reason = "unchanged"
+			}
+			report.Skipped++
+			report.Skips = append(report.Skips, failure)
+		default:
+			report.Errored++
+			report.Errors = append(report.Errors, failure)
+		}
+	}
+	return nil
+
+}
+
+// imported is true when the report of the object is there for the same ETag
+func imported(ctx context.Context, report *Report, s3Client S3API) (bool, error) {
+
+	object, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(report.Bucket),
+		Key:    aws.String(report.Key + ReportSuffix),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: %v", ErrorReadObject, err)
+	}
+	defer object.Body.Close()
+
+	var previous Report
+	if err := json.NewDecoder(object.Body).Decode(&previous); err != nil {
+		return false, nil
+	}
+	return previous.ETag == report.ETag, nil
+
+}
+
+func writeReport(ctx context.Context, report *Report, s3Client S3API) error {
+
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%s: %v", ErrorWriteReport, err)
+	}
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(report.Bucket),
+		Key:         aws.String(report.Key + ReportSuffix),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %v", ErrorWriteReport, err)
+	}
+	return nil
+
+}
@@ -0,0 +1,83 @@
+// Package logging sets up the JSON logs of the functions and carries the logger of a
+// request in its context, so what pkg/user logs is tagged with the request it's for.
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// Setup makes a JSON logger on stdout the default, at the level of LOG_LEVEL: debug,
+// info, warn or error, info when it's missing or unknown. The log package writes
+// through it too. It's called once per cold start.
+func Setup() *slog.Logger {
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: Level(os.Getenv("LOG_LEVEL"))}))
+	slog.SetDefault(logger)
+	return logger
+
+}
+
+// Level parses a LOG_LEVEL
+func Level(value string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a context that FromContext gets logger from
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext is the logger of the request ctx is for, or the default one outside of
+// a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// Err is the error attribute of a log line. An AWS error also gets its code, and the
+// status and request ID of the response when there was one, to look the call up with.
+func Err(err error) slog.Attr {
+
+	if err == nil {
+		return slog.String("error", "")
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		var response *awshttp.ResponseError
+		if errors.As(err, &response) {
+			return slog.Group("error",
+				slog.String("message", err.Error()),
+				slog.String("code", apiErr.ErrorCode()),
+				slog.Int("status", response.HTTPStatusCode()),
+				slog.String("awsRequestId", response.ServiceRequestID()),
+			)
+		}
+		return slog.Group("error",
+			slog.String("message", err.Error()),
+			slog.String("code", apiErr.ErrorCode()),
+		)
+	}
+	return slog.String("error", err.Error())
+
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"testing"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestLevel(t *testing.T) {
+
+	tests := []struct {
+		value string
+		want  slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{" DEBUG ", slog.LevelDebug},
+		{"info", slog.LevelInfo},
+		{"warn", slog.LevelWarn},
+		{"warning", slog.LevelWarn},
+		{"error", slog.LevelError},
+		{"", slog.LevelInfo},
+		{"verbose", slog.LevelInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := Level(tt.value); got != tt.want {
+				t.Errorf("Level(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestFromContext(t *testing.T) {
+
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want *slog.Logger
+	}{
+		{"request logger", WithLogger(context.Background(), logger), logger},
+		{"outside of a request", context.Background(), slog.Default()},
+		{"nil context", nil, slog.Default()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromContext(tt.ctx); got != tt.want {
+				t.Errorf("FromContext = %p, want %p", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestErr(t *testing.T) {
+
+	v2Response := &smithy.OperationError{ServiceID: "DynamoDB", OperationName: "GetItem", Err: &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusBadRequest}},
+			Err:      &smithy.GenericAPIError{Code: "ProvisionedThroughputExceededException", Message: "slow down"},
+		},
+		RequestID: "v2-request",
+	}}
+
+	tests := []struct {
+		name string
+		err  error
+		want interface{}
+	}{
+		{"nil", nil, ""},
+		{"plain", errors.New("failed"), "failed"},
+		{"v2 without response", &smithy.GenericAPIError{Code: "ValidationException", Message: "bad"}, map[string]interface{}{
+			"message": "api error ValidationException: bad",
+			"code":    "ValidationException",
+		}},
+		{"v2 with response", v2Response, map[string]interface{}{
+			"message":      v2Response.Error(),
+			"code":         "ProvisionedThroughputExceededException",
+			"status":       float64(http.StatusBadRequest),
+			"awsRequestId": "v2-request",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			slog.New(slog.NewJSONHandler(&buf, nil)).Info("failed", Err(tt.err))
+
+			var line map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(line["error"], tt.want) {
+				t.Errorf("error = %#v, want %#v", line["error"], tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,212 @@
+// Package metrics writes the metrics of an invocation as one CloudWatch Embedded Metric
+// Format line to stdout, CloudWatch Logs extracts them. With METRICS_ENABLED unset
+// nothing is recorded and nothing is allocated.
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// METRICS_ENABLED=true turns the metrics on, they go to the METRICS_NAMESPACE namespace
+var (
+	enabled   = os.Getenv("METRICS_ENABLED") == "true"
+	namespace = envString("METRICS_NAMESPACE", "GoServerless")
+)
+
+// output is where the EMF lines go, the log of the function
+var output io.Writer = os.Stdout
+
+// the dimensions and metrics of every line
+const (
+	DimensionOperation   = "operation"
+	DimensionStatusClass = "statusClass"
+
+	MetricCount           = "Count"
+	MetricLatency         = "Latency"
+	MetricDynamoRetries   = "DynamoRetries"
+	MetricUserCallLatency = "UserCallLatency"
+)
+
+// Enabled is true when METRICS_ENABLED=true
+func Enabled() bool {
+	return enabled
+}
+
+// Recorder accumulates the metrics of one invocation
+type Recorder struct {
+	mu    sync.Mutex
+	start time.Time
+	// calls is the time every call of the user package took, in milliseconds
+	calls []call
+	// counts are the metrics of Add
+	counts map[string]float64
+}
+
+type call struct {
+	Name      string  `json:"name"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+type recorderKey struct{}
+
+// Begin returns a context with a new recorder, ctx itself when the metrics are off
+func Begin(ctx context.Context) context.Context {
+	if !enabled {
+		return ctx
+	}
+	return context.WithValue(ctx, recorderKey{}, &Recorder{start: time.Now()})
+}
+
+// FromContext is the recorder of Begin, nil when there's none
+func FromContext(ctx context.Context) *Recorder {
+	if !enabled {
+		return nil
+	}
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
+
+func noop() {}
+
+// Time starts timing a call named name and returns the function that stops it
+func Time(ctx context.Context, name string) func() {
+
+	r := FromContext(ctx)
+	if r == nil {
+		return noop
+	}
+	start := time.Now()
+	return func() {
+		r.mu.Lock()
+		r.calls = append(r.calls, call{Name: name, LatencyMs: milliseconds(time.Since(start))})
+		r.mu.Unlock()
+	}
+
+}
+
+// Add adds value to the count named name, it's one more metric of the line
+func Add(ctx context.Context, name string, value float64) {
+	r := FromContext(ctx)
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.counts == nil {
+		r.counts = map[string]float64{}
+	}
+	r.counts[name] += value
+	r.mu.Unlock()
+}
+
+// Flush writes the EMF line of the invocation: one request of operation answered with
+// status, its latency since Begin, the DynamoDB retries it took, the latencies of the
+// calls timed and the counts added. properties are written along, they're no dimensions.
+func Flush(ctx context.Context, operation string, status int, retries int64, properties map[string]interface{}) {
+
+	r := FromContext(ctx)
+	if r == nil {
+		return
+	}
+	line, err := r.document(operation, status, retries, properties, time.Now())
+	if err != nil {
+		return
+	}
+	output.Write(append(line, '\n'))
+
+}
+
+// document is the EMF document of the recorder at now
+func (r *Recorder) document(operation string, status int, retries int64, properties map[string]interface{}, now time.Time) ([]byte, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	definitions := []metricDefinition{
+		{Name: MetricCount, Unit: "Count"},
+		{Name: MetricLatency, Unit: "Milliseconds"},
+		{Name: MetricDynamoRetries, Unit: "Count"},
+	}
+	doc := map[string]interface{}{}
+	for key, value := range properties {
+		doc[key] = value
+	}
+	doc[DimensionOperation] = operation
+	doc[DimensionStatusClass] = StatusClass(status)
+	doc[MetricCount] = 1
+	doc[MetricLatency] = milliseconds(now.Sub(r.start))
+	doc[MetricDynamoRetries] = retries
+	doc["status"] = status
+
+	if len(r.calls) > 0 {
+		latencies := make([]float64, len(r.calls))
+		for i, c := range r.calls {
+			latencies[i] = c.LatencyMs
+		}
+		definitions = append(definitions, metricDefinition{Name: MetricUserCallLatency, Unit: "Milliseconds"})
+		doc[MetricUserCallLatency] = latencies
+		doc["userCalls"] = r.calls
+	}
+
+	names := make([]string, 0, len(r.counts))
+	for name := range r.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		definitions = append(definitions, metricDefinition{Name: name, Unit: "Count"})
+		doc[name] = r.counts[name]
+	}
+
+	doc["_aws"] = metadata{
+		Timestamp: now.UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []metricDirective{{
+			Namespace:  namespace,
+			Dimensions: [][]string{{DimensionOperation, DimensionStatusClass}},
+			Metrics:    definitions,
+		}},
+	}
+	return json.Marshal(doc)
+
+}
+
+type metadata struct {
+	Timestamp         int64             `json:"Timestamp"`
+	CloudWatchMetrics []metricDirective `json:"CloudWatchMetrics"`
+}
+
+type metricDirective struct {
+	Namespace  string             `json:"Namespace"`
+	Dimensions [][]string         `json:"Dimensions"`
+	Metrics    []metricDefinition `json:"Metrics"`
+}
+
+type metricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// StatusClass is 2xx, 4xx, 5xx and so on
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func envString(name, fallback string) string {
+	if value := os.Getenv(name); len(value) > 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// enable turns the metrics on for a test and returns what they write
+func enable(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	previous, previousOutput := enabled, output
+	t.Cleanup(func() { enabled, output = previous, previousOutput })
+	buf := &bytes.Buffer{}
+	enabled, output = true, buf
+	return buf
+}
+
+func TestStatusClass(t *testing.T) {
+
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{200, "2xx"},
+		{204, "2xx"},
+		{304, "3xx"},
+		{404, "4xx"},
+		{429, "4xx"},
+		{503, "5xx"},
+		{0, "unknown"},
+		{600, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := StatusClass(tt.status); got != tt.want {
+			t.Errorf("StatusClass(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+
+}
+
+func TestDisabled(t *testing.T) {
+
+	buf := enable(t)
+	enabled = false
+
+	ctx := Begin(context.Background())
+	if FromContext(ctx) != nil {
+		t.Fatal("a recorder while the metrics are off")
+	}
+	Time(ctx, "GetUser")()
+	Add(ctx, "Panics", 1)
+	Flush(ctx, "GET /users/{email}", 200, 0, nil)
+	if buf.Len() > 0 {
+		t.Errorf("output = %s, want none", buf)
+	}
+
+}
+
+func TestFlush(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		status      int
+		retries     int64
+		calls       []string
+		counts      map[string]float64
+		properties  map[string]interface{}
+		wantClass   string
+		wantMetrics []string
+	}{
+		{
+			name:        "plain",
+			status:      200,
+			wantClass:   "2xx",
+			wantMetrics: []string{MetricCount, MetricLatency, MetricDynamoRetries},
+		},
+		{
+			name:        "calls and retries",
+			status:      404,
+			retries:     2,
+			calls:       []string{"FetchUser", "UpdateUser"},
+			wantClass:   "4xx",
+			wantMetrics: []string{MetricCount, MetricLatency, MetricDynamoRetries, MetricUserCallLatency},
+		},
+		{
+			name:        "counts",
+			status:      500,
+			counts:      map[string]float64{"Panics": 1, "AvatarBytes": 2048},
+			properties:  map[string]interface{}{"requestId": "req-1"},
+			wantClass:   "5xx",
+			wantMetrics: []string{MetricCount, MetricLatency, MetricDynamoRetries, "AvatarBytes", "Panics"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := enable(t)
+			ctx := Begin(context.Background())
+			if FromContext(ctx) == nil {
+				t.Fatal("no recorder while the metrics are on")
+			}
+			for _, name := range tt.calls {
+				Time(ctx, name)()
+			}
+			for name, value := range tt.counts {
+				// added twice, the line has the sum
+				Add(ctx, name, value/2)
+				Add(ctx, name, value/2)
+			}
+
+			Flush(ctx, "GET /users/{email}", tt.status, tt.retries, tt.properties)
+			line := buf.Bytes()
+			if len(line) == 0 || line[len(line)-1] != '\n' || bytes.Count(line, []byte("\n")) != 1 {
+				t.Fatalf("output = %q, want one line", line)
+			}
+
+			var doc struct {
+				AWS struct {
+					Timestamp         int64
+					CloudWatchMetrics []struct {
+						Namespace  string
+						Dimensions [][]string
+						Metrics    []struct{ Name, Unit string }
+					}
+				} `json:"_aws"`
+				Operation     string                   `json:"operation"`
+				StatusClass   string                   `json:"statusClass"`
+				Status        int                      `json:"status"`
+				Count         float64                  `json:"Count"`
+				Latency       float64                  `json:"Latency"`
+				DynamoRetries int64                    `json:"DynamoRetries"`
+				CallLatency   []float64                `json:"UserCallLatency"`
+				Calls         []map[string]interface{} `json:"userCalls"`
+			}
+			if err := json.Unmarshal(line, &doc); err != nil {
+				t.Fatalf("%v: %s", err, line)
+			}
+			if delta := time.Now().UnixMilli() - doc.AWS.Timestamp; delta < 0 || delta > 10000 {
+				t.Errorf("Timestamp = %d", doc.AWS.Timestamp)
+			}
+			if len(doc.AWS.CloudWatchMetrics) != 1 {
+				t.Fatalf("CloudWatchMetrics = %+v", doc.AWS.CloudWatchMetrics)
+			}
+			directive := doc.AWS.CloudWatchMetrics[0]
+			if directive.Namespace != namespace || !reflect.DeepEqual(directive.Dimensions, [][]string{{DimensionOperation, DimensionStatusClass}}) {
+				t.Errorf("directive = %+v", directive)
+			}
+			var names []string
+			for _, m := range directive.Metrics {
+				names = append(names, m.Name)
+				want := "Count"
+				if m.Name == MetricLatency || m.Name == MetricUserCallLatency {
+					want = "Milliseconds"
+				}
+				if m.Unit != want {
+					t.Errorf("unit of %s = %q, want %q", m.Name, m.Unit, want)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.wantMetrics) {
+				t.Errorf("metrics = %v, want %v", names, tt.wantMetrics)
+			}
+
+			if doc.Operation != "GET /users/{email}" || doc.StatusClass != tt.wantClass || doc.Status != tt.status {
+				t.Errorf("dimensions = %q, %q, %d", doc.Operation, doc.StatusClass, doc.Status)
+			}
+			if doc.Count != 1 || doc.Latency < 0 || doc.DynamoRetries != tt.retries {
+				t.Errorf("count, latency, retries = %v, %v, %d", doc.Count, doc.Latency, doc.DynamoRetries)
+			}
+			if len(doc.CallLatency) != len(tt.calls) || len(doc.Calls) != len(tt.calls) {
+				t.Fatalf("calls = %v, %v, want %d", doc.CallLatency, doc.Calls, len(tt.calls))
+			}
+			for i, name := range tt.calls {
+				if doc.Calls[i]["name"] != name {
+					t.Errorf("call %d = %v, want %s", i, doc.Calls[i], name)
+				}
+			}
+
+			var values map[string]interface{}
+			json.Unmarshal(line, &values)
+			for name, value := range tt.counts {
+				if values[name] != value {
+					t.Errorf("%s = %v, want %v", name, values[name], value)
+				}
+			}
+			for key, value := range tt.properties {
+				if values[key] != value {
+					t.Errorf("property %s = %v, want %v", key, values[key], value)
+				}
+			}
+		})
+	}
+
+}
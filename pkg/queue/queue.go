@@ -0,0 +1,70 @@
+// Package queue creates users from the messages of an SQS queue, for bulk onboarding
+// that shouldn't go through the API one request at a time.
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// TenantAttribute is the message attribute with the tenant of the user, it's needed
+// with MULTI_TENANT on
+const TenantAttribute = "tenantId"
+
+// ProcessMessages creates a user from the body of every message, the same body as a
+// POST /users. A user that already exists counts as created, a message delivered twice
+// is no failure. Everything else that fails is reported in BatchItemFailures, so only
+// those messages go back to the queue and, once the redrive policy gives up, to its
+// dead letter queue. The event source mapping needs ReportBatchItemFailures.
+func ProcessMessages(ctx context.Context, event events.SQSEvent, tableName string, dynaClient user.DynamoDBAPI) events.SQSEventResponse {
+
+	response := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+	for _, message := range event.Records {
+		err := processMessage(ctx, message, tableName, dynaClient)
+		switch {
+		case err == nil:
+		case err.Error() == user.ErrorUserAlreadyExists:
+			log.Printf("message %s: user already exists, nothing to do", message.MessageId)
+		case strings.HasPrefix(err.Error(), user.ErrorInvalidUserData):
+			// retrying won't fix the body, it ends up in the dead letter queue
+			log.Printf("message %s: malformed body: %v", message.MessageId, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+		default:
+			log.Printf("message %s: %v", message.MessageId, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+		}
+	}
+	return response
+
+}
+
+// processMessage hands the message to CreateUser as the request it stands for, created
+// by the queue and in the tenant of its attribute
+func processMessage(ctx context.Context, message events.SQSMessage, tableName string, dynaClient user.DynamoDBAPI) error {
+
+	if len(strings.TrimSpace(message.Body)) == 0 {
+		return errors.New(user.ErrorInvalidUserData)
+	}
+
+	claims := map[string]interface{}{"sub": message.EventSourceARN}
+	if tenant := message.MessageAttributes[TenantAttribute].StringValue; tenant != nil && len(*tenant) > 0 {
+		claims[TenantAttribute] = *tenant
+	}
+	req := events.APIGatewayProxyRequest{
+		Body:           message.Body,
+		RequestContext: events.APIGatewayProxyRequestContext{Authorizer: claims},
+	}
+
+	u, err := user.CreateUser(ctx, req, tableName, dynaClient)
+	if err != nil {
+		return err
+	}
+	log.Printf("message %s: created %s", message.MessageId, u.Email)
+	return nil
+
+}
@@ -0,0 +1,64 @@
+// Package ratelimit limits how many requests a client may make per minute. Every client
+// gets a bucket of tokens that is refilled at the start of each minute, the bucket is a
+// DynamoDB counter so all Lambda instances share it.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrorDynamoUpdateBucket = "could not update rate limit bucket"
+
+// UpdateItemAPI is the one DynamoDB call the buckets need
+type UpdateItemAPI interface {
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+}
+
+// Allow takes a token from the bucket of client. When the bucket is empty it returns
+// false and how long until it's refilled. The table is keyed by "key" with TTL on expiresAt.
+func Allow(ctx context.Context, client string, perMinute int, tableName string, dynaClient UpdateItemAPI) (bool, time.Duration, error) {
+
+	now := time.Now()
+	window := now.Truncate(time.Minute)
+	refill := window.Add(time.Minute)
+
+	// ADD is atomic, concurrent requests each get their own count back
+	result, err := dynaClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"key": &types.AttributeValueMemberS{Value: client + "#" + strconv.FormatInt(window.Unix(), 10)},
+		},
+		UpdateExpression:         aws.String("ADD #count :one SET #expiresAt = :expiresAt"),
+		ExpressionAttributeNames: map[string]string{"#count": "count", "#expiresAt": "expiresAt"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":       &types.AttributeValueMemberN{Value: "1"},
+			":expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(refill.Add(time.Minute).Unix(), 10)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return false, 0, errors.New(ErrorDynamoUpdateBucket)
+	}
+
+	attr, ok := result.Attributes["count"].(*types.AttributeValueMemberN)
+	if !ok {
+		return false, 0, errors.New(ErrorDynamoUpdateBucket)
+	}
+	count, err := strconv.Atoi(attr.Value)
+	if err != nil {
+		return false, 0, errors.New(ErrorDynamoUpdateBucket)
+	}
+
+	if count > perMinute {
+		return false, refill.Sub(now), nil
+	}
+	return true, 0, nil
+
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type fakeBuckets func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
+
+func (f fakeBuckets) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return f(input)
+}
+
+func TestAllow(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		attributes  map[string]types.AttributeValue
+		err         error
+		wantAllowed bool
+		wantErr     bool
+	}{
+		{name: "first request", attributes: map[string]types.AttributeValue{"count": &types.AttributeValueMemberN{Value: "1"}}, wantAllowed: true},
+		{name: "last token", attributes: map[string]types.AttributeValue{"count": &types.AttributeValueMemberN{Value: "3"}}, wantAllowed: true},
+		{name: "bucket empty", attributes: map[string]types.AttributeValue{"count": &types.AttributeValueMemberN{Value: "4"}}},
+		{name: "no count", attributes: map[string]types.AttributeValue{}, wantErr: true},
+		{name: "update fails", err: errors.New("throttled"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input *dynamodb.UpdateItemInput
+			client := fakeBuckets(func(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				input = in
+				return &dynamodb.UpdateItemOutput{Attributes: tt.attributes}, tt.err
+			})
+
+			allowed, retryAfter, err := Allow(context.Background(), "ip:203.0.113.7", 3, "buckets", client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			if allowed != tt.wantAllowed {
+				t.Errorf("allowed = %t, want %t", allowed, tt.wantAllowed)
+			}
+			if !tt.wantErr && !allowed && retryAfter <= 0 {
+				t.Errorf("retryAfter = %s", retryAfter)
+			}
+			key, _ := input.Key["key"].(*types.AttributeValueMemberS)
+			if aws.ToString(input.TableName) != "buckets" || key == nil || !strings.HasPrefix(key.Value, "ip:203.0.113.7#") {
+				t.Errorf("input = %+v", input)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,133 @@
+// Package redact masks the personal data of users, emails and names, wherever it's
+// written somewhere it shouldn't be in full: logs, audit records, events.
+package redact
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mask replaces what's hidden
+const Mask = "***"
+
+// the JSON fields whose values are names, compared without case
+var nameFields = map[string]bool{
+	"firstname": true,
+	"lastname":  true,
+	"name":      true,
+	"fullname":  true,
+}
+
+// the JSON fields whose values are secrets and masked in full, compared without case
+var secretFields = map[string]bool{
+	"password": true,
+	"secret":   true,
+	"token":    true,
+	"apikey":   true,
+	"key":      true,
+}
+
+// emails inside free text, looser than validators.IsEmailValid on purpose
+var emailRegexp = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// Email keeps the first character of the local part and the domain, j***@example.com.
+// Anything without an @ is masked as a whole.
+func Email(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return Name(email)
+	}
+	return Name(email[:at]) + email[at:]
+}
+
+// Name keeps the first character, J***. An empty name stays empty.
+func Name(name string) string {
+	if len(name) == 0 {
+		return ""
+	}
+	_, size := utf8.DecodeRuneInString(name)
+	return name[:size] + Mask
+}
+
+// Text masks every email in s
+func Text(s string) string {
+	return emailRegexp.ReplaceAllStringFunc(s, Email)
+}
+
+// JSON masks the emails anywhere in a JSON document and the values of name fields, at
+// any depth. The values of secret fields, whatever they are, become Mask. What isn't JSON is masked as Text.
+func JSON(body []byte) []byte {
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return []byte(Text(string(body)))
+	}
+	masked, err := json.Marshal(value("", doc))
+	if err != nil {
+		return []byte(Text(string(body)))
+	}
+	return masked
+
+}
+
+func value(field string, v interface{}) interface{} {
+	if secretFields[strings.ToLower(field)] {
+		return Mask
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = value(key, child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = value(field, child)
+		}
+		return v
+	case string:
+		if nameFields[strings.ToLower(field)] {
+			return Name(v)
+		}
+		return Text(v)
+	}
+	return v
+}
+
+// CSV masks every field of email,firstName,lastName rows, the format of the imports: the
+// emails as Email, the rest as Name, the header aside. What isn't CSV is masked as Text.
+func CSV(body []byte) []byte {
+
+	r := csv.NewReader(bytes.NewReader(body))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return []byte(Text(string(body)))
+	}
+	for n, record := range records {
+		// the header of the import format stays
+		if n == 0 && len(record) > 0 && strings.EqualFold(record[0], "email") {
+			continue
+		}
+		for i, field := range record {
+			switch {
+			case strings.Contains(field, "@"):
+				record[i] = Email(field)
+			case i > 0:
+				record[i] = Name(field)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.WriteAll(records)
+	return buf.Bytes()
+
+}
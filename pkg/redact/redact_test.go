@@ -0,0 +1,69 @@
+package redact
+
+import "testing"
+
+func TestEmail(t *testing.T) {
+
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"jane@example.com", "j***@example.com"},
+		{"Émile@example.com", "É***@example.com"},
+		{"@example.com", "@***"},
+		{"jane", "j***"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if got := Email(tt.email); got != tt.want {
+				t.Errorf("Email(%q) = %q, want %q", tt.email, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestJSON(t *testing.T) {
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"names", `{"firstName":"Jane","LASTNAME":"Doe","status":"active"}`, `{"LASTNAME":"D***","firstName":"J***","status":"active"}`},
+		{"emails at any depth", `{"users":[{"email":"jane@example.com"}],"note":"mail bob@example.org"}`, `{"note":"mail b***@example.org","users":[{"email":"j***@example.com"}]}`},
+		{"secrets", `{"password":"hunter2","Token":"abc","apiKey":"k1","key":{"id":1},"secret":7}`, `{"Token":"***","apiKey":"***","key":"***","password":"***","secret":"***"}`},
+		{"numbers kept", `{"version":12345678901234567890}`, `{"version":12345678901234567890}`},
+		{"not JSON", `email=jane@example.com`, `email=j***@example.com`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(JSON([]byte(tt.body))); got != tt.want {
+				t.Errorf("JSON(%s) = %s, want %s", tt.body, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestCSV(t *testing.T) {
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"rows", "email,firstName,lastName\njane@example.com,Jane,Doe\n", "email,firstName,lastName\nj***@example.com,J***,D***\n"},
+		{"no header", "jane@example.com,Jane\n", "j***@example.com,J***\n"},
+		{"not CSV", "\"jane@example.com", "\"j***@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(CSV([]byte(tt.body))); got != tt.want {
+				t.Errorf("CSV(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Dynamo is the UserRepository of the DynamoDB table, it's the pkg/user functions
+type Dynamo struct {
+	tableName  string
+	dynaClient user.DynamoDBAPI
+}
+
+func NewDynamo(tableName string, dynaClient user.DynamoDBAPI) *Dynamo {
+	return &Dynamo{tableName: tableName, dynaClient: dynaClient}
+}
+
+func (d *Dynamo) Get(ctx context.Context, email, tenant string, consistent bool, fields ...string) (*user.User, error) {
+	// eventually consistent reads may as well come from the cache of USER_CACHE_SIZE
+	fetch := user.FetchUserCached
+	if consistent {
+		fetch = user.FetchUserConsistent
+	}
+	u, err := fetch(ctx, email, tenant, d.tableName, d.dynaClient, fields...)
+	return u, translate(err)
+}
+
+func (d *Dynamo) List(ctx context.Context, filters map[string]string, tenant string, fields ...string) ([]user.User, bool, error) {
+	users, complete, err := user.FetchUsers(ctx, filters, tenant, d.tableName, d.dynaClient, fields...)
+	if err != nil {
+		return nil, false, translate(err)
+	}
+	return *users, complete, nil
+}
+
+func (d *Dynamo) Create(ctx context.Context, req events.APIGatewayProxyRequest) (*user.User, error) {
+	u, err := user.CreateUser(ctx, req, d.tableName, d.dynaClient)
+	return u, translate(err)
+}
+
+func (d *Dynamo) Update(ctx context.Context, req events.APIGatewayProxyRequest, expectedVersion *int64, upsert bool) (*user.User, *user.User, error) {
+	u, previous, err := user.UpdateUser(ctx, req, expectedVersion, upsert, d.tableName, d.dynaClient)
+	return u, previous, translate(err)
+}
+
+func (d *Dynamo) Delete(ctx context.Context, email, tenant string, conditions map[string]string) (*user.User, error) {
+	u, err := user.DeleteUser(ctx, email, tenant, conditions, d.tableName, d.dynaClient)
+	return u, translate(err)
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Memory is a UserRepository in a map, for tests and local development. Users are
+// checked and filled in like in the table, they're gone with the process. Reads are
+// always consistent and return every field.
+type Memory struct {
+	mu    sync.Mutex
+	users map[string]user.User
+}
+
+func NewMemory() *Memory {
+	return &Memory{users: map[string]user.User{}}
+}
+
+// find returns the key a user is stored under, users stored under the email in a
+// different case are found like through EmailLowerIndex
+func (m *Memory) find(email string) (string, bool) {
+	if _, ok := m.users[email]; ok {
+		return email, true
+	}
+	lower := strings.ToLower(email)
+	for key := range m.users {
+		if strings.ToLower(key) == lower {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// visible is the stored user under email that the tenant may see
+func (m *Memory) visible(email, tenant string) (string, user.User, error) {
+	key, ok := m.find(validators.NormalizeEmail(email))
+	if !ok {
+		return "", user.User{}, translate(errors.New(user.ErrorUserDoesNotExists))
+	}
+	u := m.users[key]
+	if !u.Visible(tenant) {
+		return "", user.User{}, translate(errors.New(user.ErrorUserDoesNotExists))
+	}
+	return key, u, nil
+}
+
+func (m *Memory) Get(ctx context.Context, email, tenant string, consistent bool, fields ...string) (*user.User, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, u, err := m.visible(email, tenant)
+	if err != nil {
+		return nil, err
+	}
+	return clone(u), nil
+
+}
+
+// List returns the matching users by email, it's always complete
+func (m *Memory) List(ctx context.Context, filters map[string]string, tenant string, fields ...string) ([]user.User, bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := []user.User{}
+	for _, u := range m.users {
+		matches, err := user.MatchesFilters(u, filters)
+		if err != nil {
+			return nil, false, err
+		}
+		if matches && u.Visible(tenant) {
+			users = append(users, *clone(u))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users, true, nil
+
+}
+
+func (m *Memory) Create(ctx context.Context, req events.APIGatewayProxyRequest) (*user.User, error) {
+
+	u, err := user.NewUserFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// emails are unique across tenants, like in the table
+	if _, ok := m.find(u.Email); ok {
+		return nil, translate(errors.New(user.ErrorUserAlreadyExists))
+	}
+	stored := clone(*u)
+	stored.SendWelcomeEmail = nil
+	m.users[u.Email] = *stored
+	return u, nil
+
+}
+
+func (m *Memory) Update(ctx context.Context, req events.APIGatewayProxyRequest, expectedVersion *int64, upsert bool) (*user.User, *user.User, error) {
+
+	update, err := user.UpdateFromRequest(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, stored, err := m.visible(update.Email, update.TenantID)
+	switch {
+	case err == nil:
+		if expectedVersion != nil && *expectedVersion != stored.Version {
+			return nil, nil, translate(errors.New(user.ErrorVersionMismatch))
+		}
+		if err := user.CheckConditions(&stored, update.IfMatch); err != nil {
+			return nil, nil, err
+		}
+	case errors.Is(err, ErrNotFound) && upsert && expectedVersion == nil && len(update.IfMatch) == 0:
+		if _, taken := m.find(update.Email); taken {
+			return nil, nil, translate(errors.New(user.ErrorUserAlreadyExists))
+		}
+		if err := user.PrepareUpsert(update, user.CallerIdentity(req)); err != nil {
+			return nil, nil, err
+		}
+		m.users[update.Email] = *clone(*update)
+		return update, nil, nil
+	default:
+		return nil, nil, err
+	}
+
+	previous := clone(stored)
+	if err := user.ApplyUpdate(&stored, update, user.CallerIdentity(req)); err != nil {
+		return nil, nil, err
+	}
+	m.users[key] = stored
+	return clone(stored), previous, nil
+
+}
+
+func (m *Memory) Delete(ctx context.Context, email, tenant string, conditions map[string]string) (*user.User, error) {
+
+	if !validators.IsEmailValid(validators.NormalizeEmail(email)) {
+		return nil, errors.New(user.ErrorInvalidEmail)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, u, err := m.visible(email, tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.CheckConditions(&u, conditions); err != nil {
+		return nil, err
+	}
+	delete(m.users, key)
+	return clone(u), nil
+
+}
+
+// clone copies u so neither the caller nor the map sees changes of the other
+func clone(u user.User) *user.User {
+	if u.Metadata != nil {
+		metadata := make(map[string]string, len(u.Metadata))
+		for k, v := range u.Metadata {
+			metadata[k] = v
+		}
+		u.Metadata = metadata
+	}
+	if u.ExpiresAt != nil {
+		expiresAt := *u.ExpiresAt
+		u.ExpiresAt = &expiresAt
+	}
+	return &u
+}
@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// memoryWith is a Memory holding users as they'd be stored
+func memoryWith(users ...user.User) *Memory {
+	m := NewMemory()
+	for _, u := range users {
+		if u.Version == 0 {
+			u.Version = 1
+		}
+		m.users[u.Email] = u
+	}
+	return m
+}
+
+func body(s string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{Body: s}
+}
+
+func TestTranslate(t *testing.T) {
+
+	tests := []struct {
+		message string
+		kind    error
+	}{
+		{user.ErrorUserDoesNotExists, ErrNotFound},
+		{user.ErrorUserAlreadyExists, ErrConflict},
+		{user.ErrorVersionConflict, ErrConflict},
+		{user.ErrorVersionMismatch, ErrConflict},
+		{user.ErrorInvalidEmail, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			err := translate(errors.New(tt.message))
+			if err.Error() != tt.message {
+				t.Errorf("message = %q, want %q", err.Error(), tt.message)
+			}
+			for _, kind := range []error{ErrNotFound, ErrConflict} {
+				if errors.Is(err, kind) != (kind == tt.kind) {
+					t.Errorf("errors.Is(%v) = %t", kind, !(kind == tt.kind))
+				}
+			}
+		})
+	}
+	if translate(nil) != nil {
+		t.Error("translate(nil) isn't nil")
+	}
+
+}
+
+func TestMemoryCreate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		body     string
+		wantKind error
+		wantErr  string
+	}{
+		{name: "created", body: `{"email":"bob@example.com","firstName":"Bob","lastName":"Doe"}`},
+		{name: "exists", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"}`, wantKind: ErrConflict},
+		{name: "exists in other case", body: `{"email":"JANE@example.com","firstName":"Jane","lastName":"Doe"}`, wantKind: ErrConflict},
+		{name: "invalid email", body: `{"email":"bob","firstName":"Bob","lastName":"Doe"}`, wantErr: user.ErrorInvalidEmail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memoryWith(user.User{Email: "jane@example.com"})
+
+			u, err := m.Create(context.Background(), body(tt.body))
+			if tt.wantKind != nil || len(tt.wantErr) > 0 {
+				if err == nil || (tt.wantKind != nil && !errors.Is(err, tt.wantKind)) || (len(tt.wantErr) > 0 && err.Error() != tt.wantErr) {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Version != 1 || len(u.CreatedAt) == 0 || u.Role != user.RoleUser {
+				t.Errorf("user = %+v", u)
+			}
+			if stored, err := m.Get(context.Background(), "bob@example.com", "", true); err != nil || stored.FirstName != "Bob" {
+				t.Errorf("stored = %+v, %v", stored, err)
+			}
+		})
+	}
+
+}
+
+func TestMemoryUpdate(t *testing.T) {
+
+	two, three := int64(2), int64(3)
+	tests := []struct {
+		name            string
+		body            string
+		expectedVersion *int64
+		upsert          bool
+		wantKind        error
+		wantPrevious    bool
+		wantVersion     int64
+	}{
+		{name: "updated", body: `{"email":"jane@example.com","firstName":"Janet"}`, wantPrevious: true, wantVersion: 3},
+		{name: "expected version", body: `{"email":"jane@example.com","firstName":"Janet"}`, expectedVersion: &two, wantPrevious: true, wantVersion: 3},
+		{name: "other version expected", body: `{"email":"jane@example.com","firstName":"Janet"}`, expectedVersion: &three, wantKind: ErrConflict},
+		{name: "missing", body: `{"email":"bob@example.com","firstName":"Bob"}`, wantKind: ErrNotFound},
+		{name: "upsert", body: `{"email":"bob@example.com","firstName":"Bob","lastName":"Doe"}`, upsert: true, wantVersion: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memoryWith(user.User{Email: "jane@example.com", FirstName: "Jane", LastName: "Doe", Version: 2})
+
+			u, previous, err := m.Update(context.Background(), body(tt.body), tt.expectedVersion, tt.upsert)
+			if tt.wantKind != nil {
+				if !errors.Is(err, tt.wantKind) {
+					t.Fatalf("err = %v, want %v", err, tt.wantKind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (previous != nil) != tt.wantPrevious || u.Version != tt.wantVersion {
+				t.Errorf("user = %+v, previous = %+v", u, previous)
+			}
+			if previous != nil && (previous.FirstName != "Jane" || previous.Version != 2) {
+				t.Errorf("previous = %+v", previous)
+			}
+			if tt.wantPrevious && u.LastName != "Doe" {
+				t.Errorf("lastName = %q, empty fields are kept", u.LastName)
+			}
+		})
+	}
+
+}
+
+func TestMemoryDelete(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		email      string
+		tenant     string
+		conditions map[string]string
+		wantKind   error
+		wantErr    bool
+	}{
+		{name: "deleted", email: "jane@example.com"},
+		{name: "other case", email: "Jane@Example.com"},
+		{name: "in tenant", email: "jane@example.com", tenant: "acme"},
+		{name: "other tenant", email: "jane@example.com", tenant: "globex", wantKind: ErrNotFound},
+		{name: "missing", email: "bob@example.com", wantKind: ErrNotFound},
+		{name: "condition holds", email: "jane@example.com", conditions: map[string]string{"status": user.StatusActive}},
+		{name: "condition fails", email: "jane@example.com", conditions: map[string]string{"status": user.StatusSuspended}, wantErr: true},
+		{name: "invalid email", email: "jane", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memoryWith(user.User{Email: "jane@example.com", TenantID: "acme", Status: user.StatusActive})
+
+			u, err := m.Delete(context.Background(), tt.email, tt.tenant, tt.conditions)
+			if tt.wantKind != nil || tt.wantErr {
+				if err == nil || (tt.wantKind != nil && !errors.Is(err, tt.wantKind)) {
+					t.Fatalf("err = %v", err)
+				}
+				if _, err := m.Get(context.Background(), "jane@example.com", "", true); err != nil {
+					t.Errorf("the user is gone: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Email != "jane@example.com" {
+				t.Errorf("user = %+v", u)
+			}
+			if _, err := m.Get(context.Background(), "jane@example.com", "", true); !errors.Is(err, ErrNotFound) {
+				t.Errorf("still stored: %v", err)
+			}
+		})
+	}
+
+}
+
+func TestMemoryList(t *testing.T) {
+
+	m := memoryWith(
+		user.User{Email: "carol@example.com", FirstName: "Carol", TenantID: "globex"},
+		user.User{Email: "alice@example.com", FirstName: "Alice", TenantID: "acme", Role: user.RoleAdmin},
+		user.User{Email: "bob@example.com", FirstName: "Bob", TenantID: "acme"},
+	)
+
+	tests := []struct {
+		name    string
+		filters map[string]string
+		tenant  string
+		want    []string
+		wantErr bool
+	}{
+		{name: "everybody", want: []string{"alice@example.com", "bob@example.com", "carol@example.com"}},
+		{name: "tenant", tenant: "acme", want: []string{"alice@example.com", "bob@example.com"}},
+		{name: "role", filters: map[string]string{"role": user.RoleUser}, want: []string{"bob@example.com", "carol@example.com"}},
+		{name: "prefix", filters: map[string]string{user.FilterKey("firstName", user.FilterBeginsWith): "Ca"}, want: []string{"carol@example.com"}},
+		{name: "invalid filter", filters: map[string]string{"passwordHash": "x"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, complete, err := m.List(context.Background(), tt.filters, tt.tenant)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil || !complete {
+				t.Fatalf("complete = %t, err = %v", complete, err)
+			}
+			if len(users) != len(tt.want) {
+				t.Fatalf("users = %v, want %v", users, tt.want)
+			}
+			for i, u := range users {
+				if u.Email != tt.want[i] {
+					t.Errorf("users[%d] = %s, want %s", i, u.Email, tt.want[i])
+				}
+			}
+		})
+	}
+
+}
+
+func TestMemoryClones(t *testing.T) {
+
+	m := memoryWith(user.User{Email: "jane@example.com", Metadata: map[string]string{"plan": "free"}})
+
+	u, err := m.Get(context.Background(), "jane@example.com", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.FirstName = "Changed"
+	u.Metadata["plan"] = "pro"
+
+	stored, _ := m.Get(context.Background(), "jane@example.com", "", true)
+	if stored.FirstName != "" || stored.Metadata["plan"] != "free" {
+		t.Errorf("the stored user changed with the returned one: %+v", stored)
+	}
+
+}
@@ -0,0 +1,74 @@
+// Package repository is the storage the user handlers depend on. Dynamo keeps users in
+// the DynamoDB table through pkg/user, Memory in a map for tests and local development.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// the kinds of failure every store reports the same way, test for them with errors.Is.
+// The errors returned keep the message of pkg/user, so the API answers as before.
+var (
+	ErrNotFound = errors.New("user not found")
+	ErrConflict = errors.New("user conflicts with the stored one")
+)
+
+// UserRepository reads and writes single users and lists them. Every method reads the
+// tenant the way pkg/user does, "" is every user. Requests are passed as they came in,
+// the stores decode and check them with the pkg/user functions.
+type UserRepository interface {
+	// Get returns the user stored under email, fields limits what is read. A read that
+	// isn't consistent may be answered from a cache.
+	Get(ctx context.Context, email, tenant string, consistent bool, fields ...string) (*user.User, error)
+	// List returns the users matching filters, complete is false when there are more
+	List(ctx context.Context, filters map[string]string, tenant string, fields ...string) (users []user.User, complete bool, err error)
+	// Create stores the user of a POST
+	Create(ctx context.Context, req events.APIGatewayProxyRequest) (*user.User, error)
+	// Update applies a PUT, see user.UpdateUser for expectedVersion and upsert. previous
+	// is the user it overwrote, nil when it created one.
+	Update(ctx context.Context, req events.APIGatewayProxyRequest, expectedVersion *int64, upsert bool) (u, previous *user.User, err error)
+	// Delete removes the user and returns what was stored, only while it matches the
+	// conditions if there are any, see user.DeleteUser
+	Delete(ctx context.Context, email, tenant string, conditions map[string]string) (*user.User, error)
+}
+
+// kindError is an error of pkg/user that is also one of the kinds above
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// kinds of the pkg/user error messages
+var errorKinds = map[string]error{
+	user.ErrorUserDoesNotExists: ErrNotFound,
+	user.ErrorUserAlreadyExists: ErrConflict,
+	user.ErrorVersionConflict:   ErrConflict,
+	user.ErrorVersionMismatch:   ErrConflict,
+}
+
+// translate tags a pkg/user error with its kind, anything else is returned as it is
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+	if kind, ok := errorKinds[err.Error()]; ok {
+		return &kindError{kind: kind, err: err}
+	}
+	return err
+}
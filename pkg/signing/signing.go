@@ -0,0 +1,125 @@
+// Package signing verifies the HMAC-SHA256 signatures partners put on their requests.
+// Every client has its own shared secret, named by its client ID.
+//
+// What's signed is the timestamp of the request, its unix seconds as sent, a dot and the
+// raw body:
+//
+//	1700000000.{"email":"jane@example.com"}
+//
+// The signature is sha256= and the hex HMAC-SHA256 of that with the secret. The timestamp
+// being signed is what keeps an old signature from being replayed with a new timestamp.
+package signing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+var (
+	ErrorSignatureMissing = "missing signature"
+	ErrorSignatureStale   = "stale signature timestamp"
+	ErrorSignatureInvalid = "invalid signature"
+	ErrorInvalidSecrets   = "invalid signing secrets"
+	ErrorLoadSecrets      = "could not load signing secrets"
+)
+
+// Sign is the signature of body sent at timestamp with secret, see the package doc for
+// what's signed
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks signature, with or without its sha256= prefix, is that of body sent at
+// timestamp with secret, and the unix seconds of timestamp are within window of now
+func Verify(secret, body []byte, signature, timestamp string, window time.Duration, now time.Time) error {
+
+	if len(signature) == 0 || len(timestamp) == 0 {
+		return errors.New(ErrorSignatureMissing)
+	}
+	timestamp = strings.TrimSpace(timestamp)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New(ErrorSignatureStale)
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > window || skew < -window {
+		return errors.New(ErrorSignatureStale)
+	}
+
+	got, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil {
+		return errors.New(ErrorSignatureInvalid)
+	}
+	want, _ := hex.DecodeString(strings.TrimPrefix(Sign(secret, timestamp, body), "sha256="))
+	if !hmac.Equal(got, want) {
+		return errors.New(ErrorSignatureInvalid)
+	}
+	return nil
+
+}
+
+// ParseSecrets reads client1=secret1,client2=secret2, the format of SIGNING_SECRETS
+func ParseSecrets(value string) (map[string]string, error) {
+
+	secrets := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		client, secret, ok := strings.Cut(pair, "=")
+		client, secret = strings.TrimSpace(client), strings.TrimSpace(secret)
+		if !ok || len(client) == 0 || len(secret) == 0 {
+			return nil, fmt.Errorf("%s: want client=secret pairs", ErrorInvalidSecrets)
+		}
+		secrets[client] = secret
+	}
+	return secrets, nil
+
+}
+
+// LoadSSM reads the secrets stored as parameters under prefix, SecureStrings decrypted.
+// The last element of the name of a parameter is the client ID: /signing/partner is the
+// secret of partner.
+func LoadSSM(ctx context.Context, prefix string, client ssm.GetParametersByPathAPIClient) (map[string]string, error) {
+
+	secrets := map[string]string{}
+	pages := ssm.NewGetParametersByPathPaginator(client, &ssm.GetParametersByPathInput{
+		Path:           aws.String(prefix),
+		WithDecryption: aws.Bool(true),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ErrorLoadSecrets, err)
+		}
+		for _, p := range page.Parameters {
+			if id := basename(aws.ToString(p.Name)); len(id) > 0 && len(aws.ToString(p.Value)) > 0 {
+				secrets[id] = aws.ToString(p.Value)
+			}
+		}
+	}
+	return secrets, nil
+
+}
+
+func basename(name string) string {
+	name = path.Base(name)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
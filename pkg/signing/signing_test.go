@@ -0,0 +1,140 @@
+package signing
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestSign(t *testing.T) {
+
+	tests := []struct {
+		timestamp string
+		body      string
+		want      string
+	}{
+		// printf '1700000000.{}' | openssl dgst -sha256 -hmac secret
+		{"1700000000", "{}", "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timestamp, func(t *testing.T) {
+			if got := Sign([]byte("secret"), tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestVerify(t *testing.T) {
+
+	secret := []byte("secret")
+	body := []byte(`{"email":"jane@example.com"}`)
+	now := time.Unix(1700000000, 0)
+	signed := Sign(secret, "1700000000", body)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		timestamp string
+		wantErr   string
+	}{
+		{"valid", body, signed, "1700000000", ""},
+		{"valid without prefix", body, signed[len("sha256="):], "1700000000", ""},
+		{"valid within window", body, Sign(secret, "1699999800", body), "1699999800", ""},
+		{"missing signature", body, "", "1700000000", ErrorSignatureMissing},
+		{"missing timestamp", body, signed, "", ErrorSignatureMissing},
+		{"stale", body, Sign(secret, "1699999000", body), "1699999000", ErrorSignatureStale},
+		{"from the future", body, Sign(secret, "1700001000", body), "1700001000", ErrorSignatureStale},
+		{"timestamp not a number", body, signed, "yesterday", ErrorSignatureStale},
+		{"timestamp replaced", body, signed, "1700000001", ErrorSignatureInvalid},
+		{"body changed", []byte(`{"email":"bob@example.com"}`), signed, "1700000000", ErrorSignatureInvalid},
+		{"other secret", body, Sign([]byte("other"), "1700000000", body), "1700000000", ErrorSignatureInvalid},
+		{"not hex", body, "sha256=zz", "1700000000", ErrorSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(secret, tt.body, tt.signature, tt.timestamp, 5*time.Minute, now)
+			if got := errString(err); got != tt.wantErr {
+				t.Errorf("Verify = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+
+}
+
+func TestParseSecrets(t *testing.T) {
+
+	tests := []struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"a=1, b = 2,", map[string]string{"a": "1", "b": "2"}, false},
+		{"a=1=2", map[string]string{"a": "1=2"}, false},
+		{"a", nil, true},
+		{"a=", nil, true},
+		{"=1", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSecrets(tt.value)
+			if (err != nil) != tt.wantErr || (err == nil && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("ParseSecrets = %v %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+}
+
+// fakeSSM serves its parameters one per page
+type fakeSSM struct {
+	parameters []types.Parameter
+	err        error
+}
+
+func (f *fakeSSM) GetParametersByPath(ctx context.Context, input *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	page, _ := strconv.Atoi(aws.ToString(input.NextToken))
+	output := &ssm.GetParametersByPathOutput{Parameters: f.parameters[page : page+1]}
+	if page+1 < len(f.parameters) {
+		output.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	return output, nil
+}
+
+func TestLoadSSM(t *testing.T) {
+
+	client := &fakeSSM{parameters: []types.Parameter{
+		{Name: aws.String("/signing/partner"), Value: aws.String("s1")},
+		{Name: aws.String("/signing/empty"), Value: aws.String("")},
+		{Name: aws.String("/signing/other"), Value: aws.String("s2")},
+	}}
+	secrets, err := LoadSSM(context.Background(), "/signing", client)
+	if err != nil || !reflect.DeepEqual(secrets, map[string]string{"partner": "s1", "other": "s2"}) {
+		t.Errorf("LoadSSM = %v %v", secrets, err)
+	}
+
+	if _, err := LoadSSM(context.Background(), "/signing", &fakeSSM{err: errors.New("denied")}); err == nil {
+		t.Error("a failed read isn't an error")
+	}
+
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,243 @@
+// Package spec builds an OpenAPI 3.0 document. Schemas are derived from the Go structs
+// through reflection, so the document follows struct changes without being edited.
+package spec
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Document struct {
+	OpenAPI    string                        `json:"openapi"`
+	Info       Info                          `json:"info"`
+	Paths      map[string]map[string]Op      `json:"paths"`
+	Components map[string]map[string]*Schema `json:"components,omitempty"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Op struct {
+	Summary     string              `json:"summary,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *Body               `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type Body struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Endpoint describes one method on one path. Request and Response are sample values
+// (e.g. user.User{}) whose types become the schemas, nil means no body.
+type Endpoint struct {
+	Method   string
+	Path     string
+	Summary  string
+	Status   int
+	Request  interface{}
+	Response interface{}
+	Errors   interface{}
+}
+
+// Build assembles the document. Named struct types end up under components/schemas and
+// are referenced from the operations.
+func Build(title, version string, endpoints []Endpoint) *Document {
+
+	doc := &Document{
+		OpenAPI:    "3.0.3",
+		Info:       Info{Title: title, Version: version},
+		Paths:      map[string]map[string]Op{},
+		Components: map[string]map[string]*Schema{"schemas": {}},
+	}
+	schemas := doc.Components["schemas"]
+
+	for _, e := range endpoints {
+		op := Op{Summary: e.Summary, Responses: map[string]Response{}}
+
+		for _, name := range pathParams(e.Path) {
+			op.Parameters = append(op.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+
+		if e.Request != nil {
+			op.RequestBody = &Body{Required: true, Content: map[string]MediaType{
+				"application/json": {Schema: SchemaOf(reflect.TypeOf(e.Request), schemas)},
+			}}
+		}
+
+		status := e.Status
+		if status == 0 {
+			status = 200
+		}
+		resp := Response{Description: "success"}
+		if e.Response != nil {
+			resp.Content = map[string]MediaType{
+				"application/json": {Schema: SchemaOf(reflect.TypeOf(e.Response), schemas)},
+			}
+		}
+		op.Responses[strconv.Itoa(status)] = resp
+
+		if e.Errors != nil {
+			op.Responses["default"] = Response{Description: "error", Content: map[string]MediaType{
+				"application/problem+json": {Schema: SchemaOf(reflect.TypeOf(e.Errors), schemas)},
+			}}
+		}
+
+		if doc.Paths[e.Path] == nil {
+			doc.Paths[e.Path] = map[string]Op{}
+		}
+		doc.Paths[e.Path][strings.ToLower(e.Method)] = op
+	}
+
+	return doc
+
+}
+
+// SchemaOf describes t. Named structs are stored in schemas once and referenced.
+func SchemaOf(t reflect.Type, schemas map[string]*Schema) *Schema {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if isTime(t) {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: SchemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: SchemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			// placeholder first, so self-referencing types don't recurse forever
+			schemas[t.Name()] = &Schema{}
+			*schemas[t.Name()] = *structSchema(t, schemas)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+
+	return &Schema{}
+
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// isTime is true for time.Time and for structs that only wrap one, they marshal to a
+// timestamp string
+func isTime(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	return t.Kind() == reflect.Struct && t.NumField() == 1 && t.Field(0).Anonymous && t.Field(0).Type == timeType
+}
+
+// structSchema uses the json tags: the tag name is the property, fields without
+// omitempty are always present and therefore required
+func structSchema(t reflect.Type, schemas map[string]*Schema) *Schema {
+
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+
+		// embedded structs without a name are flattened, as encoding/json does
+		if f.Anonymous && tag[0] == "" {
+			embedded := f.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := structSchema(embedded, schemas)
+				for name, prop := range inner.Properties {
+					s.Properties[name] = prop
+				}
+				s.Required = append(s.Required, inner.Required...)
+				continue
+			}
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = SchemaOf(f.Type, schemas)
+
+		omitempty := false
+		for _, opt := range tag[1:] {
+			omitempty = omitempty || opt == "omitempty"
+		}
+		if !omitempty && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	sort.Strings(s.Required)
+	return s
+
+}
+
+// pathParams returns the {name} placeholders of a path
+func pathParams(path string) []string {
+	var names []string
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			names = append(names, strings.Trim(part, "{}"))
+		}
+	}
+	return names
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+type requestSegmentKey struct{}
+
+// AWSConfig adds a subsegment to every call of the clients made from cfg afterwards,
+// like xray.AWSV2Instrumentor of the X-Ray SDK: the operation, the table of DynamoDB
+// calls, the request ID and the status, and the trace header on the request. A call made
+// with a context that isn't traced isn't either.
+func AWSConfig(cfg *aws.Config) *aws.Config {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		// after the service metadata, so the operation is known
+		if err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("tracing.Segment", segmentMiddleware), middleware.After); err != nil {
+			return err
+		}
+		return stack.Build.Add(middleware.BuildMiddlewareFunc("tracing.Header", headerMiddleware), middleware.After)
+	})
+	return cfg
+}
+
+func segmentMiddleware(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+
+	ctx, seg := Begin(ctx, awsmiddleware.GetServiceID(ctx))
+	if seg == nil {
+		return next.HandleInitialize(ctx, in)
+	}
+	seg.Namespace = "aws"
+
+	out, metadata, err := next.HandleInitialize(setRequestSegment(ctx, seg), in)
+
+	info := map[string]interface{}{
+		"operation": awsmiddleware.GetOperationName(ctx),
+		"region":    awsmiddleware.GetRegion(ctx),
+	}
+	if id, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+		info["request_id"] = id
+	}
+	if attempts, ok := retry.GetAttemptResults(metadata); ok && len(attempts.Results) > 0 {
+		info["retries"] = len(attempts.Results) - 1
+	}
+	if table := tableName(in.Parameters); len(table) > 0 {
+		info["table_name"] = table
+	}
+	seg.mu.Lock()
+	seg.AWS = info
+	seg.mu.Unlock()
+
+	var failure *awshttp.ResponseError
+	if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+		seg.SetStatus(resp.StatusCode)
+	} else if errors.As(err, &failure) {
+		seg.SetStatus(failure.HTTPStatusCode())
+	}
+	seg.Close(err)
+	return out, metadata, err
+
+}
+
+func headerMiddleware(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+	if seg, ok := ctx.Value(requestSegmentKey{}).(*Segment); ok {
+		if req, ok := in.Request.(*smithyhttp.Request); ok {
+			req.Header.Set(TraceHeader, seg.header())
+		}
+	}
+	return next.HandleBuild(ctx, in)
+}
+
+// tableName is the TableName of the input of a call, "" for calls without one
+func tableName(params interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(params))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	field := v.FieldByName("TableName")
+	if !field.IsValid() {
+		return ""
+	}
+	name, _ := field.Interface().(*string)
+	return aws.ToString(name)
+}
+
+func setRequestSegment(ctx context.Context, seg *Segment) context.Context {
+	return context.WithValue(ctx, requestSegmentKey{}, seg)
+}
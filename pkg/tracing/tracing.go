@@ -0,0 +1,230 @@
+// Package tracing sends X-Ray subsegments for the handlers and the AWS calls they make,
+// straight to the X-Ray daemon Lambda runs next to the function. Without the trace
+// header of a sampled invocation, locally or in tests, every call of it is a no-op.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+// TraceHeader is the header of the trace context, in requests to AWS and from Lambda
+const TraceHeader = "X-Amzn-Trace-Id"
+
+// the context key aws-lambda-go puts the trace header of the invocation under
+const lambdaTraceKey = "x-amzn-trace-id"
+
+// Segment is a subsegment of the trace of the invocation, see the X-Ray segment
+// documents. All of its methods do nothing on a nil Segment.
+type Segment struct {
+	mu sync.Mutex
+
+	ID          string                 `json:"id"`
+	TraceID     string                 `json:"trace_id"`
+	ParentID    string                 `json:"parent_id"`
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"`
+	Namespace   string                 `json:"namespace,omitempty"`
+	StartTime   float64                `json:"start_time"`
+	EndTime     float64                `json:"end_time"`
+	Error       bool                   `json:"error,omitempty"`
+	Fault       bool                   `json:"fault,omitempty"`
+	Throttle    bool                   `json:"throttle,omitempty"`
+	Cause       *cause                 `json:"cause,omitempty"`
+	HTTP        *httpInfo              `json:"http,omitempty"`
+	AWS         map[string]interface{} `json:"aws,omitempty"`
+	Annotations map[string]interface{} `json:"annotations,omitempty"`
+}
+
+type cause struct {
+	Exceptions []exception `json:"exceptions"`
+}
+
+type exception struct {
+	ID      string `json:"id"`
+	Type    string `json:"type,omitempty"`
+	Message string `json:"message"`
+}
+
+type httpInfo struct {
+	Response struct {
+		Status int `json:"status"`
+	} `json:"response"`
+}
+
+type segmentKey struct{}
+
+// Begin starts a subsegment of the one in ctx, or of the invocation when there's none,
+// and returns a context carrying it. It's nil when the invocation isn't sampled.
+func Begin(ctx context.Context, name string) (context.Context, *Segment) {
+
+	traceID, parentID, ok := parent(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	seg := &Segment{
+		ID:        newID(),
+		TraceID:   traceID,
+		ParentID:  parentID,
+		Type:      "subsegment",
+		Name:      name,
+		StartTime: epoch(time.Now()),
+	}
+	return context.WithValue(ctx, segmentKey{}, seg), seg
+
+}
+
+// FromContext is the segment Begin put in ctx, nil when there's none
+func FromContext(ctx context.Context) *Segment {
+	seg, _ := ctx.Value(segmentKey{}).(*Segment)
+	return seg
+}
+
+// parent is the trace and the parent of a new subsegment: the segment in ctx, or the
+// trace header of the invocation when it's sampled
+func parent(ctx context.Context) (string, string, bool) {
+
+	if seg := FromContext(ctx); seg != nil {
+		return seg.TraceID, seg.ID, true
+	}
+	header, _ := ctx.Value(lambdaTraceKey).(string)
+	if len(header) == 0 {
+		header = os.Getenv("_X_AMZN_TRACE_ID")
+	}
+
+	var traceID, parentID string
+	sampled := false
+	for _, part := range strings.Split(header, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "Root":
+			traceID = value
+		case "Parent":
+			parentID = value
+		case "Sampled":
+			sampled = value == "1"
+		}
+	}
+	return traceID, parentID, sampled && len(traceID) > 0 && len(parentID) > 0
+
+}
+
+// Annotate adds an indexed annotation, values must be strings, numbers or booleans
+func (s *Segment) Annotate(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Annotations == nil {
+		s.Annotations = map[string]interface{}{}
+	}
+	s.Annotations[key] = value
+}
+
+// SetStatus records the HTTP status of the response, a 4xx marks an error, a 429 a
+// throttle too, a 5xx a fault
+func (s *Segment) SetStatus(status int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.HTTP = &httpInfo{}
+	s.HTTP.Response.Status = status
+	s.Error = status >= 400 && status < 500
+	s.Throttle = status == 429
+	s.Fault = status >= 500
+}
+
+// Close ends the subsegment and sends it, err is its cause. A failed send is dropped,
+// tracing never fails a request.
+func (s *Segment) Close(err error) {
+
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.EndTime = epoch(time.Now())
+	if err != nil {
+		if !s.Error && !s.Throttle {
+			s.Fault = true
+		}
+		e := exception{ID: newID(), Message: err.Error()}
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			e.Type = apiErr.ErrorCode()
+		}
+		s.Cause = &cause{Exceptions: []exception{e}}
+	}
+	doc, merr := json.Marshal(s)
+	s.mu.Unlock()
+
+	if merr == nil {
+		daemon.send(doc)
+	}
+
+}
+
+// header is the trace header of calls made within the subsegment
+func (s *Segment) header() string {
+	return "Root=" + s.TraceID + ";Parent=" + s.ID + ";Sampled=1"
+}
+
+func epoch(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// the X-Ray daemon listens for segment documents on UDP, each after this header line
+const daemonHeader = "{\"format\": \"json\", \"version\": 1}\n"
+
+// AWS_XRAY_DAEMON_ADDRESS is set by Lambda, the daemon of a local run listens on
+// 127.0.0.1:2000
+type daemonConn struct {
+	once sync.Once
+	conn net.Conn
+}
+
+var daemon = &daemonConn{}
+
+func (d *daemonConn) send(doc []byte) {
+
+	d.once.Do(func() {
+		address := daemonAddress(os.Getenv("AWS_XRAY_DAEMON_ADDRESS"))
+		d.conn, _ = net.Dial("udp", address)
+	})
+	if d.conn == nil {
+		return
+	}
+	d.conn.Write(append([]byte(daemonHeader), doc...))
+
+}
+
+// daemonAddress takes host:port or the "tcp:host:port udp:host:port" form
+func daemonAddress(value string) string {
+	for _, part := range strings.Fields(value) {
+		if address, ok := strings.CutPrefix(part, "udp:"); ok {
+			return address
+		}
+		if !strings.HasPrefix(part, "tcp:") {
+			return part
+		}
+	}
+	return "127.0.0.1:2000"
+}
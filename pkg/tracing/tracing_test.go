@@ -0,0 +1,254 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+)
+
+// listen points the daemon at a local UDP listener and returns it
+func listen(t *testing.T) net.PacketConn {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	previous := daemon
+	t.Cleanup(func() { daemon = previous })
+	daemon = &daemonConn{}
+	daemon.once.Do(func() {
+		daemon.conn, err = net.Dial("udp", pc.LocalAddr().String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pc
+}
+
+// received reads the next segment document the daemon got
+func received(t *testing.T, pc net.PacketConn) *Segment {
+	t.Helper()
+	buf := make([]byte, 64*1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, ok := bytes.CutPrefix(buf[:n], []byte(daemonHeader))
+	if !ok {
+		t.Fatalf("no daemon header: %s", buf[:n])
+	}
+	seg := &Segment{}
+	if err := json.Unmarshal(doc, seg); err != nil {
+		t.Fatalf("%v: %s", err, doc)
+	}
+	return seg
+}
+
+func TestBegin(t *testing.T) {
+
+	t.Setenv("_X_AMZN_TRACE_ID", "")
+
+	tests := []struct {
+		name       string
+		header     string
+		env        string
+		wantTrace  string
+		wantParent string
+	}{
+		{name: "sampled", header: "Root=1-abc;Parent=def;Sampled=1", wantTrace: "1-abc", wantParent: "def"},
+		{name: "spaces", header: "Root=1-abc; Parent=def; Sampled=1", wantTrace: "1-abc", wantParent: "def"},
+		{name: "from the environment", env: "Root=1-env;Parent=fed;Sampled=1", wantTrace: "1-env", wantParent: "fed"},
+		{name: "not sampled", header: "Root=1-abc;Parent=def;Sampled=0"},
+		{name: "no parent", header: "Root=1-abc;Sampled=1"},
+		{name: "no root", header: "Parent=def;Sampled=1"},
+		{name: "no header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("_X_AMZN_TRACE_ID", tt.env)
+			ctx := context.Background()
+			if len(tt.header) > 0 {
+				ctx = context.WithValue(ctx, lambdaTraceKey, tt.header)
+			}
+
+			ctx, seg := Begin(ctx, "GET /users")
+			if len(tt.wantTrace) == 0 {
+				if seg != nil || FromContext(ctx) != nil {
+					t.Fatalf("segment = %+v, want none", seg)
+				}
+				return
+			}
+			if seg == nil || FromContext(ctx) != seg {
+				t.Fatalf("segment = %+v, not in the context", seg)
+			}
+			if seg.TraceID != tt.wantTrace || seg.ParentID != tt.wantParent || seg.Name != "GET /users" || seg.Type != "subsegment" || len(seg.ID) != 16 {
+				t.Errorf("segment = %+v", seg)
+			}
+
+			// a segment begun within it is its child
+			_, child := Begin(ctx, "GetItem")
+			if child == nil || child.TraceID != tt.wantTrace || child.ParentID != seg.ID {
+				t.Errorf("child = %+v, want a child of %s", child, seg.ID)
+			}
+			if want := "Root=" + tt.wantTrace + ";Parent=" + seg.ID + ";Sampled=1"; seg.header() != want {
+				t.Errorf("header = %q, want %q", seg.header(), want)
+			}
+		})
+	}
+
+}
+
+func TestSetStatus(t *testing.T) {
+
+	tests := []struct {
+		status       int
+		wantError    bool
+		wantThrottle bool
+		wantFault    bool
+	}{
+		{status: 200},
+		{status: 304},
+		{status: 404, wantError: true},
+		{status: 429, wantError: true, wantThrottle: true},
+		{status: 500, wantFault: true},
+		{status: 503, wantFault: true},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			seg := &Segment{}
+			seg.SetStatus(tt.status)
+			if seg.HTTP == nil || seg.HTTP.Response.Status != tt.status {
+				t.Fatalf("http = %+v", seg.HTTP)
+			}
+			if seg.Error != tt.wantError || seg.Throttle != tt.wantThrottle || seg.Fault != tt.wantFault {
+				t.Errorf("error, throttle, fault = %t, %t, %t, want %t, %t, %t", seg.Error, seg.Throttle, seg.Fault, tt.wantError, tt.wantThrottle, tt.wantFault)
+			}
+		})
+	}
+
+}
+
+func TestClose(t *testing.T) {
+
+	pc := listen(t)
+
+	tests := []struct {
+		name      string
+		status    int
+		err       error
+		wantFault bool
+		wantError bool
+		wantType  string
+	}{
+		{name: "ok", status: 200},
+		{name: "client error", status: 404, wantError: true},
+		{name: "error without status", err: errors.New("boom"), wantFault: true},
+		{name: "error of a 4xx", status: 400, err: errors.New("bad"), wantError: true},
+		{name: "v2 error", err: &smithy.GenericAPIError{Code: "ThrottlingException", Message: "slow down"}, wantFault: true, wantType: "ThrottlingException"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := &Segment{ID: newID(), TraceID: "1-abc", ParentID: "def", Type: "subsegment", Name: tt.name, StartTime: epoch(time.Now())}
+			seg.Annotate("method", "GET")
+			if tt.status > 0 {
+				seg.SetStatus(tt.status)
+			}
+
+			seg.Close(tt.err)
+			got := received(t, pc)
+			if got.ID != seg.ID || got.TraceID != "1-abc" || got.ParentID != "def" || got.Name != tt.name {
+				t.Errorf("document = %+v", got)
+			}
+			if got.EndTime < got.StartTime || got.Annotations["method"] != "GET" {
+				t.Errorf("document = %+v", got)
+			}
+			if got.Fault != tt.wantFault || got.Error != tt.wantError {
+				t.Errorf("fault, error = %t, %t, want %t, %t", got.Fault, got.Error, tt.wantFault, tt.wantError)
+			}
+			if tt.err == nil {
+				if got.Cause != nil {
+					t.Errorf("cause = %+v, want none", got.Cause)
+				}
+				return
+			}
+			if got.Cause == nil || len(got.Cause.Exceptions) != 1 {
+				t.Fatalf("cause = %+v", got.Cause)
+			}
+			if e := got.Cause.Exceptions[0]; e.Type != tt.wantType || e.Message != tt.err.Error() || len(e.ID) == 0 {
+				t.Errorf("exception = %+v", e)
+			}
+		})
+	}
+
+}
+
+func TestNilSegment(t *testing.T) {
+
+	// nothing of a segment that isn't sampled panics
+	var seg *Segment
+	seg.Annotate("method", "GET")
+	seg.SetStatus(500)
+	seg.Close(errors.New("boom"))
+
+}
+
+func TestDaemonAddress(t *testing.T) {
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "127.0.0.1:2000"},
+		{"169.254.79.129:2000", "169.254.79.129:2000"},
+		{"tcp:127.0.0.1:2000 udp:127.0.0.2:2001", "127.0.0.2:2001"},
+		{"udp:127.0.0.2:2001 tcp:127.0.0.1:2000", "127.0.0.2:2001"},
+		{"tcp:127.0.0.1:2000", "127.0.0.1:2000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := daemonAddress(tt.value); got != tt.want {
+				t.Errorf("daemonAddress(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestTableName(t *testing.T) {
+
+	type input struct{ TableName *string }
+	type other struct{ TableName string }
+
+	tests := []struct {
+		name   string
+		params interface{}
+		want   string
+	}{
+		{"pointer", &input{TableName: aws.String("users")}, "users"},
+		{"value", input{TableName: aws.String("users")}, "users"},
+		{"nil name", &input{}, ""},
+		{"no table", &struct{ Source *string }{Source: aws.String("a")}, ""},
+		{"not a pointer name", &other{TableName: "users"}, ""},
+		{"not a struct", "users", ""},
+		{"nil", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tableName(tt.params); got != tt.want {
+				t.Errorf("tableName = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+}
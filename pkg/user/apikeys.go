@@ -0,0 +1,261 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ErrorAPIKeyNotFound = "api key not found"
+	ErrorGenerateAPIKey = "could not generate api key"
+)
+
+const (
+	ItemTypeAPIKey = "apikey"
+	apiKeyPrefix   = "APIKEY#"
+	// APIKeyPrefix starts every generated key, so leaked ones are easy to search for
+	APIKeyPrefix = "gsk_"
+)
+
+// the scopes of API keys. Read allows GET and HEAD, write everything else and admin
+// makes the key an admin.
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+	ScopeAdmin      = "admin"
+)
+
+var APIKeyScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeAdmin}
+
+// APIKey is a key of a machine to machine caller, stored as its own item under the
+// SHA-256 of the key. The key itself is only in the response of CreateAPIKey.
+type APIKey struct {
+	ID  string `json:"id" dynamodbav:"id"`
+	Key string `json:"key,omitempty" dynamodbav:"-"`
+	// Hash is the hex SHA-256 of the key
+	Hash      string   `json:"-" dynamodbav:"keyHash"`
+	Owner     string   `json:"owner" dynamodbav:"owner"`
+	Scopes    []string `json:"scopes" dynamodbav:"scopes"`
+	Enabled   bool     `json:"enabled" dynamodbav:"enabled"`
+	ExpiresAt string   `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+	TenantID  string   `json:"-" dynamodbav:"tenantId,omitempty"`
+	CreatedAt string   `json:"createdAt" dynamodbav:"createdAt"`
+	CreatedBy string   `json:"createdBy" dynamodbav:"createdBy"`
+}
+
+// Expired is true once the expiry of the key passed, keys without one never expire
+func (k *APIKey) Expired(at time.Time) bool {
+	if len(k.ExpiresAt) == 0 {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, k.ExpiresAt)
+	return err != nil || !at.Before(expires)
+}
+
+// HasScope is true when the key was given scope
+func (k *APIKey) HasScope(scope string) bool {
+	return containsString(k.Scopes, scope)
+}
+
+// Allows is true when the key may do what needs scope: admin keys anything, write keys
+// reading too
+func (k *APIKey) Allows(scope string) bool {
+	if k.HasScope(ScopeAdmin) || k.HasScope(scope) {
+		return true
+	}
+	return scope == ScopeUsersRead && k.HasScope(ScopeUsersWrite)
+}
+
+// apiKeyKey is APIKEY#<hash>, a validated email never starts like that
+func apiKeyKey(hash string) map[string]types.AttributeValue {
+	return itemKey(apiKeyPrefix + hash)
+}
+
+// HashAPIKey is what a key is stored and looked up under
+func HashAPIKey(key string) string {
+	return hashToken(key)
+}
+
+// CreateAPIKey generates a key for owner with scopes out of APIKeyScopes, valid until
+// the RFC 3339 expiresAt or forever when it's empty, in tenant. by is who created it.
+// Only the hash is stored, the returned key is the one time it's known.
+func CreateAPIKey(ctx context.Context, owner string, scopes []string, expiresAt, tenant, by, tableName string, dynaClient DynamoDBAPI) (*APIKey, error) {
+
+	var fields []FieldError
+	owner = strings.TrimSpace(owner)
+	if len(owner) == 0 {
+		fields = append(fields, FieldError{"owner", "is required"})
+	}
+	if len(scopes) == 0 {
+		fields = append(fields, FieldError{"scopes", "is required"})
+	}
+	for _, scope := range scopes {
+		if !containsString(APIKeyScopes, scope) {
+			fields = append(fields, FieldError{"scopes", fmt.Sprintf("must be out of %s", strings.Join(APIKeyScopes, ", "))})
+			break
+		}
+	}
+	if len(expiresAt) > 0 {
+		expires, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			fields = append(fields, FieldError{"expiresAt", "must be an RFC 3339 timestamp"})
+		} else if !expires.After(time.Now()) {
+			fields = append(fields, FieldError{"expiresAt", "must be in the future"})
+		} else {
+			expiresAt = expires.UTC().Format(TimestampLayout)
+		}
+	}
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+
+	id, err := newNoteID()
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, errors.New(ErrorGenerateAPIKey)
+	}
+	key := APIKey{
+		ID:        id,
+		Key:       APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw),
+		Owner:     owner,
+		Scopes:    scopes,
+		Enabled:   true,
+		ExpiresAt: expiresAt,
+		TenantID:  tenant,
+		CreatedAt: now(),
+		CreatedBy: by,
+	}
+	key.Hash = HashAPIKey(key.Key)
+
+	item, err := attributevalue.MarshalMap(key)
+	if err != nil {
+		return nil, flatten(ctx, ErrorMarshalItem, err)
+	}
+	for k, v := range apiKeyKey(key.Hash) {
+		item[k] = v
+	}
+	item[ItemTypeAttribute] = &types.AttributeValueMemberS{Value: ItemTypeAPIKey}
+
+	_, err = dynaClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(tableName),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#email)"),
+		ExpressionAttributeNames: map[string]string{"#email": KeyAttribute},
+	})
+	if err != nil {
+		return nil, flatten(ctx, ErrorDynamoPutItem, err)
+	}
+	return &key, nil
+
+}
+
+// FetchAPIKey reads the key stored under hash, or returns ErrorAPIKeyNotFound. Disabled
+// and expired keys are returned too, telling them apart is up to the caller.
+func FetchAPIKey(ctx context.Context, hash, tableName string, dynaClient DynamoDBAPI) (*APIKey, error) {
+
+	if len(hash) == 0 {
+		return nil, errors.New(ErrorAPIKeyNotFound)
+	}
+
+	result, err := dynaClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       apiKeyKey(hash),
+	})
+	if err != nil {
+		return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+	}
+	if itemType, ok := result.Item[ItemTypeAttribute].(*types.AttributeValueMemberS); !ok || itemType.Value != ItemTypeAPIKey {
+		return nil, errors.New(ErrorAPIKeyNotFound)
+	}
+
+	key := new(APIKey)
+	if err := attributevalue.UnmarshalMap(result.Item, key); err != nil {
+		return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	return key, nil
+
+}
+
+// RevokeAPIKey disables the key id of tenant for good and returns it, or returns
+// ErrorAPIKeyNotFound. Keys are stored under their hash, so it's found with a scan.
+func RevokeAPIKey(ctx context.Context, id, tenant, tableName string, dynaClient DynamoDBAPI) (*APIKey, error) {
+
+	if len(id) == 0 {
+		return nil, errors.New(ErrorAPIKeyNotFound)
+	}
+
+	condition := expression.Name(ItemTypeAttribute).Equal(expression.Value(ItemTypeAPIKey)).
+		And(expression.Name("id").Equal(expression.Value(id)))
+	if len(tenant) > 0 {
+		condition = condition.And(expression.Name(TenantAttribute).Equal(expression.Value(tenant)))
+	} else {
+		condition = condition.And(expression.AttributeNotExists(expression.Name(TenantAttribute)))
+	}
+	expr, err := expression.NewBuilder().WithFilter(condition).WithProjection(expression.NamesList(expression.Name("keyHash"))).Build()
+	if err != nil {
+		return nil, flatten(ctx, ErrorMarshalItem, err)
+	}
+	input := dynamodb.ScanInput{
+		TableName:                 aws.String(tableName),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	var hash string
+	for len(hash) == 0 {
+		result, err := dynaClient.Scan(ctx, &input)
+		if err != nil {
+			return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+		for _, item := range result.Items {
+			if keyHash, ok := item["keyHash"].(*types.AttributeValueMemberS); ok {
+				hash = keyHash.Value
+				break
+			}
+		}
+		if len(hash) == 0 && len(result.LastEvaluatedKey) == 0 {
+			return nil, errors.New(ErrorAPIKeyNotFound)
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	result, err := dynaClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       apiKeyKey(hash),
+		UpdateExpression:          aws.String("SET #enabled = :false"),
+		ConditionExpression:       aws.String("attribute_exists(#email)"),
+		ExpressionAttributeNames:  map[string]string{"#email": KeyAttribute, "#enabled": "enabled"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":false": &types.AttributeValueMemberBOOL{Value: false}},
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, errors.New(ErrorAPIKeyNotFound)
+		}
+		return nil, flatten(ctx, ErrorDynamoUpdateItem, err)
+	}
+
+	key := new(APIKey)
+	if err := attributevalue.UnmarshalMap(result.Attributes, key); err != nil {
+		return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	return key, nil
+
+}
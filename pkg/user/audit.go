@@ -0,0 +1,32 @@
+package user
+
+import (
+	"github.com/Rahul-71/go-serverless/pkg/auth"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Anonymous is the identity of callers nothing is known about, not even the source IP
+const Anonymous = "anonymous"
+
+// CallerIdentity names who made the request for createdBy/updatedBy. In order: the email
+// or sub of a Cognito (or JWT) authorizer, the ARN of an IAM caller, the source IP as
+// "ip:1.2.3.4", and Anonymous.
+func CallerIdentity(req events.APIGatewayProxyRequest) string {
+
+	claims := auth.Claims(req.RequestContext.Authorizer)
+	for _, key := range []string{"email", "sub"} {
+		if value, ok := claims[key].(string); ok && len(value) > 0 {
+			return value
+		}
+	}
+
+	identity := req.RequestContext.Identity
+	if len(identity.UserArn) > 0 {
+		return identity.UserArn
+	}
+	if len(identity.SourceIP) > 0 {
+		return "ip:" + identity.SourceIP
+	}
+	return Anonymous
+
+}
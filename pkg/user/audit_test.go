@@ -0,0 +1,67 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestCallerIdentity(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		authorizer map[string]interface{}
+		identity   events.APIGatewayRequestIdentity
+		want       string
+	}{
+		{
+			name:       "cognito email",
+			authorizer: map[string]interface{}{"claims": map[string]interface{}{"email": "jane@example.com", "sub": "1234"}},
+			identity:   events.APIGatewayRequestIdentity{SourceIP: "203.0.113.7"},
+			want:       "jane@example.com",
+		},
+		{
+			name:       "cognito sub",
+			authorizer: map[string]interface{}{"claims": map[string]interface{}{"sub": "1234"}},
+			want:       "1234",
+		},
+		{
+			name:       "jwt authorizer",
+			authorizer: map[string]interface{}{"jwt": map[string]interface{}{"claims": map[string]string{"email": "jane@example.com"}}},
+			want:       "jane@example.com",
+		},
+		{
+			name:       "lambda authorizer context",
+			authorizer: map[string]interface{}{"email": "jane@example.com"},
+			want:       "jane@example.com",
+		},
+		{
+			name:       "empty email",
+			authorizer: map[string]interface{}{"claims": map[string]interface{}{"email": "", "sub": "1234"}},
+			want:       "1234",
+		},
+		{
+			name:     "iam caller",
+			identity: events.APIGatewayRequestIdentity{UserArn: "arn:aws:iam::123456789012:user/jane", SourceIP: "203.0.113.7"},
+			want:     "arn:aws:iam::123456789012:user/jane",
+		},
+		{
+			name:     "source ip",
+			identity: events.APIGatewayRequestIdentity{SourceIP: "203.0.113.7"},
+			want:     "ip:203.0.113.7",
+		},
+		{
+			name: "nothing known",
+			want: Anonymous,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{RequestContext: events.APIGatewayProxyRequestContext{Authorizer: tt.authorizer, Identity: tt.identity}}
+			if got := CallerIdentity(req); got != tt.want {
+				t.Errorf("CallerIdentity = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+}
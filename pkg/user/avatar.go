@@ -0,0 +1,60 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SetAvatar records the S3 key of the user's profile picture, by is who set it
+func SetAvatar(ctx context.Context, email, key, tenant, by, tableName string, dynaClient DynamoDBAPI) (*User, error) {
+
+	email = validators.NormalizeEmail(email)
+	input := dynamodb.UpdateItemInput{
+		Key:                 userKey(email),
+		TableName:           aws.String(tableName),
+		UpdateExpression:    aws.String("SET #avatarKey = :avatarKey, #updatedAt = :updatedAt, #updatedBy = :updatedBy, #emailLower = :emailLower, #version = if_not_exists(#version, :zero) + :one"),
+		ConditionExpression: aws.String("attribute_exists(#email)"),
+		ExpressionAttributeNames: map[string]string{
+			"#email":      "email",
+			"#avatarKey":  "avatarKey",
+			"#updatedAt":  "updatedAt",
+			"#updatedBy":  "updatedBy",
+			"#emailLower": "emailLower",
+			"#version":    "version",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":avatarKey":  &types.AttributeValueMemberS{Value: key},
+			":updatedAt":  &types.AttributeValueMemberS{Value: now()},
+			":updatedBy":  &types.AttributeValueMemberS{Value: by},
+			":emailLower": &types.AttributeValueMemberS{Value: emailLower(email)},
+			":zero":       &types.AttributeValueMemberN{Value: "0"},
+			":one":        &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	}
+	input.ConditionExpression = tenantCondition(input.ConditionExpression, tenant, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+
+	defer forgetUsers(email)
+	result, err := dynaClient.UpdateItem(ctx, &input)
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, errors.New(ErrorUserDoesNotExists)
+		}
+		return nil, flatten(ctx, ErrorDynamoUpdateItem, err)
+	}
+
+	item := new(User)
+	if err := attributevalue.UnmarshalMap(result.Attributes, item); err != nil {
+		return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	upgrade(item)
+	return item, nil
+
+}
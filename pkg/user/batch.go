@@ -0,0 +1,514 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ErrorEmptyBatch       = "batch is empty"
+	ErrorDynamoBatchWrite = "could not dynamo batch write items"
+	ErrorDynamoBatchGet   = "could not dynamo batch get items"
+)
+
+const (
+	BatchStatusCreated       = "created"
+	BatchStatusAlreadyExists = "already-exists"
+	BatchStatusInvalid       = "invalid"
+	BatchStatusFailed        = "failed"
+	BatchStatusUpdated       = "updated"
+	BatchStatusUnchanged     = "unchanged"
+)
+
+// DynamoDB limits per BatchWriteItem / BatchGetItem call
+const (
+	batchWriteSize = 25
+	batchGetSize   = 100
+)
+
+// how often and how patiently unprocessed items are retried
+var (
+	batchMaxAttempts = 5
+	batchBaseBackoff = 50 * time.Millisecond
+)
+
+type BatchResult struct {
+	Email  string `json:"email"`
+	Status string `json:"status"`
+	// Reason is why a user is invalid or failed
+	Reason string `json:"reason,omitempty"`
+}
+
+type UsersBatch struct {
+	Users   []User   `json:"users"`
+	Missing []string `json:"missing"`
+}
+
+type BulkDeleteResult struct {
+	Deleted  []string `json:"deleted"`
+	NotFound []string `json:"notFound"`
+	Failed   []string `json:"failed,omitempty"`
+}
+
+// CreateUsers validates and stores users in BatchWriteItem chunks. Every user gets a
+// result in the same order as the input, so partial failures are visible to the caller.
+// The users are created in tenant, by is recorded as createdBy and updatedBy.
+func CreateUsers(ctx context.Context, users []User, tenant, by, tableName string, dynaClient DynamoDBAPI) ([]BatchResult, error) {
+
+	if len(users) == 0 {
+		return nil, errors.New(ErrorEmptyBatch)
+	}
+	for _, u := range users {
+		defer forgetUsers(u.Email)
+	}
+
+	results := make([]BatchResult, len(users))
+	var candidates []string
+	seen := map[string]bool{}
+	for i := range users {
+		err := prepareNewUser(&users[i])
+		u := users[i]
+		results[i] = BatchResult{Email: u.Email}
+		switch {
+		case err != nil:
+			results[i].Status = BatchStatusInvalid
+			results[i].Reason = err.Error()
+		case seen[u.Email]:
+			// the same email twice in one batch, only the first one gets written
+			results[i].Status = BatchStatusAlreadyExists
+		default:
+			seen[u.Email] = true
+			candidates = append(candidates, u.Email)
+		}
+	}
+
+	// emails are unique across tenants
+	existing, err := existingEmails(ctx, candidates, "", tableName, dynaClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []types.WriteRequest
+	pending := map[string]int{}
+	for i, u := range users {
+		if results[i].Status != "" {
+			continue
+		}
+		if existing[u.Email] {
+			results[i].Status = BatchStatusAlreadyExists
+			continue
+		}
+
+		u.Version = 1
+		u.CreatedAt = now()
+		u.UpdatedAt = u.CreatedAt
+		u.CreatedBy = by
+		u.UpdatedBy = by
+		u.TenantID = tenant
+		u.SchemaVersion = CurrentSchemaVersion
+		u.EmailLower = emailLower(u.Email)
+
+		attrVal, err := attributevalue.MarshalMap(u)
+		if err != nil {
+			results[i].Status = BatchStatusFailed
+			continue
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: attrVal}})
+		pending[u.Email] = i
+	}
+
+	unprocessed, err := batchWrite(ctx, requests, tableName, dynaClient)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := map[string]bool{}
+	for _, req := range unprocessed {
+		if email, ok := req.PutRequest.Item["email"].(*types.AttributeValueMemberS); ok {
+			failed[email.Value] = true
+		}
+	}
+	for email, i := range pending {
+		if failed[email] {
+			results[i].Status = BatchStatusFailed
+		} else {
+			results[i].Status = BatchStatusCreated
+		}
+	}
+
+	return results, nil
+
+}
+
+// UpsertUsers creates the users that don't exist yet and updates the names, phone,
+// status, role and metadata of the ones that do, in BatchWriteItem chunks. Only the
+// fields a row sets are updated. A row that wouldn't change its user is unchanged and
+// not written, so running the same rows twice writes nothing the second time. The items
+// are put whole, there's no version check against concurrent writes.
+func UpsertUsers(ctx context.Context, users []User, by, tableName string, dynaClient DynamoDBAPI) ([]BatchResult, error) {
+
+	if len(users) == 0 {
+		return nil, errors.New(ErrorEmptyBatch)
+	}
+	for _, u := range users {
+		defer forgetUsers(u.Email)
+	}
+
+	results := make([]BatchResult, len(users))
+	rows := make([]User, len(users))
+	var candidates []string
+	seen := map[string]bool{}
+	for i := range users {
+		rows[i] = users[i]
+		err := prepareNewUser(&users[i])
+		u := users[i]
+		results[i] = BatchResult{Email: u.Email}
+		switch {
+		case err != nil:
+			results[i].Status = BatchStatusInvalid
+			results[i].Reason = err.Error()
+		case seen[u.Email]:
+			results[i].Status = BatchStatusAlreadyExists
+			results[i].Reason = "repeated in the batch"
+		default:
+			seen[u.Email] = true
+			candidates = append(candidates, u.Email)
+		}
+	}
+
+	items, err := batchGet(ctx, candidates, tableName, dynaClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []types.WriteRequest
+	pending := map[string]int{}
+	for i, u := range users {
+		if results[i].Status != "" {
+			continue
+		}
+
+		status := BatchStatusCreated
+		if item, ok := items[u.Email]; ok {
+			stored := new(User)
+			if err := attributevalue.UnmarshalMap(item, stored); err != nil {
+				results[i].Status = BatchStatusFailed
+				results[i].Reason = ErrorFailedToUnmarshalRecord
+				continue
+			}
+			upgrade(stored)
+			updated := mergeRow(*stored, rows[i], u)
+			if len(ChangedFields(stored, &updated)) == 0 {
+				results[i].Status = BatchStatusUnchanged
+				continue
+			}
+			updated.Version++
+			updated.UpdatedAt = now()
+			updated.UpdatedBy = by
+			u, status = updated, BatchStatusUpdated
+		} else {
+			u.Version = 1
+			u.CreatedAt = now()
+			u.UpdatedAt = u.CreatedAt
+			u.CreatedBy = by
+			u.UpdatedBy = by
+		}
+		u.SchemaVersion = CurrentSchemaVersion
+		u.EmailLower = emailLower(u.Email)
+
+		attrVal, err := attributevalue.MarshalMap(u)
+		if err != nil {
+			results[i].Status = BatchStatusFailed
+			results[i].Reason = ErrorMarshalItem
+			continue
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: attrVal}})
+		results[i].Status = status
+		pending[u.Email] = i
+	}
+
+	unprocessed, err := batchWrite(ctx, requests, tableName, dynaClient)
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range unprocessed {
+		if email, ok := req.PutRequest.Item["email"].(*types.AttributeValueMemberS); ok {
+			results[pending[email.Value]].Status = BatchStatusFailed
+			results[pending[email.Value]].Reason = ErrorDynamoBatchWrite
+		}
+	}
+
+	return results, nil
+
+}
+
+// mergeRow is stored with the fields row sets, taken from prepared which holds them
+// validated and normalized
+func mergeRow(stored, row, prepared User) User {
+
+	stored.FirstName = prepared.FirstName
+	stored.LastName = prepared.LastName
+	if len(row.Phone) > 0 {
+		stored.Phone = prepared.Phone
+	}
+	if len(row.Status) > 0 {
+		stored.Status = prepared.Status
+	}
+	if len(row.Role) > 0 {
+		stored.Role = prepared.Role
+	}
+	if row.Metadata != nil {
+		stored.Metadata = prepared.Metadata
+	}
+	return stored
+
+}
+
+// DeleteUsers removes the given users with BatchWriteItem. Nothing is deleted when any
+// of the emails is invalid. With a tenant users of other tenants are reported NotFound.
+func DeleteUsers(ctx context.Context, emails []string, tenant, tableName string, dynaClient DynamoDBAPI) (*BulkDeleteResult, error) {
+
+	if len(emails) == 0 {
+		return nil, errors.New(ErrorEmptyBatch)
+	}
+	defer forgetUsers(emails...)
+
+	var unique []string
+	seen := map[string]bool{}
+	for _, email := range emails {
+		email = validators.NormalizeEmail(email)
+		if !validators.IsEmailValid(email) {
+			return nil, errors.New(ErrorInvalidEmail)
+		}
+		if !seen[email] {
+			seen[email] = true
+			unique = append(unique, email)
+		}
+	}
+
+	existing, err := existingEmails(ctx, unique, tenant, tableName, dynaClient)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BulkDeleteResult{Deleted: []string{}, NotFound: []string{}}
+	var requests []types.WriteRequest
+	for _, email := range unique {
+		if !existing[email] {
+			result.NotFound = append(result.NotFound, email)
+			continue
+		}
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{
+			Key: userKey(email),
+		}})
+	}
+
+	unprocessed, err := batchWrite(ctx, requests, tableName, dynaClient)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := map[string]bool{}
+	for _, req := range unprocessed {
+		if email, ok := req.DeleteRequest.Key["email"].(*types.AttributeValueMemberS); ok {
+			failed[email.Value] = true
+			result.Failed = append(result.Failed, email.Value)
+		}
+	}
+	for _, email := range unique {
+		if existing[email] && !failed[email] {
+			result.Deleted = append(result.Deleted, email)
+		}
+	}
+
+	return result, nil
+
+}
+
+// batchWrite sends the requests in chunks of 25 and retries unprocessed items with
+// exponential backoff. Whatever is still unprocessed after the last attempt is returned.
+func batchWrite(ctx context.Context, requests []types.WriteRequest, tableName string, dynaClient DynamoDBAPI) ([]types.WriteRequest, error) {
+
+	var unprocessed []types.WriteRequest
+
+	for start := 0; start < len(requests); start += batchWriteSize {
+		end := start + batchWriteSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		chunk := requests[start:end]
+		for attempt := 0; len(chunk) > 0; attempt++ {
+			if attempt == batchMaxAttempts {
+				unprocessed = append(unprocessed, chunk...)
+				break
+			}
+			if attempt > 0 && !sleep(ctx, batchBaseBackoff<<(attempt-1)) {
+				return nil, errors.New(ErrorDynamoBatchWrite)
+			}
+
+			result, err := dynaClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{tableName: chunk},
+			})
+			if err != nil {
+				return nil, flatten(ctx, ErrorDynamoBatchWrite, err)
+			}
+			chunk = result.UnprocessedItems[tableName]
+		}
+	}
+
+	return unprocessed, nil
+
+}
+
+// sleep waits for d, or returns false when ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// existingEmails looks the emails up with BatchGetItem and reports which ones are
+// already stored, in tenant when it's set
+func existingEmails(ctx context.Context, emails []string, tenant, tableName string, dynaClient DynamoDBAPI) (map[string]bool, error) {
+
+	items, err := batchGet(ctx, emails, tableName, dynaClient, "email", TenantAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]bool{}
+	for email, item := range items {
+		stored, ok := item[TenantAttribute].(*types.AttributeValueMemberS)
+		if len(tenant) == 0 || (ok && stored.Value == tenant) {
+			existing[email] = true
+		}
+	}
+	return existing, nil
+
+}
+
+// FetchUsersBatch reads the users stored under emails with BatchGetItem. Users come back
+// in the order they were asked for, duplicates once, and emails that aren't stored are
+// listed in Missing, as are users of other tenants.
+func FetchUsersBatch(ctx context.Context, emails []string, tenant, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*UsersBatch, error) {
+
+	var unique []string
+	seen := map[string]bool{}
+	for _, email := range emails {
+		email = validators.NormalizeEmail(email)
+		if len(email) > 0 && !seen[email] {
+			seen[email] = true
+			unique = append(unique, email)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, errors.New(ErrorEmptyBatch)
+	}
+
+	// results are matched to the request by email, so it's always read, as is the
+	// expiry to leave out expired users
+	for _, attr := range []string{"email", "expiresAt", TenantAttribute} {
+		if len(attributes) > 0 && !containsString(attributes, attr) {
+			attributes = append(attributes, attr)
+		}
+	}
+
+	items, err := batchGet(ctx, unique, tableName, dynaClient, attributes...)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &UsersBatch{Users: []User{}, Missing: []string{}}
+	for _, email := range unique {
+		item, ok := items[email]
+		if !ok {
+			batch.Missing = append(batch.Missing, email)
+			continue
+		}
+
+		var u User
+		if err := attributevalue.UnmarshalMap(item, &u); err != nil {
+			return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+		}
+		if u.expired() || !u.inTenant(tenant) {
+			batch.Missing = append(batch.Missing, email)
+			continue
+		}
+		upgrade(&u)
+		batch.Users = append(batch.Users, u)
+	}
+
+	return batch, nil
+
+}
+
+// batchGet reads the items of emails in BatchGetItem chunks of 100, retrying unprocessed
+// keys with exponential backoff. The items are keyed by email, missing ones are absent.
+func batchGet(ctx context.Context, emails []string, tableName string, dynaClient DynamoDBAPI, attributes ...string) (map[string]map[string]types.AttributeValue, error) {
+
+	items := map[string]map[string]types.AttributeValue{}
+
+	for start := 0; start < len(emails); start += batchGetSize {
+		end := start + batchGetSize
+		if end > len(emails) {
+			end = len(emails)
+		}
+
+		keysAndAttributes := &types.KeysAndAttributes{}
+		for _, email := range emails[start:end] {
+			keysAndAttributes.Keys = append(keysAndAttributes.Keys, userKey(email))
+		}
+		if len(attributes) > 0 {
+			keysAndAttributes.ProjectionExpression, keysAndAttributes.ExpressionAttributeNames = projection(attributes, nil)
+		}
+
+		for attempt := 0; len(keysAndAttributes.Keys) > 0; attempt++ {
+			if attempt == batchMaxAttempts {
+				return nil, errors.New(ErrorDynamoBatchGet)
+			}
+			if attempt > 0 && !sleep(ctx, batchBaseBackoff<<(attempt-1)) {
+				return nil, errors.New(ErrorDynamoBatchGet)
+			}
+
+			result, err := dynaClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]types.KeysAndAttributes{tableName: *keysAndAttributes},
+			})
+			if err != nil {
+				return nil, flatten(ctx, ErrorDynamoBatchGet, err)
+			}
+
+			for _, item := range result.Responses[tableName] {
+				if email, ok := item["email"].(*types.AttributeValueMemberS); ok {
+					items[email.Value] = item
+				}
+			}
+
+			keysAndAttributes.Keys = nil
+			if unprocessed, ok := result.UnprocessedKeys[tableName]; ok {
+				keysAndAttributes.Keys = unprocessed.Keys
+			}
+		}
+	}
+
+	return items, nil
+
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
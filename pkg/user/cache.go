@@ -0,0 +1,171 @@
+package user
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// USER_CACHE_SIZE users are kept in memory for USER_CACHE_TTL_MS by FetchUserCached, for
+// the service accounts that are read all the time. The cache is off without a size.
+// Every write of this instance forgets the user, writes of other instances are only
+// seen once the entry expires.
+var userCache = newCache(envInt("USER_CACHE_SIZE", 0), time.Duration(envInt("USER_CACHE_TTL_MS", 5000))*time.Millisecond)
+
+type cacheEntry struct {
+	key     string
+	email   string
+	user    *User
+	expires time.Time
+}
+
+// cache is a least recently used cache of fetched users. Lambda runs one request at a
+// time, tests and the local server don't.
+type cache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newCache(size int, ttl time.Duration) *cache {
+	return &cache{size: size, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *cache) enabled() bool {
+	return c.size > 0 && c.ttl > 0
+}
+
+// cacheKey is the read a user was fetched with, users are only shared by reads of the
+// same table, tenant and attributes
+func cacheKey(email, tenant, tableName string, attributes []string) string {
+	return strings.Join([]string{tableName, emailLower(email), tenant, strings.Join(attributes, ",")}, "\x00")
+}
+
+func (c *cache) get(key string) (*User, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return copyUser(entry.user), true
+
+}
+
+func (c *cache) put(key, email string, u *User) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, email: emailLower(email), user: copyUser(u), expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+
+}
+
+// forget drops every read of the emails, whatever the table
+func (c *cache) forget(emails ...string) {
+
+	if !c.enabled() {
+		return
+	}
+	forgotten := map[string]bool{}
+	for _, email := range emails {
+		forgotten[emailLower(email)] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.entries {
+		if forgotten[element.Value.(*cacheEntry).email] {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+
+}
+
+// forgetUsers is deferred by every write of users, so it runs after the write whether
+// it failed or not
+func forgetUsers(emails ...string) {
+	userCache.forget(emails...)
+}
+
+type cacheHitKey struct{}
+
+// TrackCache returns a context in which ServedFromCache tells whether FetchUserCached
+// answered from the cache
+func TrackCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheHitKey{}, new(int32))
+}
+
+// ServedFromCache is true once a FetchUserCached with ctx was a hit
+func ServedFromCache(ctx context.Context) bool {
+	flag, ok := ctx.Value(cacheHitKey{}).(*int32)
+	return ok && atomic.LoadInt32(flag) == 1
+}
+
+// FetchUserCached is FetchUser in front of the cache of USER_CACHE_SIZE, it's FetchUser
+// as it is when the cache is off. Only users found are cached.
+func FetchUserCached(ctx context.Context, email, tenant, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*User, error) {
+
+	if !userCache.enabled() {
+		return FetchUser(ctx, email, tenant, tableName, dynaClient, attributes...)
+	}
+
+	key := cacheKey(email, tenant, tableName, attributes)
+	if u, ok := userCache.get(key); ok {
+		if flag, ok := ctx.Value(cacheHitKey{}).(*int32); ok {
+			atomic.StoreInt32(flag, 1)
+		}
+		return u, nil
+	}
+
+	u, err := FetchUser(ctx, email, tenant, tableName, dynaClient, attributes...)
+	if err != nil {
+		return nil, err
+	}
+	userCache.put(key, u.Email, u)
+	return u, nil
+
+}
+
+// copyUser copies u so neither the cache nor the caller sees changes of the other
+func copyUser(u *User) *User {
+	c := *u
+	if u.Metadata != nil {
+		c.Metadata = make(map[string]string, len(u.Metadata))
+		for k, v := range u.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	if u.ExpiresAt != nil {
+		expiresAt := *u.ExpiresAt
+		c.ExpiresAt = &expiresAt
+	}
+	return &c
+}
@@ -0,0 +1,237 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CapacityOptions decides what WithCapacity does with the capacity calls consume
+type CapacityOptions struct {
+	// Mode is the ReturnConsumedCapacity asked for, TOTAL when empty. INDEXES splits the
+	// units up by table and index.
+	Mode types.ReturnConsumedCapacity
+	// Log logs the units of every call, the log prefix has the request ID
+	Log bool
+}
+
+// Call is what a call made with a context from RecordCalls consumed and how long it
+// took, retries included
+type Call struct {
+	Operation          string  `json:"operation"`
+	Table              string  `json:"table,omitempty"`
+	CapacityUnits      float64 `json:"capacityUnits"`
+	ReadCapacityUnits  float64 `json:"readCapacityUnits,omitempty"`
+	WriteCapacityUnits float64 `json:"writeCapacityUnits,omitempty"`
+	LatencyMs          float64 `json:"latencyMs"`
+}
+
+type callsKey struct{}
+
+type recordedCalls struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// RecordCalls returns a context in which the calls of a client from WithCapacity are kept
+// for RecordedCalls
+func RecordCalls(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callsKey{}, &recordedCalls{})
+}
+
+// RecordedCalls are the calls made with ctx so far, in the order they finished
+func RecordedCalls(ctx context.Context) []Call {
+	recorded, ok := ctx.Value(callsKey{}).(*recordedCalls)
+	if !ok {
+		return nil
+	}
+	recorded.mu.Lock()
+	defer recorded.mu.Unlock()
+	return append([]Call(nil), recorded.calls...)
+}
+
+// WithCapacity wraps a client so every call asks DynamoDB for the capacity it consumed,
+// for capacity planning. Wrap the client of WithRetry, the latency is the one of the
+// call with its retries then.
+func WithCapacity(dynaClient DynamoDBAPI, opts CapacityOptions) DynamoDBAPI {
+	if len(opts.Mode) == 0 {
+		opts.Mode = types.ReturnConsumedCapacityTotal
+	}
+	return capacityClient{DynamoDBAPI: dynaClient, opts: opts}
+}
+
+type capacityClient struct {
+	DynamoDBAPI
+	opts CapacityOptions
+}
+
+// observe logs and records a call that started at start, batches and transactions
+// consume capacity on every table they touch
+func (c capacityClient) observe(ctx context.Context, operation string, start time.Time, consumed ...*types.ConsumedCapacity) {
+
+	latency := float64(time.Since(start).Microseconds()) / 1000
+	calls := []Call{}
+	for _, cc := range consumed {
+		if cc == nil {
+			continue
+		}
+		calls = append(calls, Call{
+			Operation:          operation,
+			Table:              aws.ToString(cc.TableName),
+			CapacityUnits:      aws.ToFloat64(cc.CapacityUnits),
+			ReadCapacityUnits:  aws.ToFloat64(cc.ReadCapacityUnits),
+			WriteCapacityUnits: aws.ToFloat64(cc.WriteCapacityUnits),
+			LatencyMs:          latency,
+		})
+	}
+	// failed calls don't report any
+	if len(calls) == 0 {
+		calls = append(calls, Call{Operation: operation, LatencyMs: latency})
+	}
+
+	if c.opts.Log {
+		for _, call := range calls {
+			logging.FromContext(ctx).InfoContext(ctx, "dynamodb capacity", "operation", call.Operation, "table", call.Table, "capacityUnits", call.CapacityUnits, "latencyMs", call.LatencyMs)
+		}
+	}
+	if recorded, ok := ctx.Value(callsKey{}).(*recordedCalls); ok {
+		recorded.mu.Lock()
+		recorded.calls = append(recorded.calls, calls...)
+		recorded.mu.Unlock()
+	}
+
+}
+
+func (c capacityClient) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.GetItem(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "GetItem", start)
+		return output, err
+	}
+	c.observe(ctx, "GetItem", start, output.ConsumedCapacity)
+	return output, err
+}
+
+func (c capacityClient) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.PutItem(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "PutItem", start)
+		return output, err
+	}
+	c.observe(ctx, "PutItem", start, output.ConsumedCapacity)
+	return output, err
+}
+
+func (c capacityClient) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.UpdateItem(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "UpdateItem", start)
+		return output, err
+	}
+	c.observe(ctx, "UpdateItem", start, output.ConsumedCapacity)
+	return output, err
+}
+
+func (c capacityClient) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.DeleteItem(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "DeleteItem", start)
+		return output, err
+	}
+	c.observe(ctx, "DeleteItem", start, output.ConsumedCapacity)
+	return output, err
+}
+
+func (c capacityClient) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.Query(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "Query", start)
+		return output, err
+	}
+	c.observe(ctx, "Query", start, output.ConsumedCapacity)
+	return output, err
+}
+
+func (c capacityClient) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.Scan(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "Scan", start)
+		return output, err
+	}
+	c.observe(ctx, "Scan", start, output.ConsumedCapacity)
+	return output, err
+}
+
+func (c capacityClient) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.BatchGetItem(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "BatchGetItem", start)
+		return output, err
+	}
+	c.observe(ctx, "BatchGetItem", start, each(output.ConsumedCapacity)...)
+	return output, err
+}
+
+func (c capacityClient) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.BatchWriteItem(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "BatchWriteItem", start)
+		return output, err
+	}
+	c.observe(ctx, "BatchWriteItem", start, each(output.ConsumedCapacity)...)
+	return output, err
+}
+
+func (c capacityClient) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.TransactWriteItems(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "TransactWriteItems", start)
+		return output, err
+	}
+	c.observe(ctx, "TransactWriteItems", start, each(output.ConsumedCapacity)...)
+	return output, err
+}
+
+func (c capacityClient) ExecuteStatement(ctx context.Context, input *dynamodb.ExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ExecuteStatementOutput, error) {
+	input.ReturnConsumedCapacity = c.opts.Mode
+	start := time.Now()
+	output, err := c.DynamoDBAPI.ExecuteStatement(ctx, input, optFns...)
+	if output == nil {
+		c.observe(ctx, "ExecuteStatement", start)
+		return output, err
+	}
+	c.observe(ctx, "ExecuteStatement", start, output.ConsumedCapacity)
+	return output, err
+}
+
+// each is the capacity a batch or transaction consumed per table, for observe
+func each(consumed []types.ConsumedCapacity) []*types.ConsumedCapacity {
+	pointers := make([]*types.ConsumedCapacity, len(consumed))
+	for i := range consumed {
+		pointers[i] = &consumed[i]
+	}
+	return pointers
+}
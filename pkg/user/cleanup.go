@@ -0,0 +1,127 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// cleanupMargin is the time a run keeps for itself before the deadline of its context,
+// the delete in flight and the summary have to fit in it
+var cleanupMargin = time.Duration(envInt("CLEANUP_MARGIN_MS", 10000)) * time.Millisecond
+
+type CleanupResult struct {
+	Scanned int      `json:"scanned"`
+	Deleted []string `json:"deleted"`
+	// Skipped are the users that weren't expired anymore by the time they were deleted
+	Skipped int  `json:"skipped"`
+	Errors  int  `json:"errors"`
+	DryRun  bool `json:"dryRun,omitempty"`
+	// Complete is false when the run stopped before the end of the table, the next run
+	// starts over and finds the rest
+	Complete bool `json:"complete"`
+}
+
+// Cleanup hard-deletes the users expired more than retention ago. DynamoDB TTL deletes
+// expired users eventually, Cleanup doesn't wait for it. Every delete is conditional on
+// the user still being expired that long, a user whose expiry was moved or removed
+// since the scan stays. It stops before the deadline of ctx. With dryRun the users are
+// reported as deleted but left alone.
+func Cleanup(ctx context.Context, retention time.Duration, dryRun bool, tableName string, dynaClient DynamoDBAPI) (*CleanupResult, error) {
+
+	result := &CleanupResult{Deleted: []string{}, DryRun: dryRun}
+	cutoff := time.Now().Add(-retention).UTC()
+
+	expired := expression.AttributeNotExists(expression.Name(ItemTypeAttribute)).
+		And(expression.AttributeExists(expression.Name(TTLAttribute))).
+		And(expression.Name(TTLAttribute).LessThan(expression.Value(cutoff.Unix())))
+	scanExpr, err := expression.NewBuilder().
+		WithFilter(expired.And(expression.Not(expression.Name(KeyAttribute).BeginsWith(notePrefix)))).
+		WithProjection(expression.NamesList(expression.Name(KeyAttribute))).
+		Build()
+	if err != nil {
+		return nil, flatten(ctx, ErrorMarshalItem, err)
+	}
+	deleteExpr, err := expression.NewBuilder().WithCondition(expired).Build()
+	if err != nil {
+		return nil, flatten(ctx, ErrorMarshalItem, err)
+	}
+	input := dynamodb.ScanInput{
+		TableName:                 aws.String(tableName),
+		FilterExpression:          scanExpr.Filter(),
+		ProjectionExpression:      scanExpr.Projection(),
+		ExpressionAttributeNames:  scanExpr.Names(),
+		ExpressionAttributeValues: scanExpr.Values(),
+	}
+
+	for {
+		if !timeLeft(ctx) {
+			return result, nil
+		}
+		page, err := dynaClient.Scan(ctx, &input)
+		if err != nil {
+			return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+
+		for _, item := range page.Items {
+			email, ok := item[KeyAttribute].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			result.Scanned++
+			if !timeLeft(ctx) {
+				return result, nil
+			}
+			cleanupUser(ctx, email.Value, deleteExpr, result, tableName, dynaClient)
+		}
+
+		if len(page.LastEvaluatedKey) == 0 {
+			result.Complete = true
+			return result, nil
+		}
+		input.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+
+}
+
+// cleanupUser deletes a user while it's still expired, a failed delete counts as an
+// error and the run goes on
+func cleanupUser(ctx context.Context, email string, condition expression.Expression, result *CleanupResult, tableName string, dynaClient DynamoDBAPI) {
+
+	if result.DryRun {
+		result.Deleted = append(result.Deleted, email)
+		return
+	}
+	defer forgetUsers(email)
+
+	_, err := dynaClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       userKey(email),
+		ConditionExpression:       condition.Condition(),
+		ExpressionAttributeNames:  condition.Names(),
+		ExpressionAttributeValues: condition.Values(),
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			result.Skipped++
+			return
+		}
+		flatten(ctx, ErrorDeleteItem, err)
+		result.Errors++
+		return
+	}
+	result.Deleted = append(result.Deleted, email)
+
+}
+
+// timeLeft is false once the deadline of ctx is closer than cleanupMargin
+func timeLeft(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > cleanupMargin
+}
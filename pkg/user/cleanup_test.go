@@ -0,0 +1,127 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestCleanup(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		dryRun      bool
+		refreshed   string
+		failing     string
+		wantDeleted []string
+		wantSkipped int
+		wantErrors  int
+	}{
+		{name: "deleted", wantDeleted: []string{"a@example.com", "b@example.com", "c@example.com"}},
+		{name: "dry run", dryRun: true, wantDeleted: []string{"a@example.com", "b@example.com", "c@example.com"}},
+		{name: "expiry moved since the scan", refreshed: "b@example.com", wantDeleted: []string{"a@example.com", "c@example.com"}, wantSkipped: 1},
+		{name: "delete failing", failing: "c@example.com", wantDeleted: []string{"a@example.com", "b@example.com"}, wantErrors: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deletes []*dynamodb.DeleteItemInput
+			pages := [][]string{{"a@example.com", "b@example.com"}, {"c@example.com"}}
+			client := &fakeDynamo{
+				scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+					page := 0
+					if input.ExclusiveStartKey != nil {
+						page = 1
+					}
+					output := &dynamodb.ScanOutput{}
+					for _, email := range pages[page] {
+						output.Items = append(output.Items, map[string]types.AttributeValue{KeyAttribute: &types.AttributeValueMemberS{Value: email}})
+					}
+					if page == 0 {
+						output.LastEvaluatedKey = output.Items[len(output.Items)-1]
+					}
+					return output, nil
+				},
+				deleteItem: func(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+					deletes = append(deletes, input)
+					switch input.Key[KeyAttribute].(*types.AttributeValueMemberS).Value {
+					case tt.refreshed:
+						return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+					case tt.failing:
+						return nil, errors.New("throttled")
+					}
+					return &dynamodb.DeleteItemOutput{}, nil
+				},
+			}
+
+			result, err := Cleanup(context.Background(), time.Hour, tt.dryRun, "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Complete || result.Scanned != 3 || strings.Join(result.Deleted, ",") != strings.Join(tt.wantDeleted, ",") || result.Skipped != tt.wantSkipped || result.Errors != tt.wantErrors {
+				t.Errorf("result = %+v", result)
+			}
+			if tt.dryRun {
+				if len(deletes) > 0 {
+					t.Errorf("deletes = %d, want none", len(deletes))
+				}
+				return
+			}
+
+			// every delete is conditional on the user being expired still
+			if len(deletes) != 3 {
+				t.Fatalf("deletes = %d, want 3", len(deletes))
+			}
+			for _, input := range deletes {
+				condition := aws.ToString(input.ConditionExpression)
+				if !strings.Contains(condition, "attribute_exists") || !strings.Contains(condition, "<") {
+					t.Errorf("condition = %q", condition)
+				}
+				var names []string
+				for _, name := range input.ExpressionAttributeNames {
+					names = append(names, name)
+				}
+				if joined := strings.Join(names, ","); !strings.Contains(joined, TTLAttribute) || !strings.Contains(joined, ItemTypeAttribute) {
+					t.Errorf("condition names = %v", input.ExpressionAttributeNames)
+				}
+				cutoff := time.Now().Add(-time.Hour).Unix()
+				found := false
+				for _, value := range input.ExpressionAttributeValues {
+					if n, ok := value.(*types.AttributeValueMemberN); ok {
+						at, err := strconv.ParseInt(n.Value, 10, 64)
+						found = found || (err == nil && at <= cutoff && at > cutoff-60)
+					}
+				}
+				if !found {
+					t.Errorf("condition values = %v, want the cutoff", input.ExpressionAttributeValues)
+				}
+			}
+		})
+	}
+
+}
+
+func TestCleanupDeadline(t *testing.T) {
+
+	defer func(margin time.Duration) { cleanupMargin = margin }(cleanupMargin)
+	cleanupMargin = time.Hour
+
+	client := &fakeDynamo{scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		t.Fatal("scanned past the deadline")
+		return nil, nil
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := Cleanup(ctx, time.Hour, false, "users", client)
+	if err != nil || result.Complete {
+		t.Errorf("Cleanup = %+v, %v, want an incomplete run", result, err)
+	}
+
+}
@@ -0,0 +1,151 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+var (
+	ErrorInvalidCondition = "invalid condition"
+	ErrorConditionFailed  = "condition not met"
+)
+
+// ConditionError is a write whose ifMatch conditions didn't hold, Current has the
+// stored values of the fields that didn't match
+type ConditionError struct {
+	Current map[string]string
+}
+
+func (e *ConditionError) Error() string {
+	var fields []string
+	for field := range e.Current {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return ErrorConditionFailed + ": " + strings.Join(fields, ", ") + " changed"
+}
+
+// ConditionsFromRequest reads the conditions a PUT or DELETE is guarded with: the ifMatch
+// object of the body and the X-Condition header with field=value pairs separated by
+// commas, the header wins. Conditions are filters, see filterFields, so a condition on a
+// status of active also matches users without one.
+func ConditionsFromRequest(req events.APIGatewayProxyRequest, ifMatch map[string]string) (map[string]string, error) {
+
+	conditions := map[string]string{}
+	for field, value := range ifMatch {
+		conditions[field] = value
+	}
+
+	for name, header := range req.Headers {
+		if !strings.EqualFold(name, "X-Condition") {
+			continue
+		}
+		for _, pair := range strings.Split(header, ",") {
+			field, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || len(strings.TrimSpace(field)) == 0 {
+				return nil, fmt.Errorf("%s: %q is not field=value", ErrorInvalidCondition, pair)
+			}
+			conditions[strings.TrimSpace(field)] = strings.TrimSpace(value)
+		}
+	}
+
+	for key := range conditions {
+		if _, _, err := parseFilterKey(key); err != nil {
+			return nil, fmt.Errorf("%s: %s can't be used in a condition", ErrorInvalidCondition, key)
+		}
+	}
+	return conditions, nil
+
+}
+
+// DeleteConditions is ConditionsFromRequest for a DELETE, whose body is only
+// {"ifMatch": {...}} if there is one
+func DeleteConditions(req events.APIGatewayProxyRequest) (map[string]string, error) {
+
+	var body struct {
+		IfMatch map[string]string `json:"ifMatch"`
+	}
+	if len(strings.TrimSpace(req.Body)) > 0 {
+		if err := Decode(req.Body, &body); err != nil {
+			return nil, err
+		}
+	}
+	return ConditionsFromRequest(req, body.IfMatch)
+
+}
+
+// withConditions adds the conditions to condition
+func withConditions(condition expression.ConditionBuilder, conditions map[string]string) (expression.ConditionBuilder, error) {
+	if len(conditions) == 0 {
+		return condition, nil
+	}
+	c, err := filterCondition(conditions)
+	if err != nil {
+		return condition, err
+	}
+	return condition.And(c), nil
+}
+
+// CheckConditions is nil when u matches the conditions, a *ConditionError otherwise
+func CheckConditions(u *User, conditions map[string]string) error {
+
+	current := map[string]string{}
+	for key, value := range conditions {
+		matches, err := MatchesFilters(*u, map[string]string{key: value})
+		if err != nil {
+			return err
+		}
+		if !matches {
+			field, _, _ := parseFilterKey(key)
+			current[field] = fieldValue(u, field)
+		}
+	}
+	if len(current) > 0 {
+		return &ConditionError{Current: current}
+	}
+	return nil
+
+}
+
+// conditionFailure tells why a write guarded by conditions failed its condition: the
+// user is gone, a condition doesn't hold anymore, or the user was written in between
+func conditionFailure(ctx context.Context, email, tenant string, conditions map[string]string, tableName string, dynaClient DynamoDBAPI) error {
+
+	u, err := FetchUserConsistent(ctx, email, tenant, tableName, dynaClient)
+	if err != nil {
+		return err
+	}
+	if err := CheckConditions(u, conditions); err != nil {
+		return err
+	}
+	return errors.New(ErrorVersionConflict)
+
+}
+
+// fieldValue is the stored value of a field conditions can be on, like MatchesFilters
+// sees it
+func fieldValue(u *User, field string) string {
+	switch field {
+	case "firstName":
+		return u.FirstName
+	case "lastName":
+		return u.LastName
+	case "status":
+		if len(u.Status) == 0 {
+			return StatusActive
+		}
+		return u.Status
+	case "role":
+		if len(u.Role) == 0 {
+			return RoleUser
+		}
+		return u.Role
+	}
+	return ""
+}
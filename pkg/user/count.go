@@ -0,0 +1,208 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrorInvalidFilter = "invalid filter"
+
+// attributes scans can be filtered on
+var filterFields = map[string]bool{"firstName": true, "lastName": true, "status": true, "role": true}
+
+// CountUsers counts the users with a Select=COUNT scan, following every page, in
+// parallel segments with SCAN_SEGMENTS set. Filters are attribute/value pairs that all
+// have to match, a tenant only counts its users.
+func CountUsers(ctx context.Context, filters map[string]string, tenant, tableName string, dynaClient DynamoDBAPI) (int64, error) {
+
+	input := dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+		Select:    types.SelectCount,
+	}
+
+	if err := applyFilters(&input, filters); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if scanSegments > 1 && len(tenant) == 0 {
+		err := parallelScan(ctx, input, scanSegments, dynaClient, func(result *dynamodb.ScanOutput) error {
+			count += int64(result.Count)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		return count, nil
+	}
+
+	for {
+		result, err := scan(ctx, &input, tenant, dynaClient)
+		if err != nil {
+			return 0, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+		count += int64(result.Count)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return count, nil
+
+}
+
+// applyFilters adds an equality FilterExpression for every attribute/value pair. Items
+// that aren't users, like notes, are always filtered out.
+func applyFilters(input *dynamodb.ScanInput, filters map[string]string) error {
+
+	if input.ExpressionAttributeNames == nil {
+		input.ExpressionAttributeNames = map[string]string{}
+	}
+	input.ExpressionAttributeNames["#itemType"] = ItemTypeAttribute
+	input.FilterExpression = aws.String("attribute_not_exists(#itemType)")
+	if len(filters) == 0 {
+		return nil
+	}
+
+	// DynamoDB refuses an empty map of values, it's only set with filters
+	if input.ExpressionAttributeValues == nil {
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{}
+	}
+
+	expression, err := filterExpression(filters, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return err
+	}
+	// the filters may be an OR, like status and role, that mustn't swallow the AND
+	input.FilterExpression = aws.String(*input.FilterExpression + " AND (" + *expression + ")")
+	return nil
+
+}
+
+// filter operators, a filter key is the field alone for Equals or field:operator
+const (
+	FilterEquals     = "eq"
+	FilterBeginsWith = "begins_with"
+)
+
+// FilterKey is the key of a filter on field with operator
+func FilterKey(field, operator string) string {
+	if len(operator) == 0 || operator == FilterEquals {
+		return field
+	}
+	return field + ":" + operator
+}
+
+// parseFilterKey splits a filter key into the field and the operator, only fields in
+// filterFields can be filtered on
+func parseFilterKey(key string) (string, string, error) {
+
+	field, operator := key, FilterEquals
+	if i := strings.Index(key, ":"); i >= 0 {
+		field, operator = key[:i], key[i+1:]
+	}
+	if !filterFields[field] {
+		return "", "", fmt.Errorf("%s: %s can't be filtered on", ErrorInvalidFilter, field)
+	}
+	switch operator {
+	case FilterEquals:
+	case FilterBeginsWith:
+		// a status is one of two values, and a missing one counts as active
+		if field == "status" {
+			return "", "", fmt.Errorf("%s: status only supports %s", ErrorInvalidFilter, FilterEquals)
+		}
+	default:
+		return "", "", fmt.Errorf("%s: unknown operator %s", ErrorInvalidFilter, operator)
+	}
+	return field, operator, nil
+
+}
+
+// filterExpression builds the conditions of the filters into names and values, so it
+// can be used for scans and queries alike. The values are always expression attribute
+// values and every name is aliased, status and role are reserved words.
+func filterExpression(filters map[string]string, names map[string]string, values map[string]types.AttributeValue) (*string, error) {
+
+	condition, err := filterCondition(filters)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := expression.NewBuilder().WithFilter(condition).Build()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ErrorInvalidFilter, err)
+	}
+	for k, v := range expr.Names() {
+		names[k] = v
+	}
+	for k, v := range expr.Values() {
+		values[k] = v
+	}
+	return expr.Filter(), nil
+
+}
+
+// filterCondition is the condition of the filters, every one of them has to match.
+// There has to be at least one filter.
+func filterCondition(filters map[string]string) (expression.ConditionBuilder, error) {
+
+	// sorted so the expression is the same on every call
+	var keys []string
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var condition expression.ConditionBuilder
+	for i, key := range keys {
+		field, operator, err := parseFilterKey(key)
+		if err != nil {
+			return condition, err
+		}
+		value := filters[key]
+
+		var c expression.ConditionBuilder
+		switch {
+		case operator == FilterBeginsWith:
+			c = expression.Name(field).BeginsWith(value)
+		case field == "status":
+			if !validStatus(value) {
+				return condition, errors.New(ErrorInvalidStatus)
+			}
+			c = expression.Name(field).Equal(expression.Value(value))
+			// users created before the status existed are active
+			if value == StatusActive {
+				c = c.Or(expression.Name(field).AttributeNotExists())
+			}
+		case field == "role":
+			if !validRole(value) {
+				return condition, errors.New(ErrorInvalidRole)
+			}
+			c = expression.Name(field).Equal(expression.Value(value))
+			// and users from before roles are users
+			if value == RoleUser {
+				c = c.Or(expression.Name(field).AttributeNotExists())
+			}
+		default:
+			c = expression.Name(field).Equal(expression.Value(value))
+		}
+
+		if i == 0 {
+			condition = c
+		} else {
+			condition = condition.And(c)
+		}
+	}
+
+	return condition, nil
+
+}
@@ -0,0 +1,112 @@
+package user
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// resolved is the filter expression of input with the names and values filled in
+func resolved(input *dynamodb.ScanInput) string {
+	return regexp.MustCompile(`[#:]\w+`).ReplaceAllStringFunc(aws.ToString(input.FilterExpression), func(placeholder string) string {
+		if name, ok := input.ExpressionAttributeNames[placeholder]; ok {
+			return name
+		}
+		if value, ok := input.ExpressionAttributeValues[placeholder].(*types.AttributeValueMemberS); ok {
+			return "'" + value.Value + "'"
+		}
+		return placeholder
+	})
+}
+
+func TestApplyFilters(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		filters map[string]string
+		want    []string
+		wantErr string
+	}{
+		{name: "none", want: []string{"attribute_not_exists(itemType)"}},
+		{name: "equals", filters: map[string]string{"firstName": "John"}, want: []string{"firstName = 'John'"}},
+		{name: "begins with", filters: map[string]string{FilterKey("lastName", FilterBeginsWith): "Sm"}, want: []string{"begins_with (lastName, 'Sm')"}},
+		{name: "active includes users without status", filters: map[string]string{"status": StatusActive}, want: []string{"AND ((status = 'active') OR (attribute_not_exists (status)))"}},
+		{name: "suspended", filters: map[string]string{"status": StatusSuspended}, want: []string{"status = 'suspended'"}},
+		{name: "user includes users without role", filters: map[string]string{"role": RoleUser}, want: []string{"AND ((role = 'user') OR (attribute_not_exists (role)))"}},
+		{name: "all of them", filters: map[string]string{"firstName": "John", "role": RoleAdmin}, want: []string{"firstName = 'John') AND (role = 'admin'"}},
+		{name: "unknown field", filters: map[string]string{"passwordHash": "x"}, wantErr: ErrorInvalidFilter + ": passwordHash can't be filtered on"},
+		{name: "unknown operator", filters: map[string]string{"firstName:contains": "o"}, wantErr: ErrorInvalidFilter + ": unknown operator contains"},
+		{name: "status prefix", filters: map[string]string{FilterKey("status", FilterBeginsWith): "act"}, wantErr: ErrorInvalidFilter + ": status only supports eq"},
+		{name: "invalid status", filters: map[string]string{"status": "deleted"}, wantErr: ErrorInvalidStatus},
+		{name: "invalid role", filters: map[string]string{"role": "owner"}, wantErr: ErrorInvalidRole},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := dynamodb.ScanInput{TableName: aws.String("users")}
+			err := applyFilters(&input, tt.filters)
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expression := resolved(&input)
+			// notes, webhooks and API keys are never listed
+			if !strings.HasPrefix(expression, "attribute_not_exists(itemType)") {
+				t.Errorf("FilterExpression = %s", expression)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(expression, want) {
+					t.Errorf("FilterExpression = %s, want %s in it", expression, want)
+				}
+			}
+			if len(tt.filters) == 0 && input.ExpressionAttributeValues != nil {
+				t.Errorf("ExpressionAttributeValues = %v, DynamoDB refuses an empty map", input.ExpressionAttributeValues)
+			}
+		})
+	}
+
+}
+
+func TestMatchesFilters(t *testing.T) {
+
+	jane := User{Email: "jane@example.com", FirstName: "Jane", LastName: "Smith"}
+	tests := []struct {
+		name    string
+		user    User
+		filters map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{name: "no filters", user: jane, want: true},
+		{name: "equals", user: jane, filters: map[string]string{"firstName": "Jane"}, want: true},
+		{name: "not equal", user: jane, filters: map[string]string{"firstName": "jane"}, want: false},
+		{name: "prefix", user: jane, filters: map[string]string{FilterKey("lastName", FilterBeginsWith): "Sm"}, want: true},
+		{name: "all have to match", user: jane, filters: map[string]string{"firstName": "Jane", "lastName": "Doe"}, want: false},
+		{name: "without status counts as active", user: jane, filters: map[string]string{"status": StatusActive}, want: true},
+		{name: "without role counts as user", user: jane, filters: map[string]string{"role": RoleUser}, want: true},
+		{name: "admin", user: User{Role: RoleAdmin}, filters: map[string]string{"role": RoleUser}, want: false},
+		{name: "invalid role", user: jane, filters: map[string]string{"role": "owner"}, wantErr: true},
+		{name: "unknown field", user: jane, filters: map[string]string{"email": "jane@example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MatchesFilters(tt.user, tt.filters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("MatchesFilters = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,137 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrorCursorInvalid is a well-formed cursor that can't be used anymore, the client has
+// to start over from the first page. A cursor that isn't one is ErrorInvalidCursor.
+var ErrorCursorInvalid = "cursor invalid, restart from the first page"
+
+// CURSOR_SIGNING_KEY signs the cursors, every instance needs the same one. Without it
+// cursors aren't signed and only their expiry and parameters are checked. They expire
+// after CURSOR_TTL_SECONDS.
+var cursors = newCursorCodec([]byte(os.Getenv("CURSOR_SIGNING_KEY")), time.Duration(envInt("CURSOR_TTL_SECONDS", 3600))*time.Second)
+
+// cursorCodec turns the LastEvaluatedKey of a scan into a cursor and back. The cursor
+// is the key, a hash of the parameters of the list and the expiry as base64 encoded
+// JSON, followed by its HMAC.
+type cursorCodec struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+func newCursorCodec(key []byte, ttl time.Duration) *cursorCodec {
+	return &cursorCodec{key: key, ttl: ttl, now: time.Now}
+}
+
+type cursorPayload struct {
+	// Key is the email, and the tenant too when the tenant index was queried
+	Key     map[string]string `json:"k"`
+	Params  string            `json:"p"`
+	Expires int64             `json:"x"`
+}
+
+// paramsHash is the same for the same parameters in any order
+func paramsHash(params map[string]string) string {
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%q=%q\n", k, params[k])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func (c *cursorCodec) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encode is the cursor of key for a list with params
+func (c *cursorCodec) encode(key map[string]types.AttributeValue, params map[string]string) (string, error) {
+
+	email, ok := key[KeyAttribute].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", errors.New(ErrorInvalidCursor)
+	}
+	payload := cursorPayload{
+		Key:     map[string]string{KeyAttribute: email.Value},
+		Params:  paramsHash(params),
+		Expires: c.now().Add(c.ttl).Unix(),
+	}
+	if tenant, ok := key[TenantAttribute].(*types.AttributeValueMemberS); ok {
+		payload.Key[TenantAttribute] = tenant.Value
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", errors.New(ErrorInvalidCursor)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	if len(c.key) == 0 {
+		return encoded, nil
+	}
+	return encoded + "." + c.sign(encoded), nil
+
+}
+
+// decode is the start key of a cursor issued for a list with the same params
+func (c *cursorCodec) decode(cursor string, params map[string]string) (map[string]types.AttributeValue, error) {
+
+	encoded, signature, signed := strings.Cut(cursor, ".")
+	if len(c.key) > 0 {
+		if !signed {
+			return nil, fmt.Errorf("%s: not signed", ErrorCursorInvalid)
+		}
+		if !hmac.Equal([]byte(signature), []byte(c.sign(encoded))) {
+			return nil, fmt.Errorf("%s: bad signature", ErrorCursorInvalid)
+		}
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New(ErrorInvalidCursor)
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil || len(payload.Key[KeyAttribute]) == 0 {
+		return nil, errors.New(ErrorInvalidCursor)
+	}
+	if c.now().Unix() > payload.Expires {
+		return nil, fmt.Errorf("%s: expired", ErrorCursorInvalid)
+	}
+	if payload.Params != paramsHash(params) {
+		return nil, fmt.Errorf("%s: issued for different parameters", ErrorCursorInvalid)
+	}
+
+	startKey := itemKey(payload.Key[KeyAttribute])
+	for k, v := range payload.Key {
+		switch k {
+		case KeyAttribute:
+		case TenantAttribute:
+			startKey[k] = &types.AttributeValueMemberS{Value: v}
+		default:
+			return nil, errors.New(ErrorInvalidCursor)
+		}
+	}
+	return startKey, nil
+
+}
@@ -0,0 +1,264 @@
+package user
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// testCodec is a codec whose clock is at issued
+func testCodec(key string, issued time.Time) *cursorCodec {
+	c := newCursorCodec([]byte(key), time.Hour)
+	c.now = func() time.Time { return issued }
+	return c
+}
+
+// payloadCursor is the unsigned cursor of payload
+func payloadCursor(t *testing.T, payload cursorPayload) string {
+	t.Helper()
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+
+	issued := time.Unix(1700000000, 0)
+	params := map[string]string{"tenant": "", "param:sort": "email"}
+
+	tests := []struct {
+		name       string
+		signingKey string
+		key        map[string]types.AttributeValue
+	}{
+		{"unsigned", "", itemKey("jane@example.com")},
+		{"signed", "secret", itemKey("jane@example.com")},
+		{"tenant index", "secret", map[string]types.AttributeValue{
+			KeyAttribute:    &types.AttributeValueMemberS{Value: "jane@example.com"},
+			TenantAttribute: &types.AttributeValueMemberS{Value: "acme"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCodec(tt.signingKey, issued)
+			cursor, err := c.encode(tt.key, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(cursor, ".") != (len(tt.signingKey) > 0) {
+				t.Errorf("cursor = %s", cursor)
+			}
+
+			// the same parameters in any order, right before it expires
+			c.now = func() time.Time { return issued.Add(time.Hour) }
+			startKey, err := c.decode(cursor, map[string]string{"param:sort": "email", "tenant": ""})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(startKey) != len(tt.key) {
+				t.Fatalf("start key = %v, want %v", startKey, tt.key)
+			}
+			for name, value := range tt.key {
+				if !equalAttribute(startKey[name], value) {
+					t.Errorf("%s = %#v, want %#v", name, startKey[name], value)
+				}
+			}
+		})
+	}
+
+}
+
+func TestCursorRejected(t *testing.T) {
+
+	issued := time.Unix(1700000000, 0)
+	params := map[string]string{"tenant": "", "filter:role": "admin"}
+	signed, _ := testCodec("secret", issued).encode(itemKey("jane@example.com"), params)
+	unsigned, _ := testCodec("", issued).encode(itemKey("jane@example.com"), params)
+	encoded, signature, _ := strings.Cut(signed, ".")
+	expires := issued.Add(time.Hour).Unix()
+
+	tests := []struct {
+		name       string
+		signingKey string
+		cursor     string
+		params     map[string]string
+		now        time.Time
+		wantErr    string
+	}{
+		{
+			name:       "expired",
+			signingKey: "secret",
+			cursor:     signed,
+			now:        issued.Add(time.Hour + time.Second),
+			wantErr:    ErrorCursorInvalid + ": expired",
+		},
+		{
+			name:    "expired unsigned",
+			cursor:  unsigned,
+			now:     issued.Add(2 * time.Hour),
+			wantErr: ErrorCursorInvalid + ": expired",
+		},
+		{
+			name:       "other filters",
+			signingKey: "secret",
+			cursor:     signed,
+			params:     map[string]string{"tenant": "", "filter:role": "user"},
+			wantErr:    ErrorCursorInvalid + ": issued for different parameters",
+		},
+		{
+			name:       "other tenant",
+			signingKey: "secret",
+			cursor:     signed,
+			params:     map[string]string{"tenant": "acme", "filter:role": "admin"},
+			wantErr:    ErrorCursorInvalid + ": issued for different parameters",
+		},
+		{
+			name:       "other key",
+			signingKey: "other secret",
+			cursor:     signed,
+			wantErr:    ErrorCursorInvalid + ": bad signature",
+		},
+		{
+			name:       "tampered key",
+			signingKey: "secret",
+			cursor:     payloadCursor(t, cursorPayload{Key: map[string]string{KeyAttribute: "bob@example.com"}, Params: paramsHash(params), Expires: expires}) + "." + signature,
+			wantErr:    ErrorCursorInvalid + ": bad signature",
+		},
+		{
+			name:       "extended expiry",
+			signingKey: "secret",
+			cursor:     payloadCursor(t, cursorPayload{Key: map[string]string{KeyAttribute: "jane@example.com"}, Params: paramsHash(params), Expires: expires + 86400}) + "." + signature,
+			now:        issued.Add(2 * time.Hour),
+			wantErr:    ErrorCursorInvalid + ": bad signature",
+		},
+		{
+			name:       "signature dropped",
+			signingKey: "secret",
+			cursor:     encoded,
+			wantErr:    ErrorCursorInvalid + ": not signed",
+		},
+		{
+			name:       "unsigned while signing",
+			signingKey: "secret",
+			cursor:     unsigned,
+			wantErr:    ErrorCursorInvalid + ": not signed",
+		},
+		{
+			name:    "not base64",
+			cursor:  "not a cursor!",
+			wantErr: ErrorInvalidCursor,
+		},
+		{
+			name:    "not json",
+			cursor:  base64.RawURLEncoding.EncodeToString([]byte("jane@example.com")),
+			wantErr: ErrorInvalidCursor,
+		},
+		{
+			name:    "no email",
+			cursor:  payloadCursor(t, cursorPayload{Params: paramsHash(params), Expires: expires}),
+			wantErr: ErrorInvalidCursor,
+		},
+		{
+			name:    "other attributes",
+			cursor:  payloadCursor(t, cursorPayload{Key: map[string]string{KeyAttribute: "jane@example.com", "passwordHash": "x"}, Params: paramsHash(params), Expires: expires}),
+			wantErr: ErrorInvalidCursor,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			if now.IsZero() {
+				now = issued
+			}
+			p := tt.params
+			if p == nil {
+				p = params
+			}
+
+			_, err := testCodec(tt.signingKey, now).decode(tt.cursor, p)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("err = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+
+}
+
+func TestParamsHash(t *testing.T) {
+
+	tests := []struct {
+		name string
+		a, b map[string]string
+		same bool
+	}{
+		{"order", map[string]string{"a": "1", "b": "2"}, map[string]string{"b": "2", "a": "1"}, true},
+		{"value", map[string]string{"a": "1"}, map[string]string{"a": "2"}, false},
+		{"moved separator", map[string]string{"a": "b=c"}, map[string]string{"a=b": "c"}, false},
+		{"empty value", map[string]string{"a": ""}, map[string]string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := paramsHash(tt.a) == paramsHash(tt.b); same != tt.same {
+				t.Errorf("same hash = %t, want %t", same, tt.same)
+			}
+		})
+	}
+
+}
+
+func TestFetchUsersPageCursor(t *testing.T) {
+
+	var inputs []*dynamodb.ScanInput
+	client := &fakeDynamo{scan: func(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		inputs = append(inputs, in)
+		return &dynamodb.ScanOutput{
+			Items:            []map[string]types.AttributeValue{storedItem(t, User{Email: "jane@example.com", SchemaVersion: CurrentSchemaVersion})},
+			LastEvaluatedKey: itemKey("jane@example.com"),
+		}, nil
+	}}
+	first, err := FetchUsersPage(context.Background(), 1, "", nil, map[string]string{"role": RoleAdmin}, "", "users", client)
+	if err != nil || len(first.NextCursor) == 0 {
+		t.Fatalf("first page = %+v, %v", first, err)
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		filters map[string]string
+		wantErr string
+	}{
+		{name: "next page", filters: map[string]string{"role": RoleAdmin}},
+		{name: "other filters", filters: map[string]string{"role": RoleUser}, wantErr: ErrorCursorInvalid + ": issued for different parameters"},
+		{name: "other sort", params: map[string]string{"sort": "lastName"}, filters: map[string]string{"role": RoleAdmin}, wantErr: ErrorCursorInvalid + ": issued for different parameters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs = nil
+			_, err := FetchUsersPage(context.Background(), 1, first.NextCursor, tt.params, tt.filters, "", "users", client)
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				if len(inputs) > 0 {
+					t.Error("scanned with a rejected cursor")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalAttribute(inputs[0].ExclusiveStartKey[KeyAttribute], &types.AttributeValueMemberS{Value: "jane@example.com"}) {
+				t.Errorf("ExclusiveStartKey = %v", inputs[0].ExclusiveStartKey)
+			}
+		})
+	}
+
+}
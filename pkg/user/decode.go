@@ -0,0 +1,45 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// LENIENT_JSON=true goes back to ignoring unknown fields and trailing data, as an escape
+// hatch for clients that can't be fixed right away
+var lenientJSON = os.Getenv("LENIENT_JSON") == "true"
+
+// Decode reads a JSON body into v. Unknown fields are rejected with their name in the
+// error, so a misspelt "first_name" doesn't silently get lost.
+func Decode(body string, v interface{}) error {
+
+	if lenientJSON {
+		if err := json.Unmarshal([]byte(body), v); err != nil {
+			return errors.New(ErrorInvalidUserData)
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(body)))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		// the decoder has no typed error for this, the message is `json: unknown field "name"`
+		if prefix := "json: unknown field "; strings.HasPrefix(err.Error(), prefix) {
+			return fmt.Errorf("%s: unknown field %s", ErrorInvalidUserData, strings.TrimPrefix(err.Error(), prefix))
+		}
+		return errors.New(ErrorInvalidUserData)
+	}
+
+	// exactly one JSON value, nothing after it
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("%s: unexpected data after the JSON body", ErrorInvalidUserData)
+	}
+	return nil
+
+}
@@ -0,0 +1,44 @@
+package user
+
+import "reflect"
+
+// ChangedFields names the fields a write changed from previous to updated, as they are
+// called in the API. Only names, the values may be personal data that doesn't belong in
+// logs. What changes with every write, the version and updatedAt/updatedBy, isn't listed.
+func ChangedFields(previous, updated *User) []string {
+
+	// the expiry only counts when the instant changed
+	expiresAt := func(u *User) int64 {
+		if u.ExpiresAt == nil || u.ExpiresAt.IsZero() {
+			return 0
+		}
+		return u.ExpiresAt.Unix()
+	}
+
+	var changed []string
+	for _, field := range []struct {
+		name    string
+		changed bool
+	}{
+		{"firstName", previous.FirstName != updated.FirstName},
+		{"lastName", previous.LastName != updated.LastName},
+		{"phone", previous.Phone != updated.Phone},
+		{"status", previous.Status != updated.Status},
+		{"role", previous.Role != updated.Role},
+		{"password", previous.PasswordHash != updated.PasswordHash},
+		{"metadata", !sameMetadata(previous.Metadata, updated.Metadata)},
+		{"expiresAt", expiresAt(previous) != expiresAt(updated)},
+	} {
+		if field.changed {
+			changed = append(changed, field.name)
+		}
+	}
+	return changed
+
+}
+
+// sameMetadata compares metadata the way it's stored, without the empty values
+func sameMetadata(a, b map[string]string) bool {
+	a, b = compactMetadata(a), compactMetadata(b)
+	return (len(a) == 0 && len(b) == 0) || reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,168 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrorTooManyNotes = "user has too many notes to move"
+
+// a transaction writes at most 100 items, the user takes two of them
+const transactMaxItems = 100
+
+// ChangeEmail moves the user stored under email to newEmail, by is recorded as
+// updatedBy. The email is the key, so the user is written under the new key and
+// deleted under the old one in one transaction, along with its notes. The new address
+// has to be verified again. A taken newEmail is ErrorUserAlreadyExists, a user deleted
+// or written in between ErrorUserDoesNotExists.
+func ChangeEmail(ctx context.Context, email, newEmail, tenant, by, tableName string, dynaClient DynamoDBAPI) (*User, error) {
+
+	newEmail = validators.NormalizeEmail(newEmail)
+	if !validators.IsEmailValid(newEmail) {
+		return nil, errors.New(ErrorInvalidEmail)
+	}
+	if err := checkEmailDomain(newEmail); err != nil {
+		return nil, err
+	}
+
+	u, err := FetchUserConsistent(ctx, email, tenant, tableName, dynaClient)
+	if err != nil {
+		return nil, err
+	}
+	oldEmail := u.Email
+	if newEmail == oldEmail {
+		return nil, errors.New(ErrorNothingToUpdate)
+	}
+	// a quick answer for a taken address, also in different case. Emails are unique
+	// across tenants.
+	if _, err := FetchUserConsistent(ctx, newEmail, "", tableName, dynaClient, "email"); err == nil {
+		return nil, errors.New(ErrorUserAlreadyExists)
+	} else if err.Error() != ErrorUserDoesNotExists {
+		return nil, err
+	}
+
+	notes, err := noteItems(ctx, oldEmail, tableName, dynaClient)
+	if err != nil {
+		return nil, err
+	}
+	if 2+2*len(notes) > transactMaxItems {
+		return nil, errors.New(ErrorTooManyNotes)
+	}
+
+	current := u.Version
+	u.Email = newEmail
+	u.EmailLower = emailLower(newEmail)
+	u.Version++
+	u.UpdatedAt = now()
+	u.UpdatedBy = by
+	u.Verified = false
+	if err := newVerification(u); err != nil {
+		return nil, err
+	}
+
+	item, err := attributevalue.MarshalMap(u)
+	if err != nil {
+		return nil, flatten(ctx, ErrorMarshalItem, err)
+	}
+
+	names := map[string]string{}
+	condition, values := versionCondition(current, names)
+	condition = tenantCondition(condition, tenant, names, values)
+	items := []types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:                aws.String(tableName),
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(#email)"),
+			ExpressionAttributeNames: map[string]string{"#email": KeyAttribute},
+		}},
+		{Delete: &types.Delete{
+			TableName:                 aws.String(tableName),
+			Key:                       userKey(oldEmail),
+			ConditionExpression:       condition,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		}},
+	}
+	for _, note := range notes {
+		// noteItems only returns notes with an id
+		id := note["id"].(*types.AttributeValueMemberS).Value
+		moved := map[string]types.AttributeValue{}
+		for k, v := range note {
+			moved[k] = v
+		}
+		for k, v := range noteKey(newEmail, id) {
+			moved[k] = v
+		}
+		moved["noteOwner"] = &types.AttributeValueMemberS{Value: newEmail}
+		items = append(items,
+			types.TransactWriteItem{Put: &types.Put{TableName: aws.String(tableName), Item: moved}},
+			types.TransactWriteItem{Delete: &types.Delete{TableName: aws.String(tableName), Key: noteKey(oldEmail, id)}},
+		)
+	}
+
+	defer forgetUsers(oldEmail, newEmail)
+	_, err = dynaClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			return nil, emailChangeCancellation(ctx, canceled)
+		}
+		return nil, flatten(ctx, ErrorDynamoTransactWrite, err)
+	}
+
+	return u, nil
+
+}
+
+// emailChangeCancellation tells a taken new email from an old user that changed
+func emailChangeCancellation(ctx context.Context, canceled *types.TransactionCanceledException) error {
+	reasons := canceled.CancellationReasons
+	if len(reasons) > 0 && aws.ToString(reasons[0].Code) == "ConditionalCheckFailed" {
+		return errors.New(ErrorUserAlreadyExists)
+	}
+	if len(reasons) > 1 && aws.ToString(reasons[1].Code) == "ConditionalCheckFailed" {
+		return errors.New(ErrorUserDoesNotExists)
+	}
+	return flatten(ctx, ErrorDynamoTransactWrite, canceled)
+}
+
+// noteItems reads the stored notes of the user stored under email as they are
+func noteItems(ctx context.Context, email, tableName string, dynaClient DynamoDBAPI) ([]map[string]types.AttributeValue, error) {
+
+	input := dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		IndexName:                 aws.String(NotesIndex),
+		KeyConditionExpression:    aws.String("#owner = :owner"),
+		ExpressionAttributeNames:  map[string]string{"#owner": "noteOwner"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":owner": &types.AttributeValueMemberS{Value: email}},
+	}
+
+	var items []map[string]types.AttributeValue
+	for {
+		result, err := dynaClient.Query(ctx, &input)
+		if err != nil {
+			// no index, no notes
+			if isMissingIndex(err) {
+				return nil, nil
+			}
+			return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+		for _, item := range result.Items {
+			if _, ok := item["id"].(*types.AttributeValueMemberS); ok {
+				items = append(items, item)
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+}
@@ -0,0 +1,81 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TTLAttribute is the attribute the table's TTL is configured on
+const TTLAttribute = "ttl"
+
+// the stored names of the fields that are called differently in JSON
+var storedNames = map[string]string{"expiresAt": TTLAttribute}
+
+// Expiry is when a temporary user gets deleted. It's RFC3339 in JSON and epoch seconds in
+// the table, the format DynamoDB TTL expects. An empty string in a request is the zero
+// Expiry, which removes it.
+type Expiry struct {
+	time.Time
+}
+
+func (e Expiry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.UTC().Format(time.RFC3339))
+}
+
+func (e *Expiry) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		e.Time = time.Time{}
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return err
+	}
+	e.Time = t
+	return nil
+}
+
+func (e Expiry) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(e.Unix(), 10)}, nil
+}
+
+func (e *Expiry) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	n, ok := av.(*types.AttributeValueMemberN)
+	if !ok {
+		return errors.New(ErrorFailedToUnmarshalRecord)
+	}
+	seconds, err := strconv.ParseInt(n.Value, 10, 64)
+	if err != nil {
+		return err
+	}
+	e.Time = time.Unix(seconds, 0).UTC()
+	return nil
+}
+
+// expired is true once the TTL has passed, DynamoDB only deletes such items eventually
+func (u *User) expired() bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(time.Now())
+}
+
+// checkExpiry drops an empty expiresAt and makes sure a set one is in the future
+func checkExpiry(u *User) *FieldError {
+	if u.ExpiresAt == nil {
+		return nil
+	}
+	if u.ExpiresAt.IsZero() {
+		u.ExpiresAt = nil
+		return nil
+	}
+	if u.expired() {
+		return &FieldError{"expiresAt", "must be in the future"}
+	}
+	return nil
+}
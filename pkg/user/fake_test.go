@@ -0,0 +1,78 @@
+package user
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// fakeDynamo answers the calls a test sets a func for. Item calls without one find
+// nothing, other calls panic on the nil DynamoDBAPI.
+type fakeDynamo struct {
+	DynamoDBAPI
+	getItem    func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	putItem    func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	updateItem func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
+	deleteItem func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+	query      func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	scan       func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
+
+	describeTable func(*dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error)
+	createTable   func(*dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error)
+
+	executeStatement func(*dynamodb.ExecuteStatementInput) (*dynamodb.ExecuteStatementOutput, error)
+}
+
+func (f *fakeDynamo) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if f.getItem == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return f.getItem(input)
+}
+
+func (f *fakeDynamo) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if f.putItem == nil {
+		return &dynamodb.PutItemOutput{}, nil
+	}
+	return f.putItem(input)
+}
+
+func (f *fakeDynamo) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if f.updateItem == nil {
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+	return f.updateItem(input)
+}
+
+func (f *fakeDynamo) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if f.deleteItem == nil {
+		return &dynamodb.DeleteItemOutput{}, nil
+	}
+	return f.deleteItem(input)
+}
+
+func (f *fakeDynamo) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if f.query == nil {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	return f.query(input)
+}
+
+func (f *fakeDynamo) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if f.scan == nil {
+		return &dynamodb.ScanOutput{}, nil
+	}
+	return f.scan(input)
+}
+
+func (f *fakeDynamo) DescribeTable(ctx context.Context, input *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	return f.describeTable(input)
+}
+
+func (f *fakeDynamo) CreateTable(ctx context.Context, input *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	return f.createTable(input)
+}
+
+func (f *fakeDynamo) ExecuteStatement(ctx context.Context, input *dynamodb.ExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ExecuteStatementOutput, error) {
+	return f.executeStatement(input)
+}
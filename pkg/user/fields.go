@@ -0,0 +1,83 @@
+package user
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var ErrorInvalidFields = "invalid fields"
+
+// FieldNames lists the attribute names of User, taken from the json tags so new fields
+// are picked up automatically
+func FieldNames() []string {
+	var names []string
+	t := reflect.TypeOf(User{})
+	for i := 0; i < t.NumField(); i++ {
+		// fields that aren't stored, like the plain password, can't be selected
+		if t.Field(i).Tag.Get("dynamodbav") == "-" {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if len(name) > 0 && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ParseFields turns "email,firstName" into the list of attributes to read. Unknown names
+// are rejected with an error listing the valid ones.
+func ParseFields(value string) ([]string, error) {
+
+	valid := map[string]bool{}
+	for _, name := range FieldNames() {
+		valid[name] = true
+	}
+
+	var fields []string
+	seen := map[string]bool{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 || seen[field] {
+			continue
+		}
+		if !valid[field] {
+			return nil, fmt.Errorf("%s, valid fields are: %s", ErrorInvalidFields, strings.Join(FieldNames(), ", "))
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s, valid fields are: %s", ErrorInvalidFields, strings.Join(FieldNames(), ", "))
+	}
+	return fields, nil
+
+}
+
+// projection builds a ProjectionExpression for the attributes. Names are always aliased
+// since several (e.g. name, status) are DynamoDB reserved words.
+func projection(attributes []string, names map[string]string) (*string, map[string]string) {
+	if names == nil {
+		names = map[string]string{}
+	}
+
+	var aliases []string
+	for _, attr := range attributes {
+		stored, ok := storedNames[attr]
+		if !ok {
+			stored = attr
+		}
+		names["#"+attr] = stored
+		aliases = append(aliases, "#"+attr)
+	}
+	// upgrading an item needs to know its schema, whatever was asked for
+	if !containsString(attributes, "schemaVersion") {
+		names["#schemaVersion"] = "schemaVersion"
+		aliases = append(aliases, "#schemaVersion")
+	}
+	return aws.String(strings.Join(aliases, ", ")), names
+}
@@ -0,0 +1,31 @@
+package user
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// KeyAttribute is the partition key of the table. Users are stored under their email,
+// other items under a prefixed key and marked with ItemTypeAttribute, so the table
+// doesn't need a sort key and user items stay as they always were.
+const (
+	KeyAttribute      = "email"
+	ItemTypeAttribute = "itemType"
+)
+
+const (
+	ItemTypeNote = "note"
+	notePrefix   = "NOTE#"
+)
+
+func itemKey(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{KeyAttribute: &types.AttributeValueMemberS{Value: key}}
+}
+
+func userKey(email string) map[string]types.AttributeValue {
+	return itemKey(email)
+}
+
+// noteKey is NOTE#<email>#<id>, a validated email never starts like that
+func noteKey(email, id string) map[string]types.AttributeValue {
+	return itemKey(notePrefix + email + "#" + id)
+}
@@ -0,0 +1,138 @@
+package user
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrorCreateTable = "could not create table"
+
+// tableWait is how long EnsureTable waits for a table it created to become active
+const tableWait = 5 * time.Minute
+
+// DYNAMODB_ENDPOINT points the client at DynamoDB Local or LocalStack, for example
+// http://localhost:8000. Those take any credentials, so dummy ones are used.
+var dynamoEndpoint = os.Getenv("DYNAMODB_ENDPOINT")
+
+// DynamoOptions configures every DynamoDB client, on top of the shared configuration:
+// dynamodb.NewFromConfig(cfg, user.DynamoOptions). The SDK doesn't retry, WithRetry
+// does. With DYNAMODB_ENDPOINT set the client talks to that endpoint instead,
+// certificates are only left unchecked for localhost.
+func DynamoOptions(o *dynamodb.Options) {
+
+	o.Retryer = aws.NopRetryer{}
+	if len(dynamoEndpoint) == 0 {
+		return
+	}
+
+	o.BaseEndpoint = aws.String(dynamoEndpoint)
+	o.Credentials = credentials.NewStaticCredentialsProvider("local", "local", "")
+	// any region does locally, but the SDK won't sign without one
+	if len(o.Region) == 0 {
+		o.Region = "us-east-1"
+	}
+	if isLocalhost(dynamoEndpoint) {
+		o.HTTPClient = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}}
+	}
+
+}
+
+// isLocalhost is true for endpoints on the loopback interface
+func isLocalhost(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// tableIndexes are the GSIs the package queries, by partition and sort key
+var tableIndexes = []struct {
+	name, partition, sort string
+}{
+	{name: TenantIndex, partition: TenantAttribute},
+	{name: LastNameIndex, partition: "lastName"},
+	{name: EmailLowerIndex, partition: "emailLower"},
+	{name: VerificationIndex, partition: "verificationTokenHash"},
+	{name: NotesIndex, partition: "noteOwner", sort: "createdAt"},
+}
+
+// EnsureTable creates the table, keyed by email with on-demand billing and the indexes
+// of tableIndexes, unless it exists already, and waits until it can be used. It's for
+// DynamoDB Local, see LOCAL_BOOTSTRAP, deployed tables come from the infrastructure.
+func EnsureTable(ctx context.Context, tableName string, dynaClient DynamoDBAPI) error {
+
+	_, err := dynaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	if err == nil {
+		return nil
+	}
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		return flatten(ctx, ErrorCreateTable, err)
+	}
+
+	// every key attribute is a string, and is defined once however many keys it's in
+	attributes := []types.AttributeDefinition{{AttributeName: aws.String(KeyAttribute), AttributeType: types.ScalarAttributeTypeS}}
+	defined := map[string]bool{KeyAttribute: true}
+	var indexes []types.GlobalSecondaryIndex
+	for _, index := range tableIndexes {
+		keys := []types.KeySchemaElement{{AttributeName: aws.String(index.partition), KeyType: types.KeyTypeHash}}
+		if len(index.sort) > 0 {
+			keys = append(keys, types.KeySchemaElement{AttributeName: aws.String(index.sort), KeyType: types.KeyTypeRange})
+		}
+		for _, key := range keys {
+			if name := aws.ToString(key.AttributeName); !defined[name] {
+				defined[name] = true
+				attributes = append(attributes, types.AttributeDefinition{AttributeName: key.AttributeName, AttributeType: types.ScalarAttributeTypeS})
+			}
+		}
+		indexes = append(indexes, types.GlobalSecondaryIndex{
+			IndexName:  aws.String(index.name),
+			KeySchema:  keys,
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		})
+	}
+
+	_, err = dynaClient.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String(tableName),
+		AttributeDefinitions: attributes,
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(KeyAttribute), KeyType: types.KeyTypeHash},
+		},
+		GlobalSecondaryIndexes: indexes,
+		BillingMode:            types.BillingModePayPerRequest,
+	})
+	// another instance may have created it in between
+	var inUse *types.ResourceInUseException
+	if err != nil && !errors.As(err, &inUse) {
+		return flatten(ctx, ErrorCreateTable, err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(dynaClient)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)}, tableWait); err != nil {
+		return flatten(ctx, ErrorCreateTable, err)
+	}
+	logging.FromContext(ctx).InfoContext(ctx, "created table", "table", tableName)
+	return nil
+
+}
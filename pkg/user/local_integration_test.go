@@ -0,0 +1,69 @@
+//go:build integration
+
+package user
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Runs against DynamoDB Local or LocalStack at DYNAMODB_ENDPOINT:
+//
+//	docker run -p 8000:8000 amazon/dynamodb-local
+//	DYNAMODB_ENDPOINT=http://localhost:8000 go test -tags=integration ./pkg/user
+func TestLocalTable(t *testing.T) {
+
+	if len(dynamoEndpoint) == 0 {
+		t.Skip("DYNAMODB_ENDPOINT is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client := dynamodb.NewFromConfig(aws.Config{}, DynamoOptions)
+	tableName := "users-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	defer client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(tableName)})
+
+	if err := EnsureTable(ctx, tableName, client); err != nil {
+		t.Fatal(err)
+	}
+	// a second run finds the table
+	if err := EnsureTable(ctx, tableName, client); err != nil {
+		t.Fatal(err)
+	}
+	described, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes := map[string]bool{}
+	for _, index := range described.Table.GlobalSecondaryIndexes {
+		indexes[aws.ToString(index.IndexName)] = true
+	}
+	for _, index := range tableIndexes {
+		if !indexes[index.name] {
+			t.Errorf("index %s is missing, the table has %v", index.name, indexes)
+		}
+	}
+
+	req := events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodPost,
+		Body:       `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"}`,
+	}
+	if _, err := CreateUser(ctx, req, tableName, client); err != nil {
+		t.Fatal(err)
+	}
+	got, err := FetchUserConsistent(ctx, "jane@example.com", "", tableName, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "jane@example.com" || got.FirstName != "Jane" || got.LastName != "Doe" {
+		t.Errorf("FetchUserConsistent = %+v", got)
+	}
+
+}
@@ -0,0 +1,139 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestIsLocalhost(t *testing.T) {
+
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{"http://localhost:8000", true},
+		{"https://127.0.0.1:4566", true},
+		{"http://[::1]:8000", true},
+		{"http://dynamodb-local:8000", false},
+		{"https://dynamodb.eu-west-1.amazonaws.com", false},
+		{"http://localhost.example.com", false},
+		{"::not a url", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			if got := isLocalhost(tt.endpoint); got != tt.want {
+				t.Errorf("isLocalhost(%q) = %t, want %t", tt.endpoint, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestDynamoOptions(t *testing.T) {
+
+	defer func(endpoint string) { dynamoEndpoint = endpoint }(dynamoEndpoint)
+
+	tests := []struct {
+		name           string
+		endpoint       string
+		region         string
+		wantRegion     string
+		wantHTTPClient bool
+	}{
+		{name: "aws", region: "eu-west-1", wantRegion: "eu-west-1"},
+		{name: "dynamodb local", endpoint: "http://localhost:8000", wantRegion: "us-east-1", wantHTTPClient: true},
+		{name: "localstack with a region", endpoint: "http://127.0.0.1:4566", region: "eu-west-1", wantRegion: "eu-west-1", wantHTTPClient: true},
+		{name: "remote endpoint", endpoint: "https://dynamodb.example.com", region: "eu-west-1", wantRegion: "eu-west-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynamoEndpoint = tt.endpoint
+			o := dynamodb.Options{Region: tt.region}
+			DynamoOptions(&o)
+
+			if _, ok := o.Retryer.(aws.NopRetryer); !ok {
+				t.Errorf("Retryer = %T, the SDK retries as well", o.Retryer)
+			}
+			if aws.ToString(o.BaseEndpoint) != tt.endpoint || o.Region != tt.wantRegion {
+				t.Errorf("endpoint = %q, region = %q", aws.ToString(o.BaseEndpoint), o.Region)
+			}
+			if (o.Credentials != nil) != (len(tt.endpoint) > 0) {
+				t.Errorf("credentials = %v", o.Credentials)
+			}
+			_, custom := o.HTTPClient.(*http.Client)
+			if custom != tt.wantHTTPClient {
+				t.Errorf("HTTPClient = %T", o.HTTPClient)
+			}
+		})
+	}
+
+}
+
+func TestEnsureTable(t *testing.T) {
+
+	active := &dynamodb.DescribeTableOutput{Table: &types.TableDescription{TableStatus: types.TableStatusActive}}
+	tests := []struct {
+		name        string
+		describeErr error
+		createErr   error
+		wantCreate  bool
+		wantErr     string
+	}{
+		{name: "exists"},
+		{name: "created", describeErr: &types.ResourceNotFoundException{}, wantCreate: true},
+		{name: "created in between", describeErr: &types.ResourceNotFoundException{}, createErr: &types.ResourceInUseException{}, wantCreate: true},
+		{name: "describe fails", describeErr: errThrottled, wantErr: ErrorCreateTable},
+		{name: "create fails", describeErr: &types.ResourceNotFoundException{}, createErr: errThrottled, wantCreate: true, wantErr: ErrorCreateTable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *dynamodb.CreateTableInput
+			describes := 0
+			client := &fakeDynamo{
+				describeTable: func(in *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+					// the first describe is EnsureTable's, the others the waiter's
+					if describes++; describes == 1 && tt.describeErr != nil {
+						return nil, tt.describeErr
+					}
+					return active, nil
+				},
+				createTable: func(in *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+					created = in
+					return &dynamodb.CreateTableOutput{}, tt.createErr
+				},
+			}
+
+			err := EnsureTable(context.Background(), "users", client)
+			if (created != nil) != tt.wantCreate {
+				t.Fatalf("created = %t, want %t", created != nil, tt.wantCreate)
+			}
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created != nil {
+				if aws.ToString(created.TableName) != "users" || created.BillingMode != types.BillingModePayPerRequest {
+					t.Errorf("input = %+v", created)
+				}
+				if len(created.KeySchema) != 1 || aws.ToString(created.KeySchema[0].AttributeName) != KeyAttribute || created.KeySchema[0].KeyType != types.KeyTypeHash {
+					t.Errorf("KeySchema = %+v", created.KeySchema)
+				}
+				// the email and the six keys of the indexes
+				if len(created.GlobalSecondaryIndexes) != len(tableIndexes) || len(created.AttributeDefinitions) != 7 {
+					t.Errorf("indexes = %d, attributes = %d", len(created.GlobalSecondaryIndexes), len(created.AttributeDefinitions))
+				}
+			}
+		})
+	}
+
+}
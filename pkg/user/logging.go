@@ -0,0 +1,16 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+)
+
+// flatten logs err, most likely one of the SDK, with the logger of ctx and returns the
+// error of message in its place. Callers only ever see message, the log is the one
+// place that tells what DynamoDB said.
+func flatten(ctx context.Context, message string, err error) error {
+	logging.FromContext(ctx).ErrorContext(ctx, message, logging.Err(err))
+	return errors.New(message)
+}
@@ -0,0 +1,67 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// EmailLowerIndex is the GSI with emailLower as partition key. It finds users stored
+// under a key that differs from the normalized email in case, like Foo@Example.com
+// from before emails were normalized.
+const EmailLowerIndex = "emailLower-index"
+
+// EMAIL_LOOKUP_INDEX=true resolves every email through the index, instead of only when
+// the exact key isn't stored
+var emailLookupIndex = os.Getenv("EMAIL_LOOKUP_INDEX") == "true"
+
+// emailLower is what the emailLower attribute is set to on every write
+func emailLower(email string) string {
+	return strings.ToLower(email)
+}
+
+// lookupEmail finds the key the user with email is stored under through EmailLowerIndex,
+// or ErrorUserDoesNotExists. When several keys only differ in case the one that equals
+// email wins. Like every GSI query it's eventually consistent.
+func lookupEmail(ctx context.Context, email, tableName string, dynaClient DynamoDBAPI) (string, error) {
+
+	result, err := dynaClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		IndexName:                 aws.String(EmailLowerIndex),
+		KeyConditionExpression:    aws.String("#emailLower = :emailLower"),
+		ExpressionAttributeNames:  map[string]string{"#emailLower": "emailLower"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":emailLower": &types.AttributeValueMemberS{Value: emailLower(email)}},
+	})
+	if err != nil {
+		if isMissingIndex(err) {
+			return "", errors.New(ErrorIndexNotFound)
+		}
+		return "", flatten(ctx, ErrorFailedToFetchRecord, err)
+	}
+
+	var keys []string
+	for _, item := range result.Items {
+		if key, ok := item[KeyAttribute].(*types.AttributeValueMemberS); ok {
+			keys = append(keys, key.Value)
+		}
+	}
+	if len(keys) == 0 {
+		return "", errors.New(ErrorUserDoesNotExists)
+	}
+	if len(keys) > 1 {
+		logging.FromContext(ctx).WarnContext(ctx, "users stored in different case", "users", len(keys), "email", emailLower(email))
+		for _, key := range keys {
+			if key == email {
+				return key, nil
+			}
+		}
+	}
+	return keys[0], nil
+
+}
@@ -0,0 +1,74 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// limits on the free-form metadata of a user, the size is that of the JSON object
+const (
+	MetadataMaxKeys        = 25
+	MetadataMaxKeyLength   = 64
+	MetadataMaxValueLength = 1024
+	MetadataMaxSize        = 16 * 1024
+)
+
+// checkMetadata returns a FieldError for every key over the limits, named like
+// "metadata.<key>", and one for the whole map when it has too many keys or is too big
+func checkMetadata(metadata map[string]string) []FieldError {
+
+	// sorted so the errors come in the same order on every call
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var fields []FieldError
+	for _, key := range keys {
+		switch {
+		case len(key) == 0:
+			fields = append(fields, FieldError{"metadata", "keys must not be empty"})
+		case len(key) > MetadataMaxKeyLength:
+			fields = append(fields, FieldError{"metadata." + key, fmt.Sprintf("key must be at most %d characters", MetadataMaxKeyLength)})
+		case len(metadata[key]) > MetadataMaxValueLength:
+			fields = append(fields, FieldError{"metadata." + key, fmt.Sprintf("value must be at most %d characters", MetadataMaxValueLength)})
+		}
+	}
+
+	if len(metadata) > MetadataMaxKeys {
+		fields = append(fields, FieldError{"metadata", fmt.Sprintf("must have at most %d keys", MetadataMaxKeys)})
+	}
+	if encoded, _ := json.Marshal(metadata); len(encoded) > MetadataMaxSize {
+		fields = append(fields, FieldError{"metadata", fmt.Sprintf("must be at most %d bytes", MetadataMaxSize)})
+	}
+	return fields
+
+}
+
+// mergeMetadata applies a patch to the current metadata, an empty value deletes the key
+func mergeMetadata(current, patch map[string]string) map[string]string {
+
+	merged := map[string]string{}
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		if len(value) == 0 {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+
+}
+
+// compactMetadata drops the keys with empty values, an empty value means no key
+func compactMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	return mergeMetadata(nil, metadata)
+}
@@ -0,0 +1,117 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrorDynamoTransactWrite = "could not dynamo transact write items"
+
+type EmailCollision struct {
+	Email      string `json:"email"`
+	Normalized string `json:"normalized"`
+}
+
+type EmailMigration struct {
+	Migrated   []string         `json:"migrated"`
+	Collisions []EmailCollision `json:"collisions"`
+	Failed     []string         `json:"failed,omitempty"`
+}
+
+// MigrateEmails moves records stored under a not normalized email (Foo@Example.COM) to
+// the normalized key. A record is only moved when nothing is stored under the normalized
+// email yet, otherwise it's reported as a collision and left alone for someone to merge
+// by hand. With dryRun nothing is written.
+func MigrateEmails(ctx context.Context, dryRun bool, tableName string, dynaClient DynamoDBAPI) (*EmailMigration, error) {
+
+	migration := &EmailMigration{Migrated: []string{}, Collisions: []EmailCollision{}}
+
+	// raw items, so attributes User doesn't know about are moved along
+	input := dynamodb.ScanInput{TableName: aws.String(tableName)}
+	for {
+		result, err := dynaClient.Scan(ctx, &input)
+		if err != nil {
+			return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+
+		for _, item := range result.Items {
+			attr, ok := item[KeyAttribute].(*types.AttributeValueMemberS)
+			if !ok || item[ItemTypeAttribute] != nil {
+				continue
+			}
+			email := attr.Value
+			normalized := validators.NormalizeEmail(email)
+			if normalized == email {
+				continue
+			}
+
+			if dryRun {
+				if _, err := FetchUser(ctx, normalized, "", tableName, dynaClient, "email"); err == nil {
+					migration.Collisions = append(migration.Collisions, EmailCollision{email, normalized})
+				} else if err.Error() == ErrorUserDoesNotExists {
+					migration.Migrated = append(migration.Migrated, email)
+				} else {
+					migration.Failed = append(migration.Failed, email)
+				}
+				continue
+			}
+
+			switch err := moveItem(ctx, item, email, normalized, tableName, dynaClient); {
+			case err == nil:
+				migration.Migrated = append(migration.Migrated, email)
+			case err.Error() == ErrorUserAlreadyExists:
+				migration.Collisions = append(migration.Collisions, EmailCollision{email, normalized})
+			default:
+				migration.Failed = append(migration.Failed, email)
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return migration, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+}
+
+// moveItem writes item under the normalized email and deletes the old key in one
+// transaction, so a failure never leaves the user twice or not at all
+func moveItem(ctx context.Context, item map[string]types.AttributeValue, email, normalized, tableName string, dynaClient DynamoDBAPI) error {
+
+	moved := map[string]types.AttributeValue{}
+	for k, v := range item {
+		moved[k] = v
+	}
+	moved["email"] = &types.AttributeValueMemberS{Value: normalized}
+	moved["emailLower"] = &types.AttributeValueMemberS{Value: emailLower(normalized)}
+
+	_, err := dynaClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName:                aws.String(tableName),
+				Item:                     moved,
+				ConditionExpression:      aws.String("attribute_not_exists(#email)"),
+				ExpressionAttributeNames: map[string]string{"#email": "email"},
+			}},
+			{Delete: &types.Delete{
+				TableName: aws.String(tableName),
+				Key:       userKey(email),
+			}},
+		},
+	})
+	if err != nil {
+		// the only condition is on the normalized email being free
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			return errors.New(ErrorUserAlreadyExists)
+		}
+		return flatten(ctx, ErrorDynamoTransactWrite, err)
+	}
+	return nil
+
+}
@@ -0,0 +1,198 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ErrorNoteNotFound      = "note not found"
+	ErrorGenerateNoteID    = "could not generate note id"
+	ErrorInvalidNoteData   = "invalid note data"
+	ErrorNoteAlreadyExists = "note already exists"
+)
+
+// NotesIndex is the GSI with noteOwner as partition and createdAt as sort key
+const NotesIndex = "noteOwner-createdAt-index"
+
+const NoteMaxLength = 4000
+
+// Note is a free-text note about a user, stored as its own item next to the user
+type Note struct {
+	ID        string `json:"id" dynamodbav:"id"`
+	Owner     string `json:"-" dynamodbav:"noteOwner"`
+	TenantID  string `json:"-" dynamodbav:"tenantId,omitempty"`
+	Text      string `json:"text" dynamodbav:"text"`
+	CreatedAt string `json:"createdAt" dynamodbav:"createdAt"`
+	CreatedBy string `json:"createdBy" dynamodbav:"createdBy"`
+}
+
+// CreateNote adds a note to the user with the given email, by is who wrote it. The
+// user has to exist in tenant, otherwise ErrorUserDoesNotExists.
+func CreateNote(ctx context.Context, email, text, tenant, by, tableName string, dynaClient DynamoDBAPI) (*Note, error) {
+
+	email = validators.NormalizeEmail(email)
+	if !validators.IsEmailValid(email) {
+		return nil, errors.New(ErrorInvalidEmail)
+	}
+
+	text = strings.TrimSpace(text)
+	switch {
+	case len(text) == 0:
+		return nil, &ValidationError{Fields: []FieldError{{"text", "is required"}}}
+	case len(text) > NoteMaxLength:
+		return nil, &ValidationError{Fields: []FieldError{{"text", fmt.Sprintf("must be at most %d characters", NoteMaxLength)}}}
+	}
+
+	id, err := newNoteID()
+	if err != nil {
+		return nil, err
+	}
+	note := Note{ID: id, Owner: email, TenantID: tenant, Text: text, CreatedAt: now(), CreatedBy: by}
+
+	item, err := attributevalue.MarshalMap(note)
+	if err != nil {
+		return nil, flatten(ctx, ErrorMarshalItem, err)
+	}
+	for k, v := range noteKey(email, id) {
+		item[k] = v
+	}
+	item[ItemTypeAttribute] = &types.AttributeValueMemberS{Value: ItemTypeNote}
+
+	check := types.ConditionCheck{
+		TableName:                aws.String(tableName),
+		Key:                      userKey(email),
+		ConditionExpression:      aws.String("attribute_exists(#email)"),
+		ExpressionAttributeNames: map[string]string{"#email": KeyAttribute},
+	}
+	if len(tenant) > 0 {
+		check.ExpressionAttributeValues = map[string]types.AttributeValue{}
+		check.ConditionExpression = tenantCondition(check.ConditionExpression, tenant, check.ExpressionAttributeNames, check.ExpressionAttributeValues)
+	}
+
+	// the check and the put are one transaction, a note can't outlive a user deleted
+	// in between
+	_, err = dynaClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{ConditionCheck: &check},
+			{Put: &types.Put{
+				TableName:                aws.String(tableName),
+				Item:                     item,
+				ConditionExpression:      aws.String("attribute_not_exists(#email)"),
+				ExpressionAttributeNames: map[string]string{"#email": KeyAttribute},
+			}},
+		},
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			return nil, noteCancellation(ctx, canceled)
+		}
+		return nil, flatten(ctx, ErrorDynamoTransactWrite, err)
+	}
+
+	return &note, nil
+
+}
+
+// noteCancellation tells a missing user from a clashing note id
+func noteCancellation(ctx context.Context, canceled *types.TransactionCanceledException) error {
+	reasons := canceled.CancellationReasons
+	if len(reasons) > 0 && aws.ToString(reasons[0].Code) == "ConditionalCheckFailed" {
+		return errors.New(ErrorUserDoesNotExists)
+	}
+	if len(reasons) > 1 && aws.ToString(reasons[1].Code) == "ConditionalCheckFailed" {
+		return errors.New(ErrorNoteAlreadyExists)
+	}
+	return flatten(ctx, ErrorDynamoTransactWrite, canceled)
+}
+
+// FetchNotes returns the notes of a user, oldest first
+func FetchNotes(ctx context.Context, email, tenant, tableName string, dynaClient DynamoDBAPI) ([]Note, error) {
+
+	email = validators.NormalizeEmail(email)
+	if _, err := FetchUser(ctx, email, tenant, tableName, dynaClient, "email"); err != nil {
+		return nil, err
+	}
+
+	input := dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		IndexName:                 aws.String(NotesIndex),
+		KeyConditionExpression:    aws.String("#owner = :owner"),
+		ExpressionAttributeNames:  map[string]string{"#owner": "noteOwner"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":owner": &types.AttributeValueMemberS{Value: email}},
+	}
+
+	notes := []Note{}
+	for {
+		result, err := dynaClient.Query(ctx, &input)
+		if err != nil {
+			if isMissingIndex(err) {
+				return nil, errors.New(ErrorIndexNotFound)
+			}
+			return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+
+		var page []Note
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+		}
+		notes = append(notes, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return notes, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+}
+
+// DeleteNote removes one note of a user, or returns ErrorNoteNotFound
+func DeleteNote(ctx context.Context, email, id, tenant, tableName string, dynaClient DynamoDBAPI) error {
+
+	if len(id) == 0 {
+		return errors.New(ErrorInvalidNoteData)
+	}
+
+	input := dynamodb.DeleteItemInput{
+		TableName:                aws.String(tableName),
+		Key:                      noteKey(validators.NormalizeEmail(email), id),
+		ConditionExpression:      aws.String("attribute_exists(#email)"),
+		ExpressionAttributeNames: map[string]string{"#email": KeyAttribute},
+	}
+	if len(tenant) > 0 {
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{}
+		input.ConditionExpression = tenantCondition(input.ConditionExpression, tenant, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	}
+
+	_, err := dynaClient.DeleteItem(ctx, &input)
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return errors.New(ErrorNoteNotFound)
+		}
+		return flatten(ctx, ErrorDeleteItem, err)
+	}
+	return nil
+
+}
+
+// newNoteID is a random (version 4) UUID
+func newNoteID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.New(ErrorGenerateNoteID)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
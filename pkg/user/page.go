@@ -0,0 +1,89 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+var (
+	ErrorInvalidCursor = "invalid cursor"
+	ErrorInvalidLimit  = "invalid limit"
+)
+
+const MaxPageLimit = 1000
+
+type UserPage struct {
+	Items      []User `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// FetchUsersPage scans a single page of at most limit users (0 means no limit), starting
+// after the item the cursor points at. NextCursor is empty on the last page. With filters
+// the limit applies before filtering, a page may hold fewer users but still have a cursor.
+// A cursor only works for the same filters, tenant and attributes, and the same params,
+// the other list parameters of the caller like the sort order.
+func FetchUsersPage(ctx context.Context, limit int64, cursor string, params, filters map[string]string, tenant, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*UserPage, error) {
+
+	if limit < 0 || limit > MaxPageLimit {
+		return nil, errors.New(ErrorInvalidLimit)
+	}
+
+	input := dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(int32(limit))
+	}
+	if err := applyFilters(&input, filters); err != nil {
+		return nil, err
+	}
+	if len(attributes) > 0 {
+		input.ProjectionExpression, input.ExpressionAttributeNames = projection(attributes, input.ExpressionAttributeNames)
+	}
+
+	if len(cursor) > 0 {
+		startKey, err := cursors.decode(cursor, cursorParams(params, filters, tenant, attributes))
+		if err != nil {
+			return nil, err
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	result, err := scan(ctx, &input, tenant, dynaClient)
+	if err != nil {
+		return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+	}
+
+	page := UserPage{Items: []User{}}
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &page.Items); err != nil {
+		return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	upgradeUsers(page.Items)
+
+	if len(result.LastEvaluatedKey) > 0 {
+		if page.NextCursor, err = cursors.encode(result.LastEvaluatedKey, cursorParams(params, filters, tenant, attributes)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &page, nil
+
+}
+
+// cursorParams are what a cursor is bound to, the parameters of the caller plus the
+// filters, the tenant and the attributes of the scan
+func cursorParams(params, filters map[string]string, tenant string, attributes []string) map[string]string {
+	all := map[string]string{"tenant": tenant, "fields": strings.Join(attributes, ",")}
+	for k, v := range params {
+		all["param:"+k] = v
+	}
+	for k, v := range filters {
+		all["filter:"+k] = v
+	}
+	return all
+}
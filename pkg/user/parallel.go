@@ -0,0 +1,109 @@
+package user
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// SCAN_SEGMENTS > 1 has ScanAll and CountUsers split the table into that many segments
+// scanned at the same time. Tenants are read from TenantIndex, those queries always run
+// sequentially.
+var scanSegments = envInt("SCAN_SEGMENTS", 1)
+
+// ScanAllParallel is ScanAll with a parallel scan of segments segments. fn is called for
+// one user at a time, in no particular order. The first error, from DynamoDB or from fn,
+// stops every segment and is returned.
+func ScanAllParallel(ctx context.Context, filters map[string]string, tenant, tableName string, segments int, dynaClient DynamoDBAPI, fn func(User) error) error {
+
+	if segments <= 1 || len(tenant) > 0 {
+		return scanAll(ctx, filters, tenant, tableName, dynaClient, fn)
+	}
+
+	input := dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	}
+	if err := applyFilters(&input, filters); err != nil {
+		return err
+	}
+
+	return parallelScan(ctx, input, segments, dynaClient, func(result *dynamodb.ScanOutput) error {
+		var page []User
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+		}
+		upgradeUsers(page)
+		for _, u := range page {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+}
+
+// parallelScan scans every segment in its own goroutine and hands the pages to page on
+// the calling one, so page needs no locking. An error cancels the segments still running.
+func parallelScan(ctx context.Context, input dynamodb.ScanInput, segments int, dynaClient DynamoDBAPI, page func(*dynamodb.ScanOutput) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pages := make(chan *dynamodb.ScanOutput)
+	failed := make(chan error, segments)
+
+	var wg sync.WaitGroup
+	for segment := 0; segment < segments; segment++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			segmentInput := input
+			segmentInput.Segment = aws.Int32(int32(segment))
+			segmentInput.TotalSegments = aws.Int32(int32(segments))
+			for {
+				result, err := dynaClient.Scan(ctx, &segmentInput)
+				if err != nil {
+					failed <- flatten(ctx, ErrorFailedToFetchRecord, err)
+					return
+				}
+				select {
+				case pages <- result:
+				case <-ctx.Done():
+					return
+				}
+				if len(result.LastEvaluatedKey) == 0 {
+					return
+				}
+				segmentInput.ExclusiveStartKey = result.LastEvaluatedKey
+			}
+		}(segment)
+	}
+	go func() {
+		wg.Wait()
+		close(pages)
+	}()
+
+	for {
+		select {
+		case result, ok := <-pages:
+			if !ok {
+				// every segment is through, one may have failed on its last page
+				select {
+				case err := <-failed:
+					return err
+				default:
+					return nil
+				}
+			}
+			if err := page(result); err != nil {
+				return err
+			}
+		case err := <-failed:
+			return err
+		}
+	}
+
+}
@@ -0,0 +1,154 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// segmentedTable is a table of pages users per segment, one user per page. A scan
+// without segments reads segment 0 only. failing fails every scan of that segment.
+// The func returned along with it counts the pages read so far.
+func segmentedTable(t *testing.T, segments, pages, failing int) (*fakeDynamo, func() int) {
+
+	var mu sync.Mutex
+	seen := 0
+	read := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen
+	}
+	return &fakeDynamo{scan: func(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		segment := int(aws.ToInt32(in.Segment))
+		if in.TotalSegments != nil && int(*in.TotalSegments) != segments {
+			t.Errorf("TotalSegments = %d", *in.TotalSegments)
+		}
+		if segment == failing {
+			return nil, errThrottled
+		}
+		seen++
+		page := 0
+		if key, ok := in.ExclusiveStartKey["page"].(*types.AttributeValueMemberN); ok {
+			page, _ = strconv.Atoi(key.Value)
+		}
+
+		output := &dynamodb.ScanOutput{
+			Items: []map[string]types.AttributeValue{storedItem(t, User{Email: fmt.Sprintf("%d-%d@example.com", segment, page), SchemaVersion: CurrentSchemaVersion})},
+			Count: 1,
+		}
+		if page+1 < pages {
+			output.LastEvaluatedKey = map[string]types.AttributeValue{"page": &types.AttributeValueMemberN{Value: strconv.Itoa(page + 1)}}
+		}
+		return output, nil
+	}}, read
+
+}
+
+func TestScanAllParallel(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		segments  int
+		pages     int
+		failing   int
+		wantUsers int
+		wantErr   string
+	}{
+		{name: "sequential", segments: 1, pages: 3, failing: -1, wantUsers: 3},
+		{name: "four segments", segments: 4, pages: 3, failing: -1, wantUsers: 12},
+		{name: "one page each", segments: 8, pages: 1, failing: -1, wantUsers: 8},
+		{name: "segment fails", segments: 4, pages: 3, failing: 2, wantErr: ErrorFailedToFetchRecord},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := segmentedTable(t, tt.segments, tt.pages, tt.failing)
+
+			var emails []string
+			err := ScanAllParallel(context.Background(), nil, "", "users", tt.segments, client, func(u User) error {
+				emails = append(emails, u.Email)
+				return nil
+			})
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(emails)
+			if len(emails) != tt.wantUsers {
+				t.Fatalf("users = %v, want %d", emails, tt.wantUsers)
+			}
+			for i := 1; i < len(emails); i++ {
+				if emails[i] == emails[i-1] {
+					t.Errorf("%s is read twice", emails[i])
+				}
+			}
+		})
+	}
+
+}
+
+func TestScanAllParallelStops(t *testing.T) {
+
+	client, seen := segmentedTable(t, 4, 100, -1)
+	stop := errors.New("stop")
+
+	read := 0
+	err := ScanAllParallel(context.Background(), nil, "", "users", 4, client, func(u User) error {
+		if read++; read == 5 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("err = %v, want %v", err, stop)
+	}
+	// every segment may have had one more page in flight
+	if pages := seen(); pages > 5+4 {
+		t.Errorf("%d pages read after fn failed", pages-5)
+	}
+
+}
+
+func TestCountUsersParallel(t *testing.T) {
+
+	defer func(segments int) { scanSegments = segments }(scanSegments)
+
+	tests := []struct {
+		segments int
+		want     int64
+	}{
+		{1, 5},
+		{3, 15},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.segments), func(t *testing.T) {
+			scanSegments = tt.segments
+			client, _ := segmentedTable(t, tt.segments, 5, -1)
+
+			count, err := CountUsers(context.Background(), nil, "", "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.want {
+				t.Errorf("count = %d, want %d", count, tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,226 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	ErrorInvalidStatement       = "invalid statement"
+	ErrorDynamoExecuteStatement = "could not execute statement"
+	ErrorQueriesDisabled        = "admin queries are disabled with MULTI_TENANT"
+)
+
+// ADMIN_QUERY_MAX_ROWS caps the rows one ExecuteQuery returns
+var queryMaxRows = envInt("ADMIN_QUERY_MAX_ROWS", 100)
+
+// attributes of a user that never leave the table through a query
+var secretAttributes = []string{"passwordHash", "verificationTokenHash"}
+
+// queryAttributes are the only attributes a row of a query keeps: those of a user, its
+// secrets aside, and the item type. Other items share the table, a webhook shows neither
+// its secret nor an API key its hash.
+var queryAttributes = userAttributes()
+
+func userAttributes() map[string]bool {
+
+	attributes := map[string]bool{ItemTypeAttribute: true}
+	t := reflect.TypeOf(User{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("dynamodbav"), ",")
+		if len(name) > 0 && name != "-" {
+			attributes[name] = true
+		}
+	}
+	for _, attr := range secretAttributes {
+		delete(attributes, attr)
+	}
+	return attributes
+
+}
+
+// QueryResult is a page of rows of ExecuteQuery. NextToken continues the query where the
+// page ended, Truncated means the last page read had more rows than the limit allowed
+// and the rest of it was dropped, NextToken then continues after that page.
+type QueryResult struct {
+	Items     []map[string]interface{} `json:"items"`
+	NextToken string                   `json:"nextToken,omitempty"`
+	Truncated bool                     `json:"truncated,omitempty"`
+}
+
+// ValidateStatement accepts a single PartiQL SELECT from tableName or one of its
+// indexes, nothing else. Literals and quoted names are skipped when looking at the
+// statement, so a SELECT can't hide a second FROM in them.
+func ValidateStatement(statement, tableName string) error {
+
+	tokens, err := partiqlTokens(statement)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 || !strings.EqualFold(tokens[0], "SELECT") {
+		return fmt.Errorf("%s: only SELECT is allowed", ErrorInvalidStatement)
+	}
+
+	from := -1
+	for i, token := range tokens {
+		switch {
+		case token == ";":
+			return fmt.Errorf("%s: only one statement is allowed", ErrorInvalidStatement)
+		case strings.EqualFold(token, "FROM"):
+			if from >= 0 {
+				return fmt.Errorf("%s: only one FROM is allowed", ErrorInvalidStatement)
+			}
+			from = i
+		}
+	}
+	if from < 0 || from+1 >= len(tokens) {
+		return fmt.Errorf("%s: FROM is missing", ErrorInvalidStatement)
+	}
+
+	// "table", table or "table"."index"
+	if unquote(tokens[from+1]) != tableName {
+		return fmt.Errorf("%s: only %s can be queried", ErrorInvalidStatement, tableName)
+	}
+	if from+2 < len(tokens) && tokens[from+2] == "." {
+		if from+3 >= len(tokens) || !strings.HasPrefix(tokens[from+3], `"`) {
+			return fmt.Errorf("%s: the index name must be quoted", ErrorInvalidStatement)
+		}
+	}
+	return nil
+
+}
+
+// partiqlTokens splits a statement into words, quoted strings and names, and single
+// punctuation characters
+func partiqlTokens(statement string) ([]string, error) {
+
+	var tokens []string
+	runes := []rune(statement)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			// a doubled quote is an escaped one
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == r {
+					if j+1 < len(runes) && runes[j+1] == r {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("%s: unterminated quote", ErrorInvalidStatement)
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-', r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			return nil, fmt.Errorf("%s: comments are not allowed", ErrorInvalidStatement)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '-') {
+				// a comment right after a word is still a comment
+				if runes[j] == '-' && j+1 < len(runes) && runes[j+1] == '-' {
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens, nil
+
+}
+
+func unquote(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return name
+}
+
+// ExecuteQuery runs a statement ValidateStatement accepts with parameters for its ?
+// placeholders. It reads pages until it has limit rows, at most queryMaxRows, and
+// returns them with nothing but queryAttributes. A statement reads the whole table, so
+// with MULTI_TENANT on it's ErrorQueriesDisabled.
+func ExecuteQuery(ctx context.Context, statement string, parameters []interface{}, limit int, nextToken, tableName string, dynaClient DynamoDBAPI) (*QueryResult, error) {
+
+	if multiTenant {
+		return nil, errors.New(ErrorQueriesDisabled)
+	}
+	if err := ValidateStatement(statement, tableName); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > queryMaxRows {
+		limit = queryMaxRows
+	}
+
+	input := dynamodb.ExecuteStatementInput{Statement: aws.String(statement)}
+	if len(parameters) > 0 {
+		values, err := attributevalue.MarshalList(parameters)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid parameters", ErrorInvalidStatement)
+		}
+		input.Parameters = values
+	}
+	if len(nextToken) > 0 {
+		input.NextToken = aws.String(nextToken)
+	}
+
+	result := &QueryResult{Items: []map[string]interface{}{}}
+	for {
+		output, err := dynaClient.ExecuteStatement(ctx, &input)
+		if err != nil {
+			// DynamoDB checks what ValidateStatement doesn't, like the syntax
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ValidationException" {
+				return nil, fmt.Errorf("%s: %s", ErrorInvalidStatement, apiErr.ErrorMessage())
+			}
+			return nil, flatten(ctx, ErrorDynamoExecuteStatement, err)
+		}
+
+		var rows []map[string]interface{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &rows); err != nil {
+			return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+		}
+		for _, row := range rows {
+			for attr := range row {
+				if !queryAttributes[attr] {
+					delete(row, attr)
+				}
+			}
+		}
+		result.Items = append(result.Items, rows...)
+
+		if len(result.Items) > limit {
+			// the rest of the page can't be continued from, only the next page can
+			result.Items = result.Items[:limit]
+			result.NextToken = aws.ToString(output.NextToken)
+			result.Truncated = true
+			return result, nil
+		}
+		result.NextToken = aws.ToString(output.NextToken)
+		if len(result.NextToken) == 0 || len(result.Items) == limit {
+			return result, nil
+		}
+		input.NextToken = output.NextToken
+	}
+
+}
@@ -0,0 +1,259 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestValidateStatement(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		statement string
+		wantErr   string
+	}{
+		{name: "select", statement: `SELECT * FROM users`},
+		{name: "lowercase", statement: `select email from users where role = 'admin'`},
+		{name: "quoted table", statement: `SELECT * FROM "users" WHERE email = ?`},
+		{name: "index", statement: `SELECT * FROM "users"."TenantIndex" WHERE tenantId = ?`},
+		{name: "from in a literal", statement: `SELECT * FROM users WHERE firstName = 'from others'`},
+		{name: "quote in a literal", statement: `SELECT * FROM users WHERE lastName = 'O''Brien'`},
+		{name: "hyphenated attribute", statement: `SELECT * FROM users WHERE "first-name" = ?`},
+		{name: "empty", statement: ``, wantErr: "only SELECT is allowed"},
+		{name: "update", statement: `UPDATE users SET role = 'admin' WHERE email = ?`, wantErr: "only SELECT is allowed"},
+		{name: "delete", statement: `DELETE FROM users WHERE email = ?`, wantErr: "only SELECT is allowed"},
+		{name: "two statements", statement: `SELECT * FROM users; DELETE FROM users`, wantErr: "only one statement is allowed"},
+		{name: "other table", statement: `SELECT * FROM orders`, wantErr: "only users can be queried"},
+		{name: "table in other case", statement: `SELECT * FROM Users`, wantErr: "only users can be queried"},
+		{name: "second from", statement: `SELECT * FROM users FROM orders`, wantErr: "only one FROM is allowed"},
+		{name: "no from", statement: `SELECT 1`, wantErr: "FROM is missing"},
+		{name: "from at the end", statement: `SELECT * FROM`, wantErr: "FROM is missing"},
+		{name: "unquoted index", statement: `SELECT * FROM users.TenantIndex`, wantErr: "the index name must be quoted"},
+		{name: "unterminated quote", statement: `SELECT * FROM users WHERE email = 'jane`, wantErr: "unterminated quote"},
+		{name: "line comment", statement: `SELECT * FROM users -- WHERE`, wantErr: "comments are not allowed"},
+		{name: "comment after a word", statement: `SELECT * FROM users--`, wantErr: "comments are not allowed"},
+		{name: "block comment", statement: `SELECT * FROM /* x */ users`, wantErr: "comments are not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStatement(tt.statement, "users")
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("ValidateStatement(%q) = %v", tt.statement, err)
+				}
+				return
+			}
+			if err == nil || err.Error() != ErrorInvalidStatement+": "+tt.wantErr {
+				t.Errorf("ValidateStatement(%q) = %v, want %s", tt.statement, err, tt.wantErr)
+			}
+		})
+	}
+
+}
+
+// statementPages serves pages of rows rows each, the token of a page is its number
+func statementPages(t *testing.T, pages, rows int) (*fakeDynamo, *[]string) {
+
+	var tokens []string
+	return &fakeDynamo{executeStatement: func(in *dynamodb.ExecuteStatementInput) (*dynamodb.ExecuteStatementOutput, error) {
+		token := aws.ToString(in.NextToken)
+		tokens = append(tokens, token)
+		page := 0
+		fmt.Sscan(token, &page)
+
+		output := &dynamodb.ExecuteStatementOutput{}
+		for row := 0; row < rows; row++ {
+			output.Items = append(output.Items, storedItem(t, User{Email: fmt.Sprintf("%d-%d@example.com", page, row), PasswordHash: "hash"}))
+		}
+		if page+1 < pages {
+			output.NextToken = aws.String(fmt.Sprint(page + 1))
+		}
+		return output, nil
+	}}, &tokens
+
+}
+
+func TestExecuteQuery(t *testing.T) {
+
+	defer func(max int) { queryMaxRows = max }(queryMaxRows)
+	queryMaxRows = 10
+
+	tests := []struct {
+		name          string
+		pages, rows   int
+		limit         int
+		nextToken     string
+		wantRows      int
+		wantNextToken string
+		wantTruncated bool
+		wantCalls     int
+	}{
+		{name: "one page", pages: 1, rows: 3, limit: 5, wantRows: 3, wantCalls: 1},
+		{name: "pages up to the limit", pages: 5, rows: 2, limit: 4, wantRows: 4, wantNextToken: "2", wantCalls: 2},
+		{name: "all pages", pages: 3, rows: 2, limit: 10, wantRows: 6, wantCalls: 3},
+		{name: "continued", pages: 3, rows: 2, limit: 10, nextToken: "1", wantRows: 4, wantCalls: 2},
+		{name: "page cut at the limit", pages: 5, rows: 3, limit: 4, wantRows: 4, wantNextToken: "2", wantTruncated: true, wantCalls: 2},
+		{name: "last page cut", pages: 1, rows: 5, limit: 4, wantRows: 4, wantTruncated: true, wantCalls: 1},
+		{name: "limit over the maximum", pages: 1, rows: 12, limit: 50, wantRows: 10, wantTruncated: true, wantCalls: 1},
+		{name: "no limit", pages: 1, rows: 12, wantRows: 10, wantTruncated: true, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, tokens := statementPages(t, tt.pages, tt.rows)
+
+			result, err := ExecuteQuery(context.Background(), `SELECT * FROM users`, nil, tt.limit, tt.nextToken, "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Items) != tt.wantRows || result.NextToken != tt.wantNextToken || result.Truncated != tt.wantTruncated {
+				t.Errorf("rows = %d, next token = %q, truncated = %t, want %d %q %t", len(result.Items), result.NextToken, result.Truncated, tt.wantRows, tt.wantNextToken, tt.wantTruncated)
+			}
+			if len(*tokens) != tt.wantCalls || (*tokens)[0] != tt.nextToken {
+				t.Errorf("tokens = %q", *tokens)
+			}
+			for _, row := range result.Items {
+				if _, ok := row["passwordHash"]; ok {
+					t.Fatalf("row has the password hash: %v", row)
+				}
+			}
+		})
+	}
+
+}
+
+func TestExecuteQueryErrors(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		statement  string
+		parameters []interface{}
+		err        error
+		wantErr    string
+	}{
+		{name: "invalid statement", statement: `DELETE FROM users`, wantErr: ErrorInvalidStatement},
+		{name: "rejected by dynamodb", statement: `SELECT * FROM users WHERE`, err: &smithy.GenericAPIError{Code: "ValidationException", Message: "Unexpected end of statement"}, wantErr: ErrorInvalidStatement + ": Unexpected end of statement"},
+		{name: "failure", statement: `SELECT * FROM users`, err: &types.InternalServerError{}, wantErr: ErrorDynamoExecuteStatement},
+		{name: "parameters", statement: `SELECT * FROM users WHERE email = ?`, parameters: []interface{}{"jane@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input *dynamodb.ExecuteStatementInput
+			client := &fakeDynamo{executeStatement: func(in *dynamodb.ExecuteStatementInput) (*dynamodb.ExecuteStatementOutput, error) {
+				input = in
+				return &dynamodb.ExecuteStatementOutput{}, tt.err
+			}}
+
+			_, err := ExecuteQuery(context.Background(), tt.statement, tt.parameters, 10, "", "users", client)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(input.Parameters) != 1 || !equalAttribute(input.Parameters[0], &types.AttributeValueMemberS{Value: "jane@example.com"}) {
+				t.Errorf("Parameters = %v", input.Parameters)
+			}
+		})
+	}
+
+}
+
+func TestExecuteQueryAttributes(t *testing.T) {
+
+	marshal := func(item interface{}, itemType string) map[string]types.AttributeValue {
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(itemType) > 0 {
+			av[KeyAttribute] = &types.AttributeValueMemberS{Value: itemType + "#1"}
+			av[ItemTypeAttribute] = &types.AttributeValueMemberS{Value: itemType}
+		}
+		return av
+	}
+
+	tests := []struct {
+		name     string
+		item     map[string]types.AttributeValue
+		wantKept []string
+		secrets  []string
+	}{
+		{
+			name:     "user",
+			item:     marshal(User{Email: "jane@example.com", FirstName: "Jane", PasswordHash: "hash", VerificationTokenHash: "token"}, ""),
+			wantKept: []string{"email", "firstName", "verified"},
+			secrets:  []string{"passwordHash", "verificationTokenHash"},
+		},
+		{
+			name:     "webhook",
+			item:     marshal(Webhook{ID: "1", URL: "https://example.com/hook", Secret: "a-secret-of-sixteen", CreatedAt: "2024-01-01T00:00:00Z"}, ItemTypeWebhook),
+			wantKept: []string{"email", "itemType", "createdAt"},
+			secrets:  []string{"secret", "url"},
+		},
+		{
+			name:     "API key",
+			item:     marshal(APIKey{ID: "1", Hash: "0123abcd", Owner: "jane@example.com", Enabled: true}, ItemTypeAPIKey),
+			wantKept: []string{"email", "itemType"},
+			secrets:  []string{"keyHash", "owner"},
+		},
+		{
+			name:     "unknown attribute",
+			item:     map[string]types.AttributeValue{"email": &types.AttributeValueMemberS{Value: "x"}, "apiToken": &types.AttributeValueMemberS{Value: "t"}},
+			wantKept: []string{"email"},
+			secrets:  []string{"apiToken"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDynamo{executeStatement: func(in *dynamodb.ExecuteStatementInput) (*dynamodb.ExecuteStatementOutput, error) {
+				return &dynamodb.ExecuteStatementOutput{Items: []map[string]types.AttributeValue{tt.item}}, nil
+			}}
+
+			result, err := ExecuteQuery(context.Background(), `SELECT * FROM users`, nil, 10, "", "users", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Items) != 1 {
+				t.Fatalf("rows = %v", result.Items)
+			}
+			row := result.Items[0]
+			for _, attr := range tt.wantKept {
+				if _, ok := row[attr]; !ok {
+					t.Errorf("%s is dropped: %v", attr, row)
+				}
+			}
+			for _, attr := range tt.secrets {
+				if _, ok := row[attr]; ok {
+					t.Errorf("%s comes back: %v", attr, row)
+				}
+			}
+		})
+	}
+
+}
+
+func TestExecuteQueryMultiTenant(t *testing.T) {
+
+	defer func(enabled bool) { multiTenant = enabled }(multiTenant)
+	multiTenant = true
+
+	client := &fakeDynamo{executeStatement: func(in *dynamodb.ExecuteStatementInput) (*dynamodb.ExecuteStatementOutput, error) {
+		t.Fatal("a statement runs across the tenants")
+		return nil, nil
+	}}
+	if _, err := ExecuteQuery(context.Background(), `SELECT * FROM users`, nil, 10, "", "users", client); err == nil || err.Error() != ErrorQueriesDisabled {
+		t.Errorf("err = %v, want %s", err, ErrorQueriesDisabled)
+	}
+
+}
@@ -0,0 +1,100 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrorHashPassword = "could not hash password"
+
+// BCRYPT_COST defaults to bcrypt's own default of 10, PASSWORD_MIN_LENGTH to 8
+var (
+	bcryptCost        = envInt("BCRYPT_COST", bcrypt.DefaultCost)
+	passwordMinLength = envInt("PASSWORD_MIN_LENGTH", 8)
+)
+
+// dummyHash is compared against when the user doesn't exist, so a login takes the same
+// time whether the email is known or not
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.MinCost)
+
+// setPassword replaces the plain password of u by its hash, validateFields has checked
+// it. Without a password nothing changes, the hash already on u is kept.
+func setPassword(u *User) error {
+
+	if len(u.Password) == 0 {
+		return nil
+	}
+
+	hash, err := hashPassword(u.Password)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+	u.Password = ""
+	return nil
+
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return "", errors.New(ErrorHashPassword)
+	}
+	return string(hash), nil
+}
+
+// checkPassword wants passwordMinLength characters with at least one letter and one
+// digit. bcrypt ignores everything after 72 bytes, longer passwords are refused.
+func checkPassword(password string) *FieldError {
+
+	var letter, digit bool
+	for _, c := range password {
+		letter = letter || unicode.IsLetter(c)
+		digit = digit || unicode.IsDigit(c)
+	}
+
+	switch {
+	case utf8.RuneCountInString(password) < passwordMinLength:
+		return &FieldError{"password", fmt.Sprintf("must be at least %d characters", passwordMinLength)}
+	case len(password) > 72:
+		return &FieldError{"password", "must be at most 72 bytes"}
+	case !letter || !digit:
+		return &FieldError{"password", "must contain a letter and a digit"}
+	}
+	return nil
+
+}
+
+// VerifyPassword tells whether password is the one stored for email. Unknown users and
+// users without a password, as well as users of other tenants, are simply not verified.
+func VerifyPassword(ctx context.Context, email, password, tenant, tableName string, dynaClient DynamoDBAPI) (bool, error) {
+
+	u, err := FetchUser(ctx, email, tenant, tableName, dynaClient, "email", "passwordHash")
+	if err != nil && err.Error() != ErrorUserDoesNotExists {
+		return false, err
+	}
+
+	hash := dummyHash
+	if u != nil && len(u.PasswordHash) > 0 {
+		hash = []byte(u.PasswordHash)
+	}
+
+	// CompareHashAndPassword compares in constant time
+	matches := bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+	return matches && u != nil && len(u.PasswordHash) > 0, nil
+
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,226 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// The functions here are the part of CreateUser and UpdateUser that doesn't touch the
+// table, so another store checks and fills in users the same way.
+
+// NewUserFromRequest decodes and checks the user of a POST and sets the server
+// controlled fields, the version, timestamps, audit fields and the tenant. Whatever the
+// client sent for those is dropped.
+func NewUserFromRequest(req events.APIGatewayProxyRequest) (*User, error) {
+
+	var u User
+	if err := Decode(req.Body, &u); err != nil {
+		return nil, err
+	}
+	tenant, err := TenantFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	// check users email is valid or not, and the rest of the data
+	if err := prepareNewUser(&u); err != nil {
+		return nil, err
+	}
+	// there's nothing to compare against yet
+	if len(u.IfMatch) > 0 {
+		return nil, fmt.Errorf("%s: a new user has no fields to match", ErrorInvalidCondition)
+	}
+
+	u.Version = 1
+	u.CreatedAt = now()
+	u.UpdatedAt = u.CreatedAt
+	u.CreatedBy = CallerIdentity(req)
+	u.UpdatedBy = u.CreatedBy
+	u.TenantID = tenant
+	u.SchemaVersion = CurrentSchemaVersion
+	u.EmailLower = emailLower(u.Email)
+	return &u, nil
+
+}
+
+// EmailFromRequest is the email a request addresses: the path (/users/{email}), or the
+// ?email= query string of older clients without one. It's what the caller is authorized
+// for, so it's also the user a write goes to.
+func EmailFromRequest(req events.APIGatewayProxyRequest) string {
+	if email := req.PathParameters["email"]; len(email) > 0 {
+		return email
+	}
+	return req.QueryStringParameters["email"]
+}
+
+// UpdateFromRequest decodes and checks the user of a PUT. When the request addresses a
+// user, see EmailFromRequest, that user gets updated and a different email in the body
+// is invalid. The password isn't hashed yet, a PUT for a missing user shouldn't pay for
+// that.
+func UpdateFromRequest(req events.APIGatewayProxyRequest) (*User, error) {
+
+	var u User
+	if err := Decode(req.Body, &u); err != nil {
+		return nil, err
+	}
+	tenant, err := TenantFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	u.TenantID = tenant
+	// only a new user is welcomed
+	u.SendWelcomeEmail = nil
+	if u.IfMatch, err = ConditionsFromRequest(req, u.IfMatch); err != nil {
+		return nil, err
+	}
+
+	u.Email = validators.NormalizeEmail(u.Email)
+	if email := validators.NormalizeEmail(EmailFromRequest(req)); len(email) > 0 {
+		if len(u.Email) > 0 && u.Email != email {
+			return nil, errors.New(ErrorInvalidUserData)
+		}
+		u.Email = email
+	}
+
+	if err := validateFields(&u); err != nil {
+		return nil, err
+	}
+	if err := normalizePhone(&u); err != nil {
+		return nil, err
+	}
+	if len(u.Status) > 0 && !validStatus(u.Status) {
+		return nil, errors.New(ErrorInvalidStatus)
+	}
+	if len(u.Role) > 0 && !validRole(u.Role) {
+		return nil, errors.New(ErrorInvalidRole)
+	}
+	return &u, nil
+
+}
+
+// ApplyUpdate writes what a PUT from UpdateFromRequest has onto the stored user, the
+// way UpdateUser does on the item: empty fields are kept, and the key, createdAt,
+// createdBy, the verification and the avatar are never changed.
+func ApplyUpdate(stored, update *User, by string) error {
+
+	if err := setPassword(update); err != nil {
+		return err
+	}
+	if len(update.FirstName) > 0 {
+		stored.FirstName = update.FirstName
+	}
+	if len(update.LastName) > 0 {
+		stored.LastName = update.LastName
+	}
+	if len(update.Phone) > 0 {
+		stored.Phone = update.Phone
+	}
+	if len(update.PasswordHash) > 0 {
+		stored.PasswordHash = update.PasswordHash
+	}
+	if len(update.Metadata) > 0 {
+		stored.Metadata = update.Metadata
+	}
+	if update.ExpiresAt != nil && !update.ExpiresAt.IsZero() {
+		stored.ExpiresAt = update.ExpiresAt
+	}
+	if len(update.Status) > 0 {
+		stored.Status = update.Status
+	}
+	if len(update.Role) > 0 {
+		stored.Role = update.Role
+	}
+
+	stored.Version++
+	stored.UpdatedAt = now()
+	stored.UpdatedBy = by
+	stored.SchemaVersion = CurrentSchemaVersion
+	stored.EmailLower = emailLower(stored.Email)
+	return nil
+
+}
+
+// PrepareUpsert turns the user of a PUT for a missing user into a new one. It has to
+// pass the same checks as on POST.
+func PrepareUpsert(u *User, by string) error {
+
+	if !validators.IsEmailValid(u.Email) {
+		return errors.New(ErrorInvalidEmail)
+	}
+	if err := checkEmailDomain(u.Email); err != nil {
+		return err
+	}
+
+	u.Version = 1
+	u.CreatedAt = now()
+	u.UpdatedAt = u.CreatedAt
+	u.CreatedBy = by
+	u.UpdatedBy = u.CreatedBy
+	u.SchemaVersion = CurrentSchemaVersion
+	u.EmailLower = emailLower(u.Email)
+	if len(u.Status) == 0 {
+		u.Status = StatusActive
+	}
+	if len(u.Role) == 0 {
+		u.Role = RoleUser
+	}
+	if err := newVerification(u); err != nil {
+		return err
+	}
+	return setPassword(u)
+
+}
+
+// Visible is false for users FetchUser treats as missing: expired ones and, with a
+// tenant, those of other tenants
+func (u *User) Visible(tenant string) bool {
+	return !u.expired() && u.inTenant(tenant)
+}
+
+// MatchesFilters is true when u matches every filter the way a filtered scan does,
+// users without a status count as active and without a role as users. Invalid filters are ErrorInvalidFilter.
+func MatchesFilters(u User, filters map[string]string) (bool, error) {
+
+	matches := true
+	for key, value := range filters {
+		field, operator, err := parseFilterKey(key)
+		if err != nil {
+			return false, err
+		}
+
+		var stored string
+		switch field {
+		case "firstName":
+			stored = u.FirstName
+		case "lastName":
+			stored = u.LastName
+		case "role":
+			if !validRole(value) {
+				return false, errors.New(ErrorInvalidRole)
+			}
+			stored = u.Role
+			if len(stored) == 0 {
+				stored = RoleUser
+			}
+		case "status":
+			if !validStatus(value) {
+				return false, errors.New(ErrorInvalidStatus)
+			}
+			stored = u.Status
+			if len(stored) == 0 {
+				stored = StatusActive
+			}
+		}
+
+		if operator == FilterBeginsWith {
+			matches = matches && strings.HasPrefix(stored, value)
+		} else {
+			matches = matches && stored == value
+		}
+	}
+	return matches, nil
+
+}
@@ -0,0 +1,168 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNewUserTimestamps(t *testing.T) {
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"set by the server", `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"}`},
+		{"sent by the client", `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe","createdAt":"2000-01-01T00:00:00.000Z","updatedAt":"2000-01-01T00:00:00.000Z","version":7}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now().Add(-time.Second)
+			u, err := NewUserFromRequest(events.APIGatewayProxyRequest{Body: tt.body})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			created, err := time.Parse(TimestampLayout, u.CreatedAt)
+			if err != nil {
+				t.Fatalf("createdAt %q: %v", u.CreatedAt, err)
+			}
+			if created.Before(before) || created.After(time.Now()) || created.Location() != time.UTC {
+				t.Errorf("createdAt = %s", u.CreatedAt)
+			}
+			if u.UpdatedAt != u.CreatedAt || u.Version != 1 {
+				t.Errorf("updatedAt = %s, version = %d", u.UpdatedAt, u.Version)
+			}
+		})
+	}
+
+}
+
+func TestApplyUpdateTimestamps(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		update User
+	}{
+		{"a field", User{FirstName: "Janet"}},
+		{"nothing", User{}},
+		{"createdAt", User{CreatedAt: "2000-01-01T00:00:00.000Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := &User{Email: "jane@example.com", Version: 3, CreatedAt: "2020-01-01T00:00:00.000Z", UpdatedAt: "2020-01-01T00:00:00.000Z"}
+			update := tt.update
+			if err := ApplyUpdate(stored, &update, "admin@example.com"); err != nil {
+				t.Fatal(err)
+			}
+
+			if stored.CreatedAt != "2020-01-01T00:00:00.000Z" {
+				t.Errorf("createdAt = %s", stored.CreatedAt)
+			}
+			if stored.UpdatedAt <= stored.CreatedAt || stored.UpdatedBy != "admin@example.com" || stored.Version != 4 {
+				t.Errorf("updatedAt = %s, updatedBy = %s, version = %d", stored.UpdatedAt, stored.UpdatedBy, stored.Version)
+			}
+		})
+	}
+
+}
+
+func TestTimestampsSort(t *testing.T) {
+
+	// the layout keeps its milliseconds, so strings sort like the times
+	tests := []struct {
+		earlier, later time.Time
+	}{
+		{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, int(500*time.Millisecond), time.UTC)},
+		{time.Date(2024, 1, 1, 0, 0, 9, int(990*time.Millisecond), time.UTC), time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)},
+		{time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		earlier, later := tt.earlier.Format(TimestampLayout), tt.later.Format(TimestampLayout)
+		if earlier >= later {
+			t.Errorf("%s sorts after %s", earlier, later)
+		}
+	}
+
+}
+
+func TestNewUserRole(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		role     string
+		wantRole string
+		wantErr  string
+	}{
+		{name: "default", wantRole: RoleUser},
+		{name: "user", role: "user", wantRole: RoleUser},
+		{name: "admin", role: "admin", wantRole: RoleAdmin},
+		{name: "unknown", role: "owner", wantErr: ErrorInvalidRole},
+		{name: "other case", role: "Admin", wantErr: ErrorInvalidRole},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe","role":"` + tt.role + `"}`
+			u, err := NewUserFromRequest(events.APIGatewayProxyRequest{Body: body})
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Role != tt.wantRole {
+				t.Errorf("role = %q, want %q", u.Role, tt.wantRole)
+			}
+		})
+	}
+
+}
+
+func TestUpdateFromRequestEmail(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		path      string
+		query     string
+		body      string
+		wantEmail string
+		wantErr   bool
+	}{
+		{name: "path", path: "jane@example.com", body: `{"firstName":"Jane","lastName":"Doe"}`, wantEmail: "jane@example.com"},
+		{name: "query", query: "jane@example.com", body: `{"firstName":"Jane","lastName":"Doe"}`, wantEmail: "jane@example.com"},
+		{name: "body", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"}`, wantEmail: "jane@example.com"},
+		{name: "domain in other case", query: "jane@Example.COM", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Doe"}`, wantEmail: "jane@example.com"},
+		{name: "other than the path", path: "jane@example.com", body: `{"email":"victim@example.com","firstName":"Jane","lastName":"Doe"}`, wantErr: true},
+		{name: "other than the query", query: "jane@example.com", body: `{"email":"victim@example.com","firstName":"Jane","lastName":"Doe"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{Body: tt.body}
+			if len(tt.path) > 0 {
+				req.PathParameters = map[string]string{"email": tt.path}
+			}
+			if len(tt.query) > 0 {
+				req.QueryStringParameters = map[string]string{"email": tt.query}
+			}
+
+			u, err := UpdateFromRequest(req)
+			if tt.wantErr {
+				if err == nil || err.Error() != ErrorInvalidUserData {
+					t.Fatalf("err = %v, want %s", err, ErrorInvalidUserData)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Email != tt.wantEmail {
+				t.Errorf("email = %q, want %q", u.Email, tt.wantEmail)
+			}
+		})
+	}
+
+}
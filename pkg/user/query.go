@@ -0,0 +1,120 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+var ErrorIndexNotFound = "index not found"
+
+// LastNameIndex is the GSI with lastName as partition key
+const LastNameIndex = "lastName-index"
+
+// QueryUsersByLastName queries the lastName GSI and follows all pages, filters narrow
+// the result down further. Tables created before the index existed answer with
+// ErrorIndexNotFound, callers can then fall back to ScanUsersByLastName.
+func QueryUsersByLastName(ctx context.Context, lastName string, filters map[string]string, tenant, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*[]User, error) {
+
+	input := dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		IndexName:                 aws.String(LastNameIndex),
+		KeyConditionExpression:    aws.String("#lastName = :lastName"),
+		ExpressionAttributeNames:  map[string]string{"#lastName": "lastName"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":lastName": &types.AttributeValueMemberS{Value: lastName}},
+	}
+	if len(filters) > 0 {
+		expression, err := filterExpression(filters, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		input.FilterExpression = expression
+	}
+	input.FilterExpression = tenantCondition(input.FilterExpression, tenant, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if len(attributes) > 0 {
+		input.ProjectionExpression, input.ExpressionAttributeNames = projection(attributes, input.ExpressionAttributeNames)
+	}
+
+	users := []User{}
+	for {
+		result, err := dynaClient.Query(ctx, &input)
+		if err != nil {
+			if isMissingIndex(err) {
+				return nil, errors.New(ErrorIndexNotFound)
+			}
+			return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+
+		var page []User
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+		}
+		upgradeUsers(page)
+		users = append(users, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return &users, nil
+
+}
+
+// ScanUsersByLastName is the slow path of QueryUsersByLastName for tables without the index
+func ScanUsersByLastName(ctx context.Context, lastName string, filters map[string]string, tenant, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*[]User, error) {
+
+	all := map[string]string{"lastName": lastName}
+	for field, value := range filters {
+		all[field] = value
+	}
+
+	input := dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	}
+	if err := applyFilters(&input, all); err != nil {
+		return nil, err
+	}
+	if len(attributes) > 0 {
+		input.ProjectionExpression, input.ExpressionAttributeNames = projection(attributes, input.ExpressionAttributeNames)
+	}
+
+	users := []User{}
+	for {
+		result, err := scan(ctx, &input, tenant, dynaClient)
+		if err != nil {
+			return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+
+		var page []User
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+		}
+		upgradeUsers(page)
+		users = append(users, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return &users, nil
+
+}
+
+// DynamoDB answers a query on an unknown index with a ValidationException like
+// "The table does not have the specified index: lastName-index"
+func isMissingIndex(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) &&
+		apiErr.ErrorCode() == "ValidationException" &&
+		strings.Contains(apiErr.ErrorMessage(), "specified index")
+}
@@ -0,0 +1,254 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go"
+)
+
+// DYNAMO_RETRY_ATTEMPTS is how often a call is tried at most, the waits in between grow
+// from DYNAMO_RETRY_BASE_MS up to DYNAMO_RETRY_MAX_MS. No retry starts once the call has
+// taken DYNAMO_RETRY_DEADLINE_MS, API Gateway gives up after 29 seconds anyway.
+var (
+	retryAttempts = envInt("DYNAMO_RETRY_ATTEMPTS", 5)
+	retryBase     = time.Duration(envInt("DYNAMO_RETRY_BASE_MS", 25)) * time.Millisecond
+	retryMaxWait  = time.Duration(envInt("DYNAMO_RETRY_MAX_MS", 1000)) * time.Millisecond
+	retryDeadline = time.Duration(envInt("DYNAMO_RETRY_DEADLINE_MS", 5000)) * time.Millisecond
+)
+
+// DYNAMO_CALL_TIMEOUT_MS bounds every single call, well below the Lambda timeout so a
+// stuck call is retried or answered with a 504 while there's still time. 0 leaves only
+// the deadline of the invocation.
+var callTimeout = time.Duration(envInt("DYNAMO_CALL_TIMEOUT_MS", 2000)) * time.Millisecond
+
+type timeoutsKey struct{}
+
+// TrackTimeouts returns a context in which TimedOut tells whether a DynamoDB call ran out
+// of time. The errors of this package don't carry that, they're the same whatever failed.
+func TrackTimeouts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, timeoutsKey{}, new(int32))
+}
+
+// TimedOut is true once ctx is done or a call made with it hit callTimeout
+func TimedOut(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	flag, ok := ctx.Value(timeoutsKey{}).(*int32)
+	return ok && atomic.LoadInt32(flag) == 1
+}
+
+func markTimedOut(ctx context.Context) {
+	if flag, ok := ctx.Value(timeoutsKey{}).(*int32); ok {
+		atomic.StoreInt32(flag, 1)
+	}
+}
+
+// error codes worth another try, anything with a 5xx status is too
+var retryableCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"RequestLimitExceeded":                   true,
+	"InternalServerError":                    true,
+	"ThrottlingException":                    true,
+	"ServiceUnavailable":                     true,
+}
+
+var retries int64
+
+// Retries is how many DynamoDB calls this instance has retried
+func Retries() int64 {
+	return atomic.LoadInt64(&retries)
+}
+
+var (
+	jitterMu sync.Mutex
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// WithRetry wraps a client so the calls this package makes are retried with exponential
+// backoff and full jitter when DynamoDB throttles or fails. Turn the SDK's own retries
+// off on the wrapped client, otherwise both retry, see DynamoOptions.
+func WithRetry(dynaClient DynamoDBAPI) DynamoDBAPI {
+	return retryingClient{dynaClient}
+}
+
+type retryingClient struct {
+	DynamoDBAPI
+}
+
+func retryable(err error) bool {
+	// a single call that ran out of callTimeout may well be quick the next time
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var failure *awshttp.ResponseError
+	if errors.As(err, &failure) && failure.HTTPStatusCode() >= 500 {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && retryableCodes[apiErr.ErrorCode()]
+}
+
+// retryableWrite is retryable for a conditional write, a timeout aside: the write may
+// have gone through, and its retry would then fail its own condition and report a
+// conflict that isn't there
+func retryableWrite(err error) bool {
+	return !errors.Is(err, context.DeadlineExceeded) && retryable(err)
+}
+
+// the errors a write with condition is retried on
+func writeRetry(condition *string) func(error) bool {
+	if condition != nil {
+		return retryableWrite
+	}
+	return retryable
+}
+
+// backoff is a random wait of up to retryBase doubled for every attempt so far
+func backoff(attempt int) time.Duration {
+	wait := retryBase << uint(attempt-1)
+	if wait <= 0 || wait > retryMaxWait {
+		wait = retryMaxWait
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitter.Int63n(int64(wait) + 1))
+}
+
+// withRetry calls fn until it succeeds, fails with an error retry says isn't worth
+// another try, or runs out of attempts or time. Every attempt gets at most callTimeout,
+// and no retry starts that would end after the deadline of ctx. The last error is
+// returned as it is.
+func withRetry(ctx context.Context, operation string, retry func(error) bool, fn func(ctx context.Context) error) error {
+
+	deadline := time.Now().Add(retryDeadline)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := attemptCall(ctx, fn)
+		if err == nil || ctx.Err() != nil || !retry(err) || attempt >= retryAttempts {
+			return err
+		}
+		wait := backoff(attempt)
+		if time.Now().Add(wait).After(deadline) {
+			return err
+		}
+
+		atomic.AddInt64(&retries, 1)
+		logging.FromContext(ctx).WarnContext(ctx, "dynamodb call failed, retrying", "operation", operation, "attempt", attempt, "attempts", retryAttempts, "wait", wait.String(), logging.Err(err))
+		if !sleep(ctx, wait) {
+			return err
+		}
+	}
+
+}
+
+// attemptCall runs one try of fn, a try that runs out of time is marked on ctx
+func attemptCall(ctx context.Context, fn func(ctx context.Context) error) error {
+
+	if callTimeout <= 0 {
+		return fn(ctx)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	err := fn(callCtx)
+	if err != nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		markTimedOut(ctx)
+	}
+	return err
+
+}
+
+func (c retryingClient) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.GetItemOutput, err error) {
+	err = withRetry(ctx, "GetItem", retryable, func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.GetItem(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c retryingClient) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.PutItemOutput, err error) {
+	err = withRetry(ctx, "PutItem", writeRetry(input.ConditionExpression), func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.PutItem(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c retryingClient) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.UpdateItemOutput, err error) {
+	err = withRetry(ctx, "UpdateItem", writeRetry(input.ConditionExpression), func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.UpdateItem(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c retryingClient) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.DeleteItemOutput, err error) {
+	err = withRetry(ctx, "DeleteItem", writeRetry(input.ConditionExpression), func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.DeleteItem(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c retryingClient) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.QueryOutput, err error) {
+	err = withRetry(ctx, "Query", retryable, func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.Query(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c retryingClient) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.ScanOutput, err error) {
+	err = withRetry(ctx, "Scan", retryable, func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.Scan(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c retryingClient) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.BatchGetItemOutput, err error) {
+	err = withRetry(ctx, "BatchGetItem", retryable, func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.BatchGetItem(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c retryingClient) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.BatchWriteItemOutput, err error) {
+	err = withRetry(ctx, "BatchWriteItem", retryable, func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.BatchWriteItem(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
+
+// a canceled transaction isn't retried, even when one of the reasons is throttling,
+// its conditions have to be evaluated by the caller. Neither is one that timed out,
+// like any conditional write.
+func (c retryingClient) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.TransactWriteItemsOutput, err error) {
+	err = withRetry(ctx, "TransactWriteItems", retryableWrite, func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.TransactWriteItems(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c retryingClient) ExecuteStatement(ctx context.Context, input *dynamodb.ExecuteStatementInput, optFns ...func(*dynamodb.Options)) (output *dynamodb.ExecuteStatementOutput, err error) {
+	err = withRetry(ctx, "ExecuteStatement", retryable, func(ctx context.Context) error {
+		output, err = c.DynamoDBAPI.ExecuteStatement(ctx, input, optFns...)
+		return err
+	})
+	return output, err
+}
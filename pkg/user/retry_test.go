@@ -0,0 +1,133 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func responseError(status int) error {
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+		Err:      errors.New("failed"),
+	}}
+}
+
+func TestRetryable(t *testing.T) {
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"throughput exceeded", errThrottled, true},
+		{"throttling", &smithy.GenericAPIError{Code: "ThrottlingException"}, true},
+		{"request limit", &types.RequestLimitExceeded{}, true},
+		{"internal error", &types.InternalServerError{}, true},
+		{"5xx", responseError(http.StatusBadGateway), true},
+		{"call timeout", &smithy.CanceledError{Err: context.DeadlineExceeded}, true},
+		{"conditional check", &types.ConditionalCheckFailedException{}, false},
+		{"validation", &smithy.GenericAPIError{Code: "ValidationException"}, false},
+		{"4xx", responseError(http.StatusBadRequest), false},
+		{"canceled", &smithy.CanceledError{Err: context.Canceled}, false},
+		{"other", errors.New("failed"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestWithRetry(t *testing.T) {
+
+	defer func(base, timeout time.Duration) { retryBase, callTimeout = base, timeout }(retryBase, callTimeout)
+	retryBase, callTimeout = time.Millisecond, 20*time.Millisecond
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      bool
+		wantTimedOut bool
+	}{
+		{name: "succeeds", errs: []error{nil}, wantAttempts: 1},
+		{name: "throttled then succeeds", errs: []error{errThrottled, errThrottled, nil}, wantAttempts: 3},
+		{name: "throttled throughout", errs: []error{errThrottled, errThrottled, errThrottled, errThrottled, errThrottled, errThrottled}, wantAttempts: retryAttempts, wantErr: true},
+		{name: "not retryable", errs: []error{&types.ConditionalCheckFailedException{}, nil}, wantAttempts: 1, wantErr: true},
+		// nil here means the attempt hangs until callTimeout
+		{name: "timed out then succeeds", errs: []error{context.DeadlineExceeded, nil}, wantAttempts: 2, wantTimedOut: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := TrackTimeouts(context.Background())
+			attempts := 0
+			err := withRetry(ctx, "GetItem", retryable, func(ctx context.Context) error {
+				err := tt.errs[attempts]
+				attempts++
+				if errors.Is(err, context.DeadlineExceeded) {
+					<-ctx.Done()
+					return &smithy.CanceledError{Err: ctx.Err()}
+				}
+				return err
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v", err)
+			}
+			if TimedOut(ctx) != tt.wantTimedOut {
+				t.Errorf("TimedOut = %t", TimedOut(ctx))
+			}
+		})
+	}
+
+}
+
+func TestConditionalWriteTimeout(t *testing.T) {
+
+	defer func(base, timeout time.Duration) { retryBase, callTimeout = base, timeout }(retryBase, callTimeout)
+	retryBase, callTimeout = time.Millisecond, 20*time.Millisecond
+
+	tests := []struct {
+		name         string
+		condition    *string
+		err          error
+		wantAttempts int
+	}{
+		{name: "unconditional write timed out", err: context.DeadlineExceeded, wantAttempts: 2},
+		{name: "conditional write timed out", condition: aws.String("attribute_not_exists(#email)"), err: context.DeadlineExceeded, wantAttempts: 1},
+		{name: "conditional write throttled", condition: aws.String("attribute_not_exists(#email)"), err: errThrottled, wantAttempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			client := WithRetry(&fakeDynamo{putItem: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				attempts++
+				if attempts > 1 {
+					return &dynamodb.PutItemOutput{}, nil
+				}
+				return nil, &smithy.OperationError{ServiceID: "DynamoDB", OperationName: "PutItem", Err: tt.err}
+			}})
+
+			client.PutItem(context.Background(), &dynamodb.PutItemInput{TableName: aws.String("users"), ConditionExpression: tt.condition})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+
+}
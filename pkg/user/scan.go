@@ -0,0 +1,51 @@
+package user
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// ScanAll walks every page of the table and calls fn for each user matching the
+// filters, and the tenant when there is one. An error returned by fn stops the scan and
+// is passed back unchanged. With SCAN_SEGMENTS set the scan runs in parallel, see
+// ScanAllParallel.
+func ScanAll(ctx context.Context, filters map[string]string, tenant, tableName string, dynaClient DynamoDBAPI, fn func(User) error) error {
+	return ScanAllParallel(ctx, filters, tenant, tableName, scanSegments, dynaClient, fn)
+}
+
+func scanAll(ctx context.Context, filters map[string]string, tenant, tableName string, dynaClient DynamoDBAPI, fn func(User) error) error {
+
+	input := dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	}
+	if err := applyFilters(&input, filters); err != nil {
+		return err
+	}
+
+	for {
+		result, err := scan(ctx, &input, tenant, dynaClient)
+		if err != nil {
+			return flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+
+		var page []User
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+		}
+		upgradeUsers(page)
+		for _, u := range page {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+}
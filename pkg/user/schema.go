@@ -0,0 +1,110 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CurrentSchemaVersion is the layout of the items this code writes. Items written before
+// schemaVersion existed are version 0.
+const CurrentSchemaVersion = 3
+
+// UPGRADE_ON_READ=true writes users read in an older schema back in the current one, so
+// the table converges without a migration run
+var upgradeOnRead = os.Getenv("UPGRADE_ON_READ") == "true"
+
+// migrations[n] upgrades a user of schema version n to n+1. Add a function here and bump
+// CurrentSchemaVersion whenever a new field needs a default for old items.
+var migrations = []func(u *User){
+	// 0 → 1: users from before statuses and optimistic locking
+	func(u *User) {
+		if len(u.Status) == 0 {
+			u.Status = StatusActive
+		}
+		if u.Version == 0 {
+			u.Version = 1
+		}
+	},
+	// 1 → 2: users from before roles
+	func(u *User) {
+		if len(u.Role) == 0 {
+			u.Role = RoleUser
+		}
+	},
+	// 2 → 3: users from before EmailLowerIndex
+	func(u *User) {
+		u.EmailLower = emailLower(u.Email)
+	},
+}
+
+// upgrade brings u to CurrentSchemaVersion and reports whether it was older
+func upgrade(u *User) bool {
+
+	if u.SchemaVersion >= CurrentSchemaVersion {
+		return false
+	}
+	for v := u.SchemaVersion; v < CurrentSchemaVersion; v++ {
+		migrations[v](u)
+	}
+	u.SchemaVersion = CurrentSchemaVersion
+	return true
+
+}
+
+// upgradeUsers upgrades every user in place and returns the ones that were older
+func upgradeUsers(users []User) []*User {
+	var legacy []*User
+	for i := range users {
+		if upgrade(&users[i]) {
+			legacy = append(legacy, &users[i])
+		}
+	}
+	return legacy
+}
+
+// writeBack stores upgraded users when UPGRADE_ON_READ is on. Only complete users may be
+// written, never ones read with a projection. A user written in between is left alone,
+// failures are logged and the read still succeeds.
+func writeBack(ctx context.Context, users []*User, tableName string, dynaClient DynamoDBAPI) {
+
+	if !upgradeOnRead {
+		return
+	}
+
+	for _, u := range users {
+		item, err := attributevalue.MarshalMap(u)
+		if err != nil {
+			logging.FromContext(ctx).WarnContext(ctx, "upgrading user failed", "email", u.Email, logging.Err(err))
+			continue
+		}
+
+		// legacy users are read as version 1 without having a version attribute
+		_, err = dynaClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(tableName),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_exists(#email) AND (attribute_not_exists(#schemaVersion) OR #schemaVersion < :schemaVersion) AND (attribute_not_exists(#version) OR #version = :version)"),
+			ExpressionAttributeNames: map[string]string{
+				"#email":         KeyAttribute,
+				"#schemaVersion": "schemaVersion",
+				"#version":       "version",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":schemaVersion": &types.AttributeValueMemberN{Value: strconv.Itoa(CurrentSchemaVersion)},
+				":version":       &types.AttributeValueMemberN{Value: strconv.FormatInt(u.Version, 10)},
+			},
+		})
+		var failed *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &failed) {
+			logging.FromContext(ctx).WarnContext(ctx, "upgrading user failed", "email", u.Email, logging.Err(err))
+		}
+	}
+
+}
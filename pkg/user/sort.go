@@ -0,0 +1,56 @@
+package user
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	ErrorInvalidSortField = "invalid sort field"
+	ErrorInvalidSortOrder = "invalid sort order"
+)
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// sortFields maps the ?sort= values to the comparison of that attribute
+var sortFields = map[string]func(a, b *User) bool{
+	"email":     func(a, b *User) bool { return a.Email < b.Email },
+	"firstName": func(a, b *User) bool { return a.FirstName < b.FirstName },
+	"lastName":  func(a, b *User) bool { return a.LastName < b.LastName },
+	"createdAt": func(a, b *User) bool { return a.CreatedAt < b.CreatedAt },
+	"updatedAt": func(a, b *User) bool { return a.UpdatedAt < b.UpdatedAt },
+}
+
+// ValidateSort checks the sort field and order without sorting anything, so requests
+// can be rejected before hitting DynamoDB
+func ValidateSort(field, order string) error {
+	if _, ok := sortFields[field]; !ok {
+		return errors.New(ErrorInvalidSortField)
+	}
+	if order != "" && order != SortAsc && order != SortDesc {
+		return errors.New(ErrorInvalidSortOrder)
+	}
+	return nil
+}
+
+// SortUsers sorts in memory since a Scan comes back in no particular order. Users with
+// equal values keep their relative order. When used with pagination only the returned
+// page is sorted, not the whole table.
+func SortUsers(users []User, field, order string) error {
+
+	if err := ValidateSort(field, order); err != nil {
+		return err
+	}
+
+	less := sortFields[field]
+	if order == SortDesc {
+		sort.SliceStable(users, func(i, j int) bool { return less(&users[j], &users[i]) })
+	} else {
+		sort.SliceStable(users, func(i, j int) bool { return less(&users[i], &users[j]) })
+	}
+	return nil
+
+}
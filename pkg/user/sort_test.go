@@ -0,0 +1,55 @@
+package user
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortUsers(t *testing.T) {
+
+	users := func() []User {
+		return []User{
+			{Email: "c@example.com", LastName: "Doe", CreatedAt: "2024-01-02T00:00:00Z"},
+			{Email: "a@example.com", LastName: "Roe", CreatedAt: "2024-01-03T00:00:00Z"},
+			{Email: "b@example.com", LastName: "Doe", CreatedAt: "2024-01-01T00:00:00Z"},
+		}
+	}
+	tests := []struct {
+		name    string
+		field   string
+		order   string
+		want    []string
+		wantErr string
+	}{
+		{name: "email", field: "email", want: []string{"a@example.com", "b@example.com", "c@example.com"}},
+		{name: "email desc", field: "email", order: SortDesc, want: []string{"c@example.com", "b@example.com", "a@example.com"}},
+		{name: "createdAt asc", field: "createdAt", order: SortAsc, want: []string{"b@example.com", "c@example.com", "a@example.com"}},
+		{name: "stable on equal values", field: "lastName", want: []string{"c@example.com", "b@example.com", "a@example.com"}},
+		{name: "stable on equal values desc", field: "lastName", order: SortDesc, want: []string{"a@example.com", "c@example.com", "b@example.com"}},
+		{name: "unknown field", field: "password", wantErr: ErrorInvalidSortField},
+		{name: "unknown order", field: "email", order: "up", wantErr: ErrorInvalidSortOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := users()
+			err := SortUsers(list, tt.field, tt.order)
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, u := range list {
+				got = append(got, u.Email)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,66 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SetStatus activates or suspends a user. Only the status, version and updatedAt are
+// written along with by as updatedBy, suspended users are kept and still returned by
+// FetchUser.
+func SetStatus(ctx context.Context, email, status, tenant, by, tableName string, dynaClient DynamoDBAPI) (*User, error) {
+
+	email = validators.NormalizeEmail(email)
+	if !validStatus(status) {
+		return nil, errors.New(ErrorInvalidStatus)
+	}
+
+	input := dynamodb.UpdateItemInput{
+		Key:                 userKey(email),
+		TableName:           aws.String(tableName),
+		UpdateExpression:    aws.String("SET #status = :status, #updatedAt = :updatedAt, #updatedBy = :updatedBy, #emailLower = :emailLower, #version = if_not_exists(#version, :zero) + :one"),
+		ConditionExpression: aws.String("attribute_exists(#email)"),
+		ExpressionAttributeNames: map[string]string{
+			"#email":      "email",
+			"#status":     "status",
+			"#updatedAt":  "updatedAt",
+			"#updatedBy":  "updatedBy",
+			"#emailLower": "emailLower",
+			"#version":    "version",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status":     &types.AttributeValueMemberS{Value: status},
+			":updatedAt":  &types.AttributeValueMemberS{Value: now()},
+			":updatedBy":  &types.AttributeValueMemberS{Value: by},
+			":emailLower": &types.AttributeValueMemberS{Value: emailLower(email)},
+			":zero":       &types.AttributeValueMemberN{Value: "0"},
+			":one":        &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	}
+	input.ConditionExpression = tenantCondition(input.ConditionExpression, tenant, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+
+	defer forgetUsers(email)
+	result, err := dynaClient.UpdateItem(ctx, &input)
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, errors.New(ErrorUserDoesNotExists)
+		}
+		return nil, flatten(ctx, ErrorDynamoUpdateItem, err)
+	}
+
+	item := new(User)
+	if err := attributevalue.UnmarshalMap(result.Attributes, item); err != nil {
+		return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	upgrade(item)
+	return item, nil
+
+}
@@ -0,0 +1,74 @@
+package user
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// StreamItem turns an image of a stream record into an item of the SDK, the Lambda
+// events have their own attribute values
+func StreamItem(image map[string]events.DynamoDBAttributeValue) map[string]types.AttributeValue {
+	item := make(map[string]types.AttributeValue, len(image))
+	for name, value := range image {
+		item[name] = streamValue(value)
+	}
+	return item
+}
+
+func streamValue(value events.DynamoDBAttributeValue) types.AttributeValue {
+
+	switch value.DataType() {
+	case events.DataTypeString:
+		return &types.AttributeValueMemberS{Value: value.String()}
+	case events.DataTypeNumber:
+		return &types.AttributeValueMemberN{Value: value.Number()}
+	case events.DataTypeBoolean:
+		return &types.AttributeValueMemberBOOL{Value: value.Boolean()}
+	case events.DataTypeBinary:
+		return &types.AttributeValueMemberB{Value: value.Binary()}
+	case events.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: value.StringSet()}
+	case events.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: value.NumberSet()}
+	case events.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: value.BinarySet()}
+	case events.DataTypeList:
+		list := []types.AttributeValue{}
+		for _, v := range value.List() {
+			list = append(list, streamValue(v))
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	case events.DataTypeMap:
+		return &types.AttributeValueMemberM{Value: StreamItem(value.Map())}
+	}
+	return &types.AttributeValueMemberNULL{Value: true}
+
+}
+
+// UserFromStreamImage is the user of an image of a stream record, upgraded like a user
+// read from the table. Images of other items, like notes, are nil.
+func UserFromStreamImage(image map[string]events.DynamoDBAttributeValue) (*User, error) {
+
+	if len(image) == 0 {
+		return nil, nil
+	}
+	item := StreamItem(image)
+	if _, ok := item[ItemTypeAttribute]; ok {
+		return nil, nil
+	}
+	if key, ok := item[KeyAttribute].(*types.AttributeValueMemberS); !ok || strings.HasPrefix(key.Value, notePrefix) {
+		return nil, nil
+	}
+
+	u := new(User)
+	if err := attributevalue.UnmarshalMap(item, u); err != nil {
+		return nil, errors.New(ErrorFailedToUnmarshalRecord)
+	}
+	upgrade(u)
+	return u, nil
+
+}
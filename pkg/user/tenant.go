@@ -0,0 +1,187 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrorTenantRequired = "tenant could not be resolved"
+
+// MULTI_TENANT=true scopes every user to the tenant of the caller. TENANT_HEADER=true
+// also takes the tenant from an X-Tenant-Id header, for development without an
+// authorizer. Never enable it in front of real clients, anyone can send the header.
+var (
+	multiTenant  = os.Getenv("MULTI_TENANT") == "true"
+	tenantHeader = os.Getenv("TENANT_HEADER") == "true"
+)
+
+// TenantAttribute holds the tenant of a user, TenantIndex is the GSI with it as
+// partition key that users of one tenant are queried with
+const (
+	TenantAttribute = "tenantId"
+	TenantIndex     = "tenantId-index"
+)
+
+// claims a tenant can come in, Cognito only allows custom attributes with a prefix
+var tenantClaims = []string{"custom:tenantId", "tenantId", "tenant_id"}
+
+// TenantFromRequest returns the tenant the request is for, "" while multi-tenancy is
+// off. With it on a request without a tenant is ErrorTenantRequired.
+func TenantFromRequest(req events.APIGatewayProxyRequest) (string, error) {
+
+	if !multiTenant {
+		return "", nil
+	}
+
+	claims := req.RequestContext.Authorizer
+	if nested, ok := claims["claims"].(map[string]interface{}); ok {
+		claims = nested
+	}
+	for _, key := range tenantClaims {
+		if tenant, ok := claims[key].(string); ok && len(tenant) > 0 {
+			return tenant, nil
+		}
+	}
+
+	if tenantHeader {
+		for k, v := range req.Headers {
+			if strings.EqualFold(k, "X-Tenant-Id") && len(strings.TrimSpace(v)) > 0 {
+				return strings.TrimSpace(v), nil
+			}
+		}
+	}
+	return "", errors.New(ErrorTenantRequired)
+
+}
+
+// inTenant is true when u belongs to tenant, every user does with no tenant. Users of
+// other tenants are treated as not existing, so nobody learns they do.
+func (u *User) inTenant(tenant string) bool {
+	return len(tenant) == 0 || u.TenantID == tenant
+}
+
+// tenantCondition adds the condition that the stored item belongs to tenant to an
+// existing condition, which may be nil
+func tenantCondition(condition *string, tenant string, names map[string]string, values map[string]types.AttributeValue) *string {
+
+	if len(tenant) == 0 {
+		return condition
+	}
+
+	names["#tenantId"] = TenantAttribute
+	values[":tenantId"] = &types.AttributeValueMemberS{Value: tenant}
+	if condition == nil {
+		return aws.String("#tenantId = :tenantId")
+	}
+	return aws.String("(" + *condition + ") AND #tenantId = :tenantId")
+
+}
+
+// scan runs the scan input, or with a tenant the same request as a query of the
+// tenant's partition of TenantIndex, so one tenant never reads through the others
+func scan(ctx context.Context, input *dynamodb.ScanInput, tenant string, dynaClient DynamoDBAPI) (*dynamodb.ScanOutput, error) {
+
+	if len(tenant) == 0 {
+		return dynaClient.Scan(ctx, input)
+	}
+
+	names := map[string]string{"#tenantId": TenantAttribute}
+	for k, v := range input.ExpressionAttributeNames {
+		names[k] = v
+	}
+	values := map[string]types.AttributeValue{":tenantId": &types.AttributeValueMemberS{Value: tenant}}
+	for k, v := range input.ExpressionAttributeValues {
+		values[k] = v
+	}
+
+	result, err := dynaClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 input.TableName,
+		IndexName:                 aws.String(TenantIndex),
+		KeyConditionExpression:    aws.String("#tenantId = :tenantId"),
+		FilterExpression:          input.FilterExpression,
+		ProjectionExpression:      input.ProjectionExpression,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		Select:                    input.Select,
+		Limit:                     input.Limit,
+		ExclusiveStartKey:         input.ExclusiveStartKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.ScanOutput{
+		Items:            result.Items,
+		Count:            result.Count,
+		ScannedCount:     result.ScannedCount,
+		LastEvaluatedKey: result.LastEvaluatedKey,
+	}, nil
+
+}
+
+type TenantAssignment struct {
+	Assigned []string `json:"assigned"`
+	Failed   []string `json:"failed,omitempty"`
+}
+
+// AssignTenant puts every item stored without a tenant, users and their notes, into
+// tenant. It's how a single-tenant table is migrated: run it with the tenant of the
+// existing users, create TenantIndex, then turn on MULTI_TENANT. Items written
+// meanwhile with a tenant are left alone. With dryRun nothing is written.
+func AssignTenant(ctx context.Context, tenant string, dryRun bool, tableName string, dynaClient DynamoDBAPI) (*TenantAssignment, error) {
+
+	if len(tenant) == 0 {
+		return nil, errors.New(ErrorTenantRequired)
+	}
+
+	assignment := &TenantAssignment{Assigned: []string{}}
+	input := dynamodb.ScanInput{
+		TableName:                aws.String(tableName),
+		ProjectionExpression:     aws.String("#email"),
+		FilterExpression:         aws.String("attribute_not_exists(#tenantId)"),
+		ExpressionAttributeNames: map[string]string{"#email": KeyAttribute, "#tenantId": TenantAttribute},
+	}
+	for {
+		result, err := dynaClient.Scan(ctx, &input)
+		if err != nil {
+			return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+
+		for _, item := range result.Items {
+			key, ok := item[KeyAttribute].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			if dryRun {
+				assignment.Assigned = append(assignment.Assigned, key.Value)
+				continue
+			}
+
+			_, err := dynaClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:                 aws.String(tableName),
+				Key:                       itemKey(key.Value),
+				UpdateExpression:          aws.String("SET #tenantId = :tenantId"),
+				ConditionExpression:       aws.String("attribute_exists(#email) AND attribute_not_exists(#tenantId)"),
+				ExpressionAttributeNames:  map[string]string{"#email": KeyAttribute, "#tenantId": TenantAttribute},
+				ExpressionAttributeValues: map[string]types.AttributeValue{":tenantId": &types.AttributeValueMemberS{Value: tenant}},
+			})
+			if err != nil {
+				assignment.Failed = append(assignment.Failed, key.Value)
+				continue
+			}
+			assignment.Assigned = append(assignment.Assigned, key.Value)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return assignment, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+}
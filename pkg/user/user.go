@@ -1,15 +1,22 @@
 package user
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Rahul-71/go-serverless/pkg/logging"
 	"github.com/Rahul-71/go-serverless/pkg/validators"
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 var (
@@ -17,156 +24,767 @@ var (
 	ErrorFailedToUnmarshalRecord = "failed to unmarshal record"
 	ErrorInvalidUserData         = "invalid user data"
 	ErrorInvalidEmail            = "invalid email"
+	ErrorEmailDomainBlocked      = "email domain is not allowed"
+	ErrorInvalidPhone            = "invalid phone number"
+	ErrorInvalidStatus           = "invalid status, must be active or suspended"
+	ErrorInvalidRole             = "invalid role, must be user or admin"
 	ErrorMarshalItem             = "could not marshal item"
 	ErrorDeleteItem              = "could not delete item"
 	ErrorDynamoPutItem           = "could not dynamo put item"
 	ErrorUserAlreadyExists       = "user already exists"
 	ErrorUserDoesNotExists       = "user does not exists"
+	ErrorNothingToUpdate         = "no fields to update"
+	ErrorDynamoUpdateItem        = "could not dynamo update item"
+	ErrorVersionMismatch         = "version does not match"
+	ErrorVersionConflict         = "user was modified concurrently"
 )
 
+// User is a user as the API returns it and as it's stored, with the attribute names of
+// its dynamodbav tags. Empty names are stored as NULL, the way they always were.
 type User struct {
-	Email     string `json:"email"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
+	Email     string `json:"email" dynamodbav:"email"`
+	FirstName string `json:"firstName" dynamodbav:"firstName,nullempty"`
+	LastName  string `json:"lastName" dynamodbav:"lastName,nullempty"`
+	Phone     string `json:"phone,omitempty" dynamodbav:"phone,omitempty"`
+	Status    string `json:"status,omitempty" dynamodbav:"status,omitempty"`
+	Role      string `json:"role,omitempty" dynamodbav:"role,omitempty"`
+	// Metadata holds whatever key/value pairs clients want to keep on the user
+	Metadata map[string]string `json:"metadata,omitempty" dynamodbav:"metadata,omitempty"`
+	// ExpiresAt makes a temporary user, DynamoDB TTL deletes it after that time
+	ExpiresAt *Expiry `json:"expiresAt,omitempty" dynamodbav:"ttl,omitempty"`
+	// Password is only ever read from requests, what's stored is its bcrypt hash
+	Password     string `json:"password,omitempty" dynamodbav:"-"`
+	PasswordHash string `json:"-" dynamodbav:"passwordHash,omitempty"`
+	// Verified turns true once the user followed the link with VerificationToken, which
+	// only exists in memory right after the user was created
+	Verified              bool   `json:"verified" dynamodbav:"verified"`
+	VerificationToken     string `json:"-" dynamodbav:"-"`
+	VerificationTokenHash string `json:"-" dynamodbav:"verificationTokenHash,omitempty"`
+	VerificationExpiresAt string `json:"-" dynamodbav:"verificationExpiresAt,omitempty"`
+	AvatarKey             string `json:"-" dynamodbav:"avatarKey,omitempty"`
+	AvatarURL             string `json:"avatarUrl,omitempty" dynamodbav:"-"`
+	Version               int64  `json:"version" dynamodbav:"version"`
+	CreatedAt             string `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt             string `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+	// who made the first and the last write, see CallerIdentity
+	CreatedBy string `json:"createdBy,omitempty" dynamodbav:"createdBy,omitempty"`
+	UpdatedBy string `json:"updatedBy,omitempty" dynamodbav:"updatedBy,omitempty"`
+	// TenantID is set from the caller with MULTI_TENANT on, see TenantFromRequest
+	TenantID string `json:"tenantId,omitempty" dynamodbav:"tenantId,omitempty"`
+	// SchemaVersion is the item layout, older items are upgraded when read
+	SchemaVersion int `json:"-" dynamodbav:"schemaVersion,omitempty"`
+	// EmailLower is the key of EmailLowerIndex, users stored under an email in any case
+	// are found with it
+	EmailLower string `json:"-" dynamodbav:"emailLower,omitempty"`
+	// IfMatch are the conditions of a PUT, see ConditionsFromRequest
+	IfMatch map[string]string `json:"ifMatch,omitempty" dynamodbav:"-"`
+	// SendWelcomeEmail false in a POST skips the welcome email
+	SendWelcomeEmail *bool `json:"sendWelcomeEmail,omitempty" dynamodbav:"-"`
 }
 
-func FetchUser(email, tableName string, dynaClient dynamodbiface.DynamoDBAPI) (*User, error) {
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+)
+
+func validStatus(status string) bool {
+	return status == StatusActive || status == StatusSuspended
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func validRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+// TimestampLayout is RFC 3339 in UTC with a fixed number of digits, so timestamps also
+// sort correctly as strings
+const TimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// checkEmailDomain keeps signups from disposable email providers out
+func checkEmailDomain(email string) error {
+	if !validators.IsEmailAllowed(email) {
+		return fmt.Errorf("%s: %s", ErrorEmailDomainBlocked, validators.EmailDomain(email))
+	}
+	return nil
+}
+
+// normalizePhone stores phone numbers in E.164, the phone is optional
+func normalizePhone(u *User) error {
+	if len(u.Phone) == 0 {
+		return nil
+	}
+	phone, ok := validators.NormalizePhone(u.Phone)
+	if !ok {
+		return errors.New(ErrorInvalidPhone)
+	}
+	u.Phone = phone
+	return nil
+}
+
+// now is the time written to createdAt and updatedAt
+func now() string {
+	return time.Now().UTC().Format(TimestampLayout)
+}
+
+// CONSISTENT_READS=true makes every FetchUser a strongly consistent read, at twice the
+// read capacity. Writes always check existence with one.
+var consistentReads = os.Getenv("CONSISTENT_READS") == "true"
+
+// FetchUser returns the user stored under email, or ErrorUserDoesNotExists, also for users
+// past their expiresAt and, with a tenant, for users of other tenants. A user stored under
+// the email in different case is found through EmailLowerIndex, its Email is the stored
+// key. When attributes are given only those are read from the table, the rest of the
+// returned User stays empty. The read is eventually consistent unless CONSISTENT_READS
+// is set, a user written just before may not be found yet.
+func FetchUser(ctx context.Context, email, tenant, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*User, error) {
+	return fetchUser(ctx, email, tenant, consistentReads, tableName, dynaClient, attributes...)
+}
+
+// FetchUserConsistent is FetchUser with a strongly consistent read, it sees every write
+// that succeeded before it. The fallback through EmailLowerIndex is still eventually
+// consistent, DynamoDB has no consistent reads on global secondary indexes.
+func FetchUserConsistent(ctx context.Context, email, tenant, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*User, error) {
+	return fetchUser(ctx, email, tenant, true, tableName, dynaClient, attributes...)
+}
+
+func fetchUser(ctx context.Context, email, tenant string, consistent bool, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*User, error) {
+
+	email = validators.NormalizeEmail(email)
+	// the keys of notes, webhooks and API keys live in the same table, they aren't users
+	if strings.HasPrefix(email, notePrefix) || strings.HasPrefix(email, webhookPrefix) || strings.HasPrefix(email, apiKeyPrefix) {
+		return nil, errors.New(ErrorUserDoesNotExists)
+	}
 
 	// based on some key we'll run operation in db. In this case, user will be found in db based
 	// on its mailId
 	input := dynamodb.GetItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"email": {S: aws.String(email)},
-		},
-		TableName: aws.String(tableName),
+		Key:            userKey(email),
+		TableName:      aws.String(tableName),
+		ConsistentRead: aws.Bool(consistent),
+	}
+	if emailLookupIndex {
+		key, err := lookupEmail(ctx, email, tableName, dynaClient)
+		if err != nil {
+			return nil, err
+		}
+		input.Key = userKey(key)
 	}
 
-	result, err := dynaClient.GetItem(&input)
+	if len(attributes) > 0 {
+		for _, attr := range []string{"email", "expiresAt", TenantAttribute} {
+			if !containsString(attributes, attr) {
+				attributes = append(attributes, attr)
+			}
+		}
+		input.ProjectionExpression, input.ExpressionAttributeNames = projection(attributes, nil)
+	}
+
+	result, err := dynaClient.GetItem(ctx, &input)
 	if err != nil {
-		return nil, errors.New(ErrorFailedToFetchRecord)
+		return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+	}
+
+	// GetItem doesn't fail for a missing key, it just returns no item. The user may still
+	// be stored under a key from before emails were normalized.
+	if len(result.Item) == 0 && !emailLookupIndex {
+		key, err := lookupEmail(ctx, email, tableName, dynaClient)
+		switch {
+		case err == nil && key != email:
+			input.Key = userKey(key)
+			if result, err = dynaClient.GetItem(ctx, &input); err != nil {
+				return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+			}
+		case err != nil && err.Error() != ErrorUserDoesNotExists && err.Error() != ErrorIndexNotFound:
+			// without the index there's just nothing to fall back to
+			return nil, err
+		}
+	}
+	if len(result.Item) == 0 {
+		return nil, errors.New(ErrorUserDoesNotExists)
 	}
 
 	item := new(User)
-	err = dynamodbattribute.UnmarshalMap(result.Item, item) // taking User from result & marshalling into item of type User
+	err = attributevalue.UnmarshalMap(result.Item, item) // taking User from result & marshalling into item of type User
 	if err != nil {
-		return nil, errors.New(ErrorFailedToUnmarshalRecord)
+		return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	// TTL deletes lazily, an expired user may still be stored for a while
+	if item.expired() || !item.inTenant(tenant) {
+		return nil, errors.New(ErrorUserDoesNotExists)
+	}
+	if upgrade(item) && len(attributes) == 0 {
+		writeBack(ctx, []*User{item}, tableName, dynaClient)
 	}
 
 	return item, nil
 
 }
 
-func FetchUsers(tableName string, dynaClient dynamodbiface.DynamoDBAPI) (*[]User, error) {
+// SCAN_MAX_ITEMS and SCAN_MAX_PAGES cap what FetchUsers reads into memory, 0 turns a
+// cap off
+var (
+	scanMaxItems = envInt("SCAN_MAX_ITEMS", 10000)
+	scanMaxPages = envInt("SCAN_MAX_PAGES", 100)
+)
+
+// FetchUsers scans the users matching filters, see CountUsers, following the scan from
+// page to page. It stops at scanMaxItems users or after scanMaxPages pages, complete is
+// false then and the table holds more matching users than were returned. With a tenant
+// only its users are read.
+func FetchUsers(ctx context.Context, filters map[string]string, tenant, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*[]User, bool, error) {
+
 	input := dynamodb.ScanInput{
 		TableName: aws.String(tableName),
 	}
-	result, err := dynaClient.Scan(&input)
-	if err != nil {
-		return nil, errors.New(ErrorFailedToFetchRecord)
+	if err := applyFilters(&input, filters); err != nil {
+		return nil, false, err
+	}
+	if len(attributes) > 0 {
+		input.ProjectionExpression, input.ExpressionAttributeNames = projection(attributes, input.ExpressionAttributeNames)
 	}
 
-	item := new([]User)
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, item)
-	if err != nil {
-		return nil, errors.New(ErrorFailedToUnmarshalRecord)
+	users := []User{}
+	complete := false
+	for pages := 1; ; pages++ {
+		result, err := scan(ctx, &input, tenant, dynaClient)
+		if err != nil {
+			return nil, false, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+
+		var page []User
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, false, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+		}
+		users = append(users, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			complete = true
+			break
+		}
+		if (scanMaxPages > 0 && pages >= scanMaxPages) || (scanMaxItems > 0 && len(users) >= scanMaxItems) {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	if scanMaxItems > 0 && len(users) > scanMaxItems {
+		users = users[:scanMaxItems]
+		complete = false
+	}
+	if !complete {
+		logging.FromContext(ctx).WarnContext(ctx, "listing stopped, more users are stored", "users", len(users))
 	}
 
-	return item, nil
+	if legacy := upgradeUsers(users); len(legacy) > 0 {
+		logging.FromContext(ctx).InfoContext(ctx, "read users in an older schema", "legacy", len(legacy), "users", len(users))
+		if len(attributes) == 0 {
+			writeBack(ctx, legacy, tableName, dynaClient)
+		}
+	}
+
+	return &users, complete, nil
+
 }
 
-func CreateUser(req events.APIGatewayProxyRequest, tableName string, dynaClient dynamodbiface.DynamoDBAPI) (*User, error) {
-	var createuser User
+func CreateUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient DynamoDBAPI) (*User, error) {
 
-	if err := json.Unmarshal([]byte(req.Body), &createuser); err != nil {
-		return nil, errors.New(ErrorInvalidUserData)
-	}
-	// check users email is valid or not
-	if !validators.IsEmailValid(createuser.Email) {
-		return nil, errors.New(ErrorInvalidEmail)
+	createuser, err := NewUserFromRequest(req)
+	if err != nil {
+		return nil, err
 	}
 
-	// check if user already exists
-	curruser, _ := FetchUser(createuser.Email, tableName, dynaClient)
-	if curruser != nil && len(curruser.Email) != 0 {
+	// check if user already exists, for a quick answer that also covers the email in
+	// different case. Emails are unique across tenants, the table is keyed by email alone.
+	if _, err := FetchUserConsistent(ctx, createuser.Email, "", tableName, dynaClient, "email"); err == nil {
 		return nil, errors.New(ErrorUserAlreadyExists)
+	} else if err.Error() != ErrorUserDoesNotExists {
+		return nil, err
 	}
 
 	// if everything is OK, let's marhsal the request into data that dynamodb can understand
-	attrVal, err := dynamodbattribute.MarshalMap(createuser)
+	attrVal, err := attributevalue.MarshalMap(createuser)
 	if err != nil {
-		return nil, errors.New(ErrorMarshalItem)
+		return nil, flatten(ctx, ErrorMarshalItem, err)
 	}
 
-	// let's create the input for dynamodb
+	// let's create the input for dynamodb. The check above can race with another create
+	// for the same email, the condition makes sure only one of them gets written.
 	input := dynamodb.PutItemInput{
-		Item:      attrVal,
-		TableName: aws.String(tableName),
+		Item:                     attrVal,
+		TableName:                aws.String(tableName),
+		ConditionExpression:      aws.String("attribute_not_exists(#email)"),
+		ExpressionAttributeNames: map[string]string{"#email": KeyAttribute},
 	}
 
+	defer forgetUsers(createuser.Email)
 	// dynaClient will trigger the operation to run PUT item to dynamodb
-	_, err = dynaClient.PutItem(&input)
+	_, err = dynaClient.PutItem(ctx, &input)
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, errors.New(ErrorUserAlreadyExists)
+		}
+		return nil, flatten(ctx, ErrorDynamoPutItem, err)
+	}
+
+	return createuser, nil
+}
+
+// UpdateUser writes the fields of a PUT to the stored user and returns the user as it
+// is stored afterwards, along with the previous user as it was read. The write only
+// happens while the stored record still has the version that was read, otherwise
+// ErrorVersionConflict, so previous is exactly what was overwritten. With an
+// expectedVersion the record must have that version, otherwise ErrorVersionMismatch.
+// A missing user is ErrorUserDoesNotExists unless upsert is set, then it is created and
+// previous is nil.
+func UpdateUser(ctx context.Context, req events.APIGatewayProxyRequest, expectedVersion *int64, upsert bool, tableName string, dynaClient DynamoDBAPI) (*User, *User, error) {
+
+	updateuser, err := UpdateFromRequest(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	tenant := updateuser.TenantID
+
+	// first check if user exist & with correct data. All of it is read, a projection
+	// costs the same and the whole user is what the update overwrites.
+	curruser, err := FetchUserConsistent(ctx, updateuser.Email, tenant, tableName, dynaClient)
+	switch {
+	case err == nil:
+		if expectedVersion != nil && *expectedVersion != curruser.Version {
+			return nil, nil, errors.New(ErrorVersionMismatch)
+		}
+		// no need to try a write that can't succeed
+		if err := CheckConditions(curruser, updateuser.IfMatch); err != nil {
+			return nil, nil, err
+		}
+	case err.Error() == ErrorUserDoesNotExists && upsert && expectedVersion == nil && len(updateuser.IfMatch) == 0:
+		created, err := upsertUser(ctx, req, updateuser, tableName, dynaClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		return created, nil, nil
+	default:
+		return nil, nil, err
+	}
+
+	// a PUT without status doesn't reactivate a suspended user, nor demote an admin. Both
+	// are written anyway, they're what the schema migrations default, so the item ends
+	// up in the current schema.
+	if len(updateuser.Status) == 0 {
+		updateuser.Status = curruser.Status
+	}
+	if len(updateuser.Role) == 0 {
+		updateuser.Role = curruser.Role
+	}
+	// a new password replaces the stored hash, without one the hash is kept
+	if err := setPassword(updateuser); err != nil {
+		return nil, nil, err
+	}
+
+	// only what the request has is set, everything else on the item stays as it is. The
+	// key, createdAt, createdBy, the verification and the avatar are never set by a PUT.
+	var update expression.UpdateBuilder
+	if len(updateuser.FirstName) > 0 {
+		update = update.Set(expression.Name("firstName"), expression.Value(updateuser.FirstName))
+	}
+	if len(updateuser.LastName) > 0 {
+		update = update.Set(expression.Name("lastName"), expression.Value(updateuser.LastName))
+	}
+	if len(updateuser.Phone) > 0 {
+		update = update.Set(expression.Name("phone"), expression.Value(updateuser.Phone))
+	}
+	if len(updateuser.PasswordHash) > 0 {
+		update = update.Set(expression.Name("passwordHash"), expression.Value(updateuser.PasswordHash))
+	}
+	if len(updateuser.Metadata) > 0 {
+		update = update.Set(expression.Name("metadata"), expression.Value(updateuser.Metadata))
+	}
+	if updateuser.ExpiresAt != nil && !updateuser.ExpiresAt.IsZero() {
+		update = update.Set(expression.Name(TTLAttribute), expression.Value(updateuser.ExpiresAt))
+	}
+	update = update.
+		Set(expression.Name("status"), expression.Value(updateuser.Status)).
+		Set(expression.Name("role"), expression.Value(updateuser.Role)).
+		Set(expression.Name("version"), expression.Value(curruser.Version+1)).
+		Set(expression.Name("updatedAt"), expression.Value(now())).
+		Set(expression.Name("updatedBy"), expression.Value(CallerIdentity(req))).
+		Set(expression.Name("schemaVersion"), expression.Value(CurrentSchemaVersion)).
+		Set(expression.Name("emailLower"), expression.Value(emailLower(curruser.Email)))
+
+	// nobody else may have written the user since it was read, and it can't be created
+	// here, that's what the upsert is for
+	condition := versionConditionBuilder(curruser.Version)
+	if len(tenant) > 0 {
+		condition = condition.And(expression.Name(TenantAttribute).Equal(expression.Value(tenant)))
+	}
+	// the version guards the conditions as well, they're checked again in case the
+	// table changes that
+	condition, err = withConditions(condition, updateuser.IfMatch)
+	if err != nil {
+		return nil, nil, err
+	}
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return nil, nil, flatten(ctx, ErrorMarshalItem, err)
+	}
+
+	defer forgetUsers(curruser.Email)
+	result, err := dynaClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                       userKey(curruser.Email),
+		TableName:                 aws.String(tableName),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			// written or deleted meanwhile
+			if expectedVersion != nil {
+				return nil, nil, errors.New(ErrorVersionMismatch)
+			}
+			if len(updateuser.IfMatch) > 0 {
+				return nil, nil, conditionFailure(ctx, curruser.Email, tenant, updateuser.IfMatch, tableName, dynaClient)
+			}
+			return nil, nil, errors.New(ErrorVersionConflict)
+		}
+		return nil, nil, flatten(ctx, ErrorDynamoUpdateItem, err)
+	}
+
+	item := new(User)
+	if err := attributevalue.UnmarshalMap(result.Attributes, item); err != nil {
+		return nil, nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	upgrade(item)
+
+	return item, curruser, nil
+
+}
+
+// upsertUser creates the user a PUT was for when it doesn't exist yet. A new user has
+// to pass the same checks as on POST.
+func upsertUser(ctx context.Context, req events.APIGatewayProxyRequest, u *User, tableName string, dynaClient DynamoDBAPI) (*User, error) {
+
+	if err := PrepareUpsert(u, CallerIdentity(req)); err != nil {
+		return nil, err
+	}
+
+	attrbVal, err := attributevalue.MarshalMap(u)
 	if err != nil {
-		return nil, errors.New(ErrorDynamoPutItem)
+		return nil, flatten(ctx, ErrorMarshalItem, err)
 	}
 
-	return &createuser, nil
+	defer forgetUsers(u.Email)
+	// the user may have been created, possibly by another tenant, since it was read
+	_, err = dynaClient.PutItem(ctx, &dynamodb.PutItemInput{
+		Item:                     attrbVal,
+		TableName:                aws.String(tableName),
+		ConditionExpression:      aws.String("attribute_not_exists(#email)"),
+		ExpressionAttributeNames: map[string]string{"#email": KeyAttribute},
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, errors.New(ErrorUserAlreadyExists)
+		}
+		return nil, flatten(ctx, ErrorDynamoPutItem, err)
+	}
+
+	return u, nil
+
 }
 
-func UpdateUser(req events.APIGatewayProxyRequest, tableName string, dynaClient dynamodbiface.DynamoDBAPI) (*User, error) {
+// PatchUser only touches the attributes present in the request body, everything
+// else on the stored record is left as it is
+func PatchUser(ctx context.Context, req events.APIGatewayProxyRequest, tableName string, dynaClient DynamoDBAPI) (*User, error) {
+
+	// pointers tell us which fields were actually sent
+	var patch struct {
+		Email     *string `json:"email"`
+		FirstName *string `json:"firstName"`
+		LastName  *string `json:"lastName"`
+		Phone     *string `json:"phone"`
+		Status    *string `json:"status"`
+		Role      *string `json:"role"`
+		Password  *string `json:"password"`
+		// metadata is merged into what's stored, an empty value deletes the key
+		Metadata map[string]string `json:"metadata"`
+		// an empty expiresAt makes the user permanent again
+		ExpiresAt *Expiry `json:"expiresAt"`
+		// server controlled, accepted so a GET response can be sent back but ignored
+		CreatedBy *string `json:"createdBy"`
+		UpdatedBy *string `json:"updatedBy"`
+		TenantID  *string `json:"tenantId"`
+	}
 
-	var updateuser User
+	if err := Decode(req.Body, &patch); err != nil {
+		return nil, err
+	}
+	tenant, err := TenantFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := json.Unmarshal([]byte(req.Body), &updateuser); err != nil {
+	email := validators.NormalizeEmail(EmailFromRequest(req))
+	if len(email) == 0 && patch.Email != nil {
+		email = validators.NormalizeEmail(*patch.Email)
+	}
+	// the email is the key, it can be used to address the user but not changed
+	if len(email) == 0 || (patch.Email != nil && validators.NormalizeEmail(*patch.Email) != email) {
 		return nil, errors.New(ErrorInvalidUserData)
 	}
 
-	// first check if user exist & with correct data
-	curruser, _ := FetchUser(updateuser.Email, tableName, dynaClient)
-	if curruser != nil && len(curruser.Email) == 0 {
-		return nil, errors.New(ErrorUserDoesNotExists)
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	var sets []string
+
+	var invalid []FieldError
+	if patch.FirstName != nil {
+		*patch.FirstName = strings.TrimSpace(*patch.FirstName)
+		if f := checkName("firstName", *patch.FirstName, requireFirstName); f != nil {
+			invalid = append(invalid, *f)
+		}
+	}
+	if patch.LastName != nil {
+		*patch.LastName = strings.TrimSpace(*patch.LastName)
+		if f := checkName("lastName", *patch.LastName, false); f != nil {
+			invalid = append(invalid, *f)
+		}
+	}
+	if patch.Password != nil {
+		if f := checkPassword(*patch.Password); f != nil {
+			invalid = append(invalid, *f)
+		}
+	}
+	if patch.ExpiresAt != nil && !patch.ExpiresAt.IsZero() {
+		if f := checkExpiry(&User{ExpiresAt: patch.ExpiresAt}); f != nil {
+			invalid = append(invalid, *f)
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, &ValidationError{Fields: invalid}
 	}
 
-	// convert unmarshalled data from json to data that dynamodb can understand
-	attrbVal, err := dynamodbattribute.MarshalMap(updateuser)
+	if patch.Password != nil {
+		hash, err := hashPassword(*patch.Password)
+		if err != nil {
+			return nil, err
+		}
+		names["#passwordHash"] = "passwordHash"
+		values[":passwordHash"] = &types.AttributeValueMemberS{Value: hash}
+		sets = append(sets, "#passwordHash = :passwordHash")
+	}
+
+	if patch.FirstName != nil {
+		names["#firstName"] = "firstName"
+		values[":firstName"] = &types.AttributeValueMemberS{Value: *patch.FirstName}
+		sets = append(sets, "#firstName = :firstName")
+	}
+	if patch.LastName != nil {
+		names["#lastName"] = "lastName"
+		values[":lastName"] = &types.AttributeValueMemberS{Value: *patch.LastName}
+		sets = append(sets, "#lastName = :lastName")
+	}
+
+	if patch.Status != nil {
+		if !validStatus(*patch.Status) {
+			return nil, errors.New(ErrorInvalidStatus)
+		}
+		names["#status"] = "status"
+		values[":status"] = &types.AttributeValueMemberS{Value: *patch.Status}
+		sets = append(sets, "#status = :status")
+	}
+
+	if patch.Role != nil {
+		if !validRole(*patch.Role) {
+			return nil, errors.New(ErrorInvalidRole)
+		}
+		names["#role"] = "role"
+		values[":role"] = &types.AttributeValueMemberS{Value: *patch.Role}
+		sets = append(sets, "#role = :role")
+	}
+
+	var removes []string
+	if patch.Phone != nil {
+		// an empty phone removes it
+		names["#phone"] = "phone"
+		if len(*patch.Phone) == 0 {
+			removes = append(removes, "#phone")
+		} else {
+			phone, ok := validators.NormalizePhone(*patch.Phone)
+			if !ok {
+				return nil, errors.New(ErrorInvalidPhone)
+			}
+			values[":phone"] = &types.AttributeValueMemberS{Value: phone}
+			sets = append(sets, "#phone = :phone")
+		}
+	}
+
+	if patch.ExpiresAt != nil {
+		names["#ttl"] = TTLAttribute
+		if patch.ExpiresAt.IsZero() {
+			removes = append(removes, "#ttl")
+		} else {
+			values[":ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(patch.ExpiresAt.Unix(), 10)}
+			sets = append(sets, "#ttl = :ttl")
+		}
+	}
+
+	if len(sets) == 0 && len(removes) == 0 && len(patch.Metadata) == 0 {
+		return nil, errors.New(ErrorNothingToUpdate)
+	}
+
+	curruser, err := FetchUserConsistent(ctx, email, tenant, tableName, dynaClient, "email", "version", "metadata")
 	if err != nil {
-		return nil, errors.New(ErrorMarshalItem)
+		return nil, err
 	}
 
-	// create input that can go inside dynamodb
-	input := dynamodb.PutItemInput{
-		Item:      attrbVal,
-		TableName: aws.String(tableName),
+	// the merged map is written as a whole, the version condition keeps concurrent
+	// patches from losing each other's keys
+	if len(patch.Metadata) > 0 {
+		metadata := mergeMetadata(curruser.Metadata, patch.Metadata)
+		if invalid := checkMetadata(metadata); len(invalid) > 0 {
+			return nil, &ValidationError{Fields: invalid}
+		}
+		names["#metadata"] = "metadata"
+		if len(metadata) == 0 {
+			removes = append(removes, "#metadata")
+		} else {
+			value, err := attributevalue.Marshal(metadata)
+			if err != nil {
+				return nil, flatten(ctx, ErrorMarshalItem, err)
+			}
+			values[":metadata"] = value
+			sets = append(sets, "#metadata = :metadata")
+		}
 	}
 
-	// use dynaClient to trigger dynamodb function to put item
-	_, err = dynaClient.PutItem(&input)
+	condition, current := versionCondition(curruser.Version, names)
+	for k, v := range current {
+		values[k] = v
+	}
+	values[":next"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(curruser.Version+1, 10)}
+	sets = append(sets, "#version = :next")
+
+	names["#updatedAt"] = "updatedAt"
+	values[":updatedAt"] = &types.AttributeValueMemberS{Value: now()}
+	sets = append(sets, "#updatedAt = :updatedAt")
+	names["#updatedBy"] = "updatedBy"
+	values[":updatedBy"] = &types.AttributeValueMemberS{Value: CallerIdentity(req)}
+	sets = append(sets, "#updatedBy = :updatedBy")
+	names["#emailLower"] = "emailLower"
+	values[":emailLower"] = &types.AttributeValueMemberS{Value: emailLower(curruser.Email)}
+	sets = append(sets, "#emailLower = :emailLower")
+	condition = tenantCondition(condition, tenant, names, values)
+
+	updateExpression := "SET " + strings.Join(sets, ", ")
+	if len(removes) > 0 {
+		updateExpression += " REMOVE " + strings.Join(removes, ", ")
+	}
+
+	input := dynamodb.UpdateItemInput{
+		Key:                       userKey(curruser.Email),
+		TableName:                 aws.String(tableName),
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       condition,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	}
+
+	defer forgetUsers(curruser.Email)
+	result, err := dynaClient.UpdateItem(ctx, &input)
 	if err != nil {
-		return nil, errors.New(ErrorDynamoPutItem)
+		// the user was written or deleted since its version was read
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, errors.New(ErrorVersionConflict)
+		}
+		return nil, flatten(ctx, ErrorDynamoUpdateItem, err)
 	}
 
-	return &updateuser, nil
+	item := new(User)
+	if err := attributevalue.UnmarshalMap(result.Attributes, item); err != nil {
+		return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	upgrade(item)
+
+	return item, nil
 
 }
 
-func DeleteUser(req events.APIGatewayProxyRequest, tableName string, dynaClient dynamodbiface.DynamoDBAPI) error {
+// DeleteUser removes the user and returns what was stored, or ErrorUserDoesNotExists
+// when there was nothing under that email, or nothing of the tenant. The user is found
+// the way FetchUser finds it. With conditions the user is only removed while it matches
+// them, see ConditionsFromRequest, or it's a *ConditionError.
+func DeleteUser(ctx context.Context, email, tenant string, conditions map[string]string, tableName string, dynaClient DynamoDBAPI) (*User, error) {
 
-	email := req.QueryStringParameters["email"]
-	// first check if user exist & with correct data
-	curruser, _ := FetchUser(email, tableName, dynaClient)
-	if curruser != nil && len(curruser.Email) == 0 {
-		return errors.New(ErrorUserDoesNotExists)
+	email = validators.NormalizeEmail(email)
+
+	if !validators.IsEmailValid(email) {
+		return nil, errors.New(ErrorInvalidEmail)
+	}
+	stored, err := FetchUser(ctx, email, tenant, tableName, dynaClient, "email")
+	if err != nil {
+		return nil, err
 	}
 
 	input := &dynamodb.DeleteItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"email": {S: aws.String(email)},
-		},
-		TableName: aws.String(tableName),
+		Key:          userKey(stored.Email),
+		TableName:    aws.String(tableName),
+		ReturnValues: types.ReturnValueAllOld,
+	}
+	switch {
+	case len(conditions) > 0:
+		// the item has to exist for the conditions to hold
+		condition := expression.AttributeExists(expression.Name(KeyAttribute))
+		if len(tenant) > 0 {
+			condition = condition.And(expression.Name(TenantAttribute).Equal(expression.Value(tenant)))
+		}
+		if condition, err = withConditions(condition, conditions); err != nil {
+			return nil, err
+		}
+		expr, err := expression.NewBuilder().WithCondition(condition).Build()
+		if err != nil {
+			return nil, flatten(ctx, ErrorMarshalItem, err)
+		}
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	case len(tenant) > 0:
+		input.ExpressionAttributeNames = map[string]string{}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{}
+		input.ConditionExpression = tenantCondition(nil, tenant, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
 	}
 
-	if _, err := dynaClient.DeleteItem(input); err != nil {
-		return errors.New(ErrorDeleteItem)
+	defer forgetUsers(stored.Email)
+	result, err := dynaClient.DeleteItem(ctx, input)
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			if len(conditions) > 0 {
+				return nil, conditionFailure(ctx, stored.Email, tenant, conditions, tableName, dynaClient)
+			}
+			return nil, errors.New(ErrorUserDoesNotExists)
+		}
+		return nil, flatten(ctx, ErrorDeleteItem, err)
 	}
 
-	return nil
+	// deleting a missing key succeeds, it just doesn't return any old attributes
+	if len(result.Attributes) == 0 {
+		return nil, errors.New(ErrorUserDoesNotExists)
+	}
+
+	item := new(User)
+	if err := attributevalue.UnmarshalMap(result.Attributes, item); err != nil {
+		return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	upgrade(item)
+
+	return item, nil
 }
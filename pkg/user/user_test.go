@@ -0,0 +1,411 @@
+package user
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var errThrottled = &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}
+
+func storedItem(t *testing.T, u User) map[string]types.AttributeValue {
+	t.Helper()
+	item, err := attributevalue.MarshalMap(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func TestUserAttributes(t *testing.T) {
+
+	expires := &Expiry{time.Unix(1700000000, 0).UTC()}
+	item := storedItem(t, User{
+		Email:             "jane@example.com",
+		Password:          "plain",
+		PasswordHash:      "hash",
+		ExpiresAt:         expires,
+		Version:           3,
+		AvatarURL:         "https://example.com/a.png",
+		VerificationToken: "token",
+		IfMatch:           map[string]string{"status": "active"},
+	})
+
+	tests := []struct {
+		name string
+		want types.AttributeValue
+	}{
+		{"email", &types.AttributeValueMemberS{Value: "jane@example.com"}},
+		{"firstName", &types.AttributeValueMemberNULL{Value: true}},
+		{"lastName", &types.AttributeValueMemberNULL{Value: true}},
+		{"passwordHash", &types.AttributeValueMemberS{Value: "hash"}},
+		{TTLAttribute, &types.AttributeValueMemberN{Value: "1700000000"}},
+		{"verified", &types.AttributeValueMemberBOOL{Value: false}},
+		{"version", &types.AttributeValueMemberN{Value: "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := item[tt.name]
+			if !ok {
+				t.Fatalf("%s is not stored", tt.name)
+			}
+			if !equalAttribute(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	// what's only in requests or responses, and empty optional fields, isn't stored
+	for _, name := range []string{"password", "Password", "avatarUrl", "AvatarURL", "verificationToken", "ifMatch", "sendWelcomeEmail", "phone", "status", "metadata", "expiresAt", "tenantId"} {
+		if _, ok := item[name]; ok {
+			t.Errorf("%s is stored", name)
+		}
+	}
+
+	var read User
+	if err := attributevalue.UnmarshalMap(item, &read); err != nil {
+		t.Fatal(err)
+	}
+	if read.Email != "jane@example.com" || read.PasswordHash != "hash" || read.Version != 3 || !read.ExpiresAt.Equal(expires.Time) || len(read.Password) > 0 {
+		t.Errorf("read back %+v", read)
+	}
+
+}
+
+func equalAttribute(a, b types.AttributeValue) bool {
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS:
+		b, ok := b.(*types.AttributeValueMemberS)
+		return ok && a.Value == b.Value
+	case *types.AttributeValueMemberN:
+		b, ok := b.(*types.AttributeValueMemberN)
+		return ok && a.Value == b.Value
+	case *types.AttributeValueMemberBOOL:
+		b, ok := b.(*types.AttributeValueMemberBOOL)
+		return ok && a.Value == b.Value
+	case *types.AttributeValueMemberNULL:
+		b, ok := b.(*types.AttributeValueMemberNULL)
+		return ok && a.Value == b.Value
+	}
+	return false
+}
+
+func TestFetchUser(t *testing.T) {
+
+	stored := User{Email: "jane@example.com", FirstName: "Jane", TenantID: "acme", Version: 2, SchemaVersion: CurrentSchemaVersion}
+	expired := stored
+	expired.ExpiresAt = &Expiry{time.Now().Add(-time.Hour)}
+
+	tests := []struct {
+		name    string
+		email   string
+		tenant  string
+		item    map[string]types.AttributeValue
+		err     error
+		wantErr string
+	}{
+		{name: "stored", email: "jane@Example.com", tenant: "acme", item: storedItem(t, stored)},
+		{name: "any tenant", email: "jane@example.com", item: storedItem(t, stored)},
+		{name: "missing", email: "jane@example.com", wantErr: ErrorUserDoesNotExists},
+		{name: "other tenant", email: "jane@example.com", tenant: "globex", item: storedItem(t, stored), wantErr: ErrorUserDoesNotExists},
+		{name: "expired", email: "jane@example.com", item: storedItem(t, expired), wantErr: ErrorUserDoesNotExists},
+		{name: "note key", email: notePrefix + "jane@example.com#1", wantErr: ErrorUserDoesNotExists},
+		{name: "failure", email: "jane@example.com", err: errThrottled, wantErr: ErrorFailedToFetchRecord},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input *dynamodb.GetItemInput
+			client := &fakeDynamo{getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				input = in
+				return &dynamodb.GetItemOutput{Item: tt.item}, tt.err
+			}}
+
+			u, err := FetchUser(context.Background(), tt.email, tt.tenant, "users", client)
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Email != stored.Email || u.FirstName != "Jane" || u.Version != 2 {
+				t.Errorf("user = %+v", u)
+			}
+			if aws.ToString(input.TableName) != "users" || !equalAttribute(input.Key[KeyAttribute], &types.AttributeValueMemberS{Value: "jane@example.com"}) {
+				t.Errorf("input = %+v", input)
+			}
+		})
+	}
+
+}
+
+func TestCreateUser(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		existing map[string]types.AttributeValue
+		getErr   error
+		putErr   error
+		wantErr  string
+	}{
+		{name: "created"},
+		{name: "exists", existing: storedItem(t, User{Email: "jane@example.com", SchemaVersion: CurrentSchemaVersion}), wantErr: ErrorUserAlreadyExists},
+		{name: "created concurrently", putErr: &types.ConditionalCheckFailedException{}, wantErr: ErrorUserAlreadyExists},
+		{name: "put fails", putErr: errThrottled, wantErr: ErrorDynamoPutItem},
+		{name: "get fails", getErr: errThrottled, wantErr: ErrorFailedToFetchRecord},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var put *dynamodb.PutItemInput
+			client := &fakeDynamo{
+				getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+					if !aws.ToBool(in.ConsistentRead) {
+						t.Error("existence is checked with an eventually consistent read")
+					}
+					return &dynamodb.GetItemOutput{Item: tt.existing}, tt.getErr
+				},
+				putItem: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+					put = in
+					return &dynamodb.PutItemOutput{}, tt.putErr
+				},
+			}
+
+			req := events.APIGatewayProxyRequest{Body: `{"email":"jane@Example.com","firstName":"Jane"}`}
+			u, err := CreateUser(context.Background(), req, "users", client)
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Email != "jane@example.com" || u.Version != 1 {
+				t.Errorf("user = %+v", u)
+			}
+			if aws.ToString(put.ConditionExpression) != "attribute_not_exists(#email)" || put.ExpressionAttributeNames["#email"] != KeyAttribute {
+				t.Errorf("condition = %s %v", aws.ToString(put.ConditionExpression), put.ExpressionAttributeNames)
+			}
+			if !equalAttribute(put.Item["email"], &types.AttributeValueMemberS{Value: "jane@example.com"}) || !equalAttribute(put.Item["firstName"], &types.AttributeValueMemberS{Value: "Jane"}) {
+				t.Errorf("item = %v", put.Item)
+			}
+		})
+	}
+
+}
+
+func TestDeleteUser(t *testing.T) {
+
+	stored := User{Email: "jane@example.com", FirstName: "Jane", TenantID: "acme", SchemaVersion: CurrentSchemaVersion}
+	tests := []struct {
+		name          string
+		email         string
+		tenant        string
+		existing      map[string]types.AttributeValue
+		old           map[string]types.AttributeValue
+		err           error
+		wantErr       string
+		wantDelete    bool
+		wantCondition bool
+	}{
+		{name: "deleted", email: "jane@Example.com", existing: storedItem(t, stored), old: storedItem(t, stored), wantDelete: true},
+		{name: "deleted in tenant", email: "jane@example.com", tenant: "acme", existing: storedItem(t, stored), old: storedItem(t, stored), wantDelete: true, wantCondition: true},
+		{name: "invalid email", email: "jane", wantErr: ErrorInvalidEmail},
+		{name: "missing", email: "jane@example.com", wantErr: ErrorUserDoesNotExists},
+		{name: "deleted in between", email: "jane@example.com", existing: storedItem(t, stored), wantErr: ErrorUserDoesNotExists, wantDelete: true},
+		{name: "moved tenant in between", email: "jane@example.com", tenant: "acme", existing: storedItem(t, stored), err: &types.ConditionalCheckFailedException{}, wantErr: ErrorUserDoesNotExists, wantDelete: true, wantCondition: true},
+		{name: "delete fails", email: "jane@example.com", existing: storedItem(t, stored), err: errThrottled, wantErr: ErrorDeleteItem, wantDelete: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input *dynamodb.DeleteItemInput
+			client := &fakeDynamo{
+				getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+					return &dynamodb.GetItemOutput{Item: tt.existing}, nil
+				},
+				deleteItem: func(in *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+					input = in
+					return &dynamodb.DeleteItemOutput{Attributes: tt.old}, tt.err
+				},
+			}
+
+			u, err := DeleteUser(context.Background(), tt.email, tt.tenant, nil, "users", client)
+			if (input != nil) != tt.wantDelete {
+				t.Fatalf("deleted = %t, want %t", input != nil, tt.wantDelete)
+			}
+			if input != nil {
+				if aws.ToString(input.TableName) != "users" {
+					t.Errorf("TableName = %q", aws.ToString(input.TableName))
+				}
+				if len(input.Key) != 1 || !equalAttribute(input.Key[KeyAttribute], &types.AttributeValueMemberS{Value: "jane@example.com"}) {
+					t.Errorf("Key = %v", input.Key)
+				}
+				if input.ReturnValues != types.ReturnValueAllOld {
+					t.Errorf("ReturnValues = %s", input.ReturnValues)
+				}
+				if (input.ConditionExpression != nil) != tt.wantCondition {
+					t.Errorf("ConditionExpression = %v", aws.ToString(input.ConditionExpression))
+				}
+			}
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Email != "jane@example.com" || u.FirstName != "Jane" {
+				t.Errorf("user = %+v", u)
+			}
+		})
+	}
+
+}
+
+// setValues maps the attributes an UpdateItem sets to the values they're set to
+func setValues(t *testing.T, in *dynamodb.UpdateItemInput) map[string]types.AttributeValue {
+	t.Helper()
+	set := map[string]types.AttributeValue{}
+	for _, m := range regexp.MustCompile(`(#\w+) = (:\w+)`).FindAllStringSubmatch(aws.ToString(in.UpdateExpression), -1) {
+		set[in.ExpressionAttributeNames[m[1]]] = in.ExpressionAttributeValues[m[2]]
+	}
+	return set
+}
+
+func TestUpdateUser(t *testing.T) {
+
+	stored := User{Email: "jane@example.com", FirstName: "Jane", LastName: "Doe", Version: 2, CreatedAt: "2020-01-01T00:00:00.000Z", SchemaVersion: CurrentSchemaVersion}
+	two, three := int64(2), int64(3)
+
+	tests := []struct {
+		name            string
+		body            string
+		expectedVersion *int64
+		existing        map[string]types.AttributeValue
+		updateErr       error
+		wantErr         string
+		wantSet         []string
+		wantKept        []string
+	}{
+		{
+			name:     "first name",
+			body:     `{"email":"jane@example.com","firstName":"Janet"}`,
+			existing: storedItem(t, stored),
+			wantSet:  []string{"firstName", "version", "updatedAt", "updatedBy", "status", "role"},
+			wantKept: []string{"lastName", "email", "createdAt", "passwordHash", "phone"},
+		},
+		{
+			name:            "expected version",
+			body:            `{"email":"jane@example.com","firstName":"Jane","lastName":"Roe"}`,
+			expectedVersion: &two,
+			existing:        storedItem(t, stored),
+			wantSet:         []string{"firstName", "lastName", "version"},
+			wantKept:        []string{"createdAt", "phone"},
+		},
+		{name: "other version expected", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Roe"}`, expectedVersion: &three, existing: storedItem(t, stored), wantErr: ErrorVersionMismatch},
+		{name: "written in between", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Roe"}`, existing: storedItem(t, stored), updateErr: &types.ConditionalCheckFailedException{}, wantErr: ErrorVersionConflict},
+		{name: "missing", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Roe"}`, wantErr: ErrorUserDoesNotExists},
+		{name: "update fails", body: `{"email":"jane@example.com","firstName":"Jane","lastName":"Roe"}`, existing: storedItem(t, stored), updateErr: errThrottled, wantErr: ErrorDynamoUpdateItem},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input *dynamodb.UpdateItemInput
+			client := &fakeDynamo{
+				getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+					return &dynamodb.GetItemOutput{Item: tt.existing}, nil
+				},
+				updateItem: func(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+					input = in
+					return &dynamodb.UpdateItemOutput{Attributes: tt.existing}, tt.updateErr
+				},
+			}
+
+			req := events.APIGatewayProxyRequest{Body: tt.body}
+			_, previous, err := UpdateUser(context.Background(), req, tt.expectedVersion, false, "users", client)
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if previous == nil || previous.Version != 2 {
+				t.Errorf("previous = %+v", previous)
+			}
+
+			if aws.ToString(input.TableName) != "users" || !equalAttribute(input.Key[KeyAttribute], &types.AttributeValueMemberS{Value: "jane@example.com"}) || input.ReturnValues != types.ReturnValueAllNew {
+				t.Errorf("input = %+v", input)
+			}
+			if !strings.HasPrefix(aws.ToString(input.UpdateExpression), "SET ") {
+				t.Errorf("UpdateExpression = %s", aws.ToString(input.UpdateExpression))
+			}
+			set := setValues(t, input)
+			for _, name := range tt.wantSet {
+				if _, ok := set[name]; !ok {
+					t.Errorf("%s isn't set by %s", name, aws.ToString(input.UpdateExpression))
+				}
+			}
+			for _, name := range tt.wantKept {
+				if _, ok := set[name]; ok {
+					t.Errorf("%s is set", name)
+				}
+			}
+			if !equalAttribute(set["version"], &types.AttributeValueMemberN{Value: "3"}) {
+				t.Errorf("version = %#v", set["version"])
+			}
+			if !strings.Contains(aws.ToString(input.ConditionExpression), "attribute_exists") {
+				t.Errorf("ConditionExpression = %s", aws.ToString(input.ConditionExpression))
+			}
+		})
+	}
+
+}
+
+func TestConsistentReads(t *testing.T) {
+
+	defer func(consistent bool) { consistentReads = consistent }(consistentReads)
+
+	tests := []struct {
+		name       string
+		fetch      func(ctx context.Context, email, tenant, tableName string, dynaClient DynamoDBAPI, attributes ...string) (*User, error)
+		consistent bool
+		want       bool
+	}{
+		{"FetchUser", FetchUser, false, false},
+		{"FetchUser with CONSISTENT_READS", FetchUser, true, true},
+		{"FetchUserConsistent", FetchUserConsistent, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consistentReads = tt.consistent
+			var input *dynamodb.GetItemInput
+			client := &fakeDynamo{getItem: func(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				input = in
+				return &dynamodb.GetItemOutput{Item: storedItem(t, User{Email: "jane@example.com", SchemaVersion: CurrentSchemaVersion})}, nil
+			}}
+
+			if _, err := tt.fetch(context.Background(), "jane@example.com", "", "users", client); err != nil {
+				t.Fatal(err)
+			}
+			if aws.ToBool(input.ConsistentRead) != tt.want {
+				t.Errorf("ConsistentRead = %t, want %t", aws.ToBool(input.ConsistentRead), tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,111 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Rahul-71/go-serverless/pkg/validators"
+)
+
+var ErrorValidation = "validation failed"
+
+// REQUIRE_FIRST_NAME=false accepts users without a first name, like before
+var requireFirstName = os.Getenv("REQUIRE_FIRST_NAME") != "false"
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request, not just the first one
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var problems []string
+	for _, f := range e.Fields {
+		problems = append(problems, f.Field+" "+f.Message)
+	}
+	return ErrorValidation + ": " + strings.Join(problems, "; ")
+}
+
+// prepareNewUser validates a user about to be created and fills in the defaults
+func prepareNewUser(u *User) error {
+
+	u.Email = validators.NormalizeEmail(u.Email)
+	if !validators.IsEmailValid(u.Email) {
+		return errors.New(ErrorInvalidEmail)
+	}
+	if err := checkEmailDomain(u.Email); err != nil {
+		return err
+	}
+	if err := validateFields(u); err != nil {
+		return err
+	}
+	if err := normalizePhone(u); err != nil {
+		return err
+	}
+	if err := setPassword(u); err != nil {
+		return err
+	}
+
+	if len(u.Status) == 0 {
+		u.Status = StatusActive
+	} else if !validStatus(u.Status) {
+		return errors.New(ErrorInvalidStatus)
+	}
+	if len(u.Role) == 0 {
+		u.Role = RoleUser
+	} else if !validRole(u.Role) {
+		return errors.New(ErrorInvalidRole)
+	}
+
+	// new users have to verify their email, whatever the client sent
+	return newVerification(u)
+
+}
+
+// validateFields trims the names of u and checks them along with the password, the
+// expiry and the metadata. It returns a *ValidationError naming every invalid field, or nil.
+func validateFields(u *User) error {
+
+	u.FirstName = strings.TrimSpace(u.FirstName)
+	u.LastName = strings.TrimSpace(u.LastName)
+
+	var fields []FieldError
+	if f := checkName("firstName", u.FirstName, requireFirstName); f != nil {
+		fields = append(fields, *f)
+	}
+	if f := checkName("lastName", u.LastName, false); f != nil {
+		fields = append(fields, *f)
+	}
+	if len(u.Password) > 0 {
+		if f := checkPassword(u.Password); f != nil {
+			fields = append(fields, *f)
+		}
+	}
+	if f := checkExpiry(u); f != nil {
+		fields = append(fields, *f)
+	}
+	u.Metadata = compactMetadata(u.Metadata)
+	fields = append(fields, checkMetadata(u.Metadata)...)
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+
+}
+
+func checkName(field, name string, required bool) *FieldError {
+	switch {
+	case len(name) == 0 && required:
+		return &FieldError{field, "is required"}
+	case !validators.IsNameValid(name):
+		return &FieldError{field, fmt.Sprintf("must be at most %d letters, spaces, hyphens or apostrophes", validators.NameMaxLength)}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ErrorTokenNotFound    = "verification token not found"
+	ErrorTokenExpired     = "verification token expired"
+	ErrorGenerateToken    = "could not generate verification token"
+	ErrorInvalidTokenData = "invalid verification token"
+)
+
+// VerificationIndex is the sparse GSI with verificationTokenHash as partition key
+const VerificationIndex = "verificationTokenHash-index"
+
+// VERIFICATION_TOKEN_TTL_HOURS is how long a verification link works, two days by default
+var verificationTokenTTL = time.Duration(envInt("VERIFICATION_TOKEN_TTL_HOURS", 48)) * time.Hour
+
+// newVerification marks u unverified and gives it a fresh token. Only the hash of the
+// token is stored, the token itself is left on u for whoever sends the email.
+func newVerification(u *User) error {
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return errors.New(ErrorGenerateToken)
+	}
+
+	u.Verified = false
+	u.VerificationToken = base64.RawURLEncoding.EncodeToString(raw)
+	u.VerificationTokenHash = hashToken(u.VerificationToken)
+	u.VerificationExpiresAt = time.Now().Add(verificationTokenTTL).UTC().Format(TimestampLayout)
+	return nil
+
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyEmail marks the user the token was issued to verified and invalidates the token.
+// by is recorded as updatedBy. Unknown or already used tokens are ErrorTokenNotFound, expired ones ErrorTokenExpired.
+func VerifyEmail(ctx context.Context, token, by, tableName string, dynaClient DynamoDBAPI) (*User, error) {
+
+	if len(token) == 0 {
+		return nil, errors.New(ErrorInvalidTokenData)
+	}
+	tokenHash := hashToken(token)
+
+	result, err := dynaClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		IndexName:                 aws.String(VerificationIndex),
+		KeyConditionExpression:    aws.String("#hash = :hash"),
+		ExpressionAttributeNames:  map[string]string{"#hash": "verificationTokenHash"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":hash": &types.AttributeValueMemberS{Value: tokenHash}},
+	})
+	if err != nil {
+		if isMissingIndex(err) {
+			return nil, errors.New(ErrorIndexNotFound)
+		}
+		return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+	}
+	if len(result.Items) == 0 {
+		return nil, errors.New(ErrorTokenNotFound)
+	}
+
+	email, ok := result.Items[0]["email"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, errors.New(ErrorTokenNotFound)
+	}
+
+	// the index may only project the keys, the expiry is read from the table
+	u, err := FetchUser(ctx, email.Value, "", tableName, dynaClient, "email", "verificationExpiresAt")
+	if err != nil {
+		return nil, err
+	}
+	if u.VerificationExpiresAt < time.Now().UTC().Format(TimestampLayout) {
+		return nil, errors.New(ErrorTokenExpired)
+	}
+
+	// the token is consumed in the same write, a second click finds nothing
+	defer forgetUsers(email.Value)
+	update, err := dynaClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                 userKey(email.Value),
+		TableName:           aws.String(tableName),
+		UpdateExpression:    aws.String("SET #verified = :true, #updatedAt = :updatedAt, #updatedBy = :updatedBy, #emailLower = :emailLower, #version = if_not_exists(#version, :zero) + :one REMOVE #hash, #expiresAt"),
+		ConditionExpression: aws.String("#hash = :hash"),
+		ExpressionAttributeNames: map[string]string{
+			"#verified":   "verified",
+			"#updatedAt":  "updatedAt",
+			"#updatedBy":  "updatedBy",
+			"#emailLower": "emailLower",
+			"#version":    "version",
+			"#hash":       "verificationTokenHash",
+			"#expiresAt":  "verificationExpiresAt",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true":       &types.AttributeValueMemberBOOL{Value: true},
+			":updatedAt":  &types.AttributeValueMemberS{Value: now()},
+			":updatedBy":  &types.AttributeValueMemberS{Value: by},
+			":emailLower": &types.AttributeValueMemberS{Value: emailLower(email.Value)},
+			":zero":       &types.AttributeValueMemberN{Value: "0"},
+			":one":        &types.AttributeValueMemberN{Value: "1"},
+			":hash":       &types.AttributeValueMemberS{Value: tokenHash},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, errors.New(ErrorTokenNotFound)
+		}
+		return nil, flatten(ctx, ErrorDynamoUpdateItem, err)
+	}
+
+	verified := new(User)
+	if err := attributevalue.UnmarshalMap(update.Attributes, verified); err != nil {
+		return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+	}
+	upgrade(verified)
+	return verified, nil
+
+}
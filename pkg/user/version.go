@@ -0,0 +1,55 @@
+package user
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// versionCondition only lets a write through while the user still has the version it
+// was read with. Records written before versioning existed have no version, they count
+// as version 0 and are read as version 1 by the schema migrations.
+func versionCondition(current int64, names map[string]string) (*string, map[string]types.AttributeValue) {
+
+	names["#email"] = "email"
+	names["#version"] = "version"
+	values := map[string]types.AttributeValue{
+		":current": &types.AttributeValueMemberN{Value: strconv.FormatInt(current, 10)},
+	}
+
+	if current <= 1 {
+		return aws.String("attribute_exists(#email) AND (attribute_not_exists(#version) OR #version = :current)"), values
+	}
+	return aws.String("attribute_exists(#email) AND #version = :current"), values
+
+}
+
+// versionConditionBuilder is versionCondition for updates built with the expression
+// package
+func versionConditionBuilder(current int64) expression.ConditionBuilder {
+
+	exists := expression.AttributeExists(expression.Name(KeyAttribute))
+	matches := expression.Name("version").Equal(expression.Value(current))
+	if current <= 1 {
+		return exists.And(expression.AttributeNotExists(expression.Name("version")).Or(matches))
+	}
+	return exists.And(matches)
+
+}
+
+// RetryOnConflict calls fn until it doesn't fail with ErrorVersionConflict, at most
+// attempts times. UpdateUser and PatchUser read the current record on every call, so
+// retrying them reapplies the change on top of whatever was written in between.
+func RetryOnConflict(attempts int, fn func() error) error {
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if err = fn(); err == nil || err.Error() != ErrorVersionConflict {
+			return err
+		}
+	}
+	return err
+
+}
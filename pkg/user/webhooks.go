@@ -0,0 +1,174 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrorWebhookNotFound = "webhook not found"
+
+const (
+	ItemTypeWebhook = "webhook"
+	webhookPrefix   = "WEBHOOK#"
+)
+
+// WebhookSecretMinLength is the shortest secret deliveries are signed with
+const WebhookSecretMinLength = 16
+
+// Webhook is a subscription to the changes of users, stored as its own item. The
+// secret signs the deliveries and is never sent back.
+type Webhook struct {
+	ID     string `json:"id" dynamodbav:"id"`
+	URL    string `json:"url" dynamodbav:"url"`
+	Secret string `json:"secret,omitempty" dynamodbav:"secret,omitempty"`
+	// Events are the detail types the webhook gets, every one when empty
+	Events    []string `json:"events,omitempty" dynamodbav:"events,omitempty"`
+	TenantID  string   `json:"-" dynamodbav:"tenantId,omitempty"`
+	CreatedAt string   `json:"createdAt" dynamodbav:"createdAt"`
+	CreatedBy string   `json:"createdBy" dynamodbav:"createdBy"`
+}
+
+// Wants is true when the webhook subscribed to eventType
+func (w *Webhook) Wants(eventType string) bool {
+	return len(w.Events) == 0 || containsString(w.Events, eventType)
+}
+
+// webhookKey is WEBHOOK#<id>, a validated email never starts like that
+func webhookKey(id string) map[string]types.AttributeValue {
+	return itemKey(webhookPrefix + id)
+}
+
+// CreateWebhook validates and stores a subscription to the eventTypes out of
+// knownEvents, in tenant. by is who created it.
+func CreateWebhook(ctx context.Context, w Webhook, knownEvents []string, tenant, by, tableName string, dynaClient DynamoDBAPI) (*Webhook, error) {
+
+	var fields []FieldError
+	target, err := url.Parse(strings.TrimSpace(w.URL))
+	if err != nil || target.Scheme != "https" || len(target.Host) == 0 {
+		fields = append(fields, FieldError{"url", "must be an https URL"})
+	}
+	if len(w.Secret) < WebhookSecretMinLength {
+		fields = append(fields, FieldError{"secret", fmt.Sprintf("must be at least %d characters", WebhookSecretMinLength)})
+	}
+	for _, event := range w.Events {
+		if !containsString(knownEvents, event) {
+			fields = append(fields, FieldError{"events", fmt.Sprintf("must be out of %s", strings.Join(knownEvents, ", "))})
+			break
+		}
+	}
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+
+	id, err := newNoteID()
+	if err != nil {
+		return nil, err
+	}
+	w.ID = id
+	w.URL = target.String()
+	w.TenantID = tenant
+	w.CreatedAt = now()
+	w.CreatedBy = by
+
+	item, err := attributevalue.MarshalMap(w)
+	if err != nil {
+		return nil, flatten(ctx, ErrorMarshalItem, err)
+	}
+	for k, v := range webhookKey(id) {
+		item[k] = v
+	}
+	item[ItemTypeAttribute] = &types.AttributeValueMemberS{Value: ItemTypeWebhook}
+
+	_, err = dynaClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(tableName),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#email)"),
+		ExpressionAttributeNames: map[string]string{"#email": KeyAttribute},
+	})
+	if err != nil {
+		return nil, flatten(ctx, ErrorDynamoPutItem, err)
+	}
+	return &w, nil
+
+}
+
+// FetchWebhooks returns the webhooks of tenant, secrets included. There are few of them,
+// they're scanned for.
+func FetchWebhooks(ctx context.Context, tenant, tableName string, dynaClient DynamoDBAPI) ([]Webhook, error) {
+
+	condition := expression.Name(ItemTypeAttribute).Equal(expression.Value(ItemTypeWebhook))
+	if len(tenant) > 0 {
+		condition = condition.And(expression.Name(TenantAttribute).Equal(expression.Value(tenant)))
+	} else {
+		condition = condition.And(expression.AttributeNotExists(expression.Name(TenantAttribute)))
+	}
+	expr, err := expression.NewBuilder().WithFilter(condition).Build()
+	if err != nil {
+		return nil, flatten(ctx, ErrorMarshalItem, err)
+	}
+	input := dynamodb.ScanInput{
+		TableName:                 aws.String(tableName),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	webhooks := []Webhook{}
+	for {
+		result, err := dynaClient.Scan(ctx, &input)
+		if err != nil {
+			return nil, flatten(ctx, ErrorFailedToFetchRecord, err)
+		}
+
+		var page []Webhook
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, flatten(ctx, ErrorFailedToUnmarshalRecord, err)
+		}
+		webhooks = append(webhooks, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return webhooks, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+}
+
+// DeleteWebhook removes a webhook of tenant, or returns ErrorWebhookNotFound
+func DeleteWebhook(ctx context.Context, id, tenant, tableName string, dynaClient DynamoDBAPI) error {
+
+	if len(id) == 0 {
+		return errors.New(ErrorWebhookNotFound)
+	}
+
+	input := dynamodb.DeleteItemInput{
+		TableName:                aws.String(tableName),
+		Key:                      webhookKey(id),
+		ConditionExpression:      aws.String("attribute_exists(#email)"),
+		ExpressionAttributeNames: map[string]string{"#email": KeyAttribute},
+	}
+	if len(tenant) > 0 {
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{}
+		input.ConditionExpression = tenantCondition(input.ConditionExpression, tenant, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	}
+
+	_, err := dynaClient.DeleteItem(ctx, &input)
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return errors.New(ErrorWebhookNotFound)
+		}
+		return flatten(ctx, ErrorDeleteItem, err)
+	}
+	return nil
+
+}
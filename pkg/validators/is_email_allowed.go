@@ -0,0 +1,66 @@
+package validators
+
+import (
+	_ "embed"
+	"os"
+	"strings"
+)
+
+//go:embed blocked_domains.txt
+var defaultBlockedDomains string
+
+// BLOCKED_EMAIL_DOMAINS adds to the embedded list of disposable domains,
+// ALLOWED_EMAIL_DOMAINS lets domains through even when they're blocked
+var (
+	blockedDomains = domainSet(append(strings.Split(defaultBlockedDomains, "\n"), strings.Split(os.Getenv("BLOCKED_EMAIL_DOMAINS"), ",")...))
+	allowedDomains = domainSet(strings.Split(os.Getenv("ALLOWED_EMAIL_DOMAINS"), ","))
+)
+
+// IsEmailAllowed is false for emails on a blocked domain or one of its subdomains.
+// Run it after IsEmailValid, it doesn't check the email itself.
+func IsEmailAllowed(email string) bool {
+
+	domain := EmailDomain(email)
+	if len(domain) == 0 {
+		return true
+	}
+	if matchesDomain(allowedDomains, domain) {
+		return true
+	}
+	return !matchesDomain(blockedDomains, domain)
+
+}
+
+// EmailDomain is the lowercase part after the @
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// matchesDomain checks domain and every parent of it, so foo.mailinator.com matches mailinator.com
+func matchesDomain(set map[string]bool, domain string) bool {
+	for {
+		if set[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+func domainSet(domains []string) map[string]bool {
+	set := map[string]bool{}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if len(domain) > 0 && !strings.HasPrefix(domain, "#") {
+			set[domain] = true
+		}
+	}
+	return set
+}
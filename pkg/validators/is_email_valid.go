@@ -1,12 +1,58 @@
 package validators
 
-import "regexp"
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// the limits IsEmailValid checks, RFC 5321 ones by default. They're plain variables so
+// a deployment can tighten them at startup.
+var (
+	MaxEmailLength     = 254
+	MaxLocalPartLength = 64
+	MaxDomainLength    = 253
+)
+
+// EMAIL_ALLOW_IDN=true accepts internationalized domains like bücher.de, they are
+// checked in their punycode form (xn--bcher-kva.de)
+var AllowIDN = os.Getenv("EMAIL_ALLOW_IDN") == "true"
+
+// the pragmatic subset of RFC 5322 that IsEmailValid accepts. The local part is a
+// dot-atom, which can't start or end with a dot or have two in a row, or a quoted
+// string. The domain is dot separated labels of letters, digits and inner hyphens.
+var (
+	EmailLocalPartRegexp = regexp.MustCompile("^[a-zA-Z0-9!#$%&'*+/=?^_`{|}~-]+(?:\\.[a-zA-Z0-9!#$%&'*+/=?^_`{|}~-]+)*$")
+	EmailQuotedRegexp    = regexp.MustCompile(`^"(?:[\x20\x21\x23-\x3f\x41-\x5b\x5d-\x7e]|\\[\x20-\x7e])*"$`)
+	EmailDomainRegexp    = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+)
 
 func IsEmailValid(email string) bool {
-	var rxEmail = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]{1,64}@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
-	if len(email) < 3 || len(email) > 253 || !rxEmail.MatchString(email) {
+	// exactly one @, a quoted local part can't hide another one either
+	if strings.Count(email, "@") != 1 {
 		return false
 	}
-	return true
+	at := strings.Index(email, "@")
+	local, domain := email[:at], email[at+1:]
+
+	if AllowIDN {
+		ascii, ok := DomainToASCII(domain)
+		if !ok {
+			return false
+		}
+		domain = ascii
+	}
+
+	if len(local) == 0 || len(local) > MaxLocalPartLength {
+		return false
+	}
+	if len(domain) == 0 || len(domain) > MaxDomainLength || len(local)+1+len(domain) > MaxEmailLength {
+		return false
+	}
+	if !EmailLocalPartRegexp.MatchString(local) && !EmailQuotedRegexp.MatchString(local) {
+		return false
+	}
+	return EmailDomainRegexp.MatchString(domain)
+
 }
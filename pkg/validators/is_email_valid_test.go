@@ -0,0 +1,117 @@
+package validators
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsEmailValid(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		email string
+		want  bool
+	}{
+		{"plain", "jane@example.com", true},
+		{"subdomain", "jane.doe@mail.example.co.uk", true},
+		{"plus tag", "jane+news@example.com", true},
+		{"special characters", "o'brien!#$%&*/=?^_`{|}~-@example.com", true},
+		{"quoted local part", `"jane doe"@example.com`, true},
+		{"quoted escape", `"jane\"doe"@example.com`, true},
+		{"hyphenated domain", "jane@my-example.com", true},
+		{"no @", "jane.example.com", false},
+		{"two @", "jane@doe@example.com", false},
+		{"@ in quotes", `"jane@doe"@example.com`, false},
+		{"empty local part", "@example.com", false},
+		{"empty domain", "jane@", false},
+		{"leading dot", ".jane@example.com", false},
+		{"trailing dot", "jane.@example.com", false},
+		{"two dots", "jane..doe@example.com", false},
+		{"space", "jane doe@example.com", false},
+		{"leading hyphen in label", "jane@-example.com", false},
+		{"trailing hyphen in label", "jane@example-.com", false},
+		{"empty label", "jane@example..com", false},
+		{"local part of 64", strings.Repeat("a", 64) + "@example.com", true},
+		{"local part of 65", strings.Repeat("a", 65) + "@example.com", false},
+		{"label of 64", "jane@" + strings.Repeat("a", 64) + ".com", false},
+		{"over 254", strings.Repeat("a", 64) + "@" + strings.Repeat(strings.Repeat("b", 62)+".", 3) + strings.Repeat("c", 10) + ".com", false},
+		{"idn while off", "jane@bücher.de", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEmailValid(tt.email); got != tt.want {
+				t.Errorf("IsEmailValid(%q) = %t, want %t", tt.email, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestIsEmailValidIDN(t *testing.T) {
+
+	defer func(allow bool) { AllowIDN = allow }(AllowIDN)
+	AllowIDN = true
+
+	tests := []struct {
+		name  string
+		email string
+		want  bool
+	}{
+		{"ascii", "jane@example.com", true},
+		{"umlaut", "jane@bücher.de", true},
+		{"punycode", "jane@xn--bcher-kva.de", true},
+		{"non-ascii local part", "jäne@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEmailValid(tt.email); got != tt.want {
+				t.Errorf("IsEmailValid(%q) = %t, want %t", tt.email, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestDomainToASCII(t *testing.T) {
+
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.com", "example.com"},
+		{"bücher.de", "xn--bcher-kva.de"},
+		{"mail.münchen.de", "mail.xn--mnchen-3ya.de"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got, ok := DomainToASCII(tt.domain)
+			if !ok || got != tt.want {
+				t.Errorf("DomainToASCII(%q) = %q, %t, want %q", tt.domain, got, ok, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestNormalizeEmail(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{"as is", "jane@example.com", "jane@example.com"},
+		{"domain lowercased", "Jane@Example.COM", "Jane@example.com"},
+		{"trimmed", "  jane@example.com\n", "jane@example.com"},
+		{"angle brackets", " <jane@example.com> ", "jane@example.com"},
+		{"no @", "Jane", "Jane"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeEmail(tt.email); got != tt.want {
+				t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.email, got, tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,43 @@
+package validators
+
+import (
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NAME_MAX_LENGTH is the longest name accepted, in characters
+var NameMaxLength = envInt("NAME_MAX_LENGTH", 100)
+
+// IsNameValid accepts names of letters in any script, combining marks, spaces, hyphens
+// and apostrophes, at most NameMaxLength characters long and without surrounding spaces.
+// The empty name is valid, whether a name is required is up to the caller.
+func IsNameValid(name string) bool {
+
+	if utf8.RuneCountInString(name) > NameMaxLength || !utf8.ValidString(name) {
+		return false
+	}
+
+	for i, c := range name {
+		switch {
+		case unicode.IsLetter(c), unicode.IsMark(c):
+		case c == '-', c == '\'', c == '’':
+		case c == ' ':
+			if i == 0 || i == len(name)-1 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,40 @@
+package validators
+
+import "strings"
+
+// NormalizePhone turns a phone number written with spaces, dashes, dots or parentheses
+// into E.164 (+14155552671). The country code is required, either as +, 00 or as the
+// leading digits. Letters, extensions and numbers of the wrong length are rejected.
+func NormalizePhone(phone string) (string, bool) {
+
+	phone = strings.TrimSpace(phone)
+	if strings.HasPrefix(phone, "+") {
+		phone = phone[1:]
+	} else if strings.HasPrefix(phone, "00") {
+		phone = phone[2:]
+	}
+
+	var digits strings.Builder
+	for _, c := range phone {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c == ' ' || c == '-' || c == '.' || c == '(' || c == ')':
+		default:
+			return "", false
+		}
+	}
+
+	// E.164 allows at most 15 digits, country codes never start with 0
+	number := digits.String()
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", false
+	}
+	return "+" + number, true
+
+}
+
+func IsPhoneValid(phone string) bool {
+	_, ok := NormalizePhone(phone)
+	return ok
+}
@@ -0,0 +1,40 @@
+package validators
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		phone  string
+		want   string
+		wantOK bool
+	}{
+		{"e164", "+14155552671", "+14155552671", true},
+		{"formatted", "+1 (415) 555-2671", "+14155552671", true},
+		{"dots", "+44.20.7946.0958", "+442079460958", true},
+		{"00 prefix", "0049 30 901820", "+4930901820", true},
+		{"country code without +", "14155552671", "+14155552671", true},
+		{"surrounding space", "  +14155552671 ", "+14155552671", true},
+		{"15 digits", "+123456789012345", "+123456789012345", true},
+		{"16 digits", "+1234567890123456", "", false},
+		{"too short", "+1234567", "", false},
+		{"national number", "04155552671", "", false},
+		{"letters", "+1415CALLNOW", "", false},
+		{"extension", "+14155552671 ext 12", "", false},
+		{"plus inside", "1+4155552671", "", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NormalizePhone(tt.phone)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("NormalizePhone(%q) = %q, %t, want %q, %t", tt.phone, got, ok, tt.want, tt.wantOK)
+			}
+			if IsPhoneValid(tt.phone) != tt.wantOK {
+				t.Errorf("IsPhoneValid(%q) = %t", tt.phone, !tt.wantOK)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,32 @@
+package validators
+
+import (
+	"os"
+	"strings"
+)
+
+// EMAIL_LOWERCASE_LOCAL=true also lowercases the part before the @. RFC 5321 lets mail
+// servers treat it case-sensitively, in practice hardly any do.
+var lowercaseLocalPart = os.Getenv("EMAIL_LOWERCASE_LOCAL") == "true"
+
+// NormalizeEmail is the form emails are stored and looked up in: trimmed, without the
+// angle brackets of "<foo@example.com>", and with a lowercase domain
+func NormalizeEmail(email string) string {
+
+	email = strings.TrimSpace(email)
+	if strings.HasPrefix(email, "<") && strings.HasSuffix(email, ">") {
+		email = strings.TrimSpace(email[1 : len(email)-1])
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	if lowercaseLocalPart {
+		local = strings.ToLower(local)
+	}
+	return local + "@" + domain
+
+}
@@ -0,0 +1,229 @@
+// Package webhooks delivers the change events of users to the webhooks subscribed to
+// them. It runs in cmd/webhook-dispatcher, the target of an EventBridge rule on the
+// events the API publishes, so no write waits for a webhook.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	userevents "github.com/Rahul-71/go-serverless/pkg/events"
+	"github.com/Rahul-71/go-serverless/pkg/logging"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// WEBHOOK_TIMEOUT_MS is how long one delivery may take, it's tried WEBHOOK_RETRIES more
+// times when it fails. The webhooks of a table are read again after
+// WEBHOOK_CACHE_TTL_MS, webhooks created or deleted in the meantime are seen then.
+var (
+	timeout  = time.Duration(envInt("WEBHOOK_TIMEOUT_MS", 2000)) * time.Millisecond
+	retries  = envInt("WEBHOOK_RETRIES", 2)
+	cacheTTL = time.Duration(envInt("WEBHOOK_CACHE_TTL_MS", 30000)) * time.Millisecond
+	backoff  = 100 * time.Millisecond
+)
+
+var client = &http.Client{}
+
+// the headers of a delivery. The signature is sha256= and the hex HMAC-SHA256, keyed with
+// the secret of the webhook, of the timestamp, a dot and the body.
+const (
+	IDHeader        = "X-Webhook-Id"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+var failures int64
+
+// Failures is how many deliveries this instance gave up on
+func Failures() int64 {
+	return atomic.LoadInt64(&failures)
+}
+
+// ProcessEvent delivers a change event of the bus, see userevents.Source. A delivery that
+// gives up is logged and counted, not returned: EventBridge retrying the event would
+// deliver it again to the webhooks that did get it.
+func ProcessEvent(ctx context.Context, event events.CloudWatchEvent, tableName string, dynaClient user.DynamoDBAPI) error {
+
+	var change userevents.Change
+	if err := json.Unmarshal(event.Detail, &change); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "decoding change event failed", "eventId", event.ID, "detailType", event.DetailType, logging.Err(err))
+		return nil
+	}
+	message := userevents.NewMessage(event.DetailType, change)
+	if !event.Time.IsZero() {
+		message.Timestamp = event.Time.UTC().Format(user.TimestampLayout)
+	}
+	Deliver(ctx, message, tableName, dynaClient)
+	return nil
+
+}
+
+// Deliver POSTs the message to every webhook of the tenant of the user that subscribed
+// to its type, all at once. It returns when every delivery succeeded or gave up.
+func Deliver(ctx context.Context, message userevents.Message, tableName string, dynaClient user.DynamoDBAPI) {
+
+	list, err := cache.get(ctx, message.Data.TenantID, tableName, dynaClient)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "reading webhooks failed", "table", tableName, logging.Err(err))
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, webhook := range list {
+		if !webhook.Wants(message.Type) {
+			continue
+		}
+		wg.Add(1)
+		go func(webhook user.Webhook) {
+			defer wg.Done()
+			deliver(ctx, webhook, message)
+		}(webhook)
+	}
+	wg.Wait()
+
+}
+
+// webhookCache keeps the webhooks of a table and tenant for cacheTTL, so not every event
+// scans for them
+type webhookCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	webhooks []user.Webhook
+	expires  time.Time
+}
+
+var cache = &webhookCache{entries: map[string]cacheEntry{}}
+
+func (c *webhookCache) get(ctx context.Context, tenant, tableName string, dynaClient user.DynamoDBAPI) ([]user.Webhook, error) {
+
+	key := tableName + "\x00" + tenant
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.webhooks, nil
+	}
+
+	list, err := user.FetchWebhooks(ctx, tenant, tableName, dynaClient)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[key] = cacheEntry{webhooks: list, expires: time.Now().Add(cacheTTL)}
+	c.mu.Unlock()
+	return list, nil
+
+}
+
+// deliver tries a delivery until it gets a 2xx. A 4xx other than 429 won't get any
+// better and isn't retried.
+func deliver(ctx context.Context, webhook user.Webhook, message userevents.Message) {
+
+	message.ID = newDeliveryID()
+	body, err := json.Marshal(message)
+	if err != nil {
+		atomic.AddInt64(&failures, 1)
+		logging.FromContext(ctx).ErrorContext(ctx, "encoding webhook delivery failed", "webhookId", webhook.ID, "eventType", message.Type, logging.Err(err))
+		return
+	}
+
+	var status int
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 && !pause(ctx, backoff<<(attempt-1)) {
+			break
+		}
+
+		status, err = post(ctx, webhook, message, body)
+		if err == nil && status >= 200 && status < 300 {
+			logging.FromContext(ctx).InfoContext(ctx, "webhook delivered", "webhookId", webhook.ID, "eventType", message.Type, "deliveryId", message.ID, "status", status, "attempts", attempt+1)
+			return
+		}
+		if err == nil && status >= 400 && status < 500 && status != http.StatusTooManyRequests {
+			break
+		}
+	}
+
+	atomic.AddInt64(&failures, 1)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "webhook delivery failed", "webhookId", webhook.ID, "eventType", message.Type, "deliveryId", message.ID, logging.Err(err))
+		return
+	}
+	logging.FromContext(ctx).ErrorContext(ctx, "webhook delivery failed", "webhookId", webhook.ID, "eventType", message.Type, "deliveryId", message.ID, "status", status)
+
+}
+
+func post(ctx context.Context, webhook user.Webhook, message userevents.Message, body []byte) (int, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(IDHeader, webhook.ID)
+	httpReq.Header.Set(EventHeader, message.Type)
+	httpReq.Header.Set(DeliveryHeader, message.ID)
+	httpReq.Header.Set(TimestampHeader, timestamp)
+	httpReq.Header.Set(SignatureHeader, Signature(webhook.Secret, timestamp, body))
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+
+}
+
+// Signature is the X-Webhook-Signature of a delivery, receivers compute it the same way
+// and compare
+func Signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// pause waits for d, or returns false when ctx is done first
+func pause(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,287 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	userevents "github.com/Rahul-71/go-serverless/pkg/events"
+	"github.com/Rahul-71/go-serverless/pkg/user"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// delivery is a request a receiver got
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver answers the deliveries with statuses, one per attempt, 200 once they run out
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, func() []delivery) {
+
+	var mu sync.Mutex
+	var got []delivery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, delivery{header: r.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(got) <= len(statuses) {
+			status = statuses[len(got)-1]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []delivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]delivery(nil), got...)
+	}
+
+}
+
+// cached makes list the webhooks of the table and tenant without a scan
+func cached(t *testing.T, tenant string, list ...user.Webhook) {
+	t.Helper()
+	cache.mu.Lock()
+	cache.entries["users\x00"+tenant] = cacheEntry{webhooks: list, expires: time.Now().Add(time.Hour)}
+	cache.mu.Unlock()
+	t.Cleanup(func() {
+		cache.mu.Lock()
+		delete(cache.entries, "users\x00"+tenant)
+		cache.mu.Unlock()
+	})
+}
+
+func TestDeliver(t *testing.T) {
+
+	defer func(b time.Duration) { backoff = b }(backoff)
+	backoff = time.Millisecond
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantFailed   bool
+	}{
+		{name: "delivered", statuses: []int{http.StatusNoContent}, wantAttempts: 1},
+		{name: "server error retried", statuses: []int{http.StatusInternalServerError, http.StatusOK}, wantAttempts: 2},
+		{name: "throttled retried", statuses: []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK}, wantAttempts: 3},
+		{name: "bad request not retried", statuses: []int{http.StatusBadRequest}, wantAttempts: 1, wantFailed: true},
+		{name: "gone not retried", statuses: []int{http.StatusGone}, wantAttempts: 1, wantFailed: true},
+		{name: "given up", statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusInternalServerError}, wantAttempts: 3, wantFailed: true},
+		{name: "not a 2xx retried", statuses: []int{http.StatusNotModified, http.StatusNotModified, http.StatusNotModified}, wantAttempts: 3, wantFailed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := receiver(t, tt.statuses...)
+			webhook := user.Webhook{ID: "hook-1", URL: server.URL, Secret: "0123456789abcdef"}
+			cached(t, "", webhook)
+			message := userevents.NewMessage(userevents.TypeUserUpdated, userevents.Change{Email: "jane@example.com", Changed: []string{"firstName"}, RequestID: "req-1"})
+			before := Failures()
+
+			Deliver(context.Background(), message, "users", nil)
+			got := received()
+			if len(got) != tt.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", len(got), tt.wantAttempts)
+			}
+			if failed := Failures() - before; (failed == 1) != tt.wantFailed || failed > 1 {
+				t.Errorf("failures = %d, want failed %t", failed, tt.wantFailed)
+			}
+
+			for _, d := range got {
+				timestamp := d.header.Get(TimestampHeader)
+				if !hmac.Equal([]byte(d.header.Get(SignatureHeader)), []byte(Signature(webhook.Secret, timestamp, d.body))) {
+					t.Errorf("signature %q doesn't verify", d.header.Get(SignatureHeader))
+				}
+				if d.header.Get(IDHeader) != webhook.ID || d.header.Get(EventHeader) != userevents.TypeUserUpdated || d.header.Get("Content-Type") != "application/json" {
+					t.Errorf("headers = %v", d.header)
+				}
+				var body userevents.Message
+				if err := json.Unmarshal(d.body, &body); err != nil || body.ID != d.header.Get(DeliveryHeader) || len(body.ID) == 0 || body.Data.Email != "jane@example.com" {
+					t.Errorf("body = %s, delivery %q", d.body, d.header.Get(DeliveryHeader))
+				}
+			}
+			// a retry is the same delivery
+			if len(got) > 1 && got[0].header.Get(DeliveryHeader) != got[1].header.Get(DeliveryHeader) {
+				t.Errorf("retry has delivery %q, want %q", got[1].header.Get(DeliveryHeader), got[0].header.Get(DeliveryHeader))
+			}
+		})
+	}
+
+}
+
+func TestSignature(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		secret      string
+		timestamp   string
+		body        string
+		otherSecret string
+		otherBody   string
+		otherTime   string
+	}{
+		{name: "body", secret: "0123456789abcdef", timestamp: "1700000000", body: `{"type":"user.created"}`, otherBody: `{"type":"user.deleted"}`},
+		{name: "secret", secret: "0123456789abcdef", timestamp: "1700000000", body: `{}`, otherSecret: "fedcba9876543210"},
+		{name: "timestamp", secret: "0123456789abcdef", timestamp: "1700000000", body: `{}`, otherTime: "1700000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Signature(tt.secret, tt.timestamp, []byte(tt.body))
+			if len(got) != len("sha256=")+64 || got[:7] != "sha256=" {
+				t.Fatalf("Signature = %q", got)
+			}
+			if again := Signature(tt.secret, tt.timestamp, []byte(tt.body)); again != got {
+				t.Errorf("Signature isn't stable: %q, %q", got, again)
+			}
+			secret, timestamp, body := tt.secret, tt.timestamp, tt.body
+			if len(tt.otherSecret) > 0 {
+				secret = tt.otherSecret
+			}
+			if len(tt.otherTime) > 0 {
+				timestamp = tt.otherTime
+			}
+			if len(tt.otherBody) > 0 {
+				body = tt.otherBody
+			}
+			if Signature(secret, timestamp, []byte(body)) == got {
+				t.Errorf("another %s signs the same", tt.name)
+			}
+		})
+	}
+
+}
+
+func TestDeliverSubscriptions(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		eventType string
+		tenant    string
+		events    []string
+		want      bool
+	}{
+		{name: "every event", eventType: userevents.TypeUserDeleted, want: true},
+		{name: "subscribed", eventType: userevents.TypeUserCreated, events: []string{userevents.TypeUserCreated}, want: true},
+		{name: "not subscribed", eventType: userevents.TypeUserUpdated, events: []string{userevents.TypeUserCreated}},
+		{name: "of the tenant", eventType: userevents.TypeUserCreated, tenant: "acme", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := receiver(t)
+			cached(t, tt.tenant, user.Webhook{ID: "hook-1", URL: server.URL, Secret: "0123456789abcdef", Events: tt.events})
+
+			Deliver(context.Background(), userevents.NewMessage(tt.eventType, userevents.Change{Email: "jane@example.com", TenantID: tt.tenant}), "users", nil)
+			if got := len(received()) > 0; got != tt.want {
+				t.Errorf("delivered = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestProcessEvent(t *testing.T) {
+
+	sent := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		event      events.CloudWatchEvent
+		wantType   string
+		wantEmail  string
+		wantTime   string
+		wantNoSend bool
+	}{
+		{
+			name:      "change",
+			event:     events.CloudWatchEvent{ID: "1", Source: userevents.Source, DetailType: userevents.TypeUserCreated, Time: sent, Detail: json.RawMessage(`{"email":"jane@example.com","requestId":"req-1"}`)},
+			wantType:  userevents.TypeUserCreated,
+			wantEmail: "jane@example.com",
+			wantTime:  sent.Format(user.TimestampLayout),
+		},
+		{
+			name:       "not a change",
+			event:      events.CloudWatchEvent{ID: "2", Source: userevents.Source, DetailType: userevents.TypeUserCreated, Detail: json.RawMessage(`[1, 2]`)},
+			wantNoSend: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := receiver(t)
+			cached(t, "", user.Webhook{ID: "hook-1", URL: server.URL, Secret: "0123456789abcdef"})
+
+			if err := ProcessEvent(context.Background(), tt.event, "users", nil); err != nil {
+				t.Fatalf("ProcessEvent = %v, an event is never retried", err)
+			}
+			got := received()
+			if tt.wantNoSend {
+				if len(got) > 0 {
+					t.Errorf("deliveries = %d, want none", len(got))
+				}
+				return
+			}
+			if len(got) != 1 {
+				t.Fatalf("deliveries = %d, want 1", len(got))
+			}
+			var message userevents.Message
+			if err := json.Unmarshal(got[0].body, &message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Type != tt.wantType || message.Data.Email != tt.wantEmail || message.Timestamp != tt.wantTime {
+				t.Errorf("message = %+v", message)
+			}
+		})
+	}
+
+}
+
+// scanDynamo answers the scans for webhooks with items
+type scanDynamo struct {
+	user.DynamoDBAPI
+	mu    sync.Mutex
+	scans int
+	items []map[string]types.AttributeValue
+}
+
+func (s *scanDynamo) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	s.mu.Lock()
+	s.scans++
+	s.mu.Unlock()
+	return &dynamodb.ScanOutput{Items: s.items}, nil
+}
+
+func TestCache(t *testing.T) {
+
+	server, received := receiver(t)
+	item, err := attributevalue.MarshalMap(user.Webhook{ID: "hook-1", URL: server.URL, Secret: "0123456789abcdef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &scanDynamo{items: []map[string]types.AttributeValue{item}}
+	t.Cleanup(func() {
+		cache.mu.Lock()
+		delete(cache.entries, "cached\x00")
+		cache.mu.Unlock()
+	})
+
+	for i := 0; i < 3; i++ {
+		Deliver(context.Background(), userevents.NewMessage(userevents.TypeUserCreated, userevents.Change{Email: "jane@example.com"}), "cached", client)
+	}
+	if client.scans != 1 {
+		t.Errorf("scans = %d, want 1", client.scans)
+	}
+	if len(received()) != 3 {
+		t.Errorf("deliveries = %d, want 3", len(received()))
+	}
+
+}